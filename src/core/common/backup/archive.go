@@ -0,0 +1,160 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backup
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/cloud-barista/cb-tumblebug/src/core/model"
+)
+
+// An archive is a gzip-compressed JSON Lines file. The first line is the header,
+// followed by one line per kvstore entry, spec row and image row, in that order.
+// Being line-oriented, archives are written and restored without holding the
+// whole instance in memory.
+
+const (
+	archivePrefix     = "tumblebug-backup-"
+	archiveSuffix     = ".jsonl.gz"
+	archiveTimeFormat = "20060102T150405Z"
+
+	recordHeader = "header"
+	recordKv     = "kv"
+	recordSpec   = "spec"
+	recordImage  = "image"
+
+	// maxRecordSize bounds a single archive line (one kvstore value or table row)
+	maxRecordSize = 64 << 20
+)
+
+var archiveNamePattern = regexp.MustCompile(`^` + archivePrefix + `(\d{8}T\d{6}Z)` + regexp.QuoteMeta(archiveSuffix) + `$`)
+
+// archiveHeader describes the archive content.
+type archiveHeader struct {
+	FormatVersion int    `json:"formatVersion"`
+	CreatedAt     string `json:"createdAt"`
+	// SchemaVersion is the kvstore schema version of the server that wrote the archive
+	SchemaVersion int `json:"schemaVersion"`
+}
+
+// record is a single archive line. Kind selects which of the other fields is set.
+type record struct {
+	Kind   string           `json:"kind"`
+	Header *archiveHeader   `json:"header,omitempty"`
+	Key    string           `json:"key,omitempty"`
+	Value  string           `json:"value,omitempty"`
+	Spec   *model.SpecInfo  `json:"spec,omitempty"`
+	Image  *model.ImageInfo `json:"image,omitempty"`
+}
+
+func archiveName(t time.Time) string {
+	return archivePrefix + t.UTC().Format(archiveTimeFormat) + archiveSuffix
+}
+
+// parseArchiveName reports whether name is an archive name and returns its creation time.
+func parseArchiveName(name string) (time.Time, bool) {
+	m := archiveNamePattern.FindStringSubmatch(name)
+	if m == nil {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(archiveTimeFormat, m[1])
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// archiveWriter appends records to a compressed archive.
+type archiveWriter struct {
+	gz  *gzip.Writer
+	buf *bufio.Writer
+	enc *json.Encoder
+}
+
+func newArchiveWriter(w io.Writer) *archiveWriter {
+	gz := gzip.NewWriter(w)
+	buf := bufio.NewWriter(gz)
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	return &archiveWriter{gz: gz, buf: buf, enc: enc}
+}
+
+func (w *archiveWriter) write(rec record) error {
+	return w.enc.Encode(rec)
+}
+
+// Close flushes the archive; the underlying writer is left open.
+func (w *archiveWriter) Close() error {
+	if err := w.buf.Flush(); err != nil {
+		return err
+	}
+	return w.gz.Close()
+}
+
+// scanArchive reads the archive at path and calls fn for every record after the
+// header, which is returned. It stops at the first error from fn.
+func scanArchive(path string, fn func(rec *record) error) (archiveHeader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return archiveHeader{}, err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return archiveHeader{}, fmt.Errorf("backup archive is not gzip-compressed: %w", err)
+	}
+	defer gz.Close()
+
+	scanner := bufio.NewScanner(gz)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxRecordSize)
+
+	var header archiveHeader
+	line := 0
+	for scanner.Scan() {
+		line++
+		var rec record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return header, fmt.Errorf("backup archive line %d is malformed: %w", line, err)
+		}
+		if line == 1 {
+			if rec.Kind != recordHeader || rec.Header == nil {
+				return header, fmt.Errorf("backup archive does not start with a header")
+			}
+			header = *rec.Header
+			if header.FormatVersion < 1 || header.FormatVersion > model.BackupFormatVersion {
+				return header, fmt.Errorf("unsupported backup format version %d (supported: 1-%d)",
+					header.FormatVersion, model.BackupFormatVersion)
+			}
+			continue
+		}
+		if err := fn(&rec); err != nil {
+			return header, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return header, fmt.Errorf("failed to read backup archive: %w", err)
+	}
+	if line == 0 {
+		return header, fmt.Errorf("backup archive is empty")
+	}
+	return header, nil
+}
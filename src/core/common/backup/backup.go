@@ -0,0 +1,378 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package backup takes point-in-time backups of CB-Tumblebug state and restores them.
+//
+// A backup holds the kvstore keys, except the coordination state of the running
+// replicas, and the spec and image tables of PostgreSQL.
+// Values encrypted at rest are archived as ciphertext with their wrapped data keys,
+// so an archive can only be restored by a server holding the same master key.
+// Archives are kept in a local directory or an S3-compatible object store and are
+// pruned by a retention policy after each backup.
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+
+	"github.com/cloud-barista/cb-tumblebug/src/core/common"
+	"github.com/cloud-barista/cb-tumblebug/src/core/common/migration"
+	"github.com/cloud-barista/cb-tumblebug/src/core/model"
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/encrypted"
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvstore"
+)
+
+const (
+	targetLocal = "local"
+	targetS3    = "s3"
+
+	tableBatchSize = 1000
+)
+
+// mu serializes backups, restores and deletions within this process.
+var mu sync.Mutex
+
+// config is the backup configuration read from TB_BACKUP_* environment variables.
+type config struct {
+	interval       time.Duration
+	target         string
+	dir            string
+	retentionCount int
+	retentionAge   time.Duration
+
+	s3Endpoint  string
+	s3Bucket    string
+	s3Prefix    string
+	s3Region    string
+	s3AccessKey string
+	s3SecretKey string
+	s3PathStyle bool
+}
+
+func loadConfig() config {
+	cfg := config{
+		interval:       24 * time.Hour,
+		target:         strings.ToLower(common.NVL(os.Getenv("TB_BACKUP_TARGET"), targetLocal)),
+		dir:            common.NVL(os.Getenv("TB_BACKUP_PATH"), "./backup"),
+		retentionCount: 7,
+		s3Endpoint:     os.Getenv("TB_BACKUP_S3_ENDPOINT"),
+		s3Bucket:       os.Getenv("TB_BACKUP_S3_BUCKET"),
+		s3Prefix:       os.Getenv("TB_BACKUP_S3_PREFIX"),
+		s3Region:       common.NVL(os.Getenv("TB_BACKUP_S3_REGION"), "us-east-1"),
+		s3AccessKey:    os.Getenv("TB_BACKUP_S3_ACCESS_KEY"),
+		s3SecretKey:    os.Getenv("TB_BACKUP_S3_SECRET_KEY"),
+		s3PathStyle:    strings.ToLower(common.NVL(os.Getenv("TB_BACKUP_S3_PATH_STYLE"), "true")) == "true",
+	}
+	if v := os.Getenv("TB_BACKUP_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err != nil {
+			log.Warn().Str("value", v).Msg("backup: invalid TB_BACKUP_INTERVAL, using default")
+		} else {
+			cfg.interval = d
+		}
+	}
+	if v := os.Getenv("TB_BACKUP_RETENTION_COUNT"); v != "" {
+		if n, err := strconv.Atoi(v); err != nil {
+			log.Warn().Str("value", v).Msg("backup: invalid TB_BACKUP_RETENTION_COUNT, using default")
+		} else {
+			cfg.retentionCount = n
+		}
+	}
+	if v := os.Getenv("TB_BACKUP_RETENTION_DAYS"); v != "" {
+		if n, err := strconv.Atoi(v); err != nil {
+			log.Warn().Str("value", v).Msg("backup: invalid TB_BACKUP_RETENTION_DAYS, ignoring")
+		} else {
+			cfg.retentionAge = time.Duration(n) * 24 * time.Hour
+		}
+	}
+	return cfg
+}
+
+func newTarget(cfg config) (target, error) {
+	switch cfg.target {
+	case targetLocal:
+		return &localTarget{dir: cfg.dir}, nil
+	case targetS3:
+		return newS3Target(cfg)
+	default:
+		return nil, fmt.Errorf("unsupported TB_BACKUP_TARGET: %s (use local or s3)", cfg.target)
+	}
+}
+
+// StartBackupLoop takes a backup every TB_BACKUP_INTERVAL (default 24h) on the leader
+// replica; a value <= 0 disables it. The first backup is taken one interval after the
+// replica becomes the leader. Call once, after the kvstore and the database are ready.
+func StartBackupLoop() {
+	cfg := loadConfig()
+	if cfg.interval <= 0 {
+		log.Info().Msg("backup: scheduled backup disabled (TB_BACKUP_INTERVAL <= 0)")
+		return
+	}
+	if _, err := newTarget(cfg); err != nil {
+		log.Error().Err(err).Msg("backup: scheduled backup disabled")
+		return
+	}
+
+	log.Info().Dur("interval", cfg.interval).Str("target", cfg.target).Msg("backup: starting scheduled backup loop")
+
+	common.RunAsLeader("backup", func(leaderCtx context.Context) {
+		ticker := time.NewTicker(cfg.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-leaderCtx.Done():
+				return
+			case <-ticker.C:
+			}
+			ctx, cancel := context.WithTimeout(leaderCtx, 30*time.Minute)
+			if _, err := Create(ctx); err != nil {
+				log.Error().Err(err).Msg("backup: scheduled backup failed")
+			}
+			cancel()
+		}
+	})
+}
+
+// Create takes a backup now, stores it in the configured target and applies the
+// retention policy. kvstore keys are read one at a time to stay below the message
+// size limit of etcd, so writes racing with the backup may or may not be included.
+func Create(ctx context.Context) (model.BackupResult, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	cfg := loadConfig()
+	t, err := newTarget(cfg)
+	if err != nil {
+		return model.BackupResult{}, err
+	}
+
+	tmp, err := os.CreateTemp("", archivePrefix+"*")
+	if err != nil {
+		return model.BackupResult{}, err
+	}
+	defer func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}()
+
+	now := time.Now().UTC()
+	result, err := writeArchive(ctx, tmp, now)
+	if err != nil {
+		return model.BackupResult{}, fmt.Errorf("failed to write backup archive: %w", err)
+	}
+	stat, err := tmp.Stat()
+	if err != nil {
+		return model.BackupResult{}, err
+	}
+
+	name := archiveName(now)
+	if err := t.Put(ctx, name, tmp); err != nil {
+		return model.BackupResult{}, fmt.Errorf("failed to store backup %s in %s target: %w", name, t.Kind(), err)
+	}
+	result.Backup = model.BackupInfo{
+		Name:      name,
+		Target:    t.Kind(),
+		Size:      stat.Size(),
+		CreatedAt: now.Format(time.RFC3339),
+	}
+	log.Info().Msgf("backup: stored %s in %s target (%d entries, %d specs, %d images, %d bytes)",
+		name, t.Kind(), result.Entries, result.Specs, result.Images, stat.Size())
+
+	result.Pruned = prune(ctx, t, cfg, name)
+	return result, nil
+}
+
+// writeArchive writes every kvstore entry and the spec and image tables to f.
+func writeArchive(ctx context.Context, f *os.File, now time.Time) (model.BackupResult, error) {
+	result := model.BackupResult{SchemaVersion: migration.CurrentVersion()}
+	w := newArchiveWriter(f)
+
+	err := w.write(record{Kind: recordHeader, Header: &archiveHeader{
+		FormatVersion: model.BackupFormatVersion,
+		CreatedAt:     now.Format(time.RFC3339),
+		SchemaVersion: result.SchemaVersion,
+	}})
+	if err != nil {
+		return result, err
+	}
+
+	// Read under the encryption layer: encrypted values are archived as ciphertext,
+	// with the wrapped data keys that seal them
+	store, err := kvstore.GetStore()
+	if err != nil {
+		return result, err
+	}
+	raw := encrypted.Inner(store)
+
+	keys, err := raw.GetKeyListWith(ctx, "/")
+	if err != nil {
+		return result, fmt.Errorf("failed to list kvstore keys: %w", err)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if isLocalKey(key) {
+			continue
+		}
+		kv, exists, err := raw.GetKvWith(ctx, key)
+		if err != nil {
+			return result, fmt.Errorf("failed to read %s: %w", key, err)
+		}
+		if !exists {
+			continue // deleted since it was listed
+		}
+		if err := w.write(record{Kind: recordKv, Key: kv.Key, Value: kv.Value}); err != nil {
+			return result, err
+		}
+		result.Entries++
+	}
+
+	var specs []model.SpecInfo
+	err = model.ORM.WithContext(ctx).Order("namespace, id").FindInBatches(&specs, tableBatchSize, func(tx *gorm.DB, batch int) error {
+		for i := range specs {
+			if err := w.write(record{Kind: recordSpec, Spec: &specs[i]}); err != nil {
+				return err
+			}
+		}
+		result.Specs += len(specs)
+		return nil
+	}).Error
+	if err != nil {
+		return result, fmt.Errorf("failed to read spec table: %w", err)
+	}
+
+	var images []model.ImageInfo
+	err = model.ORM.WithContext(ctx).Order("namespace, provider_name, csp_image_name").FindInBatches(&images, tableBatchSize, func(tx *gorm.DB, batch int) error {
+		for i := range images {
+			if err := w.write(record{Kind: recordImage, Image: &images[i]}); err != nil {
+				return err
+			}
+		}
+		result.Images += len(images)
+		return nil
+	}).Error
+	if err != nil {
+		return result, fmt.Errorf("failed to read image table: %w", err)
+	}
+
+	if err := w.Close(); err != nil {
+		return result, err
+	}
+	return result, f.Sync()
+}
+
+// prune deletes archives outside of the retention policy, never touching keep.
+// Failures are logged and do not fail the backup that triggered the pruning.
+func prune(ctx context.Context, t target, cfg config, keep string) []string {
+	pruned := []string{}
+	if cfg.retentionCount <= 0 && cfg.retentionAge <= 0 {
+		return pruned
+	}
+	list, err := t.List(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("backup: failed to list backups for retention")
+		return pruned
+	}
+	sortNewestFirst(list)
+
+	cutoff := time.Now().Add(-cfg.retentionAge)
+	for i, b := range list {
+		if b.Name == keep {
+			continue
+		}
+		createdAt, _ := parseArchiveName(b.Name)
+		expired := (cfg.retentionCount > 0 && i >= cfg.retentionCount) ||
+			(cfg.retentionAge > 0 && createdAt.Before(cutoff))
+		if !expired {
+			continue
+		}
+		if err := t.Delete(ctx, b.Name); err != nil {
+			log.Error().Err(err).Msgf("backup: failed to prune %s", b.Name)
+			continue
+		}
+		pruned = append(pruned, b.Name)
+	}
+	if len(pruned) > 0 {
+		log.Info().Msgf("backup: pruned %d backup(s) by retention policy: %s", len(pruned), strings.Join(pruned, ", "))
+	}
+	return pruned
+}
+
+// List returns the backups in the configured target, newest first.
+func List(ctx context.Context) (model.BackupListResponse, error) {
+	t, err := newTarget(loadConfig())
+	if err != nil {
+		return model.BackupListResponse{}, err
+	}
+	list, err := t.List(ctx)
+	if err != nil {
+		return model.BackupListResponse{}, err
+	}
+	sortNewestFirst(list)
+	return model.BackupListResponse{Backups: list}, nil
+}
+
+// Delete removes a backup from the configured target.
+func Delete(ctx context.Context, name string) error {
+	if _, ok := parseArchiveName(name); !ok {
+		return fmt.Errorf("invalid backup name %q", name)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+
+	t, err := newTarget(loadConfig())
+	if err != nil {
+		return err
+	}
+	return t.Delete(ctx, name)
+}
+
+// IsNotFound reports whether err means that the requested backup does not exist.
+func IsNotFound(err error) bool {
+	return errors.Is(err, errBackupNotFound)
+}
+
+// localKeyPrefixes hold the coordination state of the running replicas: the leader
+// election lock and record, and the kvstore locks bound to live sessions.
+var localKeyPrefixes = []string{"/leaderElection/", "/lock/"}
+
+// isLocalKey reports whether key belongs to this store only and is neither backed up
+// nor overwritten or deleted by a restore, such as the active data key of encryption
+// or the lock of the current leader.
+func isLocalKey(key string) bool {
+	for _, prefix := range localKeyPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return strings.HasPrefix(key, encrypted.KeyPrefix) && !isDataKey(key)
+}
+
+// isDataKey reports whether key is a wrapped encryption data key. Data keys are backed
+// up with the ciphertext they seal; a restore adds the missing ones and deletes none.
+func isDataKey(key string) bool {
+	return strings.HasPrefix(key, encrypted.DataKeyPrefix)
+}
+
+// sortNewestFirst orders archives by the timestamp embedded in their names.
+func sortNewestFirst(list []model.BackupInfo) {
+	sort.Slice(list, func(i, j int) bool { return list[i].Name > list[j].Name })
+}
@@ -0,0 +1,387 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+	"gorm.io/gorm"
+
+	"github.com/cloud-barista/cb-tumblebug/src/core/common"
+	"github.com/cloud-barista/cb-tumblebug/src/core/common/migration"
+	"github.com/cloud-barista/cb-tumblebug/src/core/model"
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/encrypted"
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvstore"
+)
+
+const labelKeyPrefix = "/label/"
+
+// Restore brings back the state saved in the backup name.
+//
+// Without nsId the whole instance is restored: every kvstore key is reset to the
+// archive (keys that are not in the archive are deleted) and the spec and image
+// tables are replaced. With nsId only that namespace is replaced: its records,
+// the labels of its objects and its spec and image rows; the rest of the instance
+// is left untouched. Labels are restored as stored and are not pushed to the CSP.
+//
+// The archive is fully validated before anything is written. Objects from an older
+// release are upgraded by the schema migrations after they are restored.
+// Restore is meant for maintenance: requests running at the same time may write
+// records that the restore then overwrites.
+func Restore(ctx context.Context, name string, nsId string) (model.BackupRestoreResult, error) {
+	if _, ok := parseArchiveName(name); !ok {
+		return model.BackupRestoreResult{}, fmt.Errorf("invalid backup name %q", name)
+	}
+	if nsId != "" {
+		if err := common.CheckString(nsId); err != nil {
+			return model.BackupRestoreResult{}, err
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	t, err := newTarget(loadConfig())
+	if err != nil {
+		return model.BackupRestoreResult{}, err
+	}
+	path, err := download(ctx, t, name)
+	if err != nil {
+		return model.BackupRestoreResult{}, err
+	}
+	defer os.Remove(path)
+
+	header, err := validateArchive(path, nsId)
+	if err == nil {
+		err = checkDataKeys(ctx, path)
+	}
+	if err != nil {
+		return model.BackupRestoreResult{}, fmt.Errorf("backup %s cannot be restored: %w", name, err)
+	}
+
+	result := model.BackupRestoreResult{Backup: name, NsId: nsId}
+	if nsId == "" {
+		err = restoreInstance(ctx, path, &result)
+	} else {
+		err = restoreNs(ctx, path, header, nsId, &result)
+	}
+	if err != nil {
+		log.Error().Err(err).Msgf("backup: restore of %s failed", name)
+		return result, err
+	}
+
+	if header.SchemaVersion < migration.CurrentVersion() {
+		report, err := migration.Run(ctx, false)
+		if err != nil {
+			return result, fmt.Errorf("restored objects could not be migrated to the current schema: %w", err)
+		}
+		migration.LogReport(report)
+		result.Migration = &report
+	}
+
+	log.Info().Msgf("backup: restored %s (nsId=%q, %d entries, %d labels, %d specs, %d images)",
+		name, nsId, result.RestoredEntries, result.RestoredLabels, result.RestoredSpecs, result.RestoredImages)
+	return result, nil
+}
+
+// download copies the archive from the target into a temporary file and returns its path.
+func download(ctx context.Context, t target, name string) (string, error) {
+	src, err := t.Get(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	tmp, err := os.CreateTemp("", archivePrefix+"*")
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(tmp, src); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("failed to download backup %s: %w", name, err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return tmp.Name(), nil
+}
+
+// validateArchive reads the whole archive and checks that it can be restored.
+func validateArchive(path string, nsId string) (archiveHeader, error) {
+	current := migration.CurrentVersion()
+	nsKey := "/ns/" + nsId
+	hasNsKey := false
+
+	header, err := scanArchive(path, func(rec *record) error {
+		switch rec.Kind {
+		case recordKv:
+			if !strings.HasPrefix(rec.Key, "/") {
+				return fmt.Errorf("entry %q is not a kvstore key", rec.Key)
+			}
+			if rec.Key == nsKey {
+				hasNsKey = true
+			}
+			if v := gjson.Get(rec.Value, migration.SchemaVersionField); v.Exists() && int(v.Int()) > current {
+				return fmt.Errorf("entry %s has schema version %d, newer than this server supports (%d)",
+					rec.Key, v.Int(), current)
+			}
+		case recordSpec:
+			if rec.Spec == nil {
+				return fmt.Errorf("spec record without a spec")
+			}
+		case recordImage:
+			if rec.Image == nil {
+				return fmt.Errorf("image record without an image")
+			}
+		default:
+			return fmt.Errorf("unknown record kind %q", rec.Kind)
+		}
+		return nil
+	})
+	if err != nil {
+		return header, err
+	}
+	if header.SchemaVersion > current {
+		return header, fmt.Errorf("the backup has schema version %d, newer than this server supports (%d)",
+			header.SchemaVersion, current)
+	}
+	if nsId != "" && !hasNsKey {
+		return header, fmt.Errorf("the backup does not contain namespace %s", nsId)
+	}
+	return header, nil
+}
+
+// checkDataKeys checks that the data keys of the archive, if any, can be unwrapped by
+// the master key of this server; otherwise the restored secrets could not be read.
+func checkDataKeys(ctx context.Context, path string) error {
+	store, err := kvstore.GetStore()
+	if err != nil {
+		return err
+	}
+	encStore, encryptionEnabled := store.(*encrypted.Store)
+	_, err = scanArchive(path, func(rec *record) error {
+		if rec.Kind != recordKv || !isDataKey(rec.Key) {
+			return nil
+		}
+		if !encryptionEnabled {
+			return fmt.Errorf("the backup holds encrypted values; enable kvstore encryption with the master key of the backup")
+		}
+		return encStore.CheckDataKey(ctx, rec.Value)
+	})
+	return err
+}
+
+// restoreDataKey adds a data key of the archive to the store, under the encryption
+// layer, unless the store already has it.
+func restoreDataKey(ctx context.Context, rec *record) error {
+	store, err := kvstore.GetStore()
+	if err != nil {
+		return err
+	}
+	err = encrypted.Inner(store).PutIfRevision(ctx, rec.Key, rec.Value, 0)
+	if err != nil && !errors.Is(err, kvstore.ErrRevisionConflict) {
+		return fmt.Errorf("failed to restore %s: %w", rec.Key, err)
+	}
+	return nil
+}
+
+// restoreInstance resets the whole kvstore and the spec and image tables to the archive.
+func restoreInstance(ctx context.Context, path string, result *model.BackupRestoreResult) error {
+	existing, err := kvstore.GetKeyListWith(ctx, "/")
+	if err != nil {
+		return fmt.Errorf("failed to list kvstore keys: %w", err)
+	}
+
+	restored := make(map[string]struct{})
+	_, err = scanArchive(path, func(rec *record) error {
+		if rec.Kind != recordKv || isLocalKey(rec.Key) {
+			return nil
+		}
+		if isDataKey(rec.Key) {
+			return restoreDataKey(ctx, rec)
+		}
+		// Encrypted values are stored as they are: the encryption layer leaves ciphertext alone
+		if err := kvstore.PutWith(ctx, rec.Key, rec.Value); err != nil {
+			return fmt.Errorf("failed to restore %s: %w", rec.Key, err)
+		}
+		restored[rec.Key] = struct{}{}
+		if strings.HasPrefix(rec.Key, labelKeyPrefix) {
+			result.RestoredLabels++
+		} else {
+			result.RestoredEntries++
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, key := range existing {
+		if _, ok := restored[key]; ok || isLocalKey(key) || isDataKey(key) {
+			continue
+		}
+		if err := kvstore.DeleteWith(ctx, key); err != nil {
+			return fmt.Errorf("failed to delete %s, which is not in the backup: %w", key, err)
+		}
+	}
+
+	return restoreTables(ctx, path, "", result)
+}
+
+// restoreNs replaces the records, labels and table rows of one namespace.
+func restoreNs(ctx context.Context, path string, header archiveHeader, nsId string, result *model.BackupRestoreResult) error {
+	nsKey := "/ns/" + nsId
+
+	// Unstamped objects are at the schema version of the archive, but once they are
+	// mixed into this store they would be taken for the current version
+	stamp := func(value string) string {
+		if header.SchemaVersion >= migration.CurrentVersion() || !gjson.Valid(value) ||
+			!gjson.Parse(value).IsObject() || gjson.Get(value, migration.SchemaVersionField).Exists() {
+			return value
+		}
+		if stamped, err := sjson.Set(value, migration.SchemaVersionField, header.SchemaVersion); err == nil {
+			return stamped
+		}
+		return value
+	}
+
+	// Remove the current namespace first so objects created after the backup do not linger
+	if err := kvstore.DeleteWithPrefixWith(ctx, nsKey+"/"); err != nil {
+		return fmt.Errorf("failed to clear namespace %s: %w", nsId, err)
+	}
+	labelKvs, err := kvstore.GetKvListWith(ctx, labelKeyPrefix)
+	if err != nil {
+		return fmt.Errorf("failed to list labels: %w", err)
+	}
+	for _, kv := range labelKvs {
+		var labelInfo model.LabelInfo
+		if err := json.Unmarshal([]byte(kv.Value), &labelInfo); err != nil {
+			continue
+		}
+		if common.LabelBelongsToNs(labelInfo, nsId) {
+			if err := kvstore.DeleteWith(ctx, kv.Key); err != nil {
+				return fmt.Errorf("failed to delete label %s: %w", kv.Key, err)
+			}
+		}
+	}
+
+	// The namespace record is written last, as in ImportNs, so the namespace is only
+	// visible once its content is complete
+	nsValue := ""
+	_, err = scanArchive(path, func(rec *record) error {
+		if rec.Kind != recordKv {
+			return nil
+		}
+		switch {
+		case isDataKey(rec.Key):
+			return restoreDataKey(ctx, rec)
+		case rec.Key == nsKey:
+			nsValue = stamp(rec.Value)
+			return nil
+		case strings.HasPrefix(rec.Key, nsKey+"/"):
+			result.RestoredEntries++
+		case strings.HasPrefix(rec.Key, labelKeyPrefix):
+			var labelInfo model.LabelInfo
+			if err := json.Unmarshal([]byte(rec.Value), &labelInfo); err != nil || !common.LabelBelongsToNs(labelInfo, nsId) {
+				return nil
+			}
+			result.RestoredLabels++
+		default:
+			return nil
+		}
+		if err := kvstore.PutWith(ctx, rec.Key, stamp(rec.Value)); err != nil {
+			return fmt.Errorf("failed to restore %s: %w", rec.Key, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := kvstore.PutWith(ctx, nsKey, nsValue); err != nil {
+		return fmt.Errorf("failed to restore %s: %w", nsKey, err)
+	}
+	result.RestoredEntries++
+
+	return restoreTables(ctx, path, nsId, result)
+}
+
+// restoreTables replaces the spec and image rows in one transaction: all rows, or
+// only those of nsId if it is set.
+func restoreTables(ctx context.Context, path string, nsId string, result *model.BackupRestoreResult) error {
+	return model.ORM.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		scope := tx.Session(&gorm.Session{AllowGlobalUpdate: true})
+		if nsId != "" {
+			scope = tx.Where("namespace = ?", nsId)
+		}
+		if err := scope.Delete(&model.SpecInfo{}).Error; err != nil {
+			return fmt.Errorf("failed to clear spec table: %w", err)
+		}
+		scope = tx.Session(&gorm.Session{AllowGlobalUpdate: true})
+		if nsId != "" {
+			scope = tx.Where("namespace = ?", nsId)
+		}
+		if err := scope.Delete(&model.ImageInfo{}).Error; err != nil {
+			return fmt.Errorf("failed to clear image table: %w", err)
+		}
+
+		var specs []model.SpecInfo
+		var images []model.ImageInfo
+		flush := func() error {
+			if len(specs) > 0 {
+				if err := tx.CreateInBatches(&specs, len(specs)).Error; err != nil {
+					return fmt.Errorf("failed to restore specs: %w", err)
+				}
+				result.RestoredSpecs += len(specs)
+				specs = specs[:0]
+			}
+			if len(images) > 0 {
+				if err := tx.CreateInBatches(&images, len(images)).Error; err != nil {
+					return fmt.Errorf("failed to restore images: %w", err)
+				}
+				result.RestoredImages += len(images)
+				images = images[:0]
+			}
+			return nil
+		}
+
+		_, err := scanArchive(path, func(rec *record) error {
+			switch {
+			case rec.Kind == recordSpec && (nsId == "" || rec.Spec.Namespace == nsId):
+				specs = append(specs, *rec.Spec)
+			case rec.Kind == recordImage && (nsId == "" || rec.Image.Namespace == nsId):
+				images = append(images, *rec.Image)
+			default:
+				return nil
+			}
+			if len(specs) >= tableBatchSize || len(images) >= tableBatchSize {
+				return flush()
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return flush()
+	})
+}
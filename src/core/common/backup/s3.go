@@ -0,0 +1,234 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backup
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+
+	"github.com/cloud-barista/cb-tumblebug/src/core/model"
+)
+
+// emptyPayloadHash is the SHA-256 of an empty request body.
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// s3Target keeps archives in a bucket of an S3-compatible object store
+// (AWS S3, MinIO, Ceph RGW, ...). Requests are signed with SigV4 directly,
+// so only the plain object and ListObjectsV2 APIs are required.
+type s3Target struct {
+	endpoint  *url.URL
+	bucket    string
+	prefix    string
+	region    string
+	pathStyle bool
+	creds     aws.Credentials
+	signer    *v4.Signer
+	client    *http.Client
+}
+
+func newS3Target(cfg config) (*s3Target, error) {
+	if cfg.s3Endpoint == "" || cfg.s3Bucket == "" {
+		return nil, fmt.Errorf("TB_BACKUP_S3_ENDPOINT and TB_BACKUP_S3_BUCKET are required for the s3 backup target")
+	}
+	endpoint, err := url.Parse(cfg.s3Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid TB_BACKUP_S3_ENDPOINT %q (e.g., https://s3.us-east-1.amazonaws.com)", cfg.s3Endpoint)
+	}
+	prefix := strings.Trim(cfg.s3Prefix, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	return &s3Target{
+		endpoint:  endpoint,
+		bucket:    cfg.s3Bucket,
+		prefix:    prefix,
+		region:    cfg.s3Region,
+		pathStyle: cfg.s3PathStyle,
+		creds: aws.Credentials{
+			AccessKeyID:     cfg.s3AccessKey,
+			SecretAccessKey: cfg.s3SecretKey,
+		},
+		signer: v4.NewSigner(func(o *v4.SignerOptions) {
+			// S3 expects the object path to be escaped only once
+			o.DisableURIPathEscaping = true
+		}),
+		client: &http.Client{Timeout: 30 * time.Minute},
+	}, nil
+}
+
+func (t *s3Target) Kind() string { return targetS3 }
+
+// bucketURL returns the URL of the bucket root, in path or virtual-hosted style.
+func (t *s3Target) bucketURL() url.URL {
+	u := *t.endpoint
+	if t.pathStyle {
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/" + t.bucket + "/"
+	} else {
+		u.Host = t.bucket + "." + u.Host
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/"
+	}
+	return u
+}
+
+func (t *s3Target) objectURL(name string) string {
+	u := t.bucketURL()
+	u.Path += t.prefix + name
+	return u.String()
+}
+
+// do signs and sends a request, and returns the response if its status is 2xx.
+func (t *s3Target) do(ctx context.Context, method, rawURL string, body io.Reader, size int64, payloadHash string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if err := t.signer.SignHTTP(ctx, t.creds, req, payloadHash, "s3", t.region, time.Now()); err != nil {
+		return nil, err
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errBackupNotFound
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return nil, fmt.Errorf("s3 %s %s: %s: %s", method, rawURL, resp.Status, strings.TrimSpace(string(msg)))
+}
+
+func (t *s3Target) Put(ctx context.Context, name string, src *os.File) error {
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	hash := sha256.New()
+	size, err := io.Copy(hash, src)
+	if err != nil {
+		return err
+	}
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	resp, err := t.do(ctx, http.MethodPut, t.objectURL(name), src, size, hex.EncodeToString(hash.Sum(nil)))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (t *s3Target) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	resp, err := t.do(ctx, http.MethodGet, t.objectURL(name), nil, 0, emptyPayloadHash)
+	if err == errBackupNotFound {
+		return nil, fmt.Errorf("%w: %s", errBackupNotFound, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// listBucketResult is the subset of the ListObjectsV2 response used here.
+type listBucketResult struct {
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+	Contents              []struct {
+		Key  string `xml:"Key"`
+		Size int64  `xml:"Size"`
+	} `xml:"Contents"`
+}
+
+func (t *s3Target) List(ctx context.Context) ([]model.BackupInfo, error) {
+	list := []model.BackupInfo{}
+	token := ""
+	for {
+		query := url.Values{}
+		query.Set("list-type", "2")
+		query.Set("prefix", t.prefix+archivePrefix)
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		u := t.bucketURL()
+		u.RawQuery = query.Encode()
+
+		resp, err := t.do(ctx, http.MethodGet, u.String(), nil, 0, emptyPayloadHash)
+		if err != nil {
+			return nil, err
+		}
+		var result listBucketResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode s3 object list: %w", err)
+		}
+
+		for _, obj := range result.Contents {
+			name := strings.TrimPrefix(obj.Key, t.prefix)
+			createdAt, ok := parseArchiveName(name)
+			if !ok {
+				continue
+			}
+			list = append(list, model.BackupInfo{
+				Name:      name,
+				Target:    targetS3,
+				Size:      obj.Size,
+				CreatedAt: createdAt.Format(time.RFC3339),
+			})
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return list, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+func (t *s3Target) Delete(ctx context.Context, name string) error {
+	// S3 reports success when deleting a missing object, so check first to keep
+	// the behavior consistent with the local target
+	resp, err := t.do(ctx, http.MethodHead, t.objectURL(name), nil, 0, emptyPayloadHash)
+	if err == errBackupNotFound {
+		return fmt.Errorf("%w: %s", errBackupNotFound, name)
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	resp, err = t.do(ctx, http.MethodDelete, t.objectURL(name), nil, 0, emptyPayloadHash)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cloud-barista/cb-tumblebug/src/core/model"
+)
+
+// errBackupNotFound is returned by a target when the requested archive does not exist.
+var errBackupNotFound = errors.New("backup not found")
+
+// target stores backup archives by name.
+type target interface {
+	// Kind returns the target type (local or s3).
+	Kind() string
+	// Put uploads the archive in src under name, replacing any archive with that name.
+	Put(ctx context.Context, name string, src *os.File) error
+	// Get opens the archive stored under name.
+	Get(ctx context.Context, name string) (io.ReadCloser, error)
+	// List returns the archives in the target. The order is unspecified.
+	List(ctx context.Context) ([]model.BackupInfo, error)
+	// Delete removes the archive stored under name.
+	Delete(ctx context.Context, name string) error
+}
+
+// localTarget keeps archives in a directory on the local filesystem.
+type localTarget struct {
+	dir string
+}
+
+func (t *localTarget) Kind() string { return targetLocal }
+
+func (t *localTarget) Put(ctx context.Context, name string, src *os.File) error {
+	if err := os.MkdirAll(t.dir, 0o700); err != nil {
+		return err
+	}
+	// Write under a hidden name first so a partial archive is never listed
+	tmp, err := os.CreateTemp(t.dir, "."+name+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := io.Copy(tmp, src); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(t.dir, name))
+}
+
+func (t *localTarget) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	f, err := os.Open(filepath.Join(t.dir, name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", errBackupNotFound, name)
+	}
+	return f, err
+}
+
+func (t *localTarget) List(ctx context.Context) ([]model.BackupInfo, error) {
+	entries, err := os.ReadDir(t.dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return []model.BackupInfo{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	list := []model.BackupInfo{}
+	for _, entry := range entries {
+		createdAt, ok := parseArchiveName(entry.Name())
+		if !ok || entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		list = append(list, model.BackupInfo{
+			Name:      entry.Name(),
+			Target:    targetLocal,
+			Size:      info.Size(),
+			CreatedAt: createdAt.Format(time.RFC3339),
+		})
+	}
+	return list, nil
+}
+
+func (t *localTarget) Delete(ctx context.Context, name string) error {
+	err := os.Remove(filepath.Join(t.dir, name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: %s", errBackupNotFound, name)
+	}
+	return err
+}
@@ -177,6 +177,12 @@ func UpdateGlobalVariable(id string) error {
 	case model.StrDragonflyRestUrl:
 		model.DragonflyRestUrl = configInfo.Value
 		log.Debug().Msg("<TB_DRAGONFLY_REST_URL> " + model.DragonflyRestUrl)
+	case model.StrPrometheusUrl:
+		model.PrometheusUrl = configInfo.Value
+		log.Debug().Msg("<TB_PROMETHEUS_URL> " + model.PrometheusUrl)
+	case model.StrPrometheusBearerToken:
+		model.PrometheusBearerToken = configInfo.Value
+		log.Debug().Msg("<TB_PROMETHEUS_BEARER_TOKEN> ********")
 	case model.StrTerrariumRestUrl:
 		model.TerrariumRestUrl = configInfo.Value
 		log.Debug().Msg("<TB_TERRARIUM_REST_URL> " + model.TerrariumRestUrl)
@@ -207,6 +213,9 @@ func UpdateGlobalVariable(id string) error {
 	case model.StrAutocontrolDurationMs:
 		model.AutocontrolDurationMs = configInfo.Value
 		log.Debug().Msg("<TB_AUTOCONTROL_DURATION_MS> " + model.AutocontrolDurationMs)
+	case model.StrWebhookAllowedCidrs:
+		model.WebhookAllowedCidrs = configInfo.Value
+		log.Debug().Msg("<TB_WEBHOOK_ALLOWED_CIDRS> " + model.WebhookAllowedCidrs)
 	case model.StrEtcdEndpoints:
 		model.EtcdEndpoints = configInfo.Value
 		log.Debug().Msg("<TB_ETCD_ENDPOINTS> " + model.EtcdEndpoints)
@@ -232,6 +241,12 @@ func InitConfig(id string) error {
 	case model.StrDragonflyRestUrl:
 		model.DragonflyRestUrl = NVL(os.Getenv("TB_DRAGONFLY_REST_URL"), "http://localhost:9090/dragonfly")
 		log.Debug().Msg("<TB_DRAGONFLY_REST_URL> " + model.DragonflyRestUrl)
+	case model.StrPrometheusUrl:
+		model.PrometheusUrl = NVL(os.Getenv("TB_PROMETHEUS_URL"), "http://localhost:9090")
+		log.Debug().Msg("<TB_PROMETHEUS_URL> " + model.PrometheusUrl)
+	case model.StrPrometheusBearerToken:
+		model.PrometheusBearerToken = os.Getenv("TB_PROMETHEUS_BEARER_TOKEN")
+		log.Debug().Msg("<TB_PROMETHEUS_BEARER_TOKEN> ********")
 	case model.StrTerrariumRestUrl:
 		model.TerrariumRestUrl = NVL(os.Getenv("TB_TERRARIUM_REST_URL"), "http://localhost:8055/terrarium")
 		log.Debug().Msg("<TB_TERRARIUM_REST_URL> " + model.TerrariumRestUrl)
@@ -262,6 +277,9 @@ func InitConfig(id string) error {
 	case model.StrAutocontrolDurationMs:
 		model.AutocontrolDurationMs = NVL(os.Getenv("TB_AUTOCONTROL_DURATION_MS"), "10000")
 		log.Debug().Msg("<TB_AUTOCONTROL_DURATION_MS> " + model.AutocontrolDurationMs)
+	case model.StrWebhookAllowedCidrs:
+		model.WebhookAllowedCidrs = os.Getenv("TB_WEBHOOK_ALLOWED_CIDRS")
+		log.Debug().Msg("<TB_WEBHOOK_ALLOWED_CIDRS> " + model.WebhookAllowedCidrs)
 	case model.StrVaultAddr:
 		model.VaultAddr = NVL(os.Getenv("VAULT_ADDR"), "http://localhost:8200")
 		log.Debug().Msg("<VAULT_ADDR> " + model.VaultAddr)
@@ -42,9 +42,10 @@ var etcdMaintenanceInterval = func() time.Duration {
 	return 24 * time.Hour
 }()
 
-// StartEtcdMaintenanceLoop runs etcd Compact+Defragment once immediately and
-// then on a fixed interval for the lifetime of the process. Call once, after
-// the kvstore has been initialized (see setupAndWaitForInternalServices in
+// StartEtcdMaintenanceLoop registers a leader controller that runs etcd
+// Compact+Defragment once on taking the lead and then on a fixed interval,
+// so that only one replica maintains a shared etcd. Call once, after the
+// kvstore has been initialized (see setupAndWaitForInternalServices in
 // main.go). Safe for a single-node etcd deployment; Defragment already
 // serializes across endpoints if ever pointed at a multi-member cluster.
 func StartEtcdMaintenanceLoop() {
@@ -53,17 +54,21 @@ func StartEtcdMaintenanceLoop() {
 		return
 	}
 
-	log.Info().Dur("interval", etcdMaintenanceInterval).Msg("etcd maintenance: starting periodic compact+defrag loop")
-
-	go func() {
+	RunAsLeader("etcdMaintenance", func(ctx context.Context) {
+		log.Info().Dur("interval", etcdMaintenanceInterval).Msg("etcd maintenance: starting periodic compact+defrag loop")
 		runEtcdMaintenance()
 
 		ticker := time.NewTicker(etcdMaintenanceInterval)
 		defer ticker.Stop()
-		for range ticker.C {
-			runEtcdMaintenance()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				runEtcdMaintenance()
+			}
 		}
-	}()
+	})
 }
 
 func runEtcdMaintenance() {
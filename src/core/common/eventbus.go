@@ -0,0 +1,136 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package common is to include common methods for managing multi-cloud infra
+package common
+
+import (
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cloud-barista/cb-tumblebug/src/core/model"
+	"github.com/rs/zerolog/log"
+)
+
+// eventBusBuffer is the number of events queued per subscriber; when a subscriber
+// falls behind further, its new events are dropped. Override with TB_EVENT_BUS_BUFFER.
+var eventBusBuffer = func() int {
+	if v, err := strconv.Atoi(os.Getenv("TB_EVENT_BUS_BUFFER")); err == nil && v > 0 {
+		return v
+	}
+	return 1024
+}()
+
+// EventHandler consumes the events of a subscription, one at a time
+type EventHandler func(event model.Event)
+
+type eventSubscriber struct {
+	name    string
+	filter  func(event model.Event) bool
+	queue   chan model.Event
+	dropped atomic.Int64
+}
+
+// eventBus fans the published events out to the subscribers. Each subscriber has its
+// own queue and goroutine, so a slow subscriber never blocks the publishers or the others.
+var eventBus = struct {
+	sync.RWMutex
+	subscribers map[uint64]*eventSubscriber
+	nextId      uint64
+}{subscribers: map[uint64]*eventSubscriber{}}
+
+// SubscribeEvents registers a handler for the events accepted by filter (nil: all events)
+// and returns the function that cancels the subscription. name identifies the subscriber in logs.
+func SubscribeEvents(name string, filter func(event model.Event) bool, handler EventHandler) (unsubscribe func()) {
+	sub := &eventSubscriber{name: name, filter: filter, queue: make(chan model.Event, eventBusBuffer)}
+
+	eventBus.Lock()
+	id := eventBus.nextId
+	eventBus.nextId++
+	eventBus.subscribers[id] = sub
+	eventBus.Unlock()
+
+	go func() {
+		for event := range sub.queue {
+			func() {
+				defer func() {
+					if r := recover(); r != nil {
+						log.Error().Msgf("Event subscriber %s panicked on %s: %v", name, event.Type, r)
+					}
+				}()
+				handler(event)
+			}()
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			eventBus.Lock()
+			delete(eventBus.subscribers, id)
+			eventBus.Unlock()
+			close(sub.queue)
+		})
+	}
+}
+
+// PublishEvent publishes an event of the given type about a resource. It never blocks:
+// the event is queued for each interested subscriber, or dropped for a subscriber whose
+// queue is full.
+func PublishEvent(eventType string, data model.EventData) {
+	source := "/tumblebug/ns/" + data.NsId
+	if data.InfraId != "" && data.ResourceType != model.StrInfra {
+		source += "/" + model.StrInfra + "/" + data.InfraId
+	}
+	if data.ResourceType != "" {
+		source += "/" + data.ResourceType
+		if data.ResourceId != "" {
+			source += "/" + data.ResourceId
+		}
+	}
+	event := model.Event{
+		SpecVersion:     "1.0",
+		Id:              GenUid(),
+		Source:          source,
+		Type:            eventType,
+		Subject:         data.ResourceId,
+		Time:            time.Now().UTC().Format(time.RFC3339Nano),
+		DataContentType: "application/json",
+		Data:            data,
+	}
+
+	log.Debug().
+		Str("type", event.Type).
+		Str("source", event.Source).
+		Str("oldStatus", data.OldStatus).
+		Str("newStatus", data.NewStatus).
+		Msg("Event published")
+
+	eventBus.RLock()
+	defer eventBus.RUnlock()
+	for _, sub := range eventBus.subscribers {
+		if sub.filter != nil && !sub.filter(event) {
+			continue
+		}
+		select {
+		case sub.queue <- event:
+		default:
+			if n := sub.dropped.Add(1); n == 1 || n%100 == 0 {
+				log.Warn().Msgf("Event subscriber %s is falling behind: %d events dropped", sub.name, n)
+			}
+		}
+	}
+}
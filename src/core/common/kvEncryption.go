@@ -0,0 +1,55 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package common
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/cloud-barista/cb-tumblebug/src/core/model"
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/encrypted"
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvstore"
+)
+
+// RotateKvEncryptionKey switches kvstore encryption to a new data key and re-encrypts
+// every protected value with it. Data keys are re-wrapped with the current master key,
+// so this is also the second step of a master key change.
+func RotateKvEncryptionKey(ctx context.Context) (model.KvEncryptionRotationResult, error) {
+	store, err := kvstore.GetStore()
+	if err != nil {
+		return model.KvEncryptionRotationResult{}, err
+	}
+	encStore, ok := store.(*encrypted.Store)
+	if !ok {
+		return model.KvEncryptionRotationResult{}, fmt.Errorf("kvstore encryption is not enabled (set TB_KVSTORE_ENCRYPTION to local or openbao)")
+	}
+
+	report, err := encStore.Rotate(ctx)
+	result := model.KvEncryptionRotationResult{
+		DataKeyId:   report.DataKeyId,
+		MasterKey:   report.MasterKey,
+		Rewrapped:   report.Rewrapped,
+		Scanned:     report.Scanned,
+		Reencrypted: report.Reencrypted,
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("kvstore encryption key rotation failed")
+		return result, err
+	}
+	log.Info().Msgf("kvstore encryption key rotated to %s (master key %s): re-wrapped %d data key(s), re-encrypted %d of %d entries",
+		result.DataKeyId, result.MasterKey, result.Rewrapped, result.Reencrypted, result.Scanned)
+	return result, nil
+}
@@ -0,0 +1,227 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package common is to include common methods for managing multi-cloud infra
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cloud-barista/cb-tumblebug/src/core/model"
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvstore"
+	"github.com/rs/zerolog/log"
+)
+
+// Background controllers that must run once per deployment (scaling, CSP status polling,
+// lease reaping, etcd maintenance, scheduled jobs) run only on the replica holding the
+// leader lock. The lock is bound to a kvstore session, so when the leader dies or loses
+// etcd its session lease expires and another replica takes over.
+const (
+	leaderLockKey = "/leaderElection/lock"
+	leaderInfoKey = "/leaderElection/leader"
+)
+
+// leaderRenewInterval is how often the leader refreshes its record in leaderInfoKey.
+const leaderRenewInterval = 10 * time.Second
+
+// leaderStepDownTimeout bounds how long a replica that lost the lead waits for its
+// controllers to return before it campaigns again.
+const leaderStepDownTimeout = 30 * time.Second
+
+// replicaId identifies this process among the replicas sharing the kvstore.
+// Override with TB_REPLICA_ID; the host name (the pod name on Kubernetes) by default.
+var replicaId = func() string {
+	if v := os.Getenv("TB_REPLICA_ID"); v != "" {
+		return v
+	}
+	if host, err := os.Hostname(); err == nil && host != "" {
+		return host
+	}
+	return fmt.Sprintf("tumblebug-%d", os.Getpid())
+}()
+
+type leaderController struct {
+	name string
+	fn   func(ctx context.Context)
+}
+
+var (
+	isLeader atomic.Bool
+
+	leaderMu          sync.Mutex
+	leaderControllers []leaderController
+	leaderCtx         context.Context // set while this replica leads
+	leaderWg          sync.WaitGroup
+)
+
+// ReplicaId returns the identifier of this replica.
+func ReplicaId() string {
+	return replicaId
+}
+
+// IsLeader reports whether this replica currently runs the singleton controllers.
+func IsLeader() bool {
+	return isLeader.Load()
+}
+
+// RunAsLeader registers a singleton controller. fn runs in its own goroutine whenever this
+// replica becomes the leader and must return once ctx is cancelled, which happens when the
+// lead is lost. Controllers registered while leading start right away.
+func RunAsLeader(name string, fn func(ctx context.Context)) {
+	leaderMu.Lock()
+	defer leaderMu.Unlock()
+	c := leaderController{name: name, fn: fn}
+	leaderControllers = append(leaderControllers, c)
+	if leaderCtx != nil {
+		startLeaderController(leaderCtx, c)
+	}
+}
+
+// startLeaderController runs one controller under the leader context. leaderMu must be held.
+func startLeaderController(ctx context.Context, c leaderController) {
+	leaderWg.Add(1)
+	go func() {
+		defer leaderWg.Done()
+		log.Info().Str("controller", c.name).Msg("leader: starting controller")
+		c.fn(ctx)
+		log.Info().Str("controller", c.name).Msg("leader: controller stopped")
+	}()
+}
+
+// GetLeaderInfo returns the replica recorded as the leader, and false if none is.
+func GetLeaderInfo() (model.LeaderInfo, bool, error) {
+	info := model.LeaderInfo{}
+	val, exists, err := kvstore.Get(leaderInfoKey)
+	if err != nil || !exists {
+		return info, false, err
+	}
+	if err := json.Unmarshal([]byte(val), &info); err != nil {
+		return info, false, err
+	}
+	return info, true, nil
+}
+
+// StartLeaderElection campaigns for the leader lock until ctx is done, running the
+// registered controllers while this replica holds it. Call in a goroutine once the
+// kvstore is initialized.
+func StartLeaderElection(ctx context.Context) {
+	log.Info().Str("replicaId", replicaId).Msg("leader: joining leader election")
+	backoff := time.Second
+	for ctx.Err() == nil {
+		if err := campaign(ctx); err != nil && ctx.Err() == nil {
+			log.Warn().Err(err).Dur("retryIn", backoff).Msg("leader: election round failed")
+			select {
+			case <-ctx.Done():
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, 30*time.Second)
+			continue
+		}
+		backoff = time.Second
+	}
+}
+
+// campaign waits for the leader lock and leads until the session ends or ctx is done.
+func campaign(ctx context.Context) error {
+	session, err := kvstore.NewSession(ctx)
+	if err != nil {
+		return fmt.Errorf("cannot create a kvstore session: %w", err)
+	}
+	defer session.Close()
+
+	// Blocks while another replica leads
+	lock, err := kvstore.NewLock(ctx, session, leaderLockKey)
+	if err != nil {
+		return fmt.Errorf("cannot acquire the leader lock: %w", err)
+	}
+
+	lead(ctx, session)
+
+	unlockCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := lock.Unlock(unlockCtx); err != nil {
+		log.Debug().Err(err).Msg("leader: cannot release the leader lock (the session expiry releases it)")
+	}
+	return nil
+}
+
+// lead runs the controllers until the session is lost or ctx is done.
+func lead(ctx context.Context, session kvstore.Session) {
+	since := time.Now().UTC().Format(time.RFC3339)
+	runCtx, cancel := context.WithCancel(ctx)
+
+	putLeaderInfo(since)
+	isLeader.Store(true)
+	log.Info().Str("event", "LeaderElected").Str("replicaId", replicaId).Msg("leader: this replica is now the leader")
+
+	leaderMu.Lock()
+	leaderCtx = runCtx
+	for _, c := range leaderControllers {
+		startLeaderController(runCtx, c)
+	}
+	leaderMu.Unlock()
+
+	ticker := time.NewTicker(leaderRenewInterval)
+	defer ticker.Stop()
+loop:
+	for {
+		select {
+		case <-ctx.Done():
+			break loop
+		case <-session.Done():
+			log.Warn().Str("event", "LeaderLost").Str("replicaId", replicaId).Msg("leader: kvstore session expired, stepping down")
+			break loop
+		case <-ticker.C:
+			putLeaderInfo(since)
+		}
+	}
+
+	isLeader.Store(false)
+	leaderMu.Lock()
+	leaderCtx = nil
+	leaderMu.Unlock()
+	cancel()
+
+	// Let the controllers finish their current round, so the next leader does not overlap them
+	done := make(chan struct{})
+	go func() {
+		leaderWg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(leaderStepDownTimeout):
+		log.Warn().Dur("timeout", leaderStepDownTimeout).Msg("leader: controllers still running after stepping down")
+	}
+}
+
+// putLeaderInfo records this replica as the leader, for the readyz API of every replica.
+func putLeaderInfo(since string) {
+	val, err := json.Marshal(model.LeaderInfo{
+		ReplicaId: replicaId,
+		Since:     since,
+		RenewedAt: time.Now().UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return
+	}
+	if err := kvstore.Put(leaderInfoKey, string(val)); err != nil {
+		log.Warn().Err(err).Msg("leader: cannot record the leader")
+	}
+}
@@ -0,0 +1,139 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package common is to include common methods for managing multi-cloud infra
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cloud-barista/cb-tumblebug/src/core/model"
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvstore"
+)
+
+// GenLeaseKey is func to generate the key of the lease of an Infra or a K8sCluster.
+// Leases live outside the resource subtree so resource listings do not see them.
+func GenLeaseKey(nsId string, resourceType string, resourceId string) string {
+	key := "/" + model.StrNamespace + "/" + nsId + "/lease"
+	if resourceType != "" {
+		key += "/" + resourceType
+		if resourceId != "" {
+			key += "/" + resourceId
+		}
+	}
+	return key
+}
+
+// ResolveExpiration validates an expiration option and returns the expiry it sets,
+// or false when it sets none. Ttl counts from now.
+func ResolveExpiration(opt model.ExpirationOption, now time.Time) (time.Time, bool, error) {
+	switch strings.ToLower(opt.ExpirationAction) {
+	case "", model.LeaseActionDelete, model.LeaseActionSuspend:
+	default:
+		return time.Time{}, false, fmt.Errorf("invalid expirationAction %q (use %s or %s)", opt.ExpirationAction, model.LeaseActionDelete, model.LeaseActionSuspend)
+	}
+	if opt.ExpiresAt != "" && opt.Ttl != "" {
+		return time.Time{}, false, fmt.Errorf("set either expiresAt or ttl, not both")
+	}
+
+	var expiresAt time.Time
+	switch {
+	case opt.ExpiresAt != "":
+		t, err := time.Parse(time.RFC3339, opt.ExpiresAt)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("invalid expiresAt %q (RFC3339 expected): %w", opt.ExpiresAt, err)
+		}
+		expiresAt = t
+	case opt.Ttl != "":
+		d, err := time.ParseDuration(opt.Ttl)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("invalid ttl %q (e.g. 72h expected): %w", opt.Ttl, err)
+		}
+		expiresAt = now.Add(d)
+	default:
+		return time.Time{}, false, nil
+	}
+	if !expiresAt.After(now) {
+		return time.Time{}, false, fmt.Errorf("the expiry %s is not in the future", expiresAt.UTC().Format(time.RFC3339))
+	}
+	return expiresAt.UTC(), true, nil
+}
+
+// RegisterLease stores the lease set by opt for a newly created resource. An option
+// without expiry stores nothing.
+func RegisterLease(nsId string, resourceType string, resourceId string, opt model.ExpirationOption) error {
+	expiresAt, set, err := ResolveExpiration(opt, time.Now())
+	if err != nil || !set {
+		return err
+	}
+	action := strings.ToLower(opt.ExpirationAction)
+	if action == "" {
+		action = model.LeaseActionDelete
+	}
+	return PutLease(model.LeaseInfo{
+		NsId:         nsId,
+		ResourceType: resourceType,
+		ResourceId:   resourceId,
+		ExpiresAt:    expiresAt.Format(time.RFC3339),
+		Action:       action,
+		Status:       model.LeaseActive,
+	})
+}
+
+// PutLease creates or replaces a lease.
+func PutLease(lease model.LeaseInfo) error {
+	lease.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	val, err := json.Marshal(lease)
+	if err != nil {
+		return err
+	}
+	return kvstore.Put(GenLeaseKey(lease.NsId, lease.ResourceType, lease.ResourceId), string(val))
+}
+
+// GetLease returns the lease of a resource, and false when it has none.
+func GetLease(nsId string, resourceType string, resourceId string) (model.LeaseInfo, bool, error) {
+	lease := model.LeaseInfo{}
+	keyValue, exists, err := kvstore.GetKv(GenLeaseKey(nsId, resourceType, resourceId))
+	if err != nil || !exists {
+		return lease, false, err
+	}
+	if err := json.Unmarshal([]byte(keyValue.Value), &lease); err != nil {
+		return lease, false, err
+	}
+	return lease, true, nil
+}
+
+// ListLease returns the leases of a namespace.
+func ListLease(nsId string) ([]model.LeaseInfo, error) {
+	keyValues, err := kvstore.GetKvList(GenLeaseKey(nsId, "", "") + "/")
+	if err != nil {
+		return nil, err
+	}
+	leases := []model.LeaseInfo{}
+	for _, kv := range keyValues {
+		lease := model.LeaseInfo{}
+		if err := json.Unmarshal([]byte(kv.Value), &lease); err != nil {
+			continue
+		}
+		leases = append(leases, lease)
+	}
+	return leases, nil
+}
+
+// DelLease deletes the lease of a resource. A resource without a lease is not an error.
+func DelLease(nsId string, resourceType string, resourceId string) error {
+	return kvstore.Delete(GenLeaseKey(nsId, resourceType, resourceId))
+}
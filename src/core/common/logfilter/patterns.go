@@ -55,6 +55,9 @@ var RequestSkipPatterns = []SkipRule{
 	// SSE streaming endpoints — BodyDump and TracingMiddleware interfere with streaming responses
 	{Method: "GET", Patterns: []string{"/stream/cmd/"}},
 
+	// WebSocket terminal sessions — long-lived, hijacked connections
+	{Method: "GET", Patterns: []string{"/terminal/infra/"}},
+
 	// High-frequency polling endpoints from UI (cb-mapui)
 	// These are called every 5-10 seconds and storing their large response bodies
 	// in RequestMap causes unbounded memory growth (memory leak).
@@ -0,0 +1,170 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package migration
+
+import (
+	"strings"
+
+	"github.com/cloud-barista/cb-tumblebug/src/core/model"
+)
+
+func init() {
+	Register(Migration{
+		Version:     1,
+		Description: "rename legacy MCI/VM/SubGroup keys and fields to Infra/Node/NodeGroup",
+		Up:          renameLegacyInfraNaming,
+	})
+}
+
+// legacyFieldNames maps pre-rename JSON fields to their current names.
+// A field is only renamed when the current name is not already present.
+var legacyFieldNames = map[string]string{
+	"vm":             "node",
+	"newVmList":      "newNodeList",
+	"mciNlbListener": "infraNlbListener",
+	"subGroupId":     "nodeGroupId",
+	"subGroupSize":   "nodeGroupSize",
+	"vmId":           "nodeId",
+	"vmUserName":     "nodeUserName",
+	"vmUserPassword": "nodeUserPassword",
+	"mciId":          "infraId",
+}
+
+// legacyLabelKeys maps pre-rename system label keys to their current names.
+var legacyLabelKeys = map[string]string{
+	"sys.mciId":          "sys.infraId",
+	"sys.mciName":        "sys.infraName",
+	"sys.mciUid":         "sys.infraUid",
+	"sys.mciDescription": "sys.infraDescription",
+	"sys.subGroupId":     "sys.nodeGroupId",
+}
+
+// legacyLabelTypes maps pre-rename label types to their current names.
+var legacyLabelTypes = map[string]string{
+	"mci": model.StrInfra,
+	"vm":  model.StrNode,
+}
+
+// renameLegacyInfraNaming moves Infra/Node records from the MCI/VM key layout and
+// renames the fields and label entries that referred to MCI, VM and SubGroup.
+func renameLegacyInfraNaming(obj *Object) (bool, error) {
+	changed := false
+
+	if key := renameLegacyKey(obj.Key); key != obj.Key {
+		obj.Key = key
+		changed = true
+	}
+
+	// Field names are only ambiguous outside the Infra subtree (e.g. "vm" in other
+	// objects), so rename them just for Infra, Node and NodeGroup records.
+	if isInfraKey(obj.Key) {
+		for _, oldName := range sortedKeys(obj.Value) {
+			newName, ok := legacyFieldNames[oldName]
+			if !ok {
+				continue
+			}
+			if _, exists := obj.Value[newName]; exists {
+				continue
+			}
+			obj.Value[newName] = obj.Value[oldName]
+			delete(obj.Value, oldName)
+			changed = true
+		}
+	}
+
+	// Resources reference Nodes by key in associatedObjectList
+	if list, ok := obj.Value["associatedObjectList"].([]any); ok {
+		for i, item := range list {
+			if s, ok := item.(string); ok {
+				if renamed := renameLegacyKey(s); renamed != s {
+					list[i] = renamed
+					changed = true
+				}
+			}
+		}
+	}
+
+	// Label records (/label/{labelType}/{uid}) carry the resource key and system labels
+	if strings.HasPrefix(obj.Key, "/label/") {
+		if resourceKey, ok := obj.Value["resourceKey"].(string); ok {
+			if renamed := renameLegacyKey(resourceKey); renamed != resourceKey {
+				obj.Value["resourceKey"] = renamed
+				changed = true
+			}
+		}
+		if labels, ok := obj.Value["labels"].(map[string]any); ok {
+			for oldKey, newKey := range legacyLabelKeys {
+				if v, exists := labels[oldKey]; exists {
+					if _, taken := labels[newKey]; !taken {
+						labels[newKey] = v
+					}
+					delete(labels, oldKey)
+					changed = true
+				}
+			}
+			if labelType, ok := labels[model.LabelLabelType].(string); ok {
+				if renamed, legacy := legacyLabelTypes[labelType]; legacy {
+					labels[model.LabelLabelType] = renamed
+					changed = true
+				}
+			}
+		}
+	}
+
+	return changed, nil
+}
+
+// renameLegacyKey rewrites a kvstore key from the MCI/VM layout, e.g.
+// /ns/default/mci/m1/vm/v1 -> /ns/default/infra/m1/node/v1 and
+// /label/vm/{uid} -> /label/node/{uid}. Other keys are returned unchanged.
+func renameLegacyKey(key string) string {
+	parts := strings.Split(key, "/")
+	if len(parts) < 3 || parts[0] != "" {
+		return key
+	}
+
+	switch parts[1] {
+	case "label":
+		if renamed, ok := legacyLabelTypes[parts[2]]; ok {
+			parts[2] = renamed
+		}
+	case model.StrNamespace:
+		// /ns/{nsId}/mci/... or /ns/{nsId}/policy/mci/...
+		i := 3
+		if len(parts) > i && parts[i] == "policy" {
+			i++
+		}
+		if len(parts) <= i || parts[i] != "mci" {
+			return key
+		}
+		parts[i] = model.StrInfra
+		if len(parts) > i+2 {
+			switch parts[i+2] {
+			case "vm":
+				parts[i+2] = model.StrNode
+			case "subgroup":
+				parts[i+2] = model.StrNodeGroup
+			}
+		}
+	default:
+		return key
+	}
+	return strings.Join(parts, "/")
+}
+
+// isInfraKey reports whether key is in an Infra subtree (/ns/{nsId}/infra/...).
+func isInfraKey(key string) bool {
+	parts := strings.Split(key, "/")
+	return len(parts) > 3 && parts[1] == model.StrNamespace && parts[3] == model.StrInfra
+}
@@ -0,0 +1,312 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package migration upgrades objects stored in the kvstore to the current schema version.
+//
+// Every stored JSON object carries its schema version in the "schemaVersion" field.
+// An object without the field is at the store-wide version recorded under
+// SchemaVersionKey, which is the version of the server that last ran the migrations;
+// objects written since then by that server are therefore never mistaken for older data.
+package migration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+	"github.com/tidwall/sjson"
+
+	"github.com/cloud-barista/cb-tumblebug/src/core/model"
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvstore"
+)
+
+const (
+	// SchemaVersionField is the JSON field stamped on every migrated object.
+	SchemaVersionField = "schemaVersion"
+	// SchemaVersionKey holds the store-wide schema version.
+	SchemaVersionKey = "/schemaVersion"
+
+	maxSampleKeys = 5
+)
+
+// scanPrefixes are the kvstore subtrees holding versioned objects.
+var scanPrefixes = []string{"/" + model.StrNamespace + "/", "/label/"}
+
+// Object is a stored object handed to a migration.
+// A migration edits Value in place and may change Key to move the record.
+type Object struct {
+	Key   string
+	Value map[string]any
+}
+
+// Migration upgrades objects from schema version Version-1 to Version.
+type Migration struct {
+	Version     int
+	Description string
+	// Up rewrites obj and reports whether anything changed.
+	Up func(obj *Object) (bool, error)
+}
+
+var (
+	registryMu sync.Mutex
+	registry   = map[int]Migration{}
+)
+
+// Register adds a migration. Versions must be unique and start at 1 without gaps,
+// which Run verifies before touching any data.
+func Register(m Migration) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if m.Version < 1 || m.Up == nil {
+		panic(fmt.Sprintf("migration: invalid migration %d", m.Version))
+	}
+	if _, dup := registry[m.Version]; dup {
+		panic(fmt.Sprintf("migration: version %d registered twice", m.Version))
+	}
+	registry[m.Version] = m
+}
+
+// CurrentVersion returns the latest schema version known to this server.
+func CurrentVersion() int {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	return len(registry)
+}
+
+// sortedMigrations returns the registered migrations in version order.
+func sortedMigrations() ([]Migration, error) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	list := make([]Migration, 0, len(registry))
+	for v := 1; v <= len(registry); v++ {
+		m, ok := registry[v]
+		if !ok {
+			return nil, fmt.Errorf("migration version %d is missing", v)
+		}
+		list = append(list, m)
+	}
+	return list, nil
+}
+
+// Run upgrades every stored object to CurrentVersion.
+// With dryRun, nothing is written and the report describes what would change.
+// It fails without writing anything if the store or any object carries a schema
+// version newer than this server understands.
+func Run(ctx context.Context, dryRun bool) (model.SchemaMigrationReport, error) {
+	migrations, err := sortedMigrations()
+	if err != nil {
+		return model.SchemaMigrationReport{}, err
+	}
+	target := len(migrations)
+
+	storedVersion, versionExists, err := readStoredVersion(ctx)
+	if err != nil {
+		return model.SchemaMigrationReport{}, err
+	}
+
+	report := model.SchemaMigrationReport{
+		DryRun:        dryRun,
+		StoredVersion: storedVersion,
+		TargetVersion: target,
+		Steps:         make([]model.SchemaMigrationStep, target),
+	}
+	for i, m := range migrations {
+		report.Steps[i] = model.SchemaMigrationStep{Version: m.Version, Description: m.Description}
+	}
+	if storedVersion > target {
+		return report, fmt.Errorf("kvstore schema version %d is newer than this server supports (%d); refusing to start with data written by a newer release",
+			storedVersion, target)
+	}
+
+	var kvs []kvstore.KeyValue
+	for _, prefix := range scanPrefixes {
+		list, err := kvstore.GetKvListWith(ctx, prefix)
+		if err != nil {
+			return report, fmt.Errorf("failed to scan %s: %w", prefix, err)
+		}
+		kvs = append(kvs, list...)
+	}
+
+	// A store that has never been stamped and holds no objects is a fresh install
+	if !versionExists && len(kvs) == 0 {
+		storedVersion = target
+	}
+
+	type pendingWrite struct {
+		oldKey string
+		key    string
+		value  string
+	}
+	var writes []pendingWrite
+
+	// Plan every change first so that an unknown future version aborts before any write
+	for _, kv := range kvs {
+		value, ok := decodeObject(kv.Value)
+		if !ok {
+			continue
+		}
+		report.Scanned++
+
+		version := storedVersion
+		stamped := false
+		if raw, exists := value[SchemaVersionField]; exists {
+			v, err := toVersion(raw)
+			if err != nil {
+				return report, fmt.Errorf("object %s has an invalid %s: %w", kv.Key, SchemaVersionField, err)
+			}
+			version, stamped = v, true
+		}
+		if version > target {
+			return report, fmt.Errorf("object %s has schema version %d, newer than this server supports (%d); refusing to start",
+				kv.Key, version, target)
+		}
+
+		obj := &Object{Key: kv.Key, Value: value}
+		changed := false
+		for i := version; i < target; i++ {
+			stepChanged, err := migrations[i].Up(obj)
+			if err != nil {
+				return report, fmt.Errorf("migration %d failed on %s: %w", migrations[i].Version, kv.Key, err)
+			}
+			if stepChanged {
+				changed = true
+				step := &report.Steps[i]
+				step.Objects++
+				if len(step.SampleKeys) < maxSampleKeys {
+					step.SampleKeys = append(step.SampleKeys, kv.Key)
+				}
+			}
+		}
+
+		var newValue string
+		switch {
+		case changed:
+			report.Migrated++
+			obj.Value[SchemaVersionField] = target
+			encoded, err := json.Marshal(obj.Value)
+			if err != nil {
+				return report, fmt.Errorf("failed to encode migrated %s: %w", kv.Key, err)
+			}
+			newValue = string(encoded)
+		case !stamped || version != target:
+			// Unchanged content; only the version stamp is added or raised
+			newValue, err = sjson.Set(kv.Value, SchemaVersionField, target)
+			if err != nil {
+				return report, fmt.Errorf("failed to stamp %s: %w", kv.Key, err)
+			}
+		default:
+			continue
+		}
+		report.Stamped++
+		if obj.Key != kv.Key {
+			report.Moved++
+		}
+		writes = append(writes, pendingWrite{oldKey: kv.Key, key: obj.Key, value: newValue})
+	}
+
+	if dryRun {
+		return report, nil
+	}
+
+	for _, w := range writes {
+		if w.key == w.oldKey {
+			err = kvstore.PutWith(ctx, w.key, w.value)
+		} else {
+			// Move atomically so an interrupted run never leaves both or neither copy
+			err = kvstore.Txn(ctx, nil, []kvstore.Op{kvstore.PutOp(w.key, w.value), kvstore.DeleteOp(w.oldKey)})
+		}
+		if err != nil {
+			return report, fmt.Errorf("failed to write migrated %s: %w", w.key, err)
+		}
+	}
+	if err := kvstore.PutWith(ctx, SchemaVersionKey, strconv.Itoa(target)); err != nil {
+		return report, fmt.Errorf("failed to record schema version: %w", err)
+	}
+	return report, nil
+}
+
+// LogReport writes a human-readable summary of the report.
+func LogReport(report model.SchemaMigrationReport) {
+	mode := "applied"
+	if report.DryRun {
+		mode = "dry-run"
+	}
+	log.Info().Msgf("schema migration (%s): version %d -> %d, scanned %d, migrated %d, moved %d, stamped %d",
+		mode, report.StoredVersion, report.TargetVersion, report.Scanned, report.Migrated, report.Moved, report.Stamped)
+	for _, step := range report.Steps {
+		if step.Objects == 0 {
+			continue
+		}
+		log.Info().Msgf("  v%d %s: %d object(s), e.g. %s",
+			step.Version, step.Description, step.Objects, strings.Join(step.SampleKeys, ", "))
+	}
+}
+
+func readStoredVersion(ctx context.Context) (int, bool, error) {
+	value, exists, err := kvstore.GetWith(ctx, SchemaVersionKey)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	if !exists {
+		return 0, false, nil
+	}
+	version, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		return 0, true, fmt.Errorf("invalid schema version %q at %s: %w", value, SchemaVersionKey, err)
+	}
+	return version, true, nil
+}
+
+// decodeObject parses a stored JSON object, keeping numbers exact.
+// Values that are not JSON objects are not versioned and are skipped.
+func decodeObject(value string) (map[string]any, bool) {
+	dec := json.NewDecoder(bytes.NewReader([]byte(value)))
+	dec.UseNumber()
+	var obj map[string]any
+	if err := dec.Decode(&obj); err != nil || obj == nil {
+		return nil, false
+	}
+	return obj, true
+}
+
+func toVersion(raw any) (int, error) {
+	switch v := raw.(type) {
+	case json.Number:
+		n, err := strconv.Atoi(v.String())
+		return n, err
+	case float64:
+		return int(v), nil
+	case int:
+		return v, nil
+	default:
+		return 0, fmt.Errorf("unexpected type %T", raw)
+	}
+}
+
+// sortedKeys is a small helper for deterministic iteration in migrations.
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,257 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package common is to include common methods for managing multi-cloud infra
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+
+	"github.com/cloud-barista/cb-tumblebug/src/core/common/migration"
+	"github.com/cloud-barista/cb-tumblebug/src/core/model"
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/encrypted"
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvstore"
+)
+
+const labelKeyPrefix = "/label/"
+
+// bundleRedactedFields are the secrets left out of exported bundles, as gjson paths per
+// key prefix under the namespace ("#" stands for every array element). They sign or
+// authenticate requests and are set again on the imported objects.
+var bundleRedactedFields = []struct {
+	prefix string
+	fields []string
+}{
+	{prefix: "/" + model.StrEventSubscription + "/", fields: []string{"secret"}},
+	{prefix: "/policy/" + model.StrInfra + "/", fields: []string{"policy.#.webhook.secret"}},
+}
+
+// redactBundleEntry removes the secrets of bundleRedactedFields from a record value.
+func redactBundleEntry(nsKey string, entry model.NsBundleEntry) model.NsBundleEntry {
+	for _, r := range bundleRedactedFields {
+		if !strings.HasPrefix(entry.Key, nsKey+r.prefix) {
+			continue
+		}
+		for _, field := range r.fields {
+			for _, path := range encrypted.FieldPaths(entry.Value, field) {
+				if value, err := sjson.Delete(entry.Value, path); err == nil {
+					entry.Value = value
+				}
+			}
+		}
+	}
+	return entry
+}
+
+// ExportNs collects every kvstore record of the namespace and the labels of its
+// objects into a portable bundle. The secrets in bundleRedactedFields are left out.
+func ExportNs(nsId string) (model.NsBundle, error) {
+	if _, err := GetNs(nsId); err != nil {
+		log.Error().Err(err).Msg("")
+		return model.NsBundle{}, err
+	}
+
+	nsKey := "/ns/" + nsId
+	nsInfo, _, err := kvstore.GetKv(nsKey)
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return model.NsBundle{}, err
+	}
+	kvs, err := kvstore.GetKvList(nsKey + "/")
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return model.NsBundle{}, err
+	}
+
+	bundle := model.NsBundle{
+		FormatVersion: model.NsBundleFormatVersion,
+		NsId:          nsId,
+		ExportedAt:    time.Now().UTC().Format(time.RFC3339),
+		Entries:       make([]model.NsBundleEntry, 0, len(kvs)+1),
+		Labels:        []model.NsBundleEntry{},
+	}
+	bundle.Entries = append(bundle.Entries, model.NsBundleEntry{Key: nsInfo.Key, Value: nsInfo.Value})
+	for _, kv := range kvs {
+		bundle.Entries = append(bundle.Entries, redactBundleEntry(nsKey, model.NsBundleEntry{Key: kv.Key, Value: kv.Value}))
+	}
+
+	// Labels are keyed by object uid, not by namespace, so pick the ones whose
+	// object belongs to this namespace.
+	labelKvs, err := kvstore.GetKvList(labelKeyPrefix)
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return model.NsBundle{}, err
+	}
+	for _, kv := range labelKvs {
+		var labelInfo model.LabelInfo
+		if err := json.Unmarshal([]byte(kv.Value), &labelInfo); err != nil {
+			continue
+		}
+		if LabelBelongsToNs(labelInfo, nsId) {
+			bundle.Labels = append(bundle.Labels, model.NsBundleEntry{Key: kv.Key, Value: kv.Value})
+		}
+	}
+
+	log.Info().Msgf("exported namespace %s (%d entries, %d labels)", nsId, len(bundle.Entries), len(bundle.Labels))
+	return bundle, nil
+}
+
+// ImportNs re-creates a namespace from a bundle produced by ExportNs.
+// The bundle is fully validated before anything is written: the namespace must not
+// exist yet and every connection config it references must exist on this server.
+// Import is metadata-only: the records and labels are stored as-is in one transaction,
+// which fails if any of their keys exists, and CB-Spider is never called. The imported
+// objects are controllable once the CSP resources they describe are registered with the
+// CB-Spider of this server under the same connection configs.
+func ImportNs(ctx context.Context, bundle *model.NsBundle) (model.NsImportResult, error) {
+	connectionNames, err := validateNsBundle(bundle)
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return model.NsImportResult{}, err
+	}
+
+	records := slices.Concat(bundle.Entries, bundle.Labels)
+	compares := make([]kvstore.Compare, 0, len(records))
+	ops := make([]kvstore.Op, 0, len(records))
+	for _, entry := range records {
+		compares = append(compares, kvstore.Compare{Key: entry.Key, ModRevision: 0})
+		ops = append(ops, kvstore.PutOp(entry.Key, entry.Value))
+	}
+	if err := kvstore.Txn(ctx, compares, ops); err != nil {
+		if errors.Is(err, kvstore.ErrRevisionConflict) {
+			err = fmt.Errorf("keys of namespace %s or of its labels already exist on this server; delete them before importing", bundle.NsId)
+		}
+		log.Error().Err(err).Msgf("import of namespace %s failed", bundle.NsId)
+		return model.NsImportResult{}, err
+	}
+
+	result := model.NsImportResult{
+		NsId:            bundle.NsId,
+		ImportedEntries: len(bundle.Entries),
+		ImportedLabels:  len(bundle.Labels),
+		ConnectionNames: connectionNames,
+	}
+	log.Info().Msgf("imported namespace %s (%d entries, %d labels)",
+		bundle.NsId, result.ImportedEntries, result.ImportedLabels)
+	return result, nil
+}
+
+// LabelBelongsToNs reports whether a label record is attached to an object of the
+// namespace. Labels are keyed by object uid, so this is decided by the resource key
+// and the sys.namespace label.
+func LabelBelongsToNs(labelInfo model.LabelInfo, nsId string) bool {
+	nsKey := "/ns/" + nsId
+	return labelInfo.ResourceKey == nsKey || strings.HasPrefix(labelInfo.ResourceKey, nsKey+"/") ||
+		labelInfo.Labels[model.LabelNamespace] == nsId
+}
+
+// validateNsBundle checks the bundle format and that it can be applied on this server.
+// It returns the connection config names referenced by the bundle.
+func validateNsBundle(bundle *model.NsBundle) ([]string, error) {
+	if bundle == nil {
+		return nil, fmt.Errorf("namespace bundle is empty")
+	}
+	if bundle.FormatVersion < 1 || bundle.FormatVersion > model.NsBundleFormatVersion {
+		return nil, fmt.Errorf("unsupported namespace bundle format version %d (supported: 1-%d)",
+			bundle.FormatVersion, model.NsBundleFormatVersion)
+	}
+	if err := CheckString(bundle.NsId); err != nil {
+		return nil, err
+	}
+	exists, err := CheckNs(bundle.NsId)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, fmt.Errorf("the namespace %s already exists; delete it before importing", bundle.NsId)
+	}
+
+	nsKey := "/ns/" + bundle.NsId
+	hasNsKey := false
+	connectionSet := make(map[string]string) // connection name -> first key referencing it
+	seenKeys := make(map[string]bool, len(bundle.Entries)+len(bundle.Labels))
+	for _, entry := range slices.Concat(bundle.Entries, bundle.Labels) {
+		if seenKeys[entry.Key] {
+			return nil, fmt.Errorf("bundle key %s appears more than once", entry.Key)
+		}
+		seenKeys[entry.Key] = true
+	}
+	for _, entry := range bundle.Entries {
+		if entry.Key == nsKey {
+			hasNsKey = true
+		} else if !strings.HasPrefix(entry.Key, nsKey+"/") {
+			return nil, fmt.Errorf("bundle entry %s is outside of namespace %s", entry.Key, bundle.NsId)
+		}
+		if !json.Valid([]byte(entry.Value)) || !gjson.Parse(entry.Value).IsObject() {
+			return nil, fmt.Errorf("bundle entry %s does not hold a JSON object", entry.Key)
+		}
+		var ref struct {
+			ConnectionName string `json:"connectionName"`
+			SchemaVersion  int    `json:"schemaVersion"`
+		}
+		json.Unmarshal([]byte(entry.Value), &ref)
+		if ref.SchemaVersion > migration.CurrentVersion() {
+			return nil, fmt.Errorf("bundle entry %s has schema version %d, newer than this server supports (%d)",
+				entry.Key, ref.SchemaVersion, migration.CurrentVersion())
+		}
+		if _, seen := connectionSet[ref.ConnectionName]; ref.ConnectionName != "" && !seen {
+			connectionSet[ref.ConnectionName] = entry.Key
+		}
+	}
+	if !hasNsKey {
+		return nil, fmt.Errorf("bundle does not contain the namespace record %s", nsKey)
+	}
+
+	for _, entry := range bundle.Labels {
+		labelType, uid, ok := strings.Cut(strings.TrimPrefix(entry.Key, labelKeyPrefix), "/")
+		if !strings.HasPrefix(entry.Key, labelKeyPrefix) || !ok || labelType == "" || uid == "" {
+			return nil, fmt.Errorf("bundle label %s is not a label key", entry.Key)
+		}
+		var labelInfo model.LabelInfo
+		if err := json.Unmarshal([]byte(entry.Value), &labelInfo); err != nil {
+			return nil, fmt.Errorf("bundle label %s is malformed: %w", entry.Key, err)
+		}
+		if name := labelInfo.Labels[model.LabelConnectionName]; name != "" {
+			if _, seen := connectionSet[name]; !seen {
+				connectionSet[name] = entry.Key
+			}
+		}
+	}
+
+	connectionNames := make([]string, 0, len(connectionSet))
+	var missing []string
+	for name, key := range connectionSet {
+		connectionNames = append(connectionNames, name)
+		if _, err := GetConnConfig(name); err != nil {
+			missing = append(missing, fmt.Sprintf("%s (referenced by %s)", name, key))
+		}
+	}
+	sort.Strings(connectionNames)
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return nil, fmt.Errorf("connection configs required by the bundle do not exist on this server: %s",
+			strings.Join(missing, ", "))
+	}
+	return connectionNames, nil
+}
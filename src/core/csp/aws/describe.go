@@ -0,0 +1,97 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aws
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/cloud-barista/cb-tumblebug/src/core/csp"
+	csptypes "github.com/cloud-barista/cb-tumblebug/src/core/model/csp"
+	"github.com/rs/zerolog/log"
+)
+
+func init() {
+	csp.RegisterBatchVMDescribeHandler(csptypes.AWS, BatchDescribeInstances)
+}
+
+// BatchDescribeInstances queries EC2 DescribeInstances for the given AWS instance IDs and
+// returns the configuration of each instance. The root volume is not counted as a data disk.
+// Instance IDs not found in AWS are omitted from the returned map.
+func BatchDescribeInstances(ctx context.Context, region string, instanceIds []string) (map[string]csp.VMDescription, error) {
+	if len(instanceIds) == 0 {
+		return map[string]csp.VMDescription{}, nil
+	}
+
+	accessKey, secretKey, err := getAWSCreds(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("AWS describe: cannot get credentials: %w", err)
+	}
+
+	client := ec2.NewFromConfig(newConfig(region, accessKey, secretKey))
+
+	result := make(map[string]csp.VMDescription, len(instanceIds))
+
+	for i := 0; i < len(instanceIds); i += describeInstancesBatchSize {
+		end := min(i+describeInstancesBatchSize, len(instanceIds))
+		batch := instanceIds[i:end]
+
+		// Filter by instance-id for the same reason as BatchDescribeInstanceStatuses
+		out, err := client.DescribeInstances(ctx, &ec2.DescribeInstancesInput{
+			Filters: []ec2types.Filter{{Name: aws.String("instance-id"), Values: batch}},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("DescribeInstances failed (region=%s, ids=%d): %w", region, len(batch), err)
+		}
+
+		for _, reservation := range out.Reservations {
+			for _, instance := range reservation.Instances {
+				if instance.InstanceId == nil {
+					continue
+				}
+				desc := csp.VMDescription{
+					SpecName: string(instance.InstanceType),
+					ImageId:  aws.ToString(instance.ImageId),
+					PublicIP: aws.ToString(instance.PublicIpAddress),
+					Tags:     make(map[string]string, len(instance.Tags)),
+				}
+				for _, sg := range instance.SecurityGroups {
+					desc.SecurityGroupIds = append(desc.SecurityGroupIds, aws.ToString(sg.GroupId))
+				}
+				rootDevice := aws.ToString(instance.RootDeviceName)
+				for _, mapping := range instance.BlockDeviceMappings {
+					if mapping.Ebs == nil || aws.ToString(mapping.DeviceName) == rootDevice {
+						continue
+					}
+					desc.DataDiskIds = append(desc.DataDiskIds, aws.ToString(mapping.Ebs.VolumeId))
+				}
+				for _, tag := range instance.Tags {
+					desc.Tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+				}
+				result[*instance.InstanceId] = desc
+			}
+		}
+	}
+
+	log.Trace().
+		Str("region", region).
+		Int("queried", len(instanceIds)).
+		Int("found", len(result)).
+		Msg("[AWS] BatchDescribeInstances completed")
+
+	return result, nil
+}
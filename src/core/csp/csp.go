@@ -119,6 +119,43 @@ func GetBatchVMControlHandler(provider, action string) (BatchVMControlFunc, bool
 	}
 }
 
+// VMDescription is the configuration of a VM as reported by the CSP, used for drift detection.
+// Ids are CSP-native (e.g., "sg-0abc", "vol-0abc"); Tags holds the CSP tags of the VM.
+type VMDescription struct {
+	SpecName         string
+	ImageId          string
+	SecurityGroupIds []string
+	DataDiskIds      []string
+	PublicIP         string
+	Tags             map[string]string
+}
+
+// BatchVMDescribeFunc queries a CSP directly for the configuration of the given VMs.
+// ctx, region and instanceIds are as in BatchVMStatusFunc. Returns a map of
+// CspResourceId → VMDescription; missing keys mean the instance was not found.
+type BatchVMDescribeFunc func(ctx context.Context, region string, instanceIds []string) (map[string]VMDescription, error)
+
+var (
+	batchVMDescribeMu       sync.RWMutex
+	batchVMDescribeHandlers = make(map[string]BatchVMDescribeFunc)
+)
+
+// RegisterBatchVMDescribeHandler registers a direct-SDK batch VM describe function for a CSP.
+// Each CSP package calls this from its init() function.
+func RegisterBatchVMDescribeHandler(provider string, fn BatchVMDescribeFunc) {
+	batchVMDescribeMu.Lock()
+	defer batchVMDescribeMu.Unlock()
+	batchVMDescribeHandlers[strings.ToLower(provider)] = fn
+}
+
+// GetBatchVMDescribeHandler returns the registered BatchVMDescribeFunc for the given provider.
+func GetBatchVMDescribeHandler(provider string) (BatchVMDescribeFunc, bool) {
+	batchVMDescribeMu.RLock()
+	defer batchVMDescribeMu.RUnlock()
+	fn, ok := batchVMDescribeHandlers[strings.ToLower(provider)]
+	return fn, ok
+}
+
 // credentialKeyMap maps each CSP's YAML credential keys to the environment variable
 // names expected by OpenTofu providers and cb-tumblebug's runtime credential lookup.
 // Must stay in sync with init/openbao/openbao-register-creds.py KEY_MAP.
@@ -289,20 +326,29 @@ func BuildSecretPathForHolder(holder, provider string) string {
 	return fmt.Sprintf("secret/data/users/%s/csp/%s", holder, provider)
 }
 
-// WriteOpenBaoSecret writes key-value data to OpenBao at the given KV v2 path (upsert).
-// ctx allows request-scoped cancellation and timeout, consistent with ReadOpenBaoSecret.
-func WriteOpenBaoSecret(ctx context.Context, path string, data map[string]any) error {
+// NewOpenBaoClient returns an OpenBao client for VAULT_ADDR authenticated with VAULT_TOKEN.
+func NewOpenBaoClient() (*api.Client, error) {
 	if model.VaultToken == "" {
-		return fmt.Errorf("VAULT_TOKEN is not set")
+		return nil, fmt.Errorf("VAULT_TOKEN is not set")
 	}
 
 	vaultConfig := api.DefaultConfig()
 	vaultConfig.Address = model.VaultAddr
 	client, err := api.NewClient(vaultConfig)
 	if err != nil {
-		return fmt.Errorf("failed to create OpenBao client: %w", err)
+		return nil, fmt.Errorf("failed to create OpenBao client: %w", err)
 	}
 	client.SetToken(model.VaultToken)
+	return client, nil
+}
+
+// WriteOpenBaoSecret writes key-value data to OpenBao at the given KV v2 path (upsert).
+// ctx allows request-scoped cancellation and timeout, consistent with ReadOpenBaoSecret.
+func WriteOpenBaoSecret(ctx context.Context, path string, data map[string]any) error {
+	client, err := NewOpenBaoClient()
+	if err != nil {
+		return err
+	}
 
 	_, err = client.Logical().WriteWithContext(ctx, path, map[string]any{
 		"data": data,
@@ -318,17 +364,10 @@ func WriteOpenBaoSecret(ctx context.Context, path string, data map[string]any) e
 // side, so it can never overwrite a real credential written concurrently.
 // Returns created=false with a nil error when the secret already exists.
 func WriteOpenBaoSecretIfAbsent(ctx context.Context, path string, data map[string]any) (created bool, err error) {
-	if model.VaultToken == "" {
-		return false, fmt.Errorf("VAULT_TOKEN is not set")
-	}
-
-	vaultConfig := api.DefaultConfig()
-	vaultConfig.Address = model.VaultAddr
-	client, err := api.NewClient(vaultConfig)
+	client, err := NewOpenBaoClient()
 	if err != nil {
-		return false, fmt.Errorf("failed to create OpenBao client: %w", err)
+		return false, err
 	}
-	client.SetToken(model.VaultToken)
 
 	_, err = client.Logical().WriteWithContext(ctx, path, map[string]any{
 		"data":    data,
@@ -411,17 +450,10 @@ func EnsurePlaceholderCredentialSecrets(ctx context.Context) {
 // It validates that VaultToken is set and the secret exists.
 // A context is used for request-scoped cancellation and timeout.
 func ReadOpenBaoSecret(ctx context.Context, path string) (map[string]any, error) {
-	if model.VaultToken == "" {
-		return nil, fmt.Errorf("VAULT_TOKEN is not set")
-	}
-
-	vaultConfig := api.DefaultConfig()
-	vaultConfig.Address = model.VaultAddr
-	client, err := api.NewClient(vaultConfig)
+	client, err := NewOpenBaoClient()
 	if err != nil {
-		return nil, fmt.Errorf("failed to create OpenBao client: %w", err)
+		return nil, err
 	}
-	client.SetToken(model.VaultToken)
 
 	secret, err := client.Logical().ReadWithContext(ctx, path)
 	if err != nil {
@@ -0,0 +1,94 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package csp
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// OpenBaoTransitKeyWrapper wraps kvstore data keys with a key of the OpenBao transit
+// secrets engine, so the master key never leaves OpenBao. Rotating the transit key
+// (bao write -f transit/keys/{name}/rotate) and then rotating the kvstore encryption
+// re-wraps every data key with the latest transit key version.
+type OpenBaoTransitKeyWrapper struct {
+	mount   string
+	keyName string
+}
+
+// NewOpenBaoTransitKeyWrapper returns a wrapper for the transit key keyName mounted at mount
+// (e.g., "transit"). The transit engine and the key must exist.
+func NewOpenBaoTransitKeyWrapper(ctx context.Context, mount, keyName string) (*OpenBaoTransitKeyWrapper, error) {
+	w := &OpenBaoTransitKeyWrapper{mount: strings.Trim(mount, "/"), keyName: keyName}
+	client, err := NewOpenBaoClient()
+	if err != nil {
+		return nil, err
+	}
+	secret, err := client.Logical().ReadWithContext(ctx, w.mount+"/keys/"+w.keyName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read OpenBao transit key %s: %w", w.Name(), err)
+	}
+	if secret == nil {
+		return nil, fmt.Errorf("OpenBao transit key %s does not exist (create it with: bao write -f %s/keys/%s)",
+			w.Name(), w.mount, w.keyName)
+	}
+	return w, nil
+}
+
+// Name identifies the transit key.
+func (w *OpenBaoTransitKeyWrapper) Name() string {
+	return "openbao-transit:" + w.mount + "/" + w.keyName
+}
+
+// WrapKey encrypts dataKey with the latest version of the transit key.
+func (w *OpenBaoTransitKeyWrapper) WrapKey(ctx context.Context, dataKey []byte) (string, error) {
+	client, err := NewOpenBaoClient()
+	if err != nil {
+		return "", err
+	}
+	secret, err := client.Logical().WriteWithContext(ctx, w.mount+"/encrypt/"+w.keyName, map[string]any{
+		"plaintext": base64.StdEncoding.EncodeToString(dataKey),
+	})
+	if err != nil {
+		return "", fmt.Errorf("OpenBao transit encrypt failed: %w", err)
+	}
+	if secret == nil {
+		return "", fmt.Errorf("OpenBao transit encrypt returned no data")
+	}
+	ciphertext := GetString(secret.Data, "ciphertext")
+	if ciphertext == "" {
+		return "", fmt.Errorf("OpenBao transit encrypt returned no ciphertext")
+	}
+	return ciphertext, nil
+}
+
+// UnwrapKey decrypts a data key wrapped by any version of the transit key.
+func (w *OpenBaoTransitKeyWrapper) UnwrapKey(ctx context.Context, wrapped string) ([]byte, error) {
+	client, err := NewOpenBaoClient()
+	if err != nil {
+		return nil, err
+	}
+	secret, err := client.Logical().WriteWithContext(ctx, w.mount+"/decrypt/"+w.keyName, map[string]any{
+		"ciphertext": wrapped,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("OpenBao transit decrypt failed: %w", err)
+	}
+	if secret == nil {
+		return nil, fmt.Errorf("OpenBao transit decrypt returned no data")
+	}
+	return base64.StdEncoding.DecodeString(GetString(secret.Data, "plaintext"))
+}
@@ -0,0 +1,559 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package infra is to manage multi-cloud infra
+package infra
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/cloud-barista/cb-tumblebug/src/core/common"
+	"github.com/cloud-barista/cb-tumblebug/src/core/common/label"
+	"github.com/cloud-barista/cb-tumblebug/src/core/model"
+	"github.com/cloud-barista/cb-tumblebug/src/core/resource"
+	"github.com/rs/zerolog/log"
+)
+
+// infraApplyLocks serializes applies per Infra so two pipelines cannot execute
+// plans computed from the same state at the same time.
+var infraApplyLocks sync.Map
+
+// ApplyInfraDynamic brings the Infra named req.Name to the desired state req.
+//
+// The desired state is compared with GetInfraInfo per NodeGroup (matched by name):
+// missing NodeGroups are created, NodeGroups that are not in req are deleted, the
+// size of the others is reconciled, and Nodes whose spec, image, connection or zone
+// differ from req are replaced (the replacement is created before the Node is deleted).
+// Labels in req are added or updated; other labels are kept because CSP tags are
+// merged into the same label set. The SecurityGroup rules of a NodeGroup are
+// reconciled with its SecurityGroup template only when req names a template.
+//
+// In plan mode nothing is changed. In apply mode the plan is executed and a failed
+// step does not stop the others; failures are listed in the returned plan.
+func ApplyInfraDynamic(ctx context.Context, nsId string, infraId string, req *model.InfraDynamicReq, mode string) (*model.InfraApplyPlan, error) {
+	if mode == "" {
+		mode = model.InfraApplyModePlan
+	}
+	if mode != model.InfraApplyModePlan && mode != model.InfraApplyModeApply {
+		return nil, fmt.Errorf("invalid mode %q (use %s or %s)", mode, model.InfraApplyModePlan, model.InfraApplyModeApply)
+	}
+	if err := common.CheckString(nsId); err != nil {
+		return nil, err
+	}
+	if req.Name == "" {
+		req.Name = infraId
+	}
+	if req.Name != infraId {
+		return nil, fmt.Errorf("the name of the desired state (%s) does not match the Infra %s", req.Name, infraId)
+	}
+	if err := common.CheckString(infraId); err != nil {
+		return nil, err
+	}
+	if len(req.NodeGroups) == 0 {
+		return nil, fmt.Errorf("the desired state of Infra %s has no NodeGroup; delete the Infra instead", infraId)
+	}
+	seen := make(map[string]bool)
+	for i := range req.NodeGroups {
+		name := common.ToLower(req.NodeGroups[i].Name)
+		if name == "" {
+			return nil, fmt.Errorf("NodeGroup #%d of the desired state has no name", i)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("NodeGroup %s appears more than once in the desired state", name)
+		}
+		seen[name] = true
+	}
+
+	mutex, _ := infraApplyLocks.LoadOrStore(nsId+"/"+infraId, &sync.Mutex{})
+	mutex.(*sync.Mutex).Lock()
+	defer mutex.(*sync.Mutex).Unlock()
+
+	plan, current, err := planInfraApply(nsId, infraId, req)
+	if err != nil {
+		return nil, err
+	}
+	plan.Mode = mode
+	if mode == model.InfraApplyModePlan || plan.NoChange {
+		return plan, nil
+	}
+
+	log.Info().Msgf("Applying the desired state of Infra %s/%s", nsId, infraId)
+	if plan.CreateInfra {
+		infraInfo, err := CreateInfraDynamic(ctx, nsId, req, "")
+		if err != nil {
+			plan.Errors = append(plan.Errors, fmt.Sprintf("create Infra: %v", err))
+		}
+		plan.Infra = infraInfo
+		return plan, nil
+	}
+
+	executeInfraApplyPlan(ctx, nsId, infraId, req, plan, current)
+
+	infraInfo, err := GetInfraInfo(nsId, infraId)
+	if err != nil {
+		plan.Errors = append(plan.Errors, fmt.Sprintf("read the applied Infra: %v", err))
+	} else {
+		plan.Infra = infraInfo
+	}
+	if len(plan.Errors) > 0 {
+		log.Warn().Msgf("Applied the desired state of Infra %s/%s with %d error(s)", nsId, infraId, len(plan.Errors))
+	}
+	return plan, nil
+}
+
+// planInfraApply compares the Infra with req. It also returns the current Nodes by
+// NodeGroup, which the execution needs for labels.
+func planInfraApply(nsId string, infraId string, req *model.InfraDynamicReq) (*model.InfraApplyPlan, map[string][]model.NodeInfo, error) {
+	plan := &model.InfraApplyPlan{InfraId: infraId, NodeGroups: []model.NodeGroupApplyPlan{}}
+
+	exists, err := CheckInfra(nsId, infraId)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !exists {
+		plan.CreateInfra = true
+		for _, ng := range req.NodeGroups {
+			plan.NodeGroups = append(plan.NodeGroups, model.NodeGroupApplyPlan{
+				Name:        common.ToLower(ng.Name),
+				Action:      model.NodeGroupApplyCreate,
+				DesiredSize: desiredNodeGroupSize(ng),
+				NodesToAdd:  desiredNodeGroupSize(ng),
+			})
+		}
+		return plan, nil, nil
+	}
+
+	infraInfo, err := GetInfraInfo(nsId, infraId)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	current := make(map[string][]model.NodeInfo)
+	for _, node := range infraInfo.Node {
+		groupId := node.NodeGroupId
+		if groupId == "" {
+			groupId = node.Id
+		}
+		current[groupId] = append(current[groupId], node)
+	}
+
+	plan.LabelsToSet = labelsToSet(infraInfo.Label, req.Label)
+
+	desiredNames := make(map[string]bool)
+	for _, ng := range req.NodeGroups {
+		name := common.ToLower(ng.Name)
+		desiredNames[name] = true
+
+		nodes, ok := current[name]
+		if !ok {
+			plan.NodeGroups = append(plan.NodeGroups, model.NodeGroupApplyPlan{
+				Name:        name,
+				Action:      model.NodeGroupApplyCreate,
+				DesiredSize: desiredNodeGroupSize(ng),
+				NodesToAdd:  desiredNodeGroupSize(ng),
+			})
+			continue
+		}
+		ngPlan := planNodeGroupApply(name, nodes, ng)
+
+		// SecurityGroup rules are only compared against an explicitly named template:
+		// rules opened later on the NodeGroup SecurityGroup are otherwise kept
+		sgTemplateId := ng.SgTemplateId
+		if sgTemplateId == "" {
+			sgTemplateId = req.SgTemplateId
+		}
+		if sgTemplateId != "" {
+			sgId := infraId + "-" + name
+			toAdd, toDelete, warning := planSecurityGroupRules(nsId, sgId, sgTemplateId, nodes)
+			if warning != "" {
+				plan.Warnings = append(plan.Warnings, warning)
+			} else if len(toAdd) > 0 || len(toDelete) > 0 {
+				ngPlan.SecurityGroupId = sgId
+				ngPlan.FirewallRulesToAdd = toAdd
+				ngPlan.FirewallRulesToDelete = toDelete
+				ngPlan.Action = model.NodeGroupApplyUpdate
+			}
+		}
+		plan.NodeGroups = append(plan.NodeGroups, ngPlan)
+	}
+
+	var removedGroups []string
+	for groupId := range current {
+		if !desiredNames[groupId] {
+			removedGroups = append(removedGroups, groupId)
+		}
+	}
+	sort.Strings(removedGroups)
+	for _, groupId := range removedGroups {
+		ngPlan := model.NodeGroupApplyPlan{
+			Name:        groupId,
+			Action:      model.NodeGroupApplyDelete,
+			CurrentSize: len(current[groupId]),
+		}
+		for _, node := range current[groupId] {
+			ngPlan.NodesToRemove = append(ngPlan.NodesToRemove, node.Id)
+		}
+		plan.NodeGroups = append(plan.NodeGroups, ngPlan)
+	}
+
+	plan.NoChange = len(plan.LabelsToSet) == 0
+	for _, ngPlan := range plan.NodeGroups {
+		if ngPlan.Action != model.NodeGroupApplyNone {
+			plan.NoChange = false
+		}
+	}
+	return plan, current, nil
+}
+
+// planNodeGroupApply compares the Nodes of an existing NodeGroup with its desired state.
+func planNodeGroupApply(name string, nodes []model.NodeInfo, desired model.CreateNodeGroupDynamicReq) model.NodeGroupApplyPlan {
+	ngPlan := model.NodeGroupApplyPlan{
+		Name:        name,
+		Action:      model.NodeGroupApplyNone,
+		CurrentSize: len(nodes),
+		DesiredSize: desiredNodeGroupSize(desired),
+	}
+
+	// Nodes that are removed first come last: failed Nodes, then the newest
+	sorted := append([]model.NodeInfo{}, nodes...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		iFailed, jFailed := sorted[i].Status == model.StatusFailed, sorted[j].Status == model.StatusFailed
+		if iFailed != jFailed {
+			return jFailed
+		}
+		return nodeIndex(name, sorted[i].Id) < nodeIndex(name, sorted[j].Id)
+	})
+
+	var matching []model.NodeInfo
+	var outdated []model.NodeInfo
+	reasons := make(map[string]string)
+	for _, node := range sorted {
+		if reason := nodeReplaceReason(node, desired); reason != "" {
+			outdated = append(outdated, node)
+			reasons[node.Id] = reason
+		} else {
+			matching = append(matching, node)
+		}
+	}
+
+	keep := min(len(matching), ngPlan.DesiredSize)
+	for _, node := range matching[keep:] {
+		ngPlan.NodesToRemove = append(ngPlan.NodesToRemove, node.Id)
+	}
+	missing := ngPlan.DesiredSize - keep
+	replace := min(len(outdated), missing)
+	for _, node := range outdated[:replace] {
+		ngPlan.NodesToReplace = append(ngPlan.NodesToReplace, node.Id)
+	}
+	if replace > 0 {
+		ngPlan.ReplaceReasons = make(map[string]string)
+		for _, nodeId := range ngPlan.NodesToReplace {
+			ngPlan.ReplaceReasons[nodeId] = reasons[nodeId]
+		}
+	}
+	for _, node := range outdated[replace:] {
+		ngPlan.NodesToRemove = append(ngPlan.NodesToRemove, node.Id)
+	}
+	ngPlan.NodesToAdd = missing - replace
+
+	// Labels are compared on the Nodes that remain; new Nodes get them at creation
+	labels := make(map[string]string)
+	for _, node := range matching[:keep] {
+		for k, v := range labelsToSet(node.Label, desired.Label) {
+			labels[k] = v
+		}
+	}
+	if len(labels) > 0 {
+		ngPlan.LabelsToSet = labels
+	}
+
+	if ngPlan.NodesToAdd > 0 || len(ngPlan.NodesToRemove) > 0 || len(ngPlan.NodesToReplace) > 0 || len(ngPlan.LabelsToSet) > 0 {
+		ngPlan.Action = model.NodeGroupApplyUpdate
+	}
+	return ngPlan
+}
+
+// nodeReplaceReason tells why node no longer matches desired, or returns "" if it does.
+// Fields that are empty in desired are not compared.
+func nodeReplaceReason(node model.NodeInfo, desired model.CreateNodeGroupDynamicReq) string {
+	var reasons []string
+	if desired.SpecId != "" && !strings.EqualFold(node.SpecId, desired.SpecId) {
+		reasons = append(reasons, fmt.Sprintf("spec %s -> %s", node.SpecId, desired.SpecId))
+	}
+	if desired.ImageId != "" && !strings.EqualFold(node.ImageId, desired.ImageId) && !strings.EqualFold(node.CspImageName, desired.ImageId) {
+		reasons = append(reasons, fmt.Sprintf("image %s -> %s", node.ImageId, desired.ImageId))
+	}
+	if desired.ConnectionName != "" && node.ConnectionName != desired.ConnectionName {
+		reasons = append(reasons, fmt.Sprintf("connection %s -> %s", node.ConnectionName, desired.ConnectionName))
+	}
+	if desired.Zone != "" && node.Region.Zone != desired.Zone {
+		reasons = append(reasons, fmt.Sprintf("zone %s -> %s", node.Region.Zone, desired.Zone))
+	}
+	return strings.Join(reasons, ", ")
+}
+
+// planSecurityGroupRules compares the rules of the NodeGroup SecurityGroup with the
+// SecurityGroup template. A non-empty warning means the rules could not be compared.
+func planSecurityGroupRules(nsId string, sgId string, templateId string, nodes []model.NodeInfo) (toAdd, toDelete []model.FirewallRuleInfo, warning string) {
+	inUse := false
+	for _, node := range nodes {
+		if contains(node.SecurityGroupIds, sgId) {
+			inUse = true
+			break
+		}
+	}
+	if !inUse {
+		return nil, nil, fmt.Sprintf("SecurityGroup %s is not used by the NodeGroup; its rules are not reconciled", sgId)
+	}
+
+	template, err := common.GetSecurityGroupTemplate(nsId, templateId)
+	if err != nil && nsId != model.SystemCommonNs {
+		template, err = common.GetSecurityGroupTemplate(model.SystemCommonNs, templateId)
+	}
+	if err != nil {
+		return nil, nil, fmt.Sprintf("SecurityGroup template %s not found; rules of %s are not reconciled", templateId, sgId)
+	}
+
+	var rules []model.FirewallRuleReq
+	if template.SecurityGroupReq.FirewallRules != nil {
+		internalCidr := ""
+		for _, rule := range *template.SecurityGroupReq.FirewallRules {
+			if strings.EqualFold(rule.CIDR, model.FirewallCidrKeywordInternal) {
+				if internalCidr == "" {
+					internalCidr = securityGroupVNetCidr(nsId, sgId)
+				}
+				if internalCidr == "" {
+					return nil, nil, fmt.Sprintf("cannot resolve the %q CIDR of template %s for %s; its rules are not reconciled",
+						model.FirewallCidrKeywordInternal, templateId, sgId)
+				}
+				rule.CIDR = internalCidr
+			}
+			rules = append(rules, rule)
+		}
+	}
+
+	toAdd, toDelete, err = resource.DiffFirewallRules(nsId, sgId, rules)
+	if err != nil {
+		return nil, nil, fmt.Sprintf("cannot read SecurityGroup %s: %v", sgId, err)
+	}
+	return toAdd, toDelete, ""
+}
+
+// securityGroupVNetCidr returns the CIDR block of the VNet of the SecurityGroup, or ""
+// if the VNet has none (e.g., GCP).
+func securityGroupVNetCidr(nsId string, sgId string) string {
+	sg, err := resource.GetSecurityGroup(nsId, sgId)
+	if err != nil {
+		return ""
+	}
+	vNet, err := resource.GetVNet(nsId, sg.VNetId)
+	if err != nil {
+		return ""
+	}
+	if _, _, err := net.ParseCIDR(vNet.CidrBlock); err != nil {
+		return ""
+	}
+	return vNet.CidrBlock
+}
+
+// executeInfraApplyPlan executes the plan of an existing Infra.
+func executeInfraApplyPlan(ctx context.Context, nsId string, infraId string, req *model.InfraDynamicReq, plan *model.InfraApplyPlan, current map[string][]model.NodeInfo) {
+	addError := func(format string, args ...any) {
+		msg := fmt.Sprintf(format, args...)
+		log.Error().Msgf("Infra apply %s/%s: %s", nsId, infraId, msg)
+		plan.Errors = append(plan.Errors, msg)
+	}
+
+	desired := make(map[string]model.CreateNodeGroupDynamicReq)
+	for _, ng := range req.NodeGroups {
+		// Infra-level templates apply to NodeGroups without their own, as in CreateInfraDynamic
+		if ng.VNetTemplateId == "" {
+			ng.VNetTemplateId = req.VNetTemplateId
+		}
+		if ng.SgTemplateId == "" {
+			ng.SgTemplateId = req.SgTemplateId
+		}
+		desired[common.ToLower(ng.Name)] = ng
+	}
+
+	for _, ngPlan := range plan.NodeGroups {
+		switch ngPlan.Action {
+		case model.NodeGroupApplyCreate:
+			addReq := &model.AddNodeGroupDynamicReq{CreateNodeGroupDynamicReq: desired[ngPlan.Name]}
+			if _, err := CreateInfraNodeGroupDynamic(ctx, nsId, infraId, addReq); err != nil {
+				addError("create NodeGroup %s: %v", ngPlan.Name, err)
+			}
+
+		case model.NodeGroupApplyUpdate:
+			created := true
+			if count := ngPlan.NodesToAdd + len(ngPlan.NodesToReplace); count > 0 {
+				ngReq := desired[ngPlan.Name]
+				ngReq.NodeGroupSize = count
+				if err := addNodesToNodeGroup(ctx, nsId, infraId, &ngReq); err != nil {
+					addError("add %d Node(s) to NodeGroup %s: %v", count, ngPlan.Name, err)
+					created = false
+				}
+			}
+			// Replaced Nodes are only deleted once their replacements exist
+			toDelete := append([]string{}, ngPlan.NodesToRemove...)
+			if created {
+				toDelete = append(toDelete, ngPlan.NodesToReplace...)
+			}
+			for _, nodeId := range toDelete {
+				if err := DelInfraNode(nsId, infraId, nodeId, ""); err != nil {
+					addError("delete Node %s: %v", nodeId, err)
+				}
+			}
+			if len(ngPlan.LabelsToSet) > 0 {
+				for _, node := range current[ngPlan.Name] {
+					if contains(toDelete, node.Id) {
+						continue
+					}
+					nodeKey := common.GenInfraKey(nsId, infraId, node.Id)
+					if err := label.CreateOrUpdateLabel(ctx, model.StrNode, node.Uid, nodeKey, ngPlan.LabelsToSet); err != nil {
+						addError("set labels of Node %s: %v", node.Id, err)
+					}
+				}
+			}
+			// Rules are deleted first, as in UpdateFirewallRules, so a rule whose CIDR
+			// changed is not rejected as a duplicate of the old one
+			if len(ngPlan.FirewallRulesToDelete) > 0 {
+				if _, err := resource.DeleteFirewallRules(nsId, ngPlan.SecurityGroupId, ngPlan.FirewallRulesToDelete); err != nil {
+					addError("delete rules from SecurityGroup %s: %v", ngPlan.SecurityGroupId, err)
+				}
+			}
+			if len(ngPlan.FirewallRulesToAdd) > 0 {
+				if _, err := resource.CreateFirewallRules(nsId, ngPlan.SecurityGroupId, ngPlan.FirewallRulesToAdd, false); err != nil {
+					addError("add rules to SecurityGroup %s: %v", ngPlan.SecurityGroupId, err)
+				}
+			}
+
+		case model.NodeGroupApplyDelete:
+			for _, nodeId := range ngPlan.NodesToRemove {
+				if err := DelInfraNode(nsId, infraId, nodeId, ""); err != nil {
+					addError("delete Node %s: %v", nodeId, err)
+				}
+			}
+		}
+	}
+
+	if len(plan.LabelsToSet) > 0 {
+		infraObj, _, err := GetInfraObject(nsId, infraId)
+		if err != nil {
+			addError("set labels of Infra: %v", err)
+			return
+		}
+		infraKey := common.GenInfraKey(nsId, infraId, "")
+		if err := label.CreateOrUpdateLabel(ctx, model.StrInfra, infraObj.Uid, infraKey, plan.LabelsToSet); err != nil {
+			addError("set labels of Infra: %v", err)
+		}
+	}
+}
+
+// addNodesToNodeGroup creates req.NodeGroupSize Nodes with the configuration of req in
+// the existing NodeGroup req.Name. Unlike ScaleOutInfraNodeGroup, the configuration is
+// taken from the request instead of an existing Node. The new Nodes are bootstrapped
+// with the post commands the NodeGroup was created with, as in scaleOutNodeGroup.
+func addNodesToNodeGroup(ctx context.Context, nsId string, infraId string, req *model.CreateNodeGroupDynamicReq) error {
+	if err := checkCommonResAvailableForNodeGroupDynamicReq(ctx, req, nsId); err != nil {
+		return err
+	}
+	nodeReqResult, err := getNodeGroupReqFromDynamicReq(ctx, nsId, infraId, req)
+	if err != nil {
+		return err
+	}
+	nodeGroupId := nodeReqResult.VmReq.Name
+	before, err := ListNodeByNodeGroup(nsId, infraId, nodeGroupId)
+	if err != nil {
+		return err
+	}
+	if _, err := CreateInfraGroupNode(ctx, nsId, infraId, nodeReqResult.VmReq, true); err != nil {
+		return err
+	}
+	after, err := ListNodeByNodeGroup(nsId, infraId, nodeGroupId)
+	if err != nil {
+		return err
+	}
+
+	infraObj, _, err := GetInfraObject(nsId, infraId)
+	if err != nil {
+		return err
+	}
+	phases := nodeGroupPostCommands(infraObj, nodeGroupId)
+	if len(phases) == 0 {
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var failed []string
+	for _, id := range after {
+		if slices.Contains(before, id) {
+			continue
+		}
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			if err := runPostCommandsOnNode(nsId, infraId, id, phases); err != nil {
+				log.Warn().Err(err).Str("nodeId", id).Msg("Post commands failed on a Node added by Infra apply")
+				mu.Lock()
+				failed = append(failed, id)
+				mu.Unlock()
+			}
+		}(id)
+	}
+	wg.Wait()
+	if len(failed) > 0 {
+		return fmt.Errorf("post commands failed on %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// labelsToSet returns the labels of desired that are missing from or different in current.
+func labelsToSet(current map[string]string, desired map[string]string) map[string]string {
+	changed := make(map[string]string)
+	for k, v := range desired {
+		if strings.HasPrefix(k, model.LabelSystemPrefix) {
+			continue
+		}
+		if cur, ok := current[k]; !ok || cur != v {
+			changed[k] = v
+		}
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+	return changed
+}
+
+// desiredNodeGroupSize is the size CreateInfraGroupNode gives to the NodeGroup.
+func desiredNodeGroupSize(ng model.CreateNodeGroupDynamicReq) int {
+	return max(ng.NodeGroupSize, 1)
+}
+
+// nodeIndex returns the numeric suffix of a Node id ("g1-3" -> 3), or 0.
+func nodeIndex(nodeGroupId string, nodeId string) int {
+	suffix, found := strings.CutPrefix(nodeId, nodeGroupId+"-")
+	if !found {
+		return 0
+	}
+	index, _ := strconv.Atoi(suffix)
+	return index
+}
@@ -0,0 +1,558 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package infra is to manage multi-cloud infra
+package infra
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloud-barista/cb-tumblebug/src/core/common"
+	"github.com/cloud-barista/cb-tumblebug/src/core/model"
+	"github.com/cloud-barista/cb-tumblebug/src/core/resource"
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvstore"
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvutil"
+	"github.com/rs/zerolog/log"
+)
+
+// autoControlDecisionLogMax is the number of decisions kept per Infra policy.
+// Override with TB_AUTOCONTROL_DECISION_LOG_MAX.
+var autoControlDecisionLogMax = func() int {
+	if v, err := strconv.Atoi(os.Getenv("TB_AUTOCONTROL_DECISION_LOG_MAX")); err == nil && v > 0 {
+		return v
+	}
+	return 200
+}()
+
+// autoRule points at one metric rule of an AutoCondition, so that the primary rule
+// (the legacy fields of AutoCondition) and Rules are evaluated the same way
+type autoRule struct {
+	metric   string
+	operator string
+	operand  float64
+	period   int
+	history  *[]string
+}
+
+func autoConditionRules(cond *model.AutoCondition) []autoRule {
+	var rules []autoRule
+	if cond.Metric != "" {
+		rules = append(rules, autoRule{cond.Metric, cond.Operator, cond.Operand, cond.EvaluationPeriod, &cond.EvaluationValue})
+	}
+	for i := range cond.Rules {
+		r := &cond.Rules[i]
+		rules = append(rules, autoRule{r.Metric, r.Operator, r.Operand, r.EvaluationPeriod, &r.EvaluationValue})
+	}
+	return rules
+}
+
+// resetAutoConditionHistory drops the samples of all rules, so that the next decision
+// waits for a full evaluation period of fresh samples
+func resetAutoConditionHistory(cond *model.AutoCondition) {
+	for _, r := range autoConditionRules(cond) {
+		*r.history = nil
+	}
+}
+
+func compareAutoMetric(operator string, value float64, operand float64) (bool, error) {
+	switch operator {
+	case ">=":
+		return value >= operand, nil
+	case ">":
+		return value > operand, nil
+	case "<=":
+		return value <= operand, nil
+	case "<":
+		return value < operand, nil
+	}
+	return false, fmt.Errorf("not available operator %q", operator)
+}
+
+// validateInfraPolicy checks the condition and the action of a policy
+func validateInfraPolicy(p *model.Policy) error {
+	if p.Webhook.Enabled && len(p.Webhook.Secret) < autoWebhookMinSecretLen {
+		return fmt.Errorf("webhook.secret must have at least %d characters", autoWebhookMinSecretLen)
+	}
+	cond := &p.AutoCondition
+	rules := autoConditionRules(cond)
+	if len(rules) == 0 && !p.Webhook.Enabled {
+		return fmt.Errorf("autoCondition needs a metric or rules (or enable the webhook)")
+	}
+	for i, r := range rules {
+		if r.metric == "" {
+			return fmt.Errorf("rule %d: metric is required", i)
+		}
+		if _, err := compareAutoMetric(r.operator, 0, 0); err != nil {
+			return fmt.Errorf("rule %d: %w", i, err)
+		}
+		if r.period < 1 {
+			return fmt.Errorf("rule %d: evaluationPeriod must be 1 or more", i)
+		}
+	}
+	switch strings.ToLower(cond.Logic) {
+	case "", model.AutoLogicAnd, model.AutoLogicOr:
+	default:
+		return fmt.Errorf("logic must be %q or %q", model.AutoLogicAnd, model.AutoLogicOr)
+	}
+	metrics := make([]string, 0, len(rules))
+	for _, r := range rules {
+		metrics = append(metrics, r.metric)
+	}
+	if err := validateMetricSource(p.MetricSource, metrics); err != nil {
+		return fmt.Errorf("metricSource: %w", err)
+	}
+
+	act := &p.AutoAction
+	switch {
+	case strings.EqualFold(act.ActionType, model.AutoActionScaleOut), strings.EqualFold(act.ActionType, model.AutoActionScaleIn):
+	case strings.EqualFold(act.ActionType, model.AutoActionRunRunbook):
+		if act.RunbookId == "" {
+			return fmt.Errorf("runbookId is required for %s", model.AutoActionRunRunbook)
+		}
+	default:
+		return fmt.Errorf("actionType must be %s, %s or %s", model.AutoActionScaleOut, model.AutoActionScaleIn, model.AutoActionRunRunbook)
+	}
+	if act.Step < 0 || act.MinSize < 0 || act.MaxSize < 0 || act.CooldownSeconds < 0 {
+		return fmt.Errorf("step, minSize, maxSize and cooldownSeconds must not be negative")
+	}
+	if act.MaxSize > 0 && act.MinSize > act.MaxSize {
+		return fmt.Errorf("minSize (%d) must not exceed maxSize (%d)", act.MinSize, act.MaxSize)
+	}
+	switch act.VictimSelection {
+	case "", model.ScaleInVictimNewest, model.ScaleInVictimOldest, model.ScaleInVictimMostExpensive:
+	default:
+		return fmt.Errorf("victimSelection must be one of %s, %s, %s", model.ScaleInVictimNewest, model.ScaleInVictimOldest, model.ScaleInVictimMostExpensive)
+	}
+	return nil
+}
+
+// autoMetricAverage returns the average of a metric over the Nodes of an Infra that reported it.
+// Nodes that failed to report are skipped as long as one Node did.
+func autoMetricAverage(nsId string, infraId string, metric string, source model.MetricSourceConfig) (float64, error) {
+	content, err := GetMonitoringDataFromSource(nsId, infraId, metric, source)
+	if err != nil && len(content.InfraMonitoring) == 0 {
+		return 0, err
+	}
+	sum, count := 0.0, 0
+	for _, monData := range content.InfraMonitoring {
+		if monData.Err != "" {
+			continue
+		}
+		v, err := strconv.ParseFloat(monData.Value, 64)
+		if err != nil {
+			continue
+		}
+		sum += v
+		count++
+	}
+	if count == 0 {
+		return 0, fmt.Errorf("no Node of infra %s reported metric %s", infraId, metric)
+	}
+	return sum / float64(count), nil
+}
+
+// evaluateAutoCondition samples each rule of a condition, keeps the last EvaluationPeriod
+// samples of each rule, and combines the rule results. sufficient is false while any rule
+// needed for the result lacks samples.
+func evaluateAutoCondition(nsId string, infraId string, cond *model.AutoCondition, source model.MetricSourceConfig) (detected bool, sufficient bool, evals []model.AutoRuleEvaluation, err error) {
+	orLogic := strings.EqualFold(cond.Logic, model.AutoLogicOr)
+	sampled := map[string]float64{}
+	allSufficient := true
+	anyMatched, allMatched := false, true
+
+	for _, r := range autoConditionRules(cond) {
+		value, ok := sampled[r.metric]
+		if !ok {
+			value, err = autoMetricAverage(nsId, infraId, r.metric, source)
+			if err != nil {
+				return false, false, evals, err
+			}
+			sampled[r.metric] = value
+		}
+
+		history := append([]string{strconv.FormatFloat(value, 'f', 6, 64)}, *r.history...)
+		if len(history) > r.period {
+			history = history[:r.period]
+		}
+		*r.history = history
+
+		eval := model.AutoRuleEvaluation{
+			Metric:   r.metric,
+			Operator: r.operator,
+			Operand:  r.operand,
+			Value:    value,
+			Samples:  len(history),
+			Period:   r.period,
+		}
+		if len(history) >= r.period {
+			sum := 0.0
+			for _, h := range history {
+				f, _ := strconv.ParseFloat(h, 64)
+				sum += f
+			}
+			eval.Average = sum / float64(r.period)
+			eval.Sufficient = true
+			eval.Matched, err = compareAutoMetric(r.operator, eval.Average, r.operand)
+			if err != nil {
+				return false, false, evals, err
+			}
+		}
+		evals = append(evals, eval)
+
+		allSufficient = allSufficient && eval.Sufficient
+		anyMatched = anyMatched || eval.Matched
+		allMatched = allMatched && eval.Matched
+	}
+
+	if orLogic {
+		// One matching rule decides; otherwise every rule has to be known to be false
+		return anyMatched, anyMatched || allSufficient, evals, nil
+	}
+	return allMatched, allSufficient, evals, nil
+}
+
+// autoActionTargetNodes returns the Nodes an action resizes: the Nodes of its NodeGroup,
+// or the auto-generated Nodes of the Infra
+func autoActionTargetNodes(nsId string, infraId string, act *model.AutoAction) ([]string, error) {
+	if act.NodeGroupId != "" {
+		return ListNodeByNodeGroup(nsId, infraId, act.NodeGroupId)
+	}
+	return getNodeIdsByLabel(nsId, infraId, model.LabelDeploymentType+"="+model.StrAutoGen)
+}
+
+// autoActionCount returns how many Nodes an action may add or remove now, given its
+// step and bounds, and a message when the bounds leave no room. A runbook action is
+// not bounded.
+func autoActionCount(act *model.AutoAction, current int) (int, string) {
+	if strings.EqualFold(act.ActionType, model.AutoActionRunRunbook) {
+		return 1, ""
+	}
+	step := act.Step
+	if step == 0 {
+		step = 1
+		if act.NodeGroupId == "" && strings.EqualFold(act.ActionType, model.AutoActionScaleOut) && act.NodeGroupDynamicReq.NodeGroupSize > 0 {
+			step = act.NodeGroupDynamicReq.NodeGroupSize
+		}
+	}
+	if strings.EqualFold(act.ActionType, model.AutoActionScaleOut) {
+		if act.MaxSize > 0 {
+			if current >= act.MaxSize {
+				return 0, fmt.Sprintf("at maxSize (%d Nodes)", current)
+			}
+			step = min(step, act.MaxSize-current)
+		}
+		return step, ""
+	}
+
+	floor := act.MinSize
+	if act.NodeGroupId != "" {
+		floor = max(floor, 1)
+	}
+	if current <= floor {
+		return 0, fmt.Sprintf("at minSize (%d Nodes)", current)
+	}
+	return min(step, current-floor), ""
+}
+
+// selectScaleInVictims orders the candidate Nodes by the victim selection strategy and
+// returns the first count of them
+func selectScaleInVictims(nsId string, infraId string, nodeIds []string, strategy string, count int) []string {
+	type candidate struct {
+		id      string
+		created string
+		cost    float32
+	}
+	specCost := map[string]float32{}
+	var candidates []candidate
+	for _, id := range nodeIds {
+		node, err := GetNodeObject(nsId, infraId, id)
+		if err != nil {
+			log.Warn().Err(err).Str("nodeId", id).Msg("Skipping a scale-in candidate")
+			continue
+		}
+		c := candidate{id: id, created: node.CreatedTime}
+		if strategy == model.ScaleInVictimMostExpensive {
+			cost, ok := specCost[node.SpecId]
+			if !ok {
+				if spec, err := resource.GetSpec(model.SystemCommonNs, node.SpecId); err == nil {
+					cost = spec.CostPerHour
+				}
+				specCost[node.SpecId] = cost
+			}
+			c.cost = cost
+		}
+		candidates = append(candidates, c)
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		switch strategy {
+		case model.ScaleInVictimOldest:
+			return a.created < b.created
+		case model.ScaleInVictimMostExpensive:
+			if a.cost != b.cost {
+				return a.cost > b.cost
+			}
+		}
+		return a.created > b.created
+	})
+
+	victims := make([]string, 0, count)
+	for _, c := range candidates[:min(count, len(candidates))] {
+		victims = append(victims, c.id)
+	}
+	return victims
+}
+
+// autoActionCooldown returns the end of the cooldown of a policy, or the zero time
+func autoActionCooldown(p *model.Policy) time.Time {
+	if p.AutoAction.CooldownSeconds == 0 || p.LastActionTime == "" {
+		return time.Time{}
+	}
+	last, err := time.Parse(time.RFC3339, p.LastActionTime)
+	if err != nil {
+		return time.Time{}
+	}
+	return last.Add(time.Duration(p.AutoAction.CooldownSeconds) * time.Second)
+}
+
+// scaleOutNodeGroup adds Nodes to the NodeGroup of an action and bootstraps them with the
+// post commands of the action, or with those the NodeGroup was created with
+func scaleOutNodeGroup(nsId string, infraId string, act *model.AutoAction, count int) ([]string, error) {
+	before, err := ListNodeByNodeGroup(nsId, infraId, act.NodeGroupId)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := ScaleOutInfraNodeGroup(common.NewDefaultContext(), nsId, infraId, act.NodeGroupId, count); err != nil {
+		return nil, err
+	}
+	after, err := ListNodeByNodeGroup(nsId, infraId, act.NodeGroupId)
+	if err != nil {
+		return nil, err
+	}
+	var added []string
+	for _, id := range after {
+		if !slices.Contains(before, id) {
+			added = append(added, id)
+		}
+	}
+
+	phases := act.PostCommands
+	if len(phases) == 0 {
+		if infraObj, _, err := GetInfraObject(nsId, infraId); err == nil {
+			phases = nodeGroupPostCommands(infraObj, act.NodeGroupId)
+		}
+	}
+	if len(phases) == 0 {
+		return added, nil
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var failed []string
+	for _, id := range added {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			if err := runPostCommandsOnNode(nsId, infraId, id, phases); err != nil {
+				log.Warn().Err(err).Str("nodeId", id).Msg("Post commands failed on a scaled-out Node")
+				mu.Lock()
+				failed = append(failed, id)
+				mu.Unlock()
+			}
+		}(id)
+	}
+	wg.Wait()
+	if len(failed) > 0 {
+		return added, fmt.Errorf("post commands failed on %s", strings.Join(failed, ", "))
+	}
+	return added, nil
+}
+
+// scaleOutAutoGen adds a new auto-generated NodeGroup of count Nodes from the
+// NodeGroupDynamicReq of an action
+func scaleOutAutoGen(nsId string, infraId string, act model.AutoAction, count int) ([]string, error) {
+	act.NodeGroupDynamicReq.Label = map[string]string{
+		model.LabelDeploymentType: model.StrAutoGen,
+	}
+	// append uid to given vm name to avoid duplicated vm ID.
+	act.NodeGroupDynamicReq.Name = common.ToLower(act.NodeGroupDynamicReq.Name) + "-" + common.GenUid()
+	act.NodeGroupDynamicReq.NodeGroupSize = count
+
+	if strings.EqualFold(act.PlacementAlgo, "random") {
+		log.Debug().Msg("[autoAction.PlacementAlgo] " + act.PlacementAlgo)
+		recommendSpecReq := model.RecommendSpecReq{}
+		recommendSpecReq.Priority.Policy = append(recommendSpecReq.Priority.Policy, model.PriorityCondition{Metric: "random"})
+		specList, err := RecommendSpec(common.NewDefaultContext(), model.SystemCommonNs, recommendSpecReq)
+		if err != nil {
+			return nil, err
+		}
+		if len(specList) != 0 {
+			act.NodeGroupDynamicReq.SpecId = specList[0].Id
+		}
+	}
+
+	common.PrintJsonPretty(act.NodeGroupDynamicReq)
+	_, err := CreateInfraNodeGroupDynamic(common.NewDefaultContext(), nsId, infraId,
+		&model.AddNodeGroupDynamicReq{CreateNodeGroupDynamicReq: act.NodeGroupDynamicReq})
+	if err != nil {
+		return nil, err
+	}
+	nodeGroupId := common.ToLower(act.NodeGroupDynamicReq.Name)
+	added, _ := ListNodeByNodeGroup(nsId, infraId, nodeGroupId)
+
+	if len(act.PostCommands) != 0 {
+		log.Debug().Msgf("[Post Command to Node] %v", act.PostCommands)
+		// Shared helper: aggregates per-node outcomes and persists status/results
+		status, cmdErr := executePostCommands(nsId, infraId, nodeGroupId, act.PostCommands, newPostCommandRequestId(infraId))
+		if cmdErr != nil {
+			return added, cmdErr
+		}
+		if status == model.PostCommandStatusFailed || status == model.PostCommandStatusCompletedWithErrors {
+			return added, fmt.Errorf("post commands ended with status %s", status)
+		}
+	}
+	return added, nil
+}
+
+// runAutoAction runs the action of a policy within its bounds and fills the decision
+func runAutoAction(nsId string, infraId string, p *model.Policy, d *model.AutoControlDecision) error {
+	act := &p.AutoAction
+	if strings.EqualFold(act.ActionType, model.AutoActionRunRunbook) {
+		result, err := RunRunbook(nsId, infraId, act.RunbookId, act.NodeGroupId, "", "", &act.RunbookRunReq, "")
+		if err != nil {
+			return err
+		}
+		d.Message = fmt.Sprintf("runbook %s (version %d): %s", act.RunbookId, result.Version, result.Status)
+		if result.Status != model.PostCommandStatusCompleted {
+			return fmt.Errorf("runbook %s did not complete", act.RunbookId)
+		}
+		d.Decision = model.AutoDecisionExecuted
+		return nil
+	}
+
+	nodeIds, err := autoActionTargetNodes(nsId, infraId, act)
+	if err != nil {
+		return err
+	}
+	d.CurrentSize = len(nodeIds)
+	count, boundMsg := autoActionCount(act, len(nodeIds))
+	if count == 0 {
+		d.Decision = model.AutoDecisionAtBound
+		d.Message = boundMsg
+		return nil
+	}
+
+	if strings.EqualFold(act.ActionType, model.AutoActionScaleOut) {
+		if act.NodeGroupId != "" {
+			d.NodeIds, err = scaleOutNodeGroup(nsId, infraId, act, count)
+		} else {
+			d.NodeIds, err = scaleOutAutoGen(nsId, infraId, *act, count)
+		}
+		if err != nil {
+			return err
+		}
+		d.Message = fmt.Sprintf("added %d Nodes", len(d.NodeIds))
+	} else {
+		strategy := act.VictimSelection
+		if strategy == "" {
+			strategy = model.ScaleInVictimNewest
+		}
+		var failed []string
+		for _, id := range selectScaleInVictims(nsId, infraId, nodeIds, strategy, count) {
+			log.Debug().Msg("[Removing Node ID] " + id)
+			if err := DelInfraNode(nsId, infraId, id, ""); err != nil {
+				log.Error().Err(err).Str("nodeId", id).Msg("Scale-in failed to remove a Node")
+				failed = append(failed, id)
+				continue
+			}
+			d.NodeIds = append(d.NodeIds, id)
+		}
+		d.Message = fmt.Sprintf("removed %d Nodes (%s)", len(d.NodeIds), strategy)
+		if len(failed) > 0 {
+			return fmt.Errorf("failed to remove %s", strings.Join(failed, ", "))
+		}
+	}
+	d.Decision = model.AutoDecisionExecuted
+	return nil
+}
+
+func autoControlDecisionKey(nsId string, infraId string) string {
+	return fmt.Sprintf("/log/autoControl/ns/%s/infra/%s", nsId, infraId)
+}
+
+// recordAutoControlDecision persists a decision of an Infra policy, drops the oldest
+// decisions beyond autoControlDecisionLogMax, and returns the decision with its id and time
+func recordAutoControlDecision(nsId string, infraId string, d model.AutoControlDecision) model.AutoControlDecision {
+	now := time.Now()
+	d.Id = fmt.Sprintf("%020d", now.UnixNano())
+	d.Time = now.UTC().Format(time.RFC3339)
+
+	log.Info().
+		Str("nsId", nsId).
+		Str("infraId", infraId).
+		Int("policyIndex", d.PolicyIndex).
+		Str("decision", d.Decision).
+		Str("message", d.Message).
+		Msg("Auto-control decision")
+
+	prefix := autoControlDecisionKey(nsId, infraId)
+	val, _ := json.Marshal(d)
+	if err := kvstore.Put(prefix+"/"+d.Id, string(val)); err != nil {
+		log.Error().Err(err).Msg("Failed to store the auto-control decision")
+		return d
+	}
+
+	kvs, err := kvstore.GetKvList(prefix + "/")
+	if err != nil || len(kvs) <= autoControlDecisionLogMax {
+		return d
+	}
+	sort.Slice(kvs, func(i, j int) bool { return kvs[i].Key < kvs[j].Key })
+	for _, kv := range kvs[:len(kvs)-autoControlDecisionLogMax] {
+		kvstore.Delete(kv.Key)
+	}
+	return d
+}
+
+// ListAutoControlDecision returns the decision log of an Infra policy, newest first.
+// limit caps the number of decisions returned (0: all kept decisions).
+func ListAutoControlDecision(nsId string, infraId string, limit int) ([]model.AutoControlDecision, error) {
+	prefix := autoControlDecisionKey(nsId, infraId)
+	kvs, err := kvstore.GetKvList(prefix + "/")
+	if err != nil {
+		return nil, err
+	}
+	kvs = kvutil.FilterKvListBy(kvs, prefix, 1)
+	sort.Slice(kvs, func(i, j int) bool { return kvs[i].Key > kvs[j].Key })
+	if limit > 0 && len(kvs) > limit {
+		kvs = kvs[:limit]
+	}
+
+	result := []model.AutoControlDecision{}
+	for _, kv := range kvs {
+		var d model.AutoControlDecision
+		if err := json.Unmarshal([]byte(kv.Value), &d); err != nil {
+			continue
+		}
+		result = append(result, d)
+	}
+	return result, nil
+}
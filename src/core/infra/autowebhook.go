@@ -0,0 +1,310 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package infra is to manage multi-cloud infra
+package infra
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cloud-barista/cb-tumblebug/src/core/model"
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvstore"
+	"github.com/rs/zerolog/log"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	// autoWebhookMinSecretLen is the minimum length of a webhook secret
+	autoWebhookMinSecretLen = 16
+
+	// autoWebhookMaxSkew bounds the age of a signed timestamp, against replays
+	autoWebhookMaxSkew = 5 * time.Minute
+
+	// autoWebhookIdempotencyTTL is how long the outcome of an idempotency key is kept
+	autoWebhookIdempotencyTTL = 24 * time.Hour
+
+	// autoWebhookSecretMask replaces the event subscription secrets in responses
+	autoWebhookSecretMask = "********"
+
+	// autoWebhookClaimStale is how long an idempotency key claimed by a request that never
+	// finished (e.g., its replica died) blocks retries of the same key
+	autoWebhookClaimStale = time.Hour
+
+	// autoControlLockWait bounds the wait for the action lock of an Infra
+	autoControlLockWait = 10 * time.Second
+)
+
+// Sentinel errors so the REST layer can map webhook outcomes to HTTP codes
+// (unauthorized → 401, busy → 409) via errors.Is
+var (
+	ErrAutoWebhookUnauthorized = errors.New("invalid webhook signature")
+	ErrAutoControlBusy         = errors.New("an action of the policy is in progress")
+)
+
+// lockAutoControl takes the kvstore lock that serializes, across replicas, the actions of
+// the policies of an Infra (the controller on the leader and the webhooks on any replica).
+// It waits at most autoControlLockWait and returns ErrAutoControlBusy after that.
+func lockAutoControl(nsId string, infraId string) (unlock func(), err error) {
+	session, err := kvstore.NewSession(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("cannot create a kvstore session: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), autoControlLockWait)
+	defer cancel()
+	lock, err := kvstore.NewLock(ctx, session, fmt.Sprintf("/lock/autoControl/ns/%s/infra/%s", nsId, infraId))
+	if err != nil {
+		session.Close()
+		if ctx.Err() != nil {
+			return nil, ErrAutoControlBusy
+		}
+		return nil, fmt.Errorf("cannot acquire the auto-control lock: %w", err)
+	}
+	return func() {
+		unlockCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := lock.Unlock(unlockCtx); err != nil {
+			log.Debug().Err(err).Msg("cannot release the auto-control lock (closing the session releases it)")
+		}
+		session.Close()
+	}, nil
+}
+
+// AutoWebhookSignature returns the signature of a webhook request: the hex HMAC-SHA256
+// of "<timestamp>.<body>" keyed by the webhook secret, prefixed by "sha256="
+func AutoWebhookSignature(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// verifyAutoWebhookSignature checks the timestamp and the signature of a webhook request
+func verifyAutoWebhookSignature(secret string, timestamp string, signature string, body []byte) error {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: the timestamp header must be in Unix seconds", ErrAutoWebhookUnauthorized)
+	}
+	if skew := time.Since(time.Unix(ts, 0)); skew > autoWebhookMaxSkew || skew < -autoWebhookMaxSkew {
+		return fmt.Errorf("%w: the timestamp is more than %s off", ErrAutoWebhookUnauthorized, autoWebhookMaxSkew)
+	}
+	if !hmac.Equal([]byte(strings.ToLower(signature)), []byte(AutoWebhookSignature(secret, timestamp, body))) {
+		return ErrAutoWebhookUnauthorized
+	}
+	return nil
+}
+
+// OmitInfraPolicySecret removes the webhook secrets of an Infra policy for responses
+func OmitInfraPolicySecret(p model.InfraPolicyInfo) model.InfraPolicyInfo {
+	policies := make([]model.Policy, len(p.Policy))
+	copy(policies, p.Policy)
+	for i := range policies {
+		policies[i].Webhook.Secret = ""
+	}
+	p.Policy = policies
+	return p
+}
+
+// autoWebhookIdempotency is the stored outcome of a webhook request with an idempotency key.
+// Pending marks a key claimed by a request that has not finished yet.
+type autoWebhookIdempotency struct {
+	StoredAt time.Time                 `json:"storedAt"`
+	Pending  bool                      `json:"pending,omitempty"`
+	Decision model.AutoControlDecision `json:"decision"`
+}
+
+func autoWebhookIdempotencyPrefix(nsId string, infraId string) string {
+	return fmt.Sprintf("/log/autoControlWebhook/ns/%s/infra/%s", nsId, infraId)
+}
+
+// autoWebhookIdempotencyKey hashes the client key so that any string is a valid kvstore key
+func autoWebhookIdempotencyKey(nsId string, infraId string, policyIndex int, key string) string {
+	sum := sha256.Sum256([]byte(strconv.Itoa(policyIndex) + "/" + key))
+	return autoWebhookIdempotencyPrefix(nsId, infraId) + "/" + hex.EncodeToString(sum[:])
+}
+
+// claimAutoWebhookIdempotency claims an idempotency key with a create-if-absent write, so
+// that a single request acts for the key whatever replica receives it. If the key is taken,
+// it returns the stored decision of a finished request (done is true) or ErrAutoControlBusy
+// while the first request is still running. Expired and stale claims are taken over.
+func claimAutoWebhookIdempotency(nsId string, infraId string, policyIndex int, key string) (stored model.AutoControlDecision, done bool, err error) {
+	ctx := context.Background()
+	storeKey := autoWebhookIdempotencyKey(nsId, infraId, policyIndex, key)
+	claim, _ := json.Marshal(autoWebhookIdempotency{StoredAt: time.Now(), Pending: true})
+
+	for range 3 {
+		kv, revision, exists, err := kvstore.GetWithRevision(ctx, storeKey)
+		if err != nil {
+			return stored, false, err
+		}
+		if exists {
+			var current autoWebhookIdempotency
+			if json.Unmarshal([]byte(kv.Value), &current) == nil {
+				age := time.Since(current.StoredAt)
+				if !current.Pending && age <= autoWebhookIdempotencyTTL {
+					return current.Decision, true, nil
+				}
+				if current.Pending && age <= autoWebhookClaimStale {
+					return stored, false, ErrAutoControlBusy
+				}
+			}
+		} else {
+			revision = 0
+		}
+		err = kvstore.PutIfRevision(ctx, storeKey, string(claim), revision)
+		if err == nil {
+			return stored, false, nil
+		}
+		if !errors.Is(err, kvstore.ErrRevisionConflict) {
+			return stored, false, err
+		}
+	}
+	return stored, false, ErrAutoControlBusy
+}
+
+// releaseAutoWebhookIdempotency drops the claim of a request that failed before acting,
+// so that the client can retry with the same key
+func releaseAutoWebhookIdempotency(nsId string, infraId string, policyIndex int, key string) {
+	if err := kvstore.Delete(autoWebhookIdempotencyKey(nsId, infraId, policyIndex, key)); err != nil {
+		log.Error().Err(err).Msg("Failed to release the webhook idempotency key")
+	}
+}
+
+// storeAutoWebhookIdempotency keeps the outcome of a key and drops the expired ones
+func storeAutoWebhookIdempotency(nsId string, infraId string, policyIndex int, key string, d model.AutoControlDecision) {
+	now := time.Now()
+	val, _ := json.Marshal(autoWebhookIdempotency{StoredAt: now, Decision: d})
+	if err := kvstore.Put(autoWebhookIdempotencyKey(nsId, infraId, policyIndex, key), string(val)); err != nil {
+		log.Error().Err(err).Msg("Failed to store the webhook idempotency key")
+	}
+
+	kvs, err := kvstore.GetKvList(autoWebhookIdempotencyPrefix(nsId, infraId) + "/")
+	if err != nil {
+		return
+	}
+	for _, kv := range kvs {
+		var stored autoWebhookIdempotency
+		if json.Unmarshal([]byte(kv.Value), &stored) != nil || (!stored.Pending && now.Sub(stored.StoredAt) > autoWebhookIdempotencyTTL) ||
+			(stored.Pending && now.Sub(stored.StoredAt) > autoWebhookClaimStale) {
+			kvstore.Delete(kv.Key)
+		}
+	}
+}
+
+// TriggerInfraPolicyWebhook runs the action of a policy for a signed webhook request.
+// The cooldown and the bounds of the action apply as for metric-driven actions. A repeated
+// idempotency key returns the decision of the first request (replayed is true) without
+// acting again; it is claimed atomically, so concurrent requests with the same key on any
+// replica act once. Actions of an Infra are serialized by a kvstore lock, waited for at
+// most autoControlLockWait.
+func TriggerInfraPolicyWebhook(nsId string, infraId string, policyIndex int, body []byte, timestamp string, signature string, idempotencyKey string) (decision model.AutoControlDecision, replayed bool, err error) {
+	policyInfo, err := GetInfraPolicyObject(nsId, infraId)
+	if err != nil {
+		return decision, false, err
+	}
+	if policyInfo.Id == "" {
+		return decision, false, fmt.Errorf("infra %s has no policy", infraId)
+	}
+	if policyIndex < 0 || policyIndex >= len(policyInfo.Policy) {
+		return decision, false, fmt.Errorf("policy index %d is out of range (infra %s has %d policies)", policyIndex, infraId, len(policyInfo.Policy))
+	}
+	webhook := policyInfo.Policy[policyIndex].Webhook
+	if !webhook.Enabled || webhook.Secret == "" {
+		return decision, false, fmt.Errorf("the webhook of policy %d of infra %s is not enabled", policyIndex, infraId)
+	}
+	if err := verifyAutoWebhookSignature(webhook.Secret, timestamp, signature, body); err != nil {
+		log.Warn().Str("nsId", nsId).Str("infraId", infraId).Int("policyIndex", policyIndex).Msg("Rejected an auto-control webhook with an invalid signature")
+		return decision, false, err
+	}
+
+	if idempotencyKey != "" {
+		stored, done, claimErr := claimAutoWebhookIdempotency(nsId, infraId, policyIndex, idempotencyKey)
+		if claimErr != nil {
+			return decision, false, claimErr
+		}
+		if done {
+			return stored, true, nil
+		}
+		// Until the outcome is stored, a failure frees the key for a retry
+		defer func() {
+			if err != nil {
+				releaseAutoWebhookIdempotency(nsId, infraId, policyIndex, idempotencyKey)
+			}
+		}()
+	}
+
+	unlock, err := lockAutoControl(nsId, infraId)
+	if err != nil {
+		return decision, false, err
+	}
+	defer unlock()
+
+	// Reload under the lock: the controller may have changed the policy meanwhile
+	policyInfo, err = GetInfraPolicyObject(nsId, infraId)
+	if err != nil {
+		return decision, false, err
+	}
+	if policyIndex >= len(policyInfo.Policy) {
+		return decision, false, fmt.Errorf("policy index %d is out of range", policyIndex)
+	}
+	policy := &policyInfo.Policy[policyIndex]
+	if strings.EqualFold(policy.Status, model.AutoStatusSuspended) {
+		return decision, false, fmt.Errorf("policy %d of infra %s is suspended", policyIndex, infraId)
+	}
+
+	decision = model.AutoControlDecision{
+		PolicyIndex:    policyIndex,
+		ActionType:     policy.AutoAction.ActionType,
+		Trigger:        model.AutoTriggerWebhook,
+		IdempotencyKey: idempotencyKey,
+	}
+	switch {
+	case gjson.ValidBytes(body) && gjson.GetBytes(body, "status").String() == "resolved":
+		// Alertmanager also notifies when an alert resolves
+		decision.Decision = model.AutoDecisionNoAction
+		decision.Message = "the alert is resolved"
+	case time.Now().Before(autoActionCooldown(policy)):
+		decision.Decision = model.AutoDecisionCooldown
+		decision.Message = "cooldown until " + autoActionCooldown(policy).UTC().Format(time.RFC3339)
+	default:
+		if err := runAutoAction(nsId, infraId, policy, &decision); err != nil {
+			log.Error().Err(err).Msg("Webhook-triggered auto-control action failed")
+			decision.Decision = model.AutoDecisionFailed
+			decision.Message = strings.TrimSpace(decision.Message + " " + err.Error())
+		}
+		if decision.Decision != model.AutoDecisionAtBound {
+			lastActionTime := time.Now().UTC().Format(time.RFC3339)
+			// Let the metrics settle before the controller evaluates the policy again
+			if err := updateInfraPolicyEntry(nsId, infraId, policyIndex, func(p *model.Policy) {
+				p.LastActionTime = lastActionTime
+				p.Status = model.AutoStatusStabilizing
+			}); err != nil {
+				log.Error().Err(err).Msgf("Failed to update policy %d of Infra %s", policyIndex, infraId)
+			}
+		}
+	}
+
+	decision = recordAutoControlDecision(nsId, infraId, decision)
+	if idempotencyKey != "" {
+		storeAutoWebhookIdempotency(nsId, infraId, policyIndex, idempotencyKey, decision)
+	}
+	return decision, false, nil
+}
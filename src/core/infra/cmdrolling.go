@@ -0,0 +1,239 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package infra is to manage multi-cloud infra
+package infra
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloud-barista/cb-tumblebug/src/core/model"
+	"github.com/rs/zerolog/log"
+)
+
+// validateCommandRolling checks the rolling option of a remote command request
+func validateCommandRolling(opt *model.CommandRollingOption) error {
+	if opt.BatchSize < 0 || opt.PauseSeconds < 0 || opt.MaxFailures < 0 {
+		return fmt.Errorf("rolling batchSize, pauseSeconds and maxFailures must not be negative")
+	}
+	if opt.BatchSize > 0 && opt.BatchPercent != 0 {
+		return fmt.Errorf("set either rolling batchSize or batchPercent, not both")
+	}
+	if opt.BatchPercent < 0 || opt.BatchPercent > 100 {
+		return fmt.Errorf("rolling batchPercent must be between 1 and 100")
+	}
+	for _, cmd := range opt.VerifyCommand {
+		if strings.TrimSpace(cmd) == "" {
+			return fmt.Errorf("rolling verifyCommand must not contain empty commands")
+		}
+	}
+	return nil
+}
+
+// rollingBatchSize returns the number of Nodes per batch for the given number of targets
+func rollingBatchSize(opt *model.CommandRollingOption, targets int) int {
+	size := 1
+	switch {
+	case opt.BatchSize > 0:
+		size = opt.BatchSize
+	case opt.BatchPercent > 0:
+		size = (targets*opt.BatchPercent + 99) / 100
+	}
+	return max(1, min(size, targets))
+}
+
+// rollingNodeOrder orders the targets of a rolling execution. Targets that serve as the
+// bastion of other targets go last, so that a batch restarting them does not cut off the
+// Nodes of the following batches.
+func rollingNodeOrder(nsId string, infraId string, nodeList []string, nodeCommands map[string][]string) []string {
+	isBastion := map[string]bool{}
+	for _, nodeId := range nodeList {
+		bastions, err := GetBastionNodes(nsId, infraId, nodeId)
+		if err != nil || len(bastions) == 0 {
+			continue
+		}
+		if b := pickBastion(bastions, nsId, infraId, nodeId).NodeId; b != "" && b != nodeId {
+			isBastion[b] = true
+		}
+	}
+
+	order := make([]string, 0, len(nodeCommands))
+	var last []string
+	for _, nodeId := range nodeList {
+		if _, ok := nodeCommands[nodeId]; !ok {
+			continue
+		}
+		if isBastion[nodeId] {
+			last = append(last, nodeId)
+		} else {
+			order = append(order, nodeId)
+		}
+	}
+	return append(order, last...)
+}
+
+// runCommandInBatches runs the preprocessed commands of RemoteCommandToInfra batch by batch.
+// After each batch it stops if more Nodes failed than tolerated, and before each pause and
+// batch if the request was cancelled; the Nodes not reached are marked Cancelled and
+// returned with an error. Progress goes to the SSE stream of xRequestId.
+func runCommandInBatches(nsId string, infraId string, nodeList []string, nodeCommands map[string][]string, nodeCommandIndices map[string]int, req *model.InfraCmdReq, xRequestId string) []model.SshCmdResult {
+	opt := req.Rolling
+	order := rollingNodeOrder(nsId, infraId, nodeList, nodeCommands)
+	size := rollingBatchSize(opt, len(order))
+	totalBatches := (len(order) + size - 1) / size
+	timeout := time.Duration(req.GetEffectiveTimeout()) * time.Minute
+	startedAt := time.Now()
+
+	// Cancelling the request stops the pause and the batches not started yet
+	ctx, cancel := context.WithCancel(context.Background())
+	requestCancelFuncs.Store(xRequestId, cancel)
+	defer func() {
+		requestCancelFuncs.Delete(xRequestId)
+		cancel()
+	}()
+
+	log.Info().
+		Str("xRequestId", xRequestId).
+		Int("nodeCount", len(order)).
+		Int("batchSize", size).
+		Int("maxFailures", opt.MaxFailures).
+		Msg("Starting rolling remote command execution")
+
+	publishBatch := func(batch int, nodeIds []string, phase string, completed, failed int, message string) {
+		PublishCommandEvent(xRequestId, model.CommandStreamEvent{
+			Type:      model.EventCommandBatch,
+			Timestamp: time.Now().Format(time.RFC3339Nano),
+			Batch: &model.CommandBatchProgress{
+				Batch:          batch,
+				TotalBatches:   totalBatches,
+				Phase:          phase,
+				NodeIds:        nodeIds,
+				CompletedNodes: completed,
+				FailedNodes:    failed,
+				Message:        message,
+			},
+		})
+	}
+
+	results := make([]model.SshCmdResult, 0, len(order))
+	completed, failed := 0, 0
+	var skipped []string
+	var skipReason string
+	for start := 0; start < len(order); start += size {
+		batchNo := start/size + 1
+		batch := order[start:min(start+size, len(order))]
+		if start > 0 && opt.PauseSeconds > 0 && ctx.Err() == nil {
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Duration(opt.PauseSeconds) * time.Second):
+			}
+		}
+		if ctx.Err() != nil {
+			skipped = order[start:]
+			skipReason = "the request was cancelled"
+			msg := fmt.Sprintf("%s, skipping %d Nodes", skipReason, len(skipped))
+			log.Warn().Str("xRequestId", xRequestId).Int("batch", batchNo).Msg("Rolling remote command execution stopped: " + msg)
+			publishBatch(batchNo, batch, model.CommandBatchStopped, completed, failed, msg)
+			break
+		}
+
+		publishBatch(batchNo, batch, model.CommandBatchStarted, completed, failed, "")
+		for _, r := range runCommandBatch(ctx, nsId, infraId, batch, nodeCommands, nodeCommandIndices, req.UserName, opt.VerifyCommand, xRequestId, timeout) {
+			if r.Err != nil {
+				failed++
+			} else {
+				completed++
+			}
+			results = append(results, r)
+		}
+
+		if failed > opt.MaxFailures && start+size < len(order) {
+			skipped = order[start+size:]
+			skipReason = fmt.Sprintf("%d Nodes failed (max %d)", failed, opt.MaxFailures)
+			msg := fmt.Sprintf("%s, skipping %d Nodes", skipReason, len(skipped))
+			log.Warn().Str("xRequestId", xRequestId).Int("batch", batchNo).Msg("Rolling remote command execution stopped: " + msg)
+			publishBatch(batchNo, batch, model.CommandBatchStopped, completed, failed, msg)
+			break
+		}
+		publishBatch(batchNo, batch, model.CommandBatchCompleted, completed, failed, "")
+	}
+
+	for _, nodeId := range skipped {
+		results = append(results, model.SshCmdResult{
+			InfraId: infraId,
+			NodeId:  nodeId,
+			Err:     fmt.Errorf("skipped: the rolling execution stopped: %s", skipReason),
+		})
+		if cmdIndex := nodeCommandIndices[nodeId]; cmdIndex > 0 {
+			UpdateCommandStatusInfo(nsId, infraId, nodeId, cmdIndex, model.CommandStatusCancelled,
+				"Skipped: rolling execution stopped", skipReason, "", "")
+		}
+	}
+
+	PublishCommandEvent(xRequestId, model.CommandStreamEvent{
+		Type:      model.EventCommandDone,
+		Timestamp: time.Now().Format(time.RFC3339Nano),
+		Summary: &model.CommandDoneSummary{
+			TotalNodes:     len(nodeList),
+			CompletedNodes: completed,
+			FailedNodes:    failed,
+			SkippedNodes:   len(skipped),
+			ElapsedSeconds: int64(time.Since(startedAt).Seconds()),
+		},
+	})
+	return results
+}
+
+// runCommandBatch runs the commands on the Nodes of one batch in parallel, followed on each
+// Node by the verification command if the commands succeeded there.
+func runCommandBatch(ctx context.Context, nsId string, infraId string, batch []string, nodeCommands map[string][]string, nodeCommandIndices map[string]int, userName string, verifyCommand []string, xRequestId string, timeout time.Duration) []model.SshCmdResult {
+	results := make([]model.SshCmdResult, len(batch))
+	var wg sync.WaitGroup
+	for i, nodeId := range batch {
+		wg.Add(1)
+		go func(i int, nodeId string) {
+			defer wg.Done()
+			cmdIndex := nodeCommandIndices[nodeId]
+
+			nodeCtx, nodeCancel := context.WithTimeout(ctx, timeout)
+			defer nodeCancel()
+			registerCancelFunc(xRequestId, nodeId, nsId, infraId, cmdIndex, nodeCancel)
+			defer unregisterCancelFunc(xRequestId, nodeId)
+			nodeCtx = withSSHLogMeta(nodeCtx, &sshLogMeta{
+				XRequestId:   xRequestId,
+				NodeId:       nodeId,
+				CommandIndex: cmdIndex,
+			})
+
+			result := runRemoteCommandWithContextAndStatus(nodeCtx, nsId, infraId, nodeId, userName, nodeCommands[nodeId], cmdIndex)
+			if result.Err == nil && len(verifyCommand) > 0 {
+				_, verifyStderr, err := RunRemoteCommandWithContext(nodeCtx, nsId, infraId, nodeId, userName, verifyCommand)
+				if err != nil {
+					result.Err = fmt.Errorf("verification failed: %w", err)
+					if cmdIndex > 0 {
+						UpdateCommandStatusInfo(nsId, infraId, nodeId, cmdIndex, model.CommandStatusFailed,
+							"Verification command failed", fmt.Sprintf("%v: %s", err, mapToString(verifyStderr)),
+							mapToString(result.Stdout), mapToString(result.Stderr))
+					}
+				}
+			}
+			results[i] = result
+		}(i, nodeId)
+	}
+	wg.Wait()
+	return results
+}
@@ -0,0 +1,258 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package infra is to manage multi-cloud infra
+package infra
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cloud-barista/cb-tumblebug/src/core/model"
+	"github.com/rs/zerolog/log"
+)
+
+// JobTypeRemoteCommand runs remote commands on the Nodes of an Infra, a NodeGroup or a label selector
+const JobTypeRemoteCommand JobType = "remoteCommand"
+
+// cmdJobMaxConcurrency caps the scheduled command runs at once; each run already fans out
+// to all its Nodes in parallel.
+const cmdJobMaxConcurrency = 5
+
+func init() {
+	RegisterJobType(JobTypeRemoteCommand, JobTypeHandlers{
+		Validate: validateRemoteCommandJobPayload,
+		Run: func(ctx context.Context, jobId string, nsId string, payload json.RawMessage) (any, error) {
+			p, err := decodeJobPayload[model.RemoteCommandJobPayload](payload)
+			if err != nil {
+				return nil, err
+			}
+			return runScheduledRemoteCommand(ctx, jobId, nsId, p)
+		},
+		MaxConcurrency: cmdJobMaxConcurrency,
+		RequireCron:    true,
+	})
+}
+
+// validateRemoteCommandJobPayload checks the target and the commands of a remoteCommand job
+func validateRemoteCommandJobPayload(nsId string, payload json.RawMessage) (json.RawMessage, error) {
+	p, err := decodeJobPayload[model.RemoteCommandJobPayload](payload)
+	if err != nil {
+		return nil, err
+	}
+	commands := make([]string, 0, len(p.Command))
+	for _, cmd := range p.Command {
+		if strings.TrimSpace(cmd) != "" {
+			commands = append(commands, cmd)
+		}
+	}
+	if len(commands) == 0 {
+		return nil, fmt.Errorf("%s jobs require command", JobTypeRemoteCommand)
+	}
+	p.Command = commands
+	if p.TimeoutMinutes < 0 || p.TimeoutMinutes > model.SSHCommandMaxTimeoutMinutes {
+		return nil, fmt.Errorf("timeoutMinutes must be between 0 (default) and %d", model.SSHCommandMaxTimeoutMinutes)
+	}
+	p.LabelSelector = strings.TrimSpace(p.LabelSelector)
+
+	if p.InfraId == "" {
+		if p.NodeGroupId != "" {
+			return nil, fmt.Errorf("nodeGroupId requires infraId")
+		}
+		if p.LabelSelector == "" {
+			return nil, fmt.Errorf("%s jobs require infraId or labelSelector", JobTypeRemoteCommand)
+		}
+		return encodeJobPayload(p)
+	}
+	exists, err := CheckInfra(nsId, p.InfraId)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("the infra %s does not exist", p.InfraId)
+	}
+	if p.NodeGroupId != "" {
+		nodeIds, err := ListNodeByNodeGroup(nsId, p.InfraId, p.NodeGroupId)
+		if err != nil {
+			return nil, err
+		}
+		if len(nodeIds) == 0 {
+			return nil, fmt.Errorf("the NodeGroup %s of infra %s has no Node", p.NodeGroupId, p.InfraId)
+		}
+	}
+	return encodeJobPayload(p)
+}
+
+// runScheduledRemoteCommand runs the commands of a remoteCommand job on its target Nodes
+// and returns the command status recorded on each Node. The run fails if any Node did
+// not complete the commands; Nodes whose commands exited non-zero raise an event.
+func runScheduledRemoteCommand(ctx context.Context, jobId string, nsId string, p model.RemoteCommandJobPayload) (model.RemoteCommandJobOutput, error) {
+	xRequestId := fmt.Sprintf("%s-%d", jobId, time.Now().Unix())
+	output := model.RemoteCommandJobOutput{XRequestId: xRequestId, Results: []model.RemoteCommandJobNodeResult{}}
+
+	infraIds, err := remoteCommandJobTargets(nsId, p)
+	if err != nil {
+		return output, err
+	}
+	if len(infraIds) == 0 {
+		return output, fmt.Errorf("no Node in namespace %s matches the label selector %q", nsId, p.LabelSelector)
+	}
+
+	// RemoteCommandToInfra bounds the run with its own timeout; stop the SSH sessions
+	// as well when the job times out or is deleted.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			if n := cancelCommandsOfRequest(xRequestId); n > 0 {
+				log.Warn().Str("jobId", jobId).Int("cancelled", n).Msg("Cancelled the remote commands of a scheduled job")
+			}
+		case <-done:
+		}
+	}()
+
+	req := &model.InfraCmdReq{UserName: p.UserName, Command: p.Command, TimeoutMinutes: p.TimeoutMinutes}
+	var runErrs []string
+	for _, infraId := range infraIds {
+		results, err := RemoteCommandToInfra(nsId, infraId, p.NodeGroupId, "", p.LabelSelector, req, xRequestId)
+		if err != nil {
+			runErrs = append(runErrs, fmt.Sprintf("infra %s: %v", infraId, err))
+			appendInfraSystemMessage(nsId, infraId, fmt.Sprintf("[schedule] commands of job %s failed: %v", jobId, err))
+			continue
+		}
+		for _, r := range results {
+			output.Results = append(output.Results, remoteCommandNodeResult(jobId, nsId, infraId, r, xRequestId))
+		}
+	}
+
+	output.TotalNodes = len(output.Results)
+	for _, r := range output.Results {
+		if r.CommandStatus.Status != model.CommandStatusCompleted {
+			output.FailedNodes++
+		}
+	}
+
+	if output.FailedNodes > 0 {
+		runErrs = append(runErrs, fmt.Sprintf("%d of %d Nodes did not complete the commands", output.FailedNodes, output.TotalNodes))
+	}
+	if len(runErrs) > 0 {
+		return output, fmt.Errorf("%s", strings.Join(runErrs, "; "))
+	}
+	return output, nil
+}
+
+// remoteCommandJobTargets returns the Infras a remoteCommand job runs on: its Infra, or
+// the Infras of the namespace with Nodes matching its label selector.
+func remoteCommandJobTargets(nsId string, p model.RemoteCommandJobPayload) ([]string, error) {
+	if p.InfraId != "" {
+		return []string{p.InfraId}, nil
+	}
+	infraIds, err := ListInfraId(nsId)
+	if err != nil {
+		return nil, err
+	}
+	targets := []string{}
+	for _, infraId := range infraIds {
+		nodeIds, err := getNodeIdsByLabel(nsId, infraId, p.LabelSelector)
+		if err != nil {
+			return nil, fmt.Errorf("label selector error: %w", err)
+		}
+		if len(nodeIds) > 0 {
+			targets = append(targets, infraId)
+		}
+	}
+	return targets, nil
+}
+
+// remoteCommandNodeResult picks the command status a scheduled run recorded on a Node,
+// and raises an event if the commands did not succeed there.
+func remoteCommandNodeResult(jobId string, nsId string, infraId string, r model.SshCmdResult, xRequestId string) model.RemoteCommandJobNodeResult {
+	result := model.RemoteCommandJobNodeResult{InfraId: infraId, NodeId: r.NodeId}
+	if r.Err != nil {
+		result.Error = r.Err.Error()
+	}
+	list, err := ListCommandStatusInfo(nsId, infraId, r.NodeId, &model.CommandStatusFilter{XRequestId: xRequestId, Limit: 1})
+	switch {
+	case err != nil:
+		result.Error = fmt.Sprintf("cannot get the command status: %v", err)
+	case len(list.Commands) == 0:
+		result.Error = "no command status recorded"
+	default:
+		result.CommandStatus = list.Commands[0]
+	}
+	if result.CommandStatus.Status == "" {
+		result.CommandStatus.Status = model.CommandStatusFailed
+	}
+
+	switch result.CommandStatus.Status {
+	case model.CommandStatusCompleted:
+	case model.CommandStatusCompletedWithError:
+		log.Warn().
+			Str("event", "ScheduledCommandNonZeroExit").
+			Str("jobId", jobId).
+			Str("nsId", nsId).
+			Str("infraId", infraId).
+			Str("nodeId", r.NodeId).
+			Str("xRequestId", xRequestId).
+			Str("stderr", result.CommandStatus.Stderr).
+			Msgf("scheduled commands of job %s exited non-zero on Node %s", jobId, r.NodeId)
+	default:
+		log.Warn().
+			Str("event", "ScheduledCommandFailed").
+			Str("jobId", jobId).
+			Str("nsId", nsId).
+			Str("infraId", infraId).
+			Str("nodeId", r.NodeId).
+			Str("xRequestId", xRequestId).
+			Str("status", string(result.CommandStatus.Status)).
+			Msgf("scheduled commands of job %s did not run on Node %s: %s", jobId, r.NodeId, result.Error)
+	}
+	return result
+}
+
+// cancelCommandsOfRequest cancels the running commands started with xRequestId, and the
+// batches of the request that have not started yet
+func cancelCommandsOfRequest(xRequestId string) int {
+	if cancel, ok := requestCancelFuncs.LoadAndDelete(xRequestId); ok {
+		cancel.(context.CancelFunc)()
+	}
+	cancelled := 0
+	prefix := xRequestId + ":"
+	cancelFuncs.Range(func(key, value any) bool {
+		if keyStr, ok := key.(string); ok && strings.HasPrefix(keyStr, prefix) {
+			if cancelByKey(xRequestId, strings.TrimPrefix(keyStr, prefix)) {
+				cancelled++
+			}
+		}
+		return true
+	})
+	return cancelled
+}
+
+// ListScheduledJobsByType returns the scheduled jobs of a type in a namespace
+func (sm *SchedulerManager) ListScheduledJobsByType(nsId string, jobType JobType) []*ScheduledJob {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	jobs := []*ScheduledJob{}
+	for _, job := range sm.jobs {
+		if job.JobType == jobType && job.NsId == nsId {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs
+}
@@ -0,0 +1,440 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package infra
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloud-barista/cb-tumblebug/src/core/common"
+	clientManager "github.com/cloud-barista/cb-tumblebug/src/core/common/client"
+	"github.com/cloud-barista/cb-tumblebug/src/core/common/label"
+	cspdirect "github.com/cloud-barista/cb-tumblebug/src/core/csp"
+	"github.com/cloud-barista/cb-tumblebug/src/core/model"
+	"github.com/cloud-barista/cb-tumblebug/src/core/resource"
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvstore"
+	"github.com/rs/zerolog/log"
+)
+
+// driftSpiderConcurrency bounds the Nodes read from CB-Spider at the same time.
+const driftSpiderConcurrency = 10
+
+// driftTarget is a Node to check together with the CSP view obtained for it.
+type driftTarget struct {
+	infraId string
+	node    model.NodeInfo
+	labels  map[string]string
+
+	source       string
+	view         cspdirect.VMDescription
+	tagsReported bool
+	err          error
+}
+
+// observation is one drift condition to record on a Node.
+type observation struct {
+	condType model.ConditionType
+	status   model.ConditionStatus
+	reason   string
+	message  string
+}
+
+// DetectNsDrift compares the Nodes of the namespace (or of infraId only, if set) with
+// what the CSP reports and records the outcome as drift conditions on each Node.
+//
+// Spec, image, SecurityGroups, data disks, public IP and labels are compared. The CSP is
+// queried directly when a describe handler is registered for it (core/csp/*) and
+// through CB-Spider otherwise. Only Running and Suspended Nodes are checked, and the
+// public IP only of Running ones since CSPs release it on suspend.
+func DetectNsDrift(ctx context.Context, nsId string, infraId string) (model.DriftReport, error) {
+	report := model.DriftReport{NsId: nsId, CheckedAt: time.Now().UTC().Format(time.RFC3339), Nodes: []model.NodeDriftInfo{}}
+
+	if err := common.CheckString(nsId); err != nil {
+		return report, err
+	}
+	var infraIds []string
+	if infraId != "" {
+		if exists, _ := CheckInfra(nsId, infraId); !exists {
+			return report, fmt.Errorf("the infra %s does not exist", infraId)
+		}
+		infraIds = []string{infraId}
+	} else {
+		var err error
+		if infraIds, err = ListInfraId(nsId); err != nil {
+			return report, err
+		}
+	}
+
+	var targets []*driftTarget
+	for _, id := range infraIds {
+		infraObj, _, err := GetInfraObject(nsId, id)
+		if err != nil {
+			log.Warn().Err(err).Msgf("Drift check skips Infra %s", id)
+			continue
+		}
+		for _, node := range infraObj.Node {
+			if node.CspResourceId == "" || (node.Status != model.StatusRunning && node.Status != model.StatusSuspended) {
+				report.Skipped++
+				continue
+			}
+			labelInfo, err := label.GetLabels(model.StrNode, node.Uid)
+			if err != nil {
+				log.Warn().Err(err).Msgf("Cannot get the labels of Node %s", node.Id)
+			}
+			targets = append(targets, &driftTarget{infraId: id, node: node, labels: labelInfo.Labels})
+		}
+	}
+
+	describeTargets(ctx, targets)
+
+	for _, t := range targets {
+		info := model.NodeDriftInfo{
+			InfraId:        t.infraId,
+			NodeId:         t.node.Id,
+			ConnectionName: t.node.ConnectionName,
+			CspResourceId:  t.node.CspResourceId,
+			Source:         t.source,
+		}
+		if t.err != nil {
+			info.Error = t.err.Error()
+			info.Conditions = t.node.Conditions
+			report.Failed++
+			report.Nodes = append(report.Nodes, info)
+			continue
+		}
+
+		conditions, err := recordDriftConditions(ctx, nsId, t.infraId, t.node.Id, compareNodeWithCsp(nsId, t))
+		if err != nil {
+			info.Error = fmt.Sprintf("failed to record drift conditions: %v", err)
+			report.Failed++
+		}
+		info.Conditions = conditions
+		var newDrifts []string
+		for _, c := range conditions {
+			if isDriftCondition(c.Type) && c.Status == model.ConditionTrue {
+				info.Drifted = true
+				if !slices.ContainsFunc(t.node.Conditions, func(old model.Condition) bool {
+					return old.Type == c.Type && old.Status == model.ConditionTrue
+				}) {
+					newDrifts = append(newDrifts, string(c.Type))
+				}
+			}
+		}
+		// Only the drifts found by this check are published, not the ones already known
+		if len(newDrifts) > 0 {
+			common.PublishEvent(model.EventTypeNodeDriftDetected, model.EventData{
+				NsId:         nsId,
+				ResourceType: model.StrNode,
+				ResourceId:   t.node.Id,
+				InfraId:      t.infraId,
+				RequestId:    common.RequestIDFromContext(ctx),
+				Message:      "Drift detected: " + strings.Join(newDrifts, ", "),
+				Labels:       t.labels,
+			})
+		}
+		report.Checked++
+		if info.Drifted {
+			report.Drifted++
+		}
+		report.Nodes = append(report.Nodes, info)
+	}
+
+	sort.Slice(report.Nodes, func(i, j int) bool {
+		if report.Nodes[i].InfraId != report.Nodes[j].InfraId {
+			return report.Nodes[i].InfraId < report.Nodes[j].InfraId
+		}
+		return report.Nodes[i].NodeId < report.Nodes[j].NodeId
+	})
+	log.Info().Msgf("Drift check of namespace %s: %d checked, %d drifted, %d failed, %d skipped",
+		nsId, report.Checked, report.Drifted, report.Failed, report.Skipped)
+	return report, nil
+}
+
+// describeTargets fills the CSP view of each target, batching Nodes per provider, region
+// and credential holder for CSPs with a direct describe handler.
+func describeTargets(ctx context.Context, targets []*driftTarget) {
+	type batchKey struct{ provider, credentialHolder, region string }
+	batches := make(map[batchKey][]*driftTarget)
+	var viaSpider []*driftTarget
+	for _, t := range targets {
+		provider := nodeProviderName(t.node)
+		if _, ok := cspdirect.GetBatchVMDescribeHandler(provider); ok {
+			key := batchKey{provider, t.node.ConnectionConfig.CredentialHolder, t.node.Region.Region}
+			batches[key] = append(batches[key], t)
+		} else {
+			viaSpider = append(viaSpider, t)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for key, group := range batches {
+		wg.Add(1)
+		go func(k batchKey, grp []*driftTarget) {
+			defer wg.Done()
+			handler, _ := cspdirect.GetBatchVMDescribeHandler(k.provider)
+			ids := make([]string, len(grp))
+			for i, t := range grp {
+				ids[i] = t.node.CspResourceId
+			}
+			sdkCtx := context.WithValue(ctx, model.CtxKeyCredentialHolder, k.credentialHolder)
+			views, err := handler(sdkCtx, k.region, ids)
+			for _, t := range grp {
+				t.source = model.DriftSourceCsp
+				if err != nil {
+					t.err = err
+					continue
+				}
+				view, found := views[t.node.CspResourceId]
+				if !found {
+					t.err = fmt.Errorf("%s does not report the instance %s", k.provider, t.node.CspResourceId)
+					continue
+				}
+				t.view = view
+				t.tagsReported = true
+			}
+		}(key, group)
+	}
+
+	sem := make(chan struct{}, driftSpiderConcurrency)
+	for _, t := range viaSpider {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(t *driftTarget) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			t.source = model.DriftSourceSpider
+			t.view, t.err = describeNodeViaSpider(t.node)
+			if t.err != nil {
+				return
+			}
+			// CSP tags are read best-effort; an empty answer is taken as "not reported"
+			// since every synced Node carries at least the sys.* labels as tags
+			t.view.Tags = label.ListCSPResourceLabel(ctx, model.StrNode, t.node.Uid, t.node.ConnectionName)
+			t.tagsReported = len(t.view.Tags) > 0
+		}(t)
+	}
+	wg.Wait()
+}
+
+// describeNodeViaSpider reads the configuration of the Node from CB-Spider.
+func describeNodeViaSpider(node model.NodeInfo) (cspdirect.VMDescription, error) {
+	client := clientManager.NewHttpClient()
+	url := model.SpiderRestUrl + "/vm/" + node.CspResourceName
+	requestBody := model.SpiderConnectionName{ConnectionName: node.ConnectionName}
+
+	var spiderNode model.SpiderVMInfo
+	_, err := clientManager.ExecuteHttpRequest(
+		client,
+		"GET",
+		url,
+		nil,
+		clientManager.SetUseBody(requestBody),
+		&requestBody,
+		&spiderNode,
+		clientManager.MediumDuration,
+	)
+	if err != nil {
+		return cspdirect.VMDescription{}, err
+	}
+
+	view := cspdirect.VMDescription{
+		SpecName: spiderNode.VMSpecName,
+		ImageId:  spiderNode.ImageIId.SystemId,
+		PublicIP: spiderNode.PublicIP,
+	}
+	for _, iid := range spiderNode.SecurityGroupIIds {
+		view.SecurityGroupIds = append(view.SecurityGroupIds, iid.SystemId)
+	}
+	for _, iid := range spiderNode.DataDiskIIDs {
+		view.DataDiskIds = append(view.DataDiskIds, iid.SystemId)
+	}
+	return view, nil
+}
+
+// compareNodeWithCsp compares the Node record with the CSP view of the target.
+func compareNodeWithCsp(nsId string, t *driftTarget) []observation {
+	node, view := t.node, t.view
+	var obs []observation
+
+	obs = append(obs, compareValue(model.ConditionSpecDrifted, "spec", node.CspSpecName, view.SpecName))
+	obs = append(obs, compareValue(model.ConditionImageDrifted, "image", node.CspImageName, view.ImageId))
+
+	if expected, err := cspIdsOf(nsId, model.StrSecurityGroup, node.SecurityGroupIds); err != nil {
+		obs = append(obs, observation{model.ConditionSecurityGroupDrifted, model.ConditionUnknown, model.ReasonNotReported, err.Error()})
+	} else {
+		obs = append(obs, compareIdSets(model.ConditionSecurityGroupDrifted, "SecurityGroups", expected, view.SecurityGroupIds))
+	}
+	if expected, err := cspIdsOf(nsId, model.StrDataDisk, node.DataDiskIds); err != nil {
+		obs = append(obs, observation{model.ConditionDataDiskDrifted, model.ConditionUnknown, model.ReasonNotReported, err.Error()})
+	} else {
+		obs = append(obs, compareIdSets(model.ConditionDataDiskDrifted, "data disks", expected, view.DataDiskIds))
+	}
+
+	if node.Status == model.StatusRunning {
+		obs = append(obs, compareValue(model.ConditionPublicIPDrifted, "public IP", node.PublicIP, view.PublicIP))
+	} else {
+		obs = append(obs, observation{model.ConditionPublicIPDrifted, model.ConditionUnknown, model.ReasonNotReported, "public IP is not compared for a " + node.Status + " Node"})
+	}
+
+	if !t.tagsReported {
+		obs = append(obs, observation{model.ConditionLabelDrifted, model.ConditionUnknown, model.ReasonNotReported, "the CSP did not report tags"})
+	} else {
+		var diffs []string
+		for k, v := range t.labels {
+			if strings.HasPrefix(k, model.LabelSystemPrefix) {
+				continue
+			}
+			if tag, ok := view.Tags[k]; !ok {
+				diffs = append(diffs, fmt.Sprintf("%s is missing", k))
+			} else if tag != v {
+				diffs = append(diffs, fmt.Sprintf("%s=%q (expected %q)", k, tag, v))
+			}
+		}
+		sort.Strings(diffs)
+		if len(diffs) > 0 {
+			obs = append(obs, observation{model.ConditionLabelDrifted, model.ConditionTrue, model.ReasonDriftDetected, "CSP tags differ: " + strings.Join(diffs, ", ")})
+		} else {
+			obs = append(obs, observation{model.ConditionLabelDrifted, model.ConditionFalse, model.ReasonNoDrift, ""})
+		}
+	}
+	return obs
+}
+
+func compareValue(condType model.ConditionType, what string, expected string, actual string) observation {
+	if expected == "" || actual == "" {
+		return observation{condType, model.ConditionUnknown, model.ReasonNotReported, what + " is not known on both sides"}
+	}
+	if !strings.EqualFold(expected, actual) {
+		return observation{condType, model.ConditionTrue, model.ReasonDriftDetected, fmt.Sprintf("%s is %s on the CSP (expected %s)", what, actual, expected)}
+	}
+	return observation{condType, model.ConditionFalse, model.ReasonNoDrift, ""}
+}
+
+func compareIdSets(condType model.ConditionType, what string, expected []string, actual []string) observation {
+	var missing, extra []string
+	for _, id := range expected {
+		if !containsFold(actual, id) {
+			missing = append(missing, id)
+		}
+	}
+	for _, id := range actual {
+		if !containsFold(expected, id) {
+			extra = append(extra, id)
+		}
+	}
+	if len(missing) == 0 && len(extra) == 0 {
+		return observation{condType, model.ConditionFalse, model.ReasonNoDrift, ""}
+	}
+	var parts []string
+	if len(missing) > 0 {
+		parts = append(parts, "missing on the CSP: "+strings.Join(missing, ", "))
+	}
+	if len(extra) > 0 {
+		parts = append(parts, "unknown to Tumblebug: "+strings.Join(extra, ", "))
+	}
+	return observation{condType, model.ConditionTrue, model.ReasonDriftDetected, what + " differ (" + strings.Join(parts, "; ") + ")"}
+}
+
+func containsFold(list []string, item string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, item) {
+			return true
+		}
+	}
+	return false
+}
+
+// cspIdsOf returns the CSP resource ids of the given Tumblebug resources.
+func cspIdsOf(nsId string, resourceType string, ids []string) ([]string, error) {
+	var cspIds []string
+	for _, id := range ids {
+		obj, err := resource.GetResource(nsId, resourceType, id)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read %s %s: %w", resourceType, id, err)
+		}
+		var res struct {
+			CspResourceId string `json:"cspResourceId"`
+		}
+		if err := common.CopySrcToDest(&obj, &res); err != nil || res.CspResourceId == "" {
+			return nil, fmt.Errorf("%s %s has no CSP resource id", resourceType, id)
+		}
+		cspIds = append(cspIds, res.CspResourceId)
+	}
+	return cspIds, nil
+}
+
+// recordDriftConditions sets the observations on the stored Node and returns its
+// resulting conditions. Only Conditions is changed, so concurrent updates of the
+// Node are preserved, and UpdateNodeInfo keeps the stored Conditions in turn.
+func recordDriftConditions(ctx context.Context, nsId, infraId, nodeId string, obs []observation) ([]model.Condition, error) {
+	var conditions []model.Condition
+	key := common.GenInfraKey(nsId, infraId, nodeId)
+	err := kvstore.UpdateWithRetry(ctx, key, func(current string, exists bool) (string, bool, error) {
+		if !exists {
+			return "", false, fmt.Errorf("node %s no longer exists", nodeId)
+		}
+		var raw map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(current), &raw); err != nil {
+			return "", false, err
+		}
+		conditions = nil
+		if c, ok := raw["conditions"]; ok {
+			if err := json.Unmarshal(c, &conditions); err != nil {
+				return "", false, err
+			}
+		}
+		for _, o := range obs {
+			model.SetCondition(&conditions, o.condType, o.status, o.reason, o.message)
+		}
+		encoded, err := json.Marshal(conditions)
+		if err != nil {
+			return "", false, err
+		}
+		raw["conditions"] = encoded
+		val, err := json.Marshal(raw)
+		if err != nil {
+			return "", false, err
+		}
+		return string(val), true, nil
+	})
+	return conditions, err
+}
+
+// isDriftCondition reports whether condType is one of the Node drift conditions.
+func isDriftCondition(condType model.ConditionType) bool {
+	switch condType {
+	case model.ConditionSpecDrifted, model.ConditionImageDrifted, model.ConditionSecurityGroupDrifted,
+		model.ConditionDataDiskDrifted, model.ConditionPublicIPDrifted, model.ConditionLabelDrifted:
+		return true
+	}
+	return false
+}
+
+// nodeProviderName returns the provider of the Node, falling back to the prefix of
+// its connection name (e.g. "aws-ap-northeast-2" → "aws").
+func nodeProviderName(node model.NodeInfo) string {
+	if node.ConnectionConfig.ProviderName != "" {
+		return node.ConnectionConfig.ProviderName
+	}
+	if parts := strings.SplitN(node.ConnectionName, "-", 2); len(parts) > 0 {
+		return strings.ToLower(parts[0])
+	}
+	return ""
+}
@@ -0,0 +1,793 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package infra is to manage multi-cloud infra
+package infra
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/cloud-barista/cb-tumblebug/src/core/common"
+	"github.com/cloud-barista/cb-tumblebug/src/core/common/label"
+	"github.com/cloud-barista/cb-tumblebug/src/core/model"
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvstore"
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvutil"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// eventDeliveryDefaultRetries and eventDeliveryMaxRetries bound the retries of a delivery
+	eventDeliveryDefaultRetries = 5
+	eventDeliveryMaxRetries     = 10
+
+	// eventDeliveryBaseBackoff doubles after each failed attempt, up to eventDeliveryMaxBackoff
+	eventDeliveryBaseBackoff = 2 * time.Second
+	eventDeliveryMaxBackoff  = 5 * time.Minute
+
+	// eventDeliveryConcurrency bounds the requests in flight to all subscribers
+	eventDeliveryConcurrency = 20
+
+	// eventDeliveryHistoryLimit and eventDeadLetterLimit are the records kept per subscription
+	eventDeliveryHistoryLimit = 100
+	eventDeadLetterLimit      = 1000
+
+	// eventDeliveryQueueSize bounds the events waiting for delivery per subscription
+	eventDeliveryQueueSize = 1000
+
+	// eventSubscriptionCacheTTL is how long the dispatcher reuses the subscriptions of a
+	// namespace; changes made on other replicas are seen after at most this delay
+	eventSubscriptionCacheTTL = 30 * time.Second
+)
+
+// errEventDestinationBlocked is returned when an endpoint resolves to an address that
+// webhooks may not reach (see checkEventDestination)
+var errEventDestinationBlocked = errors.New("the destination address is not allowed")
+
+// eventDeliveryClient checks, at dial time, the address an endpoint resolves to, so that a
+// hostname cannot point deliveries at internal services. It uses no proxy: the check
+// applies to the address actually dialed.
+var eventDeliveryClient = &http.Client{
+	Timeout: 10 * time.Second,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 5 * time.Second,
+			Control: func(_ string, address string, _ syscall.RawConn) error {
+				return checkEventDestination(address)
+			},
+		}).DialContext,
+		TLSHandshakeTimeout: 5 * time.Second,
+		MaxIdleConnsPerHost: 2,
+		IdleConnTimeout:     90 * time.Second,
+	},
+}
+
+var eventDeliverySlots = make(chan struct{}, eventDeliveryConcurrency)
+
+var eventSubscriptionDispatcherOnce sync.Once
+
+// eventSubscriptionCache keeps the subscriptions of each namespace (nsId → entry) for the
+// dispatcher, so that an event does not cost a kvstore list
+var eventSubscriptionCache sync.Map
+
+type eventSubscriptionCacheEntry struct {
+	subs     []model.EventSubscriptionInfo
+	loadedAt time.Time
+}
+
+// eventDeliveryQueues holds the delivery queue of each subscription ("nsId/subscriptionId")
+var eventDeliveryQueues sync.Map
+
+// eventDeliveryQueue holds the pending deliveries of a subscription. They run one at a time,
+// in order, in a worker that exits when the queue is empty, so that a slow or failing
+// endpoint holds at most eventDeliveryQueueSize events and one goroutine.
+type eventDeliveryQueue struct {
+	mu      sync.Mutex
+	pending []eventDeliveryJob
+	running bool
+}
+
+type eventDeliveryJob struct {
+	sub        model.EventSubscriptionInfo
+	event      model.Event
+	deliveryId string
+}
+
+// genEventSubscriptionKey generates the kvstore key of an event subscription, or of the
+// subscriptions of a namespace when subscriptionId is empty
+func genEventSubscriptionKey(nsId string, subscriptionId string) string {
+	key := "/ns/" + nsId + "/" + model.StrEventSubscription
+	if subscriptionId != "" {
+		key += "/" + subscriptionId
+	}
+	return key
+}
+
+// genEventDeliveryKey generates the kvstore key of a delivery record, or the prefix of the
+// delivery records of a subscription when deliveryId is empty
+func genEventDeliveryKey(nsId string, subscriptionId string, deliveryId string) string {
+	return fmt.Sprintf("/log/eventDelivery/ns/%s/subscription/%s/%s", nsId, subscriptionId, deliveryId)
+}
+
+// genEventDeadLetterKey is genEventDeliveryKey for the dead letters
+func genEventDeadLetterKey(nsId string, subscriptionId string, deliveryId string) string {
+	return fmt.Sprintf("/log/eventDeadLetter/ns/%s/subscription/%s/%s", nsId, subscriptionId, deliveryId)
+}
+
+// validateEventSubscriptionReq checks the endpoint, the secret and the filters of a request
+func validateEventSubscriptionReq(req *model.EventSubscriptionReq) error {
+	if err := validate.Struct(req); err != nil {
+		return err
+	}
+	u, err := url.Parse(req.Url)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url must be an absolute http(s) URL")
+	}
+	// Hostnames are checked when a delivery dials them; reject the obvious cases early
+	host := u.Hostname()
+	if strings.EqualFold(host, "localhost") {
+		host = "127.0.0.1"
+	}
+	if _, err := netip.ParseAddr(host); err == nil {
+		if err := checkEventDestination(net.JoinHostPort(host, "0")); err != nil {
+			return fmt.Errorf("url: %w (allow private ranges with %s)", err, model.StrWebhookAllowedCidrs)
+		}
+	}
+	switch req.Format {
+	case "", model.EventFormatCloudEvents, model.EventFormatText:
+	default:
+		return fmt.Errorf("invalid format %q (use %s or %s)", req.Format, model.EventFormatCloudEvents, model.EventFormatText)
+	}
+	if req.Secret != "" && req.Secret != autoWebhookSecretMask && len(req.Secret) < autoWebhookMinSecretLen {
+		return fmt.Errorf("secret must be at least %d characters", autoWebhookMinSecretLen)
+	}
+	for i, t := range req.EventTypes {
+		if strings.TrimSpace(t) == "" || strings.Contains(strings.TrimSuffix(t, "*"), "*") {
+			return fmt.Errorf("eventTypes[%d]: invalid event type %q ('*' is allowed at the end only)", i, t)
+		}
+	}
+	if req.MaxRetries < 0 || req.MaxRetries > eventDeliveryMaxRetries {
+		return fmt.Errorf("maxRetries must be between 0 (default: %d) and %d", eventDeliveryDefaultRetries, eventDeliveryMaxRetries)
+	}
+	return nil
+}
+
+// eventSubscriptionFromReq returns the subscription described by a request, without timestamps
+func eventSubscriptionFromReq(req *model.EventSubscriptionReq) model.EventSubscriptionInfo {
+	sub := model.EventSubscriptionInfo{
+		ResourceType:  model.StrEventSubscription,
+		Id:            req.Name,
+		Name:          req.Name,
+		Description:   req.Description,
+		Url:           req.Url,
+		Format:        req.Format,
+		Secret:        req.Secret,
+		EventTypes:    req.EventTypes,
+		Statuses:      req.Statuses,
+		LabelSelector: strings.TrimSpace(req.LabelSelector),
+		MaxRetries:    req.MaxRetries,
+		Disabled:      req.Disabled,
+	}
+	if sub.Format == "" {
+		sub.Format = model.EventFormatCloudEvents
+	}
+	if sub.MaxRetries == 0 {
+		sub.MaxRetries = eventDeliveryDefaultRetries
+	}
+	return sub
+}
+
+// maskEventSubscriptionSecret hides the secret of a subscription for responses
+func maskEventSubscriptionSecret(sub model.EventSubscriptionInfo) model.EventSubscriptionInfo {
+	if sub.Secret != "" {
+		sub.Secret = autoWebhookSecretMask
+	}
+	return sub
+}
+
+// CreateEventSubscription creates an outbound webhook subscription to the events of a namespace
+func CreateEventSubscription(nsId string, req *model.EventSubscriptionReq) (model.EventSubscriptionInfo, error) {
+	emptyResult := model.EventSubscriptionInfo{}
+
+	err := common.CheckString(req.Name)
+	if err != nil {
+		log.Error().Err(err).Msg("invalid subscription name")
+		return emptyResult, err
+	}
+	check, err := common.CheckNs(nsId)
+	if !check {
+		return emptyResult, fmt.Errorf("namespace '%s' does not exist", nsId)
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return emptyResult, err
+	}
+	if req.Secret == autoWebhookSecretMask {
+		return emptyResult, fmt.Errorf("secret must be at least %d characters", autoWebhookMinSecretLen)
+	}
+	if err := validateEventSubscriptionReq(req); err != nil {
+		return emptyResult, err
+	}
+
+	now := time.Now().Format(time.RFC3339)
+	sub := eventSubscriptionFromReq(req)
+	sub.CreatedAt = now
+	sub.UpdatedAt = now
+
+	val, err := json.Marshal(sub)
+	if err != nil {
+		return emptyResult, err
+	}
+	err = kvstore.UpdateWithRetry(context.Background(), genEventSubscriptionKey(nsId, sub.Id), func(_ string, exists bool) (string, bool, error) {
+		if exists {
+			return "", false, fmt.Errorf("event subscription '%s' already exists in namespace '%s'", sub.Id, nsId)
+		}
+		return string(val), true, nil
+	})
+	if err != nil {
+		return emptyResult, err
+	}
+	eventSubscriptionCache.Delete(nsId)
+	return maskEventSubscriptionSecret(sub), nil
+}
+
+// getEventSubscription returns a subscription with its secret
+func getEventSubscription(nsId string, subscriptionId string) (model.EventSubscriptionInfo, error) {
+	emptyResult := model.EventSubscriptionInfo{}
+
+	err := common.CheckString(nsId)
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return emptyResult, err
+	}
+	err = common.CheckString(subscriptionId)
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return emptyResult, err
+	}
+
+	keyValue, exists, err := kvstore.GetKv(genEventSubscriptionKey(nsId, subscriptionId))
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return emptyResult, err
+	}
+	if !exists {
+		return emptyResult, fmt.Errorf("event subscription '%s' not found in namespace '%s'", subscriptionId, nsId)
+	}
+
+	result := model.EventSubscriptionInfo{}
+	if err := json.Unmarshal([]byte(keyValue.Value), &result); err != nil {
+		log.Error().Err(err).Msg("failed to unmarshal event subscription")
+		return emptyResult, err
+	}
+	return result, nil
+}
+
+// GetEventSubscription returns a subscription, with its secret masked
+func GetEventSubscription(nsId string, subscriptionId string) (model.EventSubscriptionInfo, error) {
+	sub, err := getEventSubscription(nsId, subscriptionId)
+	if err != nil {
+		return sub, err
+	}
+	return maskEventSubscriptionSecret(sub), nil
+}
+
+// listEventSubscriptions lists the subscriptions of a namespace with their secrets
+func listEventSubscriptions(nsId string) ([]model.EventSubscriptionInfo, error) {
+	key := genEventSubscriptionKey(nsId, "")
+	keyValue, err := kvstore.GetKvList(key)
+	if err != nil {
+		return nil, err
+	}
+	keyValue = kvutil.FilterKvListBy(keyValue, key, 1)
+
+	subs := []model.EventSubscriptionInfo{}
+	for _, v := range keyValue {
+		sub := model.EventSubscriptionInfo{}
+		if err := json.Unmarshal([]byte(v.Value), &sub); err != nil {
+			log.Error().Err(err).Msg("failed to unmarshal event subscription")
+			continue
+		}
+		subs = append(subs, sub)
+	}
+	return subs, nil
+}
+
+// ListEventSubscription lists the subscriptions of a namespace, with their secrets masked
+func ListEventSubscription(nsId string) ([]model.EventSubscriptionInfo, error) {
+	err := common.CheckString(nsId)
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return nil, err
+	}
+	subs, err := listEventSubscriptions(nsId)
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return nil, err
+	}
+	for i := range subs {
+		subs[i] = maskEventSubscriptionSecret(subs[i])
+	}
+	return subs, nil
+}
+
+// UpdateEventSubscription replaces a subscription with a request. A masked secret
+// ("********") keeps the current secret.
+func UpdateEventSubscription(nsId string, subscriptionId string, req *model.EventSubscriptionReq) (model.EventSubscriptionInfo, error) {
+	emptyResult := model.EventSubscriptionInfo{}
+
+	err := common.CheckString(nsId)
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return emptyResult, err
+	}
+	err = common.CheckString(subscriptionId)
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return emptyResult, err
+	}
+
+	// Name is not changeable; it is tied to Id and the kvstore key
+	if req.Name == "" {
+		req.Name = subscriptionId
+	}
+	if req.Name != subscriptionId {
+		return emptyResult, fmt.Errorf("subscription name cannot be changed (name '%s' does not match subscription ID '%s')", req.Name, subscriptionId)
+	}
+	if err := validateEventSubscriptionReq(req); err != nil {
+		return emptyResult, err
+	}
+
+	var updated model.EventSubscriptionInfo
+	err = kvstore.UpdateWithRetry(context.Background(), genEventSubscriptionKey(nsId, subscriptionId), func(current string, exists bool) (string, bool, error) {
+		if !exists {
+			return "", false, fmt.Errorf("event subscription '%s' not found in namespace '%s'", subscriptionId, nsId)
+		}
+		existing := model.EventSubscriptionInfo{}
+		if err := json.Unmarshal([]byte(current), &existing); err != nil {
+			return "", false, err
+		}
+		updated = eventSubscriptionFromReq(req)
+		if req.Secret == autoWebhookSecretMask {
+			updated.Secret = existing.Secret
+		}
+		updated.CreatedAt = existing.CreatedAt
+		updated.UpdatedAt = time.Now().Format(time.RFC3339)
+		val, err := json.Marshal(updated)
+		if err != nil {
+			return "", false, err
+		}
+		return string(val), true, nil
+	})
+	if err != nil {
+		return emptyResult, err
+	}
+	eventSubscriptionCache.Delete(nsId)
+	return maskEventSubscriptionSecret(updated), nil
+}
+
+// DeleteEventSubscription deletes a subscription with its delivery history and dead letters.
+// Deliveries being retried stop before their next attempt.
+func DeleteEventSubscription(nsId string, subscriptionId string) error {
+	if _, err := getEventSubscription(nsId, subscriptionId); err != nil {
+		return err
+	}
+	if err := kvstore.Delete(genEventSubscriptionKey(nsId, subscriptionId)); err != nil {
+		log.Error().Err(err).Msg("failed to delete event subscription")
+		return err
+	}
+	eventSubscriptionCache.Delete(nsId)
+	if err := kvstore.DeleteWithPrefix(genEventDeliveryKey(nsId, subscriptionId, "")); err != nil {
+		log.Error().Err(err).Msg("failed to delete the delivery history of the event subscription")
+	}
+	if err := kvstore.DeleteWithPrefix(genEventDeadLetterKey(nsId, subscriptionId, "")); err != nil {
+		log.Error().Err(err).Msg("failed to delete the dead letters of the event subscription")
+	}
+	return nil
+}
+
+// DeleteAllEventSubscription deletes all event subscriptions in a namespace
+func DeleteAllEventSubscription(nsId string) error {
+	subs, err := ListEventSubscription(nsId)
+	if err != nil {
+		return err
+	}
+	for _, sub := range subs {
+		if err := DeleteEventSubscription(nsId, sub.Id); err != nil {
+			log.Error().Err(err).Msgf("failed to delete event subscription '%s'", sub.Id)
+			return err
+		}
+	}
+	return nil
+}
+
+// listEventDeliveryRecords reads the records under a prefix, newest first
+func listEventDeliveryRecords(prefix string) ([]model.EventDelivery, error) {
+	keyValue, err := kvstore.GetKvList(prefix)
+	if err != nil {
+		return nil, err
+	}
+	records := []model.EventDelivery{}
+	for _, v := range keyValue {
+		d := model.EventDelivery{}
+		if err := json.Unmarshal([]byte(v.Value), &d); err != nil {
+			continue
+		}
+		records = append(records, d)
+	}
+	slices.SortFunc(records, func(a, b model.EventDelivery) int {
+		ta, _ := time.Parse(time.RFC3339Nano, a.CreatedAt)
+		tb, _ := time.Parse(time.RFC3339Nano, b.CreatedAt)
+		return tb.Compare(ta)
+	})
+	return records, nil
+}
+
+// ListEventDeliveries returns the recent deliveries of a subscription, newest first
+func ListEventDeliveries(nsId string, subscriptionId string) ([]model.EventDelivery, error) {
+	if _, err := getEventSubscription(nsId, subscriptionId); err != nil {
+		return nil, err
+	}
+	return listEventDeliveryRecords(genEventDeliveryKey(nsId, subscriptionId, ""))
+}
+
+// ListEventDeadLetters returns the dead letters of a subscription, newest first
+func ListEventDeadLetters(nsId string, subscriptionId string) ([]model.EventDelivery, error) {
+	if _, err := getEventSubscription(nsId, subscriptionId); err != nil {
+		return nil, err
+	}
+	return listEventDeliveryRecords(genEventDeadLetterKey(nsId, subscriptionId, ""))
+}
+
+// DeleteEventDeadLetters drops the dead letters of a subscription
+func DeleteEventDeadLetters(nsId string, subscriptionId string) error {
+	if _, err := getEventSubscription(nsId, subscriptionId); err != nil {
+		return err
+	}
+	return kvstore.DeleteWithPrefix(genEventDeadLetterKey(nsId, subscriptionId, ""))
+}
+
+// RedeliverEventDeadLetter removes a dead letter and delivers its event again, in the
+// background, with the current settings of the subscription. It returns the ID of the
+// new delivery, to be followed in the delivery history.
+func RedeliverEventDeadLetter(nsId string, subscriptionId string, deliveryId string) (string, error) {
+	sub, err := getEventSubscription(nsId, subscriptionId)
+	if err != nil {
+		return "", err
+	}
+	if sub.Disabled {
+		return "", fmt.Errorf("event subscription '%s' is disabled", subscriptionId)
+	}
+	key := genEventDeadLetterKey(nsId, subscriptionId, deliveryId)
+	keyValue, exists, err := kvstore.GetKv(key)
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		return "", fmt.Errorf("dead letter '%s' not found for event subscription '%s'", deliveryId, subscriptionId)
+	}
+	dead := model.EventDelivery{}
+	if err := json.Unmarshal([]byte(keyValue.Value), &dead); err != nil || dead.Event == nil {
+		return "", fmt.Errorf("dead letter '%s' has no event to redeliver", deliveryId)
+	}
+	if err := kvstore.Delete(key); err != nil {
+		return "", err
+	}
+
+	newId := common.GenUid()
+	enqueueEventDelivery(nsId, sub, *dead.Event, newId)
+	return newId, nil
+}
+
+// StartEventSubscriptionDispatcher subscribes to the internal event bus and delivers the
+// events to the matching webhook subscriptions. Every replica delivers the events it
+// publishes itself, so it runs on all replicas.
+func StartEventSubscriptionDispatcher() {
+	eventSubscriptionDispatcherOnce.Do(func() {
+		common.SubscribeEvents("eventSubscription", nil, dispatchEvent)
+		log.Info().Msg("Event subscription dispatcher started")
+	})
+}
+
+// dispatchEvent queues a delivery of an event for each matching subscription
+func dispatchEvent(event model.Event) {
+	if event.Data.NsId == "" {
+		return
+	}
+	subs, err := cachedEventSubscriptions(event.Data.NsId)
+	if err != nil {
+		log.Warn().Err(err).Msgf("Cannot read the event subscriptions of namespace %s", event.Data.NsId)
+		return
+	}
+	for _, sub := range subs {
+		if sub.Disabled || !eventSubscriptionMatches(sub, event) {
+			continue
+		}
+		enqueueEventDelivery(event.Data.NsId, sub, event, common.GenUid())
+	}
+}
+
+// cachedEventSubscriptions returns the subscriptions of a namespace, read from the kvstore
+// at most every eventSubscriptionCacheTTL. Changes made on this replica drop the cache.
+func cachedEventSubscriptions(nsId string) ([]model.EventSubscriptionInfo, error) {
+	if v, ok := eventSubscriptionCache.Load(nsId); ok {
+		if entry := v.(eventSubscriptionCacheEntry); time.Since(entry.loadedAt) < eventSubscriptionCacheTTL {
+			return entry.subs, nil
+		}
+	}
+	subs, err := listEventSubscriptions(nsId)
+	if err != nil {
+		return nil, err
+	}
+	eventSubscriptionCache.Store(nsId, eventSubscriptionCacheEntry{subs: subs, loadedAt: time.Now()})
+	return subs, nil
+}
+
+// enqueueEventDelivery adds a delivery to the queue of its subscription and starts the
+// worker of the queue if needed. An event that does not fit is dead-lettered right away.
+func enqueueEventDelivery(nsId string, sub model.EventSubscriptionInfo, event model.Event, deliveryId string) {
+	v, _ := eventDeliveryQueues.LoadOrStore(nsId+"/"+sub.Id, &eventDeliveryQueue{})
+	q := v.(*eventDeliveryQueue)
+
+	q.mu.Lock()
+	if len(q.pending) >= eventDeliveryQueueSize {
+		q.mu.Unlock()
+		deadLetterEvent(nsId, sub, event, newEventDelivery(sub, event, deliveryId),
+			fmt.Errorf("the delivery queue of the subscription is full (%d events)", eventDeliveryQueueSize))
+		return
+	}
+	q.pending = append(q.pending, eventDeliveryJob{sub: sub, event: event, deliveryId: deliveryId})
+	start := !q.running
+	q.running = true
+	q.mu.Unlock()
+
+	if start {
+		go q.run(nsId)
+	}
+}
+
+// run delivers the queued events in order until the queue is empty
+func (q *eventDeliveryQueue) run(nsId string) {
+	for {
+		q.mu.Lock()
+		if len(q.pending) == 0 {
+			q.pending = nil
+			q.running = false
+			q.mu.Unlock()
+			return
+		}
+		job := q.pending[0]
+		q.pending = q.pending[1:]
+		q.mu.Unlock()
+
+		deliverEvent(nsId, job.sub, job.event, job.deliveryId)
+	}
+}
+
+// eventSubscriptionMatches reports whether an event passes the filters of a subscription
+func eventSubscriptionMatches(sub model.EventSubscriptionInfo, event model.Event) bool {
+	if len(sub.EventTypes) > 0 && !slices.ContainsFunc(sub.EventTypes, func(pattern string) bool {
+		pattern = strings.TrimSpace(pattern)
+		if !strings.HasPrefix(pattern, model.EventTypePrefix) {
+			pattern = model.EventTypePrefix + pattern
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			return strings.HasPrefix(event.Type, prefix)
+		}
+		return event.Type == pattern
+	}) {
+		return false
+	}
+	if len(sub.Statuses) > 0 && !slices.ContainsFunc(sub.Statuses, func(status string) bool {
+		return strings.EqualFold(strings.TrimSpace(status), event.Data.NewStatus)
+	}) {
+		return false
+	}
+	if sub.LabelSelector != "" && !label.MatchesLabelSelector(event.Data.Labels, sub.LabelSelector) {
+		return false
+	}
+	return true
+}
+
+// deliverEvent posts an event to a subscription, retrying with exponential backoff, and
+// dead-letters it when the retries are exhausted or the endpoint rejects it
+func deliverEvent(nsId string, sub model.EventSubscriptionInfo, event model.Event, deliveryId string) {
+	d := newEventDelivery(sub, event, deliveryId)
+
+	backoff := eventDeliveryBaseBackoff
+	for {
+		code, err := postEvent(sub, event, deliveryId)
+		d.Attempts++
+		d.ResponseCode = code
+		d.LastAttemptAt = time.Now().UTC().Format(time.RFC3339Nano)
+		d.Error = ""
+
+		switch {
+		case err == nil:
+			d.Status = model.EventDeliveryDelivered
+			putEventDeliveryRecord(genEventDeliveryKey(nsId, sub.Id, d.Id), d, eventDeliveryHistoryLimit)
+			return
+
+		case d.Attempts > sub.MaxRetries || !retryableDeliveryCode(code) || errors.Is(err, errEventDestinationBlocked):
+			deadLetterEvent(nsId, sub, event, d, err)
+			return
+		}
+
+		d.Error = err.Error()
+		d.Status = model.EventDeliveryRetrying
+		putEventDeliveryRecord(genEventDeliveryKey(nsId, sub.Id, d.Id), d, 0)
+		time.Sleep(backoff)
+		backoff = min(backoff*2, eventDeliveryMaxBackoff)
+
+		// Pick up changes of the subscription; stop if it was deleted or disabled meanwhile
+		current, err := getEventSubscription(nsId, sub.Id)
+		if err != nil || current.Disabled {
+			log.Info().Msgf("Delivery %s of event %s stopped: subscription %s was deleted or disabled", d.Id, event.Id, sub.Id)
+			return
+		}
+		sub = current
+	}
+}
+
+// newEventDelivery returns the record of a new delivery of an event to a subscription
+func newEventDelivery(sub model.EventSubscriptionInfo, event model.Event, deliveryId string) model.EventDelivery {
+	return model.EventDelivery{
+		Id:             deliveryId,
+		SubscriptionId: sub.Id,
+		EventId:        event.Id,
+		EventType:      event.Type,
+		Subject:        event.Subject,
+		CreatedAt:      time.Now().UTC().Format(time.RFC3339Nano),
+	}
+}
+
+// deadLetterEvent records a delivery that failed for good in the history of the
+// subscription and keeps its event in the dead letters
+func deadLetterEvent(nsId string, sub model.EventSubscriptionInfo, event model.Event, d model.EventDelivery, err error) {
+	d.Error = err.Error()
+	d.Status = model.EventDeliveryDeadLettered
+	putEventDeliveryRecord(genEventDeliveryKey(nsId, sub.Id, d.Id), d, eventDeliveryHistoryLimit)
+	d.Event = &event
+	putEventDeliveryRecord(genEventDeadLetterKey(nsId, sub.Id, d.Id), d, eventDeadLetterLimit)
+	log.Warn().Err(err).Msgf("Event %s dead-lettered for subscription %s after %d attempts", event.Id, sub.Id, d.Attempts)
+}
+
+// checkEventDestination rejects the loopback, private, link-local, unspecified and
+// multicast addresses, unless they are in TB_WEBHOOK_ALLOWED_CIDRS. address is the
+// "ip:port" being dialed.
+func checkEventDestination(address string) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	ip = ip.Unmap().WithZone("")
+	if !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() && !ip.IsMulticast() && !ip.IsUnspecified() {
+		return nil
+	}
+	for _, cidr := range strings.Split(model.WebhookAllowedCidrs, ",") {
+		prefix, err := netip.ParsePrefix(strings.TrimSpace(cidr))
+		if err == nil && prefix.Contains(ip) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", errEventDestinationBlocked, ip)
+}
+
+// retryableDeliveryCode reports whether a failed attempt is worth retrying: no response,
+// a timeout, throttling or a server error. Other client errors will fail the same way.
+func retryableDeliveryCode(code int) bool {
+	return code == 0 || code == http.StatusRequestTimeout || code == http.StatusTooManyRequests || code >= 500
+}
+
+// postEvent sends one attempt of a delivery and returns the HTTP status of the response
+func postEvent(sub model.EventSubscriptionInfo, event model.Event, deliveryId string) (int, error) {
+	var body []byte
+	var err error
+	contentType := "application/json"
+	if sub.Format == model.EventFormatText {
+		body, err = json.Marshal(map[string]string{"text": eventSummary(event)})
+	} else {
+		body, err = json.Marshal(event)
+		contentType = "application/cloudevents+json"
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, sub.Url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("User-Agent", "cb-tumblebug")
+	req.Header.Set("x-tb-event-type", event.Type)
+	req.Header.Set("x-tb-delivery-id", deliveryId)
+	if sub.Secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set("x-tb-timestamp", timestamp)
+		req.Header.Set("x-tb-signature", AutoWebhookSignature(sub.Secret, timestamp, body))
+	}
+
+	eventDeliverySlots <- struct{}{}
+	defer func() { <-eventDeliverySlots }()
+
+	resp, err := eventDeliveryClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("the endpoint responded %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// eventSummary is the one-line text of an event for chat webhooks, e.g.
+// "[Tumblebug] node.statusChanged /tumblebug/ns/default/infra/infra01/node/g1-1: Running → Terminated"
+func eventSummary(event model.Event) string {
+	summary := fmt.Sprintf("[Tumblebug] %s %s", strings.TrimPrefix(event.Type, model.EventTypePrefix), event.Source)
+	switch {
+	case event.Data.OldStatus != "":
+		summary += ": " + event.Data.OldStatus + " → " + event.Data.NewStatus
+	case event.Data.NewStatus != "":
+		summary += ": " + event.Data.NewStatus
+	}
+	if event.Data.Message != "" {
+		summary += " (" + event.Data.Message + ")"
+	}
+	return summary
+}
+
+// putEventDeliveryRecord stores a delivery record and, when limit is set, drops the
+// oldest records of the same subscription beyond limit
+func putEventDeliveryRecord(key string, d model.EventDelivery, limit int) {
+	val, err := json.Marshal(d)
+	if err != nil {
+		return
+	}
+	if err := kvstore.Put(key, string(val)); err != nil {
+		log.Error().Err(err).Msgf("Failed to store the record of delivery %s", d.Id)
+		return
+	}
+	if limit <= 0 {
+		return
+	}
+	prefix := key[:strings.LastIndex(key, "/")+1]
+	records, err := listEventDeliveryRecords(prefix)
+	if err != nil || len(records) <= limit {
+		return
+	}
+	for _, old := range records[limit:] {
+		kvstore.Delete(prefix + old.Id)
+	}
+}
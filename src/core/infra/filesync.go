@@ -0,0 +1,588 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package infra is to manage multi-cloud infra
+package infra
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloud-barista/cb-tumblebug/src/core/common"
+	"github.com/cloud-barista/cb-tumblebug/src/core/model"
+	"github.com/cloud-barista/cb-tumblebug/src/core/resource"
+	"github.com/rs/zerolog/log"
+)
+
+// FileSyncMaxBytes caps the total size of the files of a sync source, which are held in memory.
+// Override with TB_FILE_SYNC_MAX_MB.
+var FileSyncMaxBytes = func() int64 {
+	if v := os.Getenv("TB_FILE_SYNC_MAX_MB"); v != "" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil && n > 0 {
+			return n << 20
+		}
+	}
+	return 256 << 20
+}()
+
+// fileSyncConcurrency caps the Nodes synced at once
+const fileSyncConcurrency = 20
+
+// syncFile is a file of a sync source
+type syncFile struct {
+	path string // relative to the target path, slash-separated
+	data []byte
+	mode int64
+	sum  string // hex sha256 of data
+}
+
+// remoteSyncFile is the state of a file under the target path of a Node
+type remoteSyncFile struct {
+	sum   string
+	mode  int64
+	owner string // user:group
+}
+
+// newSyncFile returns a source file with its relative path checked
+func newSyncFile(name string, data []byte, mode int64) (syncFile, error) {
+	rel := path.Clean(strings.TrimPrefix(name, "./"))
+	if path.IsAbs(rel) || rel == ".." || strings.HasPrefix(rel, "../") || rel == "." {
+		return syncFile{}, fmt.Errorf("invalid file path %q in the sync source", name)
+	}
+	if strings.ContainsAny(rel, "\n\x00") {
+		return syncFile{}, fmt.Errorf("unsupported file name %q in the sync source", name)
+	}
+	sum := sha256.Sum256(data)
+	return syncFile{path: rel, data: data, mode: mode & 0o7777, sum: hex.EncodeToString(sum[:])}, nil
+}
+
+// readSyncTarball returns the regular files of a tar or tar.gz archive
+func readSyncTarball(data []byte) ([]syncFile, error) {
+	var r io.Reader = bytes.NewReader(data)
+	if len(data) > 2 && data[0] == 0x1f && data[1] == 0x8b {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gzip data: %w", err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	byPath := map[string]syncFile{}
+	var total int64
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid tar archive: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue // directories are implied by the files; links are not synced
+		}
+		total += hdr.Size
+		if total > FileSyncMaxBytes {
+			return nil, fmt.Errorf("the files of the archive exceed %d MB", FileSyncMaxBytes>>20)
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read %s from the archive: %w", hdr.Name, err)
+		}
+		f, err := newSyncFile(hdr.Name, content, hdr.Mode)
+		if err != nil {
+			return nil, err
+		}
+		byPath[f.path] = f
+	}
+	return sortedSyncFiles(byPath), nil
+}
+
+// readSyncObjectStorage downloads the objects below a prefix of an object storage
+func readSyncObjectStorage(nsId string, osId string, prefix string) ([]syncFile, error) {
+	list, err := resource.ListDataObjects(nsId, osId)
+	if err != nil {
+		return nil, err
+	}
+
+	byPath := map[string]syncFile{}
+	var total int64
+	client := &http.Client{Timeout: 10 * time.Minute}
+	for _, obj := range list.Objects {
+		if !strings.HasPrefix(obj.Key, prefix) || strings.HasSuffix(obj.Key, "/") {
+			continue
+		}
+		rel := strings.TrimLeft(strings.TrimPrefix(obj.Key, prefix), "/")
+		if rel == "" {
+			continue
+		}
+		total += obj.Size
+		if total > FileSyncMaxBytes {
+			return nil, fmt.Errorf("the objects below %q exceed %d MB", prefix, FileSyncMaxBytes>>20)
+		}
+
+		url, err := resource.GeneratePresignedURL(nsId, osId, obj.Key, 10*time.Minute, "download")
+		if err != nil {
+			return nil, err
+		}
+		resp, err := client.Get(url.PreSignedURL)
+		if err != nil {
+			return nil, fmt.Errorf("cannot download object %s: %w", obj.Key, err)
+		}
+		content, err := io.ReadAll(io.LimitReader(resp.Body, FileSyncMaxBytes+1))
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("cannot download object %s: %w", obj.Key, err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("cannot download object %s: HTTP %d", obj.Key, resp.StatusCode)
+		}
+		f, err := newSyncFile(rel, content, 0o644)
+		if err != nil {
+			return nil, err
+		}
+		byPath[f.path] = f
+	}
+	if len(byPath) == 0 {
+		return nil, fmt.Errorf("no object below %q in object storage %s", prefix, osId)
+	}
+	return sortedSyncFiles(byPath), nil
+}
+
+func sortedSyncFiles(byPath map[string]syncFile) []syncFile {
+	files := make([]syncFile, 0, len(byPath))
+	for _, f := range byPath {
+		files = append(files, f)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].path < files[j].path })
+	return files
+}
+
+// SyncTarballToInfra reconciles the files of a tar or tar.gz archive to the target path of
+// the selected Nodes of an Infra.
+func SyncTarballToInfra(nsId string, infraId string, nodeGroupId string, nodeId string, labelSelector string, tarball []byte, req *model.FileSyncReq) (model.FileSyncResult, error) {
+	if err := validateFileSyncReq(req); err != nil {
+		return model.FileSyncResult{}, err
+	}
+	files, err := readSyncTarball(tarball)
+	if err != nil {
+		return model.FileSyncResult{}, err
+	}
+	if len(files) == 0 {
+		return model.FileSyncResult{}, fmt.Errorf("the archive has no regular file")
+	}
+	return syncFilesToInfra(nsId, infraId, nodeGroupId, nodeId, labelSelector, files, req)
+}
+
+// SyncObjectStorageToInfra reconciles the objects below req.Prefix of an object storage to
+// the target path of the selected Nodes of an Infra.
+func SyncObjectStorageToInfra(nsId string, infraId string, nodeGroupId string, nodeId string, labelSelector string, osId string, req *model.FileSyncReq) (model.FileSyncResult, error) {
+	if err := validateFileSyncReq(req); err != nil {
+		return model.FileSyncResult{}, err
+	}
+	files, err := readSyncObjectStorage(nsId, osId, req.Prefix)
+	if err != nil {
+		return model.FileSyncResult{}, err
+	}
+	return syncFilesToInfra(nsId, infraId, nodeGroupId, nodeId, labelSelector, files, req)
+}
+
+// validateFileSyncReq checks and normalizes the target and the attributes of a sync request
+func validateFileSyncReq(req *model.FileSyncReq) error {
+	if err := validate.Struct(req); err != nil {
+		return err
+	}
+	if !path.IsAbs(req.TargetPath) {
+		return fmt.Errorf("targetPath must be an absolute path")
+	}
+	req.TargetPath = path.Clean(req.TargetPath)
+	if req.TargetPath == "/" {
+		return fmt.Errorf("targetPath must not be the root directory")
+	}
+	if strings.ContainsAny(req.TargetPath, "\n\x00") {
+		return fmt.Errorf("unsupported targetPath %q", req.TargetPath)
+	}
+	if req.FileMode != "" {
+		if _, err := strconv.ParseUint(req.FileMode, 8, 32); err != nil {
+			return fmt.Errorf("invalid fileMode %q (use octal, e.g. 0644)", req.FileMode)
+		}
+	}
+	if req.Owner != "" && strings.ContainsAny(req.Owner, " '\"\\\n") {
+		return fmt.Errorf("invalid owner %q", req.Owner)
+	}
+	return nil
+}
+
+// fileSyncTargets returns the Nodes of an Infra selected by NodeGroup, Node or label selector
+func fileSyncTargets(nsId string, infraId string, nodeGroupId string, nodeId string, labelSelector string) ([]string, error) {
+	exists, err := CheckInfra(nsId, infraId)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("the infra %s does not exist", infraId)
+	}
+	switch {
+	case nodeId != "":
+		return []string{nodeId}, nil
+	case nodeGroupId != "":
+		return ListNodeByNodeGroup(nsId, infraId, nodeGroupId)
+	case labelSelector != "":
+		return getNodeIdsByLabel(nsId, infraId, labelSelector)
+	}
+	return ListNodeId(nsId, infraId)
+}
+
+// syncFilesToInfra reconciles the source files on each target Node in parallel
+func syncFilesToInfra(nsId string, infraId string, nodeGroupId string, nodeId string, labelSelector string, files []syncFile, req *model.FileSyncReq) (model.FileSyncResult, error) {
+	result := model.FileSyncResult{TargetPath: req.TargetPath, SourceFiles: len(files), DryRun: req.DryRun}
+	for _, f := range files {
+		result.SourceBytes += int64(len(f.data))
+	}
+
+	nodeIds, err := fileSyncTargets(nsId, infraId, nodeGroupId, nodeId, labelSelector)
+	if err != nil {
+		return result, err
+	}
+	if len(nodeIds) == 0 {
+		return result, fmt.Errorf("no target Node in infra %s", infraId)
+	}
+
+	log.Info().Msgf("Syncing %d files (%d bytes) to %s on %d Nodes of infra %s", len(files), result.SourceBytes, req.TargetPath, len(nodeIds), infraId)
+	result.Results = make([]model.FileSyncNodeResult, len(nodeIds))
+	sem := make(chan struct{}, fileSyncConcurrency)
+	var wg sync.WaitGroup
+	for i, id := range nodeIds {
+		wg.Add(1)
+		go func(i int, id string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			result.Results[i] = syncFilesToNode(nsId, infraId, id, files, req)
+		}(i, id)
+	}
+	wg.Wait()
+
+	for _, r := range result.Results {
+		if r.Error != "" {
+			result.FailedNodes++
+		}
+	}
+	return result, nil
+}
+
+// syncFilesToNode compares the source files with the files under the target path of a
+// Node and sends the difference in one archive, applied by a single remote script.
+func syncFilesToNode(nsId string, infraId string, nodeId string, files []syncFile, req *model.FileSyncReq) model.FileSyncNodeResult {
+	result := model.FileSyncNodeResult{NodeId: nodeId}
+	fail := func(format string, args ...any) model.FileSyncNodeResult {
+		result.Error = fmt.Sprintf(format, args...)
+		log.Warn().Str("nodeId", nodeId).Msgf("File sync failed: %s", result.Error)
+		return result
+	}
+
+	nodeInfo, err := GetNodeObject(nsId, infraId, nodeId)
+	if err != nil {
+		return fail("failed to get Node status: %v", err)
+	}
+	if nodeInfo.Status != model.StatusRunning {
+		return fail("Node '%s' is in '%s' status (not Running)", nodeId, nodeInfo.Status)
+	}
+	result.NodeIp = nodeInfo.PublicIP
+
+	remote, err := listRemoteSyncFiles(nsId, infraId, nodeId, req.TargetPath)
+	if err != nil {
+		return fail("failed to list %s: %v", req.TargetPath, err)
+	}
+
+	var send []syncFile
+	for _, f := range files {
+		r, ok := remote[f.path]
+		switch {
+		case !ok:
+			result.Added = append(result.Added, f.path)
+		case r.sum != f.sum:
+			result.Updated = append(result.Updated, f.path)
+		case syncAttrsDiffer(r, f, req):
+			result.AttrFixed = append(result.AttrFixed, f.path)
+		default:
+			result.Unchanged++
+			continue
+		}
+		send = append(send, f)
+	}
+	var extraneous []string
+	if req.DeleteExtraneous {
+		inSource := make(map[string]bool, len(files))
+		for _, f := range files {
+			inSource[f.path] = true
+		}
+		for p := range remote {
+			if !inSource[p] {
+				extraneous = append(extraneous, p)
+			}
+		}
+		sort.Strings(extraneous)
+		result.Deleted = extraneous
+	}
+
+	if req.DryRun || (len(send) == 0 && len(extraneous) == 0) {
+		return result
+	}
+
+	archive, err := buildSyncArchive(send, files, extraneous, req)
+	if err != nil {
+		return fail("failed to build the archive: %v", err)
+	}
+	sshInfo, err := nodeSshInfo(nsId, infraId, nodeId)
+	if err != nil {
+		return fail("%v", err)
+	}
+	archiveName := fmt.Sprintf("tb-filesync-%s.tar.gz", common.GenUid())
+	if err := transferFileToNodeViaBastion(nsId, infraId, nodeId, sshInfo, archive, archiveName, "/tmp"); err != nil {
+		return fail("failed to transfer the archive: %v", err)
+	}
+	_, stderr, err := RunRemoteCommand(nsId, infraId, nodeId, "", []string{fileSyncApplyScript("/tmp/"+archiveName, req)})
+	if err != nil {
+		return fail("failed to apply the changes: %v %s", err, strings.TrimSpace(stderr[0]))
+	}
+	log.Info().Str("nodeId", nodeId).Msgf("File sync applied: %d added, %d updated, %d attributes fixed, %d deleted",
+		len(result.Added), len(result.Updated), len(result.AttrFixed), len(result.Deleted))
+	return result
+}
+
+// nodeSshInfo returns the SSH endpoint and credentials of a Node
+func nodeSshInfo(nsId string, infraId string, nodeId string) (model.SshInfo, error) {
+	_, nodeIp, sshPort, err := GetNodeIp(nsId, infraId, nodeId)
+	if err != nil {
+		return model.SshInfo{}, fmt.Errorf("failed to get Node IP: %v", err)
+	}
+	userName, privateKey, err := VerifySshUserName(nsId, infraId, nodeId, nodeIp, sshPort, "")
+	if err != nil {
+		return model.SshInfo{}, fmt.Errorf("failed to verify SSH username: %v", err)
+	}
+	return model.SshInfo{
+		EndPoint:   fmt.Sprintf("%s:%d", nodeIp, sshPort),
+		UserName:   userName,
+		PrivateKey: []byte(privateKey),
+	}, nil
+}
+
+// fileSyncSudo runs the rest of a remote script with sudo unless the SSH user is root
+const fileSyncSudo = `SUDO=""; [ "$(id -u)" = 0 ] || SUDO="sudo -n"`
+
+// listRemoteSyncFiles returns the checksum, mode and owner of the files under a directory of a Node.
+// The attributes come from GNU find -printf, or from stat -c on images without it (BusyBox, Alpine).
+func listRemoteSyncFiles(nsId string, infraId string, nodeId string, targetPath string) (map[string]remoteSyncFile, error) {
+	cmd := fileSyncSudo + "\n" +
+		`$SUDO sh -c 'cd "$1" 2>/dev/null || exit 0
+if find . -maxdepth 0 -printf "" 2>/dev/null; then find . -type f -printf "A %m %u:%g %P\n"
+elif stat -c %a . >/dev/null 2>&1; then find . -type f -exec stat -c "A %a %U:%G %n" {} +
+else echo "file sync needs find -printf or stat -c on the Node" >&2; exit 1; fi
+find . -type f -print0 | xargs -0 -r sha256sum' _ ` + shellQuote(targetPath)
+	stdout, stderr, err := RunRemoteCommand(nsId, infraId, nodeId, "", []string{cmd})
+	if err != nil {
+		return nil, fmt.Errorf("%v %s", err, strings.TrimSpace(stderr[0]))
+	}
+
+	remote := map[string]remoteSyncFile{}
+	scanner := bufio.NewScanner(strings.NewReader(stdout[0]))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if attrs, ok := strings.CutPrefix(line, "A "); ok {
+			parts := strings.SplitN(attrs, " ", 3)
+			if len(parts) != 3 {
+				continue
+			}
+			mode, _ := strconv.ParseInt(parts[0], 8, 64)
+			// stat -c %n prints the path as found ("./<path>"), find -printf %P without "./"
+			p := strings.TrimPrefix(parts[2], "./")
+			f := remote[p]
+			f.mode, f.owner = mode, parts[1]
+			remote[p] = f
+			continue
+		}
+		// sha256sum prints "<sum>  ./<path>"; names it has to escape start with '\' and stay unknown
+		sum, p, ok := strings.Cut(line, "  ./")
+		if !ok || len(sum) != 64 {
+			continue
+		}
+		f := remote[p]
+		f.sum = sum
+		remote[p] = f
+	}
+	return remote, scanner.Err()
+}
+
+// syncAttrsDiffer tells whether the owner or mode of a Node file differs from the requested ones
+func syncAttrsDiffer(r remoteSyncFile, f syncFile, req *model.FileSyncReq) bool {
+	wantMode := f.mode
+	if req.FileMode != "" {
+		m, _ := strconv.ParseInt(req.FileMode, 8, 64)
+		wantMode = m
+	}
+	if r.mode != wantMode {
+		return true
+	}
+	if req.Owner == "" {
+		return false
+	}
+	if strings.Contains(req.Owner, ":") {
+		return r.owner != req.Owner
+	}
+	user, _, _ := strings.Cut(r.owner, ":")
+	return user != req.Owner
+}
+
+// buildSyncArchive packs the files to send below files/, and the lists the apply script
+// works on: the paths to chown (attrs, dirs), to delete (delete) and the directories left
+// by the deleted files to remove if they end up empty (prune), NUL-separated.
+func buildSyncArchive(send []syncFile, all []syncFile, extraneous []string, req *model.FileSyncReq) ([]byte, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	now := time.Now()
+
+	var fileMode int64
+	if req.FileMode != "" {
+		fileMode, _ = strconv.ParseInt(req.FileMode, 8, 64)
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: "files/", Typeflag: tar.TypeDir, Mode: 0o755, ModTime: now}); err != nil {
+		return nil, err
+	}
+	dirs := map[string]bool{}
+	for _, f := range send {
+		for d := path.Dir(f.path); d != "."; d = path.Dir(d) {
+			if dirs[d] {
+				break
+			}
+			dirs[d] = true
+			if err := tw.WriteHeader(&tar.Header{Name: "files/" + d + "/", Typeflag: tar.TypeDir, Mode: 0o755, ModTime: now}); err != nil {
+				return nil, err
+			}
+		}
+		mode := f.mode
+		if fileMode != 0 {
+			mode = fileMode
+		}
+		if err := tw.WriteHeader(&tar.Header{Name: "files/" + f.path, Typeflag: tar.TypeReg, Mode: mode, Size: int64(len(f.data)), ModTime: now}); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(f.data); err != nil {
+			return nil, err
+		}
+	}
+
+	abs := func(p string) string { return path.Join(req.TargetPath, p) }
+	var attrs, ownedDirs, del []string
+	if req.Owner != "" {
+		for _, f := range send {
+			attrs = append(attrs, abs(f.path))
+		}
+		owned := map[string]bool{req.TargetPath: true}
+		for _, f := range all {
+			for d := path.Dir(f.path); d != "."; d = path.Dir(d) {
+				owned[abs(d)] = true
+			}
+		}
+		for d := range owned {
+			ownedDirs = append(ownedDirs, d)
+		}
+		sort.Strings(ownedDirs)
+	}
+	pruneSet := map[string]bool{}
+	for _, p := range extraneous {
+		del = append(del, abs(p))
+		for d := path.Dir(p); d != "."; d = path.Dir(d) {
+			pruneSet[d] = true
+		}
+	}
+	var prune []string
+	for d := range pruneSet {
+		prune = append(prune, d)
+	}
+	// Deepest first, so a directory is emptied of its subdirectories before it is tried
+	sort.Slice(prune, func(i, j int) bool {
+		if di, dj := strings.Count(prune[i], "/"), strings.Count(prune[j], "/"); di != dj {
+			return di > dj
+		}
+		return prune[i] < prune[j]
+	})
+	for i := range prune {
+		prune[i] = abs(prune[i])
+	}
+	for name, list := range map[string][]string{"attrs": attrs, "dirs": ownedDirs, "delete": del, "prune": prune} {
+		content := []byte(strings.Join(list, "\x00"))
+		if err := tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0o600, Size: int64(len(content)), ModTime: now}); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(content); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// fileSyncApplyScript returns the remote script that applies a sync archive to the target path
+func fileSyncApplyScript(archivePath string, req *model.FileSyncReq) string {
+	target := shellQuote(req.TargetPath)
+	lines := []string{
+		"set -e",
+		fileSyncSudo,
+		"A=" + shellQuote(archivePath) + `; W=$(mktemp -d); trap 'rm -rf "$W" "$A"' EXIT`,
+		`tar -xzf "$A" -C "$W" attrs dirs delete prune`,
+		"$SUDO mkdir -p " + target,
+		`$SUDO tar -xzpf "$A" -C ` + target + " --no-same-owner --strip-components=1 files",
+		`xargs -0 -r $SUDO rm -f -- < "$W/delete"`,
+	}
+	if req.DeleteExtraneous {
+		// Only the directories emptied by this sync are removed; rmdir keeps non-empty ones
+		lines = append(lines, `xargs -0 -r $SUDO sh -c 'for d do rmdir -- "$d" 2>/dev/null || :; done' _ < "$W/prune"`)
+	}
+	if req.Owner != "" {
+		owner := shellQuote(req.Owner)
+		lines = append(lines,
+			`xargs -0 -r $SUDO chown `+owner+` -- < "$W/attrs"`,
+			`xargs -0 -r $SUDO chown `+owner+` -- < "$W/dirs"`,
+		)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// shellQuote quotes a string for a POSIX shell
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
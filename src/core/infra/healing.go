@@ -0,0 +1,399 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package infra is to manage multi-cloud infra
+package infra
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloud-barista/cb-tumblebug/src/core/common"
+	"github.com/cloud-barista/cb-tumblebug/src/core/model"
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvstore"
+	"github.com/rs/zerolog/log"
+)
+
+// defaultMaxHealsPerHour is the NodeGroup heal budget when the policy leaves it unset
+const defaultMaxHealsPerHour = 3
+
+// healingConnectionLimit caps the replacements per connection (CSP region) within
+// healingConnectionWindow, across all NodeGroups. A regional outage turns many Nodes
+// Terminated or Failed at once; replacing them all would only pile up failed creations.
+// Override with TB_HEALING_CONNECTION_LIMIT and TB_HEALING_CONNECTION_WINDOW.
+var healingConnectionLimit = func() int {
+	if v := os.Getenv("TB_HEALING_CONNECTION_LIMIT"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			return n
+		}
+	}
+	return 3
+}()
+
+var healingConnectionWindow = func() time.Duration {
+	if v := os.Getenv("TB_HEALING_CONNECTION_WINDOW"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			return d
+		}
+	}
+	return time.Hour
+}()
+
+// nodeHealer tracks the heals in progress and recent heals for the rate limits.
+type nodeHealer struct {
+	mu sync.Mutex
+	// inFlight holds the Node keys being replaced
+	inFlight map[string]bool
+	// recent holds the start times of recent heals per connection and per NodeGroup
+	recent map[string][]time.Time
+	// deferred holds the Node keys whose deferral was already reported
+	deferred map[string]bool
+}
+
+var healer = &nodeHealer{
+	inFlight: make(map[string]bool),
+	recent:   make(map[string][]time.Time),
+	deferred: make(map[string]bool),
+}
+
+// healingPolicyKey is the kvstore key of the healing policy of a NodeGroup. Like rolling
+// updates it is kept outside the Infra subtree.
+func healingPolicyKey(nsId string, infraId string, nodeGroupId string) string {
+	return "/" + model.StrNamespace + "/" + nsId + "/healingPolicy/" + model.StrInfra + "/" + infraId + "/" + model.StrNodeGroup + "/" + common.ToLower(nodeGroupId)
+}
+
+// delInfraHealingPolicies deletes the healing policies of the NodeGroups of a deleted Infra.
+func delInfraHealingPolicies(nsId string, infraId string) error {
+	return kvstore.DeleteWithPrefix("/" + model.StrNamespace + "/" + nsId + "/healingPolicy/" + model.StrInfra + "/" + infraId + "/")
+}
+
+// PutNodeGroupHealingPolicy creates or replaces the healing policy of a NodeGroup.
+func PutNodeGroupHealingPolicy(nsId string, infraId string, nodeGroupId string, req *model.NodeGroupHealingPolicy) (model.NodeGroupHealingPolicyInfo, error) {
+	if err := common.CheckString(nsId); err != nil {
+		return model.NodeGroupHealingPolicyInfo{}, err
+	}
+	if err := common.CheckString(infraId); err != nil {
+		return model.NodeGroupHealingPolicyInfo{}, err
+	}
+	nodeGroupId = common.ToLower(nodeGroupId)
+	if _, err := GetNodeGroup(nsId, infraId, nodeGroupId); err != nil {
+		return model.NodeGroupHealingPolicyInfo{}, err
+	}
+	if req.MaxHealsPerHour < 0 {
+		return model.NodeGroupHealingPolicyInfo{}, fmt.Errorf("maxHealsPerHour must not be negative")
+	}
+	if req.MaxHealsPerHour == 0 {
+		req.MaxHealsPerHour = defaultMaxHealsPerHour
+	}
+
+	info := model.NodeGroupHealingPolicyInfo{
+		NsId:                   nsId,
+		InfraId:                infraId,
+		NodeGroupId:            nodeGroupId,
+		NodeGroupHealingPolicy: *req,
+		UpdatedAt:              time.Now().UTC().Format(time.RFC3339),
+	}
+	val, err := json.Marshal(info)
+	if err != nil {
+		return model.NodeGroupHealingPolicyInfo{}, err
+	}
+	if err := kvstore.Put(healingPolicyKey(nsId, infraId, nodeGroupId), string(val)); err != nil {
+		return model.NodeGroupHealingPolicyInfo{}, err
+	}
+	return info, nil
+}
+
+// GetNodeGroupHealingPolicy returns the healing policy of a NodeGroup.
+func GetNodeGroupHealingPolicy(nsId string, infraId string, nodeGroupId string) (model.NodeGroupHealingPolicyInfo, error) {
+	info, exists, err := getHealingPolicy(nsId, infraId, nodeGroupId)
+	if err != nil {
+		return model.NodeGroupHealingPolicyInfo{}, err
+	}
+	if !exists {
+		return model.NodeGroupHealingPolicyInfo{}, fmt.Errorf("no healing policy for NodeGroup %s of Infra %s", nodeGroupId, infraId)
+	}
+	return info, nil
+}
+
+// DelNodeGroupHealingPolicy deletes the healing policy of a NodeGroup, which turns healing off.
+func DelNodeGroupHealingPolicy(nsId string, infraId string, nodeGroupId string) error {
+	if _, exists, err := getHealingPolicy(nsId, infraId, nodeGroupId); err != nil {
+		return err
+	} else if !exists {
+		return fmt.Errorf("no healing policy for NodeGroup %s of Infra %s", nodeGroupId, infraId)
+	}
+	return kvstore.Delete(healingPolicyKey(nsId, infraId, nodeGroupId))
+}
+
+func getHealingPolicy(nsId string, infraId string, nodeGroupId string) (model.NodeGroupHealingPolicyInfo, bool, error) {
+	info := model.NodeGroupHealingPolicyInfo{}
+	keyValue, exists, err := kvstore.GetKv(healingPolicyKey(nsId, infraId, nodeGroupId))
+	if err != nil || !exists {
+		return info, false, err
+	}
+	if err := json.Unmarshal([]byte(keyValue.Value), &info); err != nil {
+		return info, false, err
+	}
+	return info, true, nil
+}
+
+// isHealableStatus tells whether a Node in this status is a candidate for replacement.
+func isHealableStatus(status string) bool {
+	return strings.EqualFold(status, model.StatusTerminated) || strings.EqualFold(status, model.StatusFailed)
+}
+
+// observeNodeFailure is called by FetchNodeStatus after it stored a new status of the Node.
+// It starts a heal when the Node has just turned Terminated or Failed while no action
+// of a user (or of Tumblebug itself) was expected to take it there. A suspend that
+// ended Failed is left alone: a running replacement is not what was asked for.
+// Heals and their rate limits are kept by the leader; on the other replicas, the failure
+// is left to the healing sweeper of the leader.
+func observeNodeFailure(nsId string, infraId string, node model.NodeInfo, prevStatus string, prevTargetAction string) {
+	if !common.IsLeader() {
+		return
+	}
+	if node.NodeGroupId == "" || !isHealableStatus(node.Status) || isHealableStatus(prevStatus) {
+		return
+	}
+	if strings.EqualFold(prevTargetAction, model.ActionTerminate) ||
+		strings.EqualFold(prevTargetAction, model.ActionCreate) ||
+		strings.EqualFold(prevTargetAction, model.ActionSuspend) ||
+		isDiscoveryAction(prevTargetAction) {
+		return
+	}
+	go healNodeIfEnabled(nsId, infraId, node)
+}
+
+// startHealingSweeper retries, every PollNormal interval, the heals that were not done
+// when the failure was observed (rate limited, or Tumblebug restarted in between).
+func startHealingSweeper(ctx context.Context) {
+	ticker := time.NewTicker(pollIntervals[PollNormal])
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			sweepHealing()
+		}
+	}
+}
+
+func sweepHealing() {
+	nsIds, err := common.ListNsId()
+	if err != nil {
+		log.Warn().Err(err).Msg("[Healing] Cannot list namespaces")
+		return
+	}
+	for _, nsId := range nsIds {
+		keyValues, err := kvstore.GetKvList("/" + model.StrNamespace + "/" + nsId + "/healingPolicy/")
+		if err != nil {
+			log.Warn().Err(err).Msgf("[Healing] Cannot list the healing policies of namespace %s", nsId)
+			continue
+		}
+		for _, kv := range keyValues {
+			policy := model.NodeGroupHealingPolicyInfo{}
+			if err := json.Unmarshal([]byte(kv.Value), &policy); err != nil || !policy.Enabled {
+				continue
+			}
+			nodeIds, err := ListNodeByNodeGroup(policy.NsId, policy.InfraId, policy.NodeGroupId)
+			if err != nil {
+				continue
+			}
+			for _, nodeId := range nodeIds {
+				node, err := GetNodeObject(policy.NsId, policy.InfraId, nodeId)
+				if err != nil || node.CspResourceId == "" || !isHealableStatus(node.Status) {
+					continue
+				}
+				// A Node failed by a user action (or a failed creation) keeps that action
+				if !strings.EqualFold(node.TargetAction, model.ActionComplete) {
+					continue
+				}
+				healNodeIfEnabled(policy.NsId, policy.InfraId, node)
+			}
+		}
+	}
+}
+
+// healNodeIfEnabled replaces the Node when its NodeGroup has healing enabled and the
+// rate limits allow it. A deferred heal is reported once and retried by the sweeper.
+func healNodeIfEnabled(nsId string, infraId string, node model.NodeInfo) {
+	policy, exists, err := getHealingPolicy(nsId, infraId, node.NodeGroupId)
+	if err != nil || !exists || !policy.Enabled {
+		return
+	}
+	if rollingUpdateInProgress(nsId, infraId, node.NodeGroupId) {
+		return
+	}
+
+	nodeKey := common.GenInfraKey(nsId, infraId, node.Id)
+	if ok, reason := healer.acquire(nodeKey, node.ConnectionName, healingPolicyKey(nsId, infraId, node.NodeGroupId), policy.MaxHealsPerHour); !ok {
+		if reason != "" {
+			appendInfraSystemMessage(nsId, infraId, fmt.Sprintf("[healing] replacement of Node %s (%s) deferred: %s", node.Id, node.Status, reason))
+		}
+		return
+	}
+	defer healer.release(nodeKey)
+
+	healNode(nsId, infraId, node)
+}
+
+// acquire reserves the heal of a Node. It returns false with an empty reason when the
+// Node is already being healed or its deferral was already reported.
+func (h *nodeHealer) acquire(nodeKey string, connectionName string, groupKey string, groupLimit int) (bool, string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.inFlight[nodeKey] {
+		return false, ""
+	}
+
+	now := time.Now()
+	connKey := "connection/" + connectionName
+	connHeals := pruneHeals(h.recent[connKey], now.Add(-healingConnectionWindow))
+	groupHeals := pruneHeals(h.recent[groupKey], now.Add(-time.Hour))
+	h.recent[connKey] = connHeals
+	h.recent[groupKey] = groupHeals
+
+	reason := ""
+	if len(connHeals) >= healingConnectionLimit {
+		reason = fmt.Sprintf("%d replacements in connection %s within %s", len(connHeals), connectionName, healingConnectionWindow)
+	} else if len(groupHeals) >= groupLimit {
+		reason = fmt.Sprintf("%d replacements in the NodeGroup within the last hour", len(groupHeals))
+	}
+	if reason != "" {
+		if h.deferred[nodeKey] {
+			return false, ""
+		}
+		h.deferred[nodeKey] = true
+		return false, reason
+	}
+
+	delete(h.deferred, nodeKey)
+	h.inFlight[nodeKey] = true
+	h.recent[connKey] = append(connHeals, now)
+	h.recent[groupKey] = append(groupHeals, now)
+	return true, ""
+}
+
+func (h *nodeHealer) release(nodeKey string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.inFlight, nodeKey)
+}
+
+// pruneHeals drops the heal times before since.
+func pruneHeals(times []time.Time, since time.Time) []time.Time {
+	kept := times[:0]
+	for _, t := range times {
+		if t.After(since) {
+			kept = append(kept, t)
+		}
+	}
+	return kept
+}
+
+// rollingUpdateInProgress tells whether a rolling update is replacing the Nodes of the NodeGroup.
+func rollingUpdateInProgress(nsId string, infraId string, nodeGroupId string) bool {
+	v, ok := rollingUpdateRuns.Load(rollingUpdateKey(nsId, infraId, nodeGroupId))
+	if !ok {
+		return false
+	}
+	run := v.(*rollingUpdateRun)
+	run.mu.Lock()
+	defer run.mu.Unlock()
+	return run.active
+}
+
+// healNode replaces a Terminated or Failed Node with a Node of the same spec, image and
+// subnet in its NodeGroup, reruns the post-deployment commands of the NodeGroup on it,
+// moves the data disks and NLB membership of the old Node to it, and deletes the old Node.
+// Every step is recorded in the system messages of the Infra.
+func healNode(nsId string, infraId string, old model.NodeInfo) {
+	infraObj, _, err := GetInfraObject(nsId, infraId)
+	if err != nil {
+		return
+	}
+	if strings.EqualFold(infraObj.TargetAction, model.ActionTerminate) {
+		return
+	}
+
+	log.Info().Msgf("[Healing] Replacing Node %s of Infra %s/%s (%s)", old.Id, nsId, infraId, old.Status)
+	appendInfraSystemMessage(nsId, infraId, fmt.Sprintf("[healing] Node %s is %s on the CSP; creating a replacement in NodeGroup %s", old.Id, old.Status, old.NodeGroupId))
+
+	ctx := common.WithCredentialHolder(context.Background(), old.ConnectionConfig.CredentialHolder)
+	req := nodeGroupReqFromNode(nsId, infraId, old.NodeGroupId, old)
+	req.NodeGroupSize = 1
+	created, err := createNodesInNodeGroup(ctx, nsId, infraId, old.NodeGroupId, req)
+	if err != nil {
+		for _, nodeId := range created {
+			if delErr := DelInfraNode(nsId, infraId, nodeId, ""); delErr != nil {
+				log.Warn().Err(delErr).Msgf("[Healing] Cannot delete the failed replacement Node %s", nodeId)
+			}
+		}
+		log.Error().Err(err).Msgf("[Healing] Cannot replace Node %s", old.Id)
+		appendInfraSystemMessage(nsId, infraId, fmt.Sprintf("[healing] replacement of Node %s failed: %v", old.Id, err))
+		return
+	}
+	newId := created[0]
+
+	var warnings []string
+	if err := runPostCommandsOnNode(nsId, infraId, newId, nodeGroupPostCommands(infraObj, old.NodeGroupId)); err != nil {
+		warnings = append(warnings, err.Error())
+	}
+
+	// Disks of a Terminated Node are usually detached by the CSP already, so the detach
+	// is best effort; the attach decides whether the disk moved.
+	for _, dataDiskId := range old.DataDiskIds {
+		if _, err := AttachDetachDataDisk(nsId, infraId, old.Id, model.DetachDataDisk, dataDiskId, true); err != nil {
+			log.Debug().Err(err).Msgf("[Healing] Detach of dataDisk %s from Node %s failed", dataDiskId, old.Id)
+		}
+		if _, err := AttachDetachDataDisk(nsId, infraId, newId, model.AttachDataDisk, dataDiskId, false); err != nil {
+			warnings = append(warnings, fmt.Sprintf("cannot attach dataDisk %s: %v", dataDiskId, err))
+		}
+	}
+
+	for _, nlbId := range nodeGroupNLBs(nsId, infraId, old.NodeGroupId, []string{old.Id}) {
+		nlb, err := GetNLB(nsId, infraId, nlbId)
+		if err != nil || !contains(nlb.TargetGroup.Nodes, old.Id) {
+			continue
+		}
+		if err := RemoveNLBNodes(nsId, infraId, nlbId, &model.NLBAddRemoveNodeReq{TargetGroup: model.NLBTargetGroupInfo{Nodes: []string{old.Id}}}); err != nil {
+			log.Debug().Err(err).Msgf("[Healing] Cannot remove Node %s from NLB %s", old.Id, nlbId)
+		}
+		if _, err := AddNLBNodes(nsId, infraId, nlbId, &model.NLBAddRemoveNodeReq{TargetGroup: model.NLBTargetGroupInfo{Nodes: []string{newId}}}); err != nil {
+			warnings = append(warnings, fmt.Sprintf("cannot add Node %s to NLB %s: %v", newId, nlbId, err))
+		}
+	}
+
+	// A Terminated Node has nothing left on the CSP to terminate
+	option := ""
+	if strings.EqualFold(old.Status, model.StatusTerminated) {
+		option = "force"
+	}
+	if err := DelInfraNode(nsId, infraId, old.Id, option); err != nil {
+		warnings = append(warnings, fmt.Sprintf("cannot delete Node %s: %v", old.Id, err))
+	}
+
+	msg := fmt.Sprintf("[healing] Node %s replaced by Node %s", old.Id, newId)
+	if len(warnings) > 0 {
+		msg += " with warnings: " + strings.Join(warnings, "; ")
+	}
+	log.Info().Msg(msg)
+	appendInfraSystemMessage(nsId, infraId, msg)
+}
@@ -0,0 +1,200 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package infra is to manage multi-cloud infra
+package infra
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/cloud-barista/cb-tumblebug/src/core/model"
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvstore"
+	"github.com/rs/zerolog/log"
+)
+
+// JobRunFunc executes one run of a scheduled job. ctx ends when the job times out or is
+// stopped. The returned value is stored as the output of the execution.
+type JobRunFunc func(ctx context.Context, jobId string, nsId string, payload json.RawMessage) (any, error)
+
+// JobValidateFunc checks the payload of a new job and returns it normalized, so that jobs
+// with the same parameters store the same payload.
+type JobValidateFunc func(nsId string, payload json.RawMessage) (json.RawMessage, error)
+
+// JobTypeHandlers describes how the scheduler runs a job type.
+type JobTypeHandlers struct {
+	Validate JobValidateFunc // Required
+	Run      JobRunFunc      // Required
+	// MaxConcurrency caps the executions of the type running at once (0: unlimited).
+	// Executions beyond it wait for a free slot within their execution timeout.
+	MaxConcurrency int
+	// RequireCron rejects interval schedules, for jobs that must run at set times of day
+	RequireCron bool
+}
+
+type jobTypeEntry struct {
+	JobTypeHandlers
+	slots chan struct{} // nil when unlimited
+}
+
+var (
+	jobTypeMu       sync.RWMutex
+	jobTypeRegistry = make(map[JobType]*jobTypeEntry)
+)
+
+// RegisterJobType registers the handlers of a scheduled job type.
+// Packages call this from their init() function, before the scheduler loads stored jobs.
+func RegisterJobType(jobType JobType, h JobTypeHandlers) {
+	if h.Validate == nil || h.Run == nil {
+		panic(fmt.Sprintf("scheduler: job type %s needs both Validate and Run", jobType))
+	}
+	entry := &jobTypeEntry{JobTypeHandlers: h}
+	if h.MaxConcurrency > 0 {
+		entry.slots = make(chan struct{}, h.MaxConcurrency)
+	}
+	jobTypeMu.Lock()
+	defer jobTypeMu.Unlock()
+	jobTypeRegistry[jobType] = entry
+}
+
+// getJobType returns the handlers of a registered job type.
+func getJobType(jobType JobType) (*jobTypeEntry, bool) {
+	jobTypeMu.RLock()
+	defer jobTypeMu.RUnlock()
+	entry, ok := jobTypeRegistry[jobType]
+	return entry, ok
+}
+
+// ListJobTypes returns the registered job types.
+func ListJobTypes() []string {
+	jobTypeMu.RLock()
+	defer jobTypeMu.RUnlock()
+	types := make([]string, 0, len(jobTypeRegistry))
+	for t := range jobTypeRegistry {
+		types = append(types, string(t))
+	}
+	sort.Strings(types)
+	return types
+}
+
+// run executes the job type once, waiting for a free slot first if the type is capped.
+func (e *jobTypeEntry) run(ctx context.Context, jobId string, nsId string, payload json.RawMessage) (any, error) {
+	if e.slots != nil {
+		select {
+		case e.slots <- struct{}{}:
+			defer func() { <-e.slots }()
+		case <-ctx.Done():
+			return nil, fmt.Errorf("no free execution slot (max %d concurrent): %w", e.MaxConcurrency, ctx.Err())
+		}
+	}
+	return e.Run(ctx, jobId, nsId, payload)
+}
+
+// decodeJobPayload decodes the payload of a job into its typed form. Unknown fields are
+// rejected so that misspelled parameters are not silently ignored.
+func decodeJobPayload[P any](payload json.RawMessage) (P, error) {
+	var p P
+	if len(payload) == 0 {
+		return p, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&p); err != nil {
+		return p, fmt.Errorf("invalid payload: %w", err)
+	}
+	return p, nil
+}
+
+// encodeJobPayload returns the normalized payload of a typed payload.
+func encodeJobPayload(p any) (json.RawMessage, error) {
+	b, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+	return json.RawMessage(b), nil
+}
+
+// Execution records
+
+const keyScheduledJobExecution = "/scheduledJobExecution"
+
+// maxJobExecutionRecords is the number of execution records kept per job.
+// Override with TB_SCHEDULER_EXECUTION_RECORDS.
+var maxJobExecutionRecords = func() int {
+	if v := os.Getenv("TB_SCHEDULER_EXECUTION_RECORDS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			return n
+		}
+	}
+	return 100
+}()
+
+// genJobExecutionKey generates the kvstore key of an execution record. Records live outside
+// keyScheduledJob so that loading jobs does not see them; the padded number keeps them ordered.
+func genJobExecutionKey(jobId string, executionNumber int) string {
+	key := fmt.Sprintf("%s/%s/", keyScheduledJobExecution, jobId)
+	if executionNumber > 0 {
+		key += fmt.Sprintf("%010d", executionNumber)
+	}
+	return key
+}
+
+// putJobExecution stores an execution record and drops the record that fell out of retention.
+func putJobExecution(rec model.ScheduleJobExecution) {
+	val, err := json.Marshal(rec)
+	if err != nil {
+		// The output of the job type may not be serializable; keep the record without it
+		rec.Output = nil
+		val, _ = json.Marshal(rec)
+	}
+	if err := kvstore.Put(genJobExecutionKey(rec.JobId, rec.ExecutionNumber), string(val)); err != nil {
+		log.Error().Err(err).Str("jobId", rec.JobId).Msg("Failed to store job execution record")
+		return
+	}
+	if old := rec.ExecutionNumber - maxJobExecutionRecords; old > 0 {
+		if err := kvstore.Delete(genJobExecutionKey(rec.JobId, old)); err != nil {
+			log.Debug().Err(err).Str("jobId", rec.JobId).Msg("Failed to drop old job execution record")
+		}
+	}
+}
+
+// ListJobExecutions returns the stored execution records of a job, oldest first.
+func ListJobExecutions(jobId string) (model.ScheduleJobExecutionList, error) {
+	list := model.ScheduleJobExecutionList{Executions: []model.ScheduleJobExecution{}}
+	keyValues, err := kvstore.GetKvList(genJobExecutionKey(jobId, 0))
+	if err != nil {
+		return list, fmt.Errorf("failed to list job executions: %w", err)
+	}
+	for _, kv := range keyValues {
+		var rec model.ScheduleJobExecution
+		if err := json.Unmarshal([]byte(kv.Value), &rec); err != nil {
+			continue
+		}
+		list.Executions = append(list.Executions, rec)
+	}
+	sort.Slice(list.Executions, func(i, j int) bool {
+		return list.Executions[i].ExecutionNumber < list.Executions[j].ExecutionNumber
+	})
+	return list, nil
+}
+
+// deleteJobExecutions removes the execution records of a deleted job.
+func deleteJobExecutions(jobId string) error {
+	return kvstore.DeleteWithPrefix(genJobExecutionKey(jobId, 0))
+}
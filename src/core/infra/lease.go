@@ -0,0 +1,319 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package infra is to manage multi-cloud infra
+package infra
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cloud-barista/cb-tumblebug/src/core/common"
+	"github.com/cloud-barista/cb-tumblebug/src/core/model"
+	"github.com/cloud-barista/cb-tumblebug/src/core/resource"
+	"github.com/rs/zerolog/log"
+)
+
+// leaseWarningLead is how long before expiry the owner of a resource is warned.
+// Override with TB_LEASE_WARNING_LEAD (Go duration).
+var leaseWarningLead = func() time.Duration {
+	if v := os.Getenv("TB_LEASE_WARNING_LEAD"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+			return d
+		}
+	}
+	return time.Hour
+}()
+
+// leaseCheckInterval is the period of the lease reaper.
+// Override with TB_LEASE_CHECK_INTERVAL (Go duration).
+var leaseCheckInterval = func() time.Duration {
+	if v := os.Getenv("TB_LEASE_CHECK_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			return d
+		}
+	}
+	return time.Minute
+}()
+
+// StartLeaseReaper registers the leader controller that warns about and then tears down
+// Infras and K8sClusters whose lease expired.
+func StartLeaseReaper() {
+	common.RunAsLeader("leaseReaper", func(ctx context.Context) {
+		log.Info().Dur("interval", leaseCheckInterval).Dur("warningLead", leaseWarningLead).Msg("lease: starting lease reaper")
+		ticker := time.NewTicker(leaseCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				reapLeases(time.Now())
+			}
+		}
+	})
+}
+
+func reapLeases(now time.Time) {
+	nsIds, err := common.ListNsId()
+	if err != nil {
+		log.Warn().Err(err).Msg("lease: cannot list namespaces")
+		return
+	}
+	for _, nsId := range nsIds {
+		leases, err := common.ListLease(nsId)
+		if err != nil {
+			log.Warn().Err(err).Msgf("lease: cannot list the leases of namespace %s", nsId)
+			continue
+		}
+		for _, lease := range leases {
+			reapLease(lease, now)
+		}
+	}
+}
+
+// reapLease warns once when the lease is about to expire and applies its action once it did.
+func reapLease(lease model.LeaseInfo, now time.Time) {
+	if lease.Status == model.LeaseSuspended {
+		return
+	}
+	expiresAt, err := time.Parse(time.RFC3339, lease.ExpiresAt)
+	if err != nil {
+		log.Warn().Err(err).Msgf("lease: invalid expiry of %s %s", lease.ResourceType, lease.ResourceId)
+		return
+	}
+	if now.Before(expiresAt.Add(-leaseWarningLead)) {
+		return
+	}
+
+	exists, err := leaseResourceExists(lease)
+	if err != nil {
+		return
+	}
+	if !exists {
+		// Deleted behind the reaper's back (e.g. with a force option that skipped cleanup)
+		if err := common.DelLease(lease.NsId, lease.ResourceType, lease.ResourceId); err != nil {
+			log.Warn().Err(err).Msgf("lease: cannot delete the lease of %s %s", lease.ResourceType, lease.ResourceId)
+		}
+		return
+	}
+
+	if now.Before(expiresAt) {
+		if lease.Status == model.LeaseActive {
+			warnLease(lease, now)
+		}
+		return
+	}
+	expireLease(lease)
+}
+
+func leaseResourceExists(lease model.LeaseInfo) (bool, error) {
+	if lease.ResourceType == model.StrK8s {
+		return resource.CheckK8sCluster(lease.NsId, lease.ResourceId)
+	}
+	return CheckInfra(lease.NsId, lease.ResourceId)
+}
+
+func warnLease(lease model.LeaseInfo, now time.Time) {
+	msg := fmt.Sprintf("[lease] expires at %s and will then be %s; extend the lease to keep it", lease.ExpiresAt, leaseActionDone(lease.Action))
+	log.Warn().
+		Str("event", "LeaseExpiring").
+		Str("nsId", lease.NsId).
+		Str("resourceType", lease.ResourceType).
+		Str("resourceId", lease.ResourceId).
+		Str("expiresAt", lease.ExpiresAt).
+		Str("action", lease.Action).
+		Msg(msg)
+	setLeaseResourceMessage(lease, msg)
+
+	lease.Status = model.LeaseWarned
+	lease.WarnedAt = now.UTC().Format(time.RFC3339)
+	if err := common.PutLease(lease); err != nil {
+		log.Warn().Err(err).Msgf("lease: cannot record the warning of %s %s", lease.ResourceType, lease.ResourceId)
+	}
+}
+
+// expireLease applies the action of an expired lease. A failed action is recorded on
+// the lease and retried on the next round.
+func expireLease(lease model.LeaseInfo) {
+	log.Info().
+		Str("event", "LeaseExpired").
+		Str("nsId", lease.NsId).
+		Str("resourceType", lease.ResourceType).
+		Str("resourceId", lease.ResourceId).
+		Str("action", lease.Action).
+		Msgf("lease: %s %s expired at %s", lease.ResourceType, lease.ResourceId, lease.ExpiresAt)
+
+	var err error
+	switch {
+	case lease.ResourceType == model.StrK8s:
+		var deleted bool
+		deleted, err = resource.DeleteK8sCluster(lease.NsId, lease.ResourceId, "")
+		if err == nil && !deleted {
+			err = fmt.Errorf("the deletion was not confirmed by the CSP")
+		}
+	case lease.Action == model.LeaseActionSuspend:
+		_, err = HandleInfraAction(lease.NsId, lease.ResourceId, model.ActionSuspend, false)
+		if err == nil {
+			setLeaseResourceMessage(lease, fmt.Sprintf("[lease] suspended on expiry at %s; extend the lease before resuming it", lease.ExpiresAt))
+			lease.Status = model.LeaseSuspended
+			lease.Message = "suspended on expiry"
+		}
+	default:
+		_, err = DelInfra(lease.NsId, lease.ResourceId, "terminate")
+	}
+
+	if err != nil {
+		log.Error().Err(err).Msgf("lease: cannot %s expired %s %s", lease.Action, lease.ResourceType, lease.ResourceId)
+		setLeaseResourceMessage(lease, fmt.Sprintf("[lease] expired but could not be %s: %v", leaseActionDone(lease.Action), err))
+		lease.Message = err.Error()
+	} else if lease.Status != model.LeaseSuspended {
+		// Deleted: the lease went with the resource
+		return
+	}
+	if err := common.PutLease(lease); err != nil {
+		log.Warn().Err(err).Msgf("lease: cannot update the lease of %s %s", lease.ResourceType, lease.ResourceId)
+	}
+}
+
+func leaseActionDone(action string) string {
+	if action == model.LeaseActionSuspend {
+		return "suspended"
+	}
+	return "deleted"
+}
+
+// setLeaseResourceMessage records msg in the system messages of the leased resource.
+func setLeaseResourceMessage(lease model.LeaseInfo, msg string) {
+	if lease.ResourceType == model.StrK8s {
+		if err := resource.SetK8sClusterSystemMessage(lease.NsId, lease.ResourceId, msg); err != nil {
+			log.Debug().Err(err).Msgf("lease: cannot set the system message of K8sCluster %s", lease.ResourceId)
+		}
+		return
+	}
+	appendInfraSystemMessage(lease.NsId, lease.ResourceId, msg)
+}
+
+// ListLeases returns the leases of the Infras and K8sClusters of a namespace.
+func ListLeases(nsId string) (model.LeaseList, error) {
+	if err := common.CheckString(nsId); err != nil {
+		return model.LeaseList{}, err
+	}
+	leases, err := common.ListLease(nsId)
+	if err != nil {
+		return model.LeaseList{}, err
+	}
+	return model.LeaseList{Leases: leases}, nil
+}
+
+// GetResourceLease returns the lease of an Infra or a K8sCluster.
+func GetResourceLease(nsId string, resourceType string, resourceId string) (model.LeaseInfo, error) {
+	lease, exists, err := common.GetLease(nsId, resourceType, resourceId)
+	if err != nil {
+		return model.LeaseInfo{}, err
+	}
+	if !exists {
+		return model.LeaseInfo{}, fmt.Errorf("%s %s has no lease (it does not expire)", resourceType, resourceId)
+	}
+	return lease, nil
+}
+
+// UpdateResourceLease sets, extends or shortens the lease of an Infra or a K8sCluster.
+// The lease becomes Active again, so the owner is warned anew before the new expiry.
+// A suspended Infra stays suspended; resume it once the lease is extended.
+func UpdateResourceLease(nsId string, resourceType string, resourceId string, req *model.LeaseUpdateReq) (model.LeaseInfo, error) {
+	if err := common.CheckString(nsId); err != nil {
+		return model.LeaseInfo{}, err
+	}
+	lease := model.LeaseInfo{NsId: nsId, ResourceType: resourceType, ResourceId: resourceId}
+	exists, err := leaseResourceExists(lease)
+	if err != nil {
+		return model.LeaseInfo{}, err
+	}
+	if !exists {
+		return model.LeaseInfo{}, fmt.Errorf("%s %s does not exist", resourceType, resourceId)
+	}
+	if resourceType == model.StrK8s {
+		if err := resource.ValidateK8sClusterExpiration(req.ExpirationOption); err != nil {
+			return model.LeaseInfo{}, err
+		}
+	}
+
+	current, hasLease, err := common.GetLease(nsId, resourceType, resourceId)
+	if err != nil {
+		return model.LeaseInfo{}, err
+	}
+	if hasLease {
+		lease = current
+	}
+
+	now := time.Now()
+	var expiresAt time.Time
+	if req.ExtendBy != "" {
+		if req.ExpiresAt != "" || req.Ttl != "" {
+			return model.LeaseInfo{}, fmt.Errorf("set one of expiresAt, ttl and extendBy")
+		}
+		if !hasLease {
+			return model.LeaseInfo{}, fmt.Errorf("%s %s has no lease to extend; set expiresAt or ttl", resourceType, resourceId)
+		}
+		d, err := time.ParseDuration(req.ExtendBy)
+		if err != nil || d <= 0 {
+			return model.LeaseInfo{}, fmt.Errorf("invalid extendBy %q (a positive duration such as 24h expected)", req.ExtendBy)
+		}
+		base, err := time.Parse(time.RFC3339, current.ExpiresAt)
+		if err != nil || base.Before(now) {
+			base = now
+		}
+		expiresAt = base.Add(d).UTC()
+		if _, _, err := common.ResolveExpiration(model.ExpirationOption{ExpirationAction: req.ExpirationAction}, now); err != nil {
+			return model.LeaseInfo{}, err
+		}
+	} else {
+		t, set, err := common.ResolveExpiration(req.ExpirationOption, now)
+		if err != nil {
+			return model.LeaseInfo{}, err
+		}
+		if !set {
+			return model.LeaseInfo{}, fmt.Errorf("set one of expiresAt, ttl and extendBy")
+		}
+		expiresAt = t
+	}
+
+	if req.ExpirationAction != "" {
+		lease.Action = strings.ToLower(req.ExpirationAction)
+	}
+	if lease.Action == "" {
+		lease.Action = model.LeaseActionDelete
+	}
+	lease.ExpiresAt = expiresAt.Format(time.RFC3339)
+	if lease.Status != model.LeaseSuspended {
+		lease.Status = model.LeaseActive
+	}
+	lease.WarnedAt = ""
+	lease.Message = ""
+	if err := common.PutLease(lease); err != nil {
+		return model.LeaseInfo{}, err
+	}
+	return lease, nil
+}
+
+// DelResourceLease removes the lease of an Infra or a K8sCluster, so it no longer expires.
+func DelResourceLease(nsId string, resourceType string, resourceId string) error {
+	if _, err := GetResourceLease(nsId, resourceType, resourceId); err != nil {
+		return err
+	}
+	return common.DelLease(nsId, resourceType, resourceId)
+}
@@ -15,6 +15,7 @@ limitations under the License.
 package infra
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -40,8 +41,6 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
-var infraInfoMutex sync.Mutex
-
 // [Infra and Node object information managemenet]
 
 // ListInfraId is func to list Infra ID
@@ -1003,6 +1002,7 @@ func GetInfraObject(nsId string, infraId string) (model.InfraInfo, bool, error)
 
 	infraTmp := model.InfraInfo{}
 	json.Unmarshal([]byte(keyValue.Value), &infraTmp)
+	infraTmp.SetReadBase(keyValue.Value)
 
 	// Use existing ListInfraNodeInfo function instead of manually iterating through Nodes
 	nodeInfoList, err := ListInfraNodeInfo(nsId, infraId)
@@ -1037,6 +1037,7 @@ func GetNodeObject(nsId string, infraId string, nodeId string) (model.NodeInfo,
 		log.Error().Err(err).Msg("")
 		return model.NodeInfo{}, err
 	}
+	nodeTmp.SetReadBase(keyValue.Value)
 	return nodeTmp, nil
 }
 
@@ -2499,6 +2500,7 @@ applyStatus:
 	// Prevent overwriting Terminated status with empty or other states
 	originalNodeInfo, _ := GetNodeObject(nsId, infraId, nodeId)
 	if originalNodeInfo.Status != model.StatusTerminated {
+		prevStatus, prevTargetAction := originalNodeInfo.Status, originalNodeInfo.TargetAction
 		nodeInfo.Status = nodeStatusTmp.Status
 		nodeInfo.TargetAction = nodeStatusTmp.TargetAction
 		nodeInfo.TargetStatus = nodeStatusTmp.TargetStatus
@@ -2516,6 +2518,7 @@ applyStatus:
 			originalNodeInfo.PrivateIP = nodeInfo.PrivateIP
 			originalNodeInfo.SSHPort = nodeInfo.SSHPort
 			UpdateNodeInfo(nsId, infraId, originalNodeInfo)
+			observeNodeFailure(nsId, infraId, originalNodeInfo, prevStatus, prevTargetAction)
 		}
 	}
 	// else: Node is already terminated, skip status update
@@ -2602,60 +2605,179 @@ func GetInfraNodeCurrentStatus(nsId string, infraId string, nodeId string) (*mod
 
 // [Update Infra and Node object]
 
-// UpdateInfraInfo is func to update Infra Info (without Node info in Infra)
+// UpdateInfraInfo is func to update Infra Info (without Node info in Infra).
+// An object read by GetInfraObject only writes the fields changed since the read, so
+// concurrent updates of other fields are kept; any other object is written whole.
 func UpdateInfraInfo(nsId string, infraInfoData model.InfraInfo) {
-	infraInfoMutex.Lock()
-	defer infraInfoMutex.Unlock()
-
 	infraInfoData.Node = nil
 
 	key := common.GenInfraKey(nsId, infraInfoData.Id, "")
 
-	// Check existence of the key. If no key, no update.
-	keyValue, exists, err := kvstore.GetKv(key)
-	if !exists || err != nil {
-		return
+	updated, _ := json.Marshal(infraInfoData)
+	var base []byte
+	if record := infraInfoData.ReadBase(); record != "" {
+		baseInfra := model.InfraInfo{}
+		if err := json.Unmarshal([]byte(record), &baseInfra); err == nil {
+			baseInfra.Node = nil
+			base, _ = json.Marshal(baseInfra)
+		}
 	}
 
-	infraTmp := model.InfraInfo{}
-	json.Unmarshal([]byte(keyValue.Value), &infraTmp)
+	err := kvstore.UpdateWithRetry(context.Background(), key, func(current string, exists bool) (string, bool, error) {
+		// Check existence of the key. If no key, no update.
+		if !exists {
+			return "", false, nil
+		}
 
-	// Note: Using reflect.DeepEqual for performance optimization to avoid unnecessary kvstore writes
-	// The static analysis warning about errors is acceptable in this context
-	if !reflect.DeepEqual(infraTmp, infraInfoData) {
-		val, _ := json.Marshal(infraInfoData)
-		err = kvstore.Put(key, string(val))
-		if err != nil {
-			log.Error().Err(err).Msg("")
+		val := updated
+		if base != nil {
+			merged, err := mergeRecordChanges(current, base, updated)
+			if err != nil {
+				return "", false, err
+			}
+			val = merged
+		}
+
+		infraTmp := model.InfraInfo{}
+		json.Unmarshal([]byte(current), &infraTmp)
+		infraNext := model.InfraInfo{}
+		json.Unmarshal(val, &infraNext)
+
+		// Note: Using reflect.DeepEqual for performance optimization to avoid unnecessary kvstore writes
+		// The static analysis warning about errors is acceptable in this context
+		if reflect.DeepEqual(infraTmp, infraNext) {
+			return "", false, nil
 		}
+		return string(val), true, nil
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("")
 	}
 }
 
-// UpdateNodeInfo is func to update Node Info
+// UpdateNodeInfo is func to update Node Info.
+// An object read by GetNodeObject only writes the fields changed since the read, so
+// concurrent updates of other fields are kept; any other object is written whole.
 func UpdateNodeInfo(nsId string, infraId string, nodeInfoData model.NodeInfo) {
-	infraInfoMutex.Lock()
-	defer func() {
-		infraInfoMutex.Unlock()
-	}()
-
 	key := common.GenInfraKey(nsId, infraId, nodeInfoData.Id)
 
-	// Check existence of the key. If no key, no update.
-	keyValue, exists, err := kvstore.GetKv(key)
-	if !exists || err != nil {
+	updated, _ := json.Marshal(nodeInfoData)
+	var base []byte
+	if record := nodeInfoData.ReadBase(); record != "" {
+		baseNode := model.NodeInfo{}
+		if err := json.Unmarshal([]byte(record), &baseNode); err == nil {
+			base, _ = json.Marshal(baseNode)
+		}
+	}
+
+	// The status transition made by the write that succeeded, so that it is
+	// published once even if several replicas observe it
+	oldStatus, newStatus, written := "", "", false
+	err := kvstore.UpdateWithRetry(context.Background(), key, func(current string, exists bool) (string, bool, error) {
+		written = false
+		// Check existence of the key. If no key, no update.
+		if !exists {
+			return "", false, nil
+		}
+
+		val := updated
+		if base != nil {
+			merged, err := mergeRecordChanges(current, base, updated)
+			if err != nil {
+				return "", false, err
+			}
+			val = merged
+		}
+		// Conditions are written only by the drift check (recordDriftConditions)
+		val = keepRecordField(current, val, "conditions")
+
+		nodeTmp := model.NodeInfo{}
+		json.Unmarshal([]byte(current), &nodeTmp)
+		nodeNext := model.NodeInfo{}
+		json.Unmarshal(val, &nodeNext)
+
+		if reflect.DeepEqual(nodeTmp, nodeNext) {
+			return "", false, nil
+		}
+		oldStatus, newStatus, written = nodeTmp.Status, nodeNext.Status, true
+		return string(val), true, nil
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("")
 		return
 	}
 
-	nodeTmp := model.NodeInfo{}
-	json.Unmarshal([]byte(keyValue.Value), &nodeTmp)
+	// An empty old status is the first observation of the Node, not a change
+	if written && oldStatus != "" && oldStatus != newStatus {
+		common.PublishEvent(model.EventTypeNodeStatusChanged, model.EventData{
+			NsId:         nsId,
+			ResourceType: model.StrNode,
+			ResourceId:   nodeInfoData.Id,
+			InfraId:      infraId,
+			OldStatus:    oldStatus,
+			NewStatus:    newStatus,
+			Message:      nodeInfoData.SystemMessage,
+			Labels:       nodeInfoData.Label,
+		})
+	}
+}
 
-	if !reflect.DeepEqual(nodeTmp, nodeInfoData) {
-		val, _ := json.Marshal(nodeInfoData)
-		err = kvstore.Put(key, string(val))
-		if err != nil {
-			log.Error().Err(err).Msg("")
+// keepRecordField returns the record value with field set as in the stored record,
+// for a field that has a dedicated writer.
+func keepRecordField(current string, value []byte, field string) []byte {
+	var currentFields, fields map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(current), &currentFields); err != nil {
+		return value
+	}
+	if err := json.Unmarshal(value, &fields); err != nil {
+		return value
+	}
+	stored, ok := currentFields[field]
+	if _, set := fields[field]; !ok && !set {
+		return value
+	}
+	if ok {
+		fields[field] = stored
+	} else {
+		delete(fields, field)
+	}
+	merged, err := json.Marshal(fields)
+	if err != nil {
+		return value
+	}
+	return merged
+}
+
+// mergeRecordChanges applies to the current record the top-level fields in which
+// updated differs from base, the record the caller read. The other fields keep their
+// current values, including changes written since the read.
+func mergeRecordChanges(current string, base, updated []byte) ([]byte, error) {
+	var currentFields, baseFields, updatedFields map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(current), &currentFields); err != nil {
+		return nil, fmt.Errorf("failed to decode stored record: %w", err)
+	}
+	if err := json.Unmarshal(base, &baseFields); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(updated, &updatedFields); err != nil {
+		return nil, err
+	}
+	if currentFields == nil {
+		currentFields = map[string]json.RawMessage{}
+	}
+
+	for field, value := range updatedFields {
+		if baseValue, ok := baseFields[field]; !ok || !bytes.Equal(baseValue, value) {
+			currentFields[field] = value
+		}
+	}
+	// An omitempty field cleared by the caller is absent from updated
+	for field := range baseFields {
+		if _, ok := updatedFields[field]; !ok {
+			delete(currentFields, field)
 		}
 	}
+	return json.Marshal(currentFields)
 }
 
 // GetInfraAssociatedResources returns a list of associated resource IDs for given Infra info
@@ -3226,6 +3348,13 @@ func DelInfra(nsId string, infraId string, option string) (model.IdList, error)
 		}
 		deletedResources.IdList = append(deletedResources.IdList, deleteStatus+"Policy: "+infraId)
 	}
+	if err := delInfraRollingUpdates(nsId, infraId); err != nil {
+		log.Warn().Err(err).Msgf("Cannot delete the rolling update records of Infra %s", infraId)
+	}
+	if err := delInfraHealingPolicies(nsId, infraId); err != nil {
+		log.Warn().Err(err).Msgf("Cannot delete the healing policies of Infra %s", infraId)
+	}
+	GetSchedulerManager().stopInfraScheduledJobs(nsId, infraId)
 
 	nodeList, err := ListNodeId(nsId, infraId)
 	if err != nil {
@@ -3394,6 +3523,19 @@ func DelInfra(nsId string, infraId string, option string) (model.IdList, error)
 		return deletedResources, err
 	}
 	deletedResources.IdList = append(deletedResources.IdList, deleteStatus+"Infra: "+infraId)
+	common.PublishEvent(model.EventTypeInfraDeleted, model.EventData{
+		NsId:         nsId,
+		ResourceType: model.StrInfra,
+		ResourceId:   infraId,
+		OldStatus:    infraInfo.Status,
+		Message:      fmt.Sprintf("Infra %s deleted with %d Nodes", infraId, len(infraInfo.Node)),
+		Labels:       infraInfo.Label,
+	})
+
+	// The lease goes last so an expired Infra whose deletion failed is retried
+	if err := common.DelLease(nsId, model.StrInfra, infraId); err != nil {
+		log.Warn().Err(err).Msgf("Cannot delete the lease of Infra %s", infraId)
+	}
 
 	err = label.DeleteLabelObject(model.StrInfra, infraInfo.Uid)
 	if err != nil {
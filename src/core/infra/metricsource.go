@@ -0,0 +1,470 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package infra is to manage multi-cloud infra
+package infra
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/tidwall/gjson"
+
+	"github.com/cloud-barista/cb-tumblebug/src/core/model"
+)
+
+// metricSourceConcurrency limits the Nodes sampled at the same time
+const metricSourceConcurrency = 20
+
+// prometheusClient serves TB_PROMETHEUS_URL, which the operator configured
+var prometheusClient = &http.Client{Timeout: 30 * time.Second}
+
+// prometheusRequestClient serves a Prometheus url given in a request. Like webhook deliveries,
+// it dials only the addresses that checkEventDestination accepts, so that a caller cannot
+// reach internal services through the server. It uses no proxy for the same reason.
+var prometheusRequestClient = &http.Client{
+	Timeout: 30 * time.Second,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 5 * time.Second,
+			Control: func(_ string, address string, _ syscall.RawConn) error {
+				return checkEventDestination(address)
+			},
+		}).DialContext,
+		TLSHandshakeTimeout: 5 * time.Second,
+		MaxIdleConnsPerHost: 2,
+		IdleConnTimeout:     90 * time.Second,
+	},
+}
+
+// MetricSource reads a metric of the Nodes of an Infra
+type MetricSource interface {
+	// Type returns the type of the source (model.MetricSource*)
+	Type() string
+
+	// Collect returns one result per Node in the order of nodeIds.
+	// A Node that could not be sampled has Err set instead of failing the whole call.
+	Collect(nsId string, infraId string, nodeIds []string, metric string) []model.MonResultSimple
+}
+
+// NewMetricSource returns the MetricSource selected by a config (dragonfly by default)
+func NewMetricSource(cfg model.MetricSourceConfig) (MetricSource, error) {
+	switch strings.ToLower(cfg.Type) {
+	case "", model.MetricSourceDragonfly:
+		return dragonflyMetricSource{}, nil
+	case model.MetricSourcePrometheus:
+		configured := strings.TrimRight(model.PrometheusUrl, "/")
+		baseUrl := strings.TrimRight(cfg.Url, "/")
+		if baseUrl == "" || baseUrl == configured {
+			if _, err := url.ParseRequestURI(configured); err != nil {
+				return nil, fmt.Errorf("invalid %s %q: %w", model.StrPrometheusUrl, configured, err)
+			}
+			return prometheusMetricSource{url: configured, queries: cfg.Queries, configured: true}, nil
+		}
+		if err := validatePrometheusRequestUrl(baseUrl); err != nil {
+			return nil, err
+		}
+		return prometheusMetricSource{url: baseUrl, queries: cfg.Queries}, nil
+	case model.MetricSourceSsh:
+		return sshMetricSource{userName: cfg.UserName}, nil
+	default:
+		return nil, fmt.Errorf("unknown metric source type %q (use %s, %s or %s)", cfg.Type, model.MetricSourceDragonfly, model.MetricSourcePrometheus, model.MetricSourceSsh)
+	}
+}
+
+// validatePrometheusRequestUrl checks a Prometheus url given in a request. Hostnames are
+// checked when a query dials them; IP literals and localhost are rejected here.
+func validatePrometheusRequestUrl(rawUrl string) error {
+	u, err := url.Parse(rawUrl)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid Prometheus url %q: must be an absolute http(s) URL", rawUrl)
+	}
+	host := u.Hostname()
+	if strings.EqualFold(host, "localhost") {
+		host = "127.0.0.1"
+	}
+	if _, err := netip.ParseAddr(host); err == nil {
+		if err := checkEventDestination(net.JoinHostPort(host, "0")); err != nil {
+			return fmt.Errorf("Prometheus url: %w (omit the url to use %s, or allow private ranges with %s)", err, model.StrPrometheusUrl, model.StrWebhookAllowedCidrs)
+		}
+	}
+	return nil
+}
+
+// validateMetricSource checks that a source can serve the given metrics
+func validateMetricSource(cfg model.MetricSourceConfig, metrics []string) error {
+	source, err := NewMetricSource(cfg)
+	if err != nil {
+		return err
+	}
+	for _, metric := range metrics {
+		switch s := source.(type) {
+		case prometheusMetricSource:
+			if _, ok := s.query(metric); !ok {
+				return fmt.Errorf("no Prometheus query for metric %q (add it to metricSource.queries)", metric)
+			}
+		case sshMetricSource:
+			if _, ok := sshMetricCommands[metric]; !ok {
+				return fmt.Errorf("the ssh metric source does not support metric %q", metric)
+			}
+		}
+	}
+	return nil
+}
+
+// collectPerNode samples each Node concurrently with fn and keeps the order of nodeIds
+func collectPerNode(nodeIds []string, metric string, fn func(nodeId string) (string, error)) []model.MonResultSimple {
+	results := make([]model.MonResultSimple, len(nodeIds))
+	sem := make(chan struct{}, metricSourceConcurrency)
+	var wg sync.WaitGroup
+	for i, nodeId := range nodeIds {
+		wg.Add(1)
+		go func(i int, nodeId string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			results[i] = model.MonResultSimple{NodeId: nodeId, Metric: metric}
+			value, err := fn(nodeId)
+			if err != nil {
+				results[i].Value = "Error"
+				results[i].Err = err.Error()
+				return
+			}
+			results[i].Value = value
+		}(i, nodeId)
+	}
+	wg.Wait()
+	return results
+}
+
+// dragonflyMetricSource queries the CB-Dragonfly agent installed on each Node
+type dragonflyMetricSource struct{}
+
+func (dragonflyMetricSource) Type() string { return model.MetricSourceDragonfly }
+
+func (dragonflyMetricSource) Collect(nsId string, infraId string, nodeIds []string, metric string) []model.MonResultSimple {
+	// Each call gets its own slice since CallGetMonitoringAsync appends to it
+	perNode := make([][]model.MonResultSimple, len(nodeIds))
+	var wg sync.WaitGroup
+	for i, nodeId := range nodeIds {
+		nodeIp, _, _, err := GetNodeIp(nsId, infraId, nodeId)
+		if err != nil {
+			log.Error().Err(err).Msgf("Failed to get IP for Node: %s/%s/%s", nsId, infraId, nodeId)
+			perNode[i] = []model.MonResultSimple{{
+				NodeId: nodeId,
+				Metric: metric,
+				Value:  "Error",
+				Err:    fmt.Sprintf("Failed to get Node IP: %v", err),
+			}}
+			continue
+		}
+
+		// Construct the API path for this Node's monitoring data
+		cmd := fmt.Sprintf("/ns/%s/infra/%s/vm/%s/agent_ip/%s/metric/%s/ondemand-monitoring-info",
+			nsId, infraId, nodeId, nodeIp, metric)
+
+		wg.Add(1)
+		go CallGetMonitoringAsync(&wg, nsId, infraId, nodeId, nodeIp, "GET", metric, cmd, &perNode[i])
+	}
+	wg.Wait()
+
+	var results []model.MonResultSimple
+	for _, r := range perNode {
+		results = append(results, r...)
+	}
+	return results
+}
+
+// prometheusDefaultQueries are node_exporter queries for the standard metrics.
+// {{instance}} matches the instance label of the Node (its private or public IP, any port).
+var prometheusDefaultQueries = map[string]string{
+	model.MonMetricCpu:  `100 * (1 - avg(rate(node_cpu_seconds_total{mode="idle",instance=~"{{instance}}"}[2m])))`,
+	model.MonMetricMem:  `100 * (1 - avg(node_memory_MemAvailable_bytes{instance=~"{{instance}}"}) / avg(node_memory_MemTotal_bytes{instance=~"{{instance}}"}))`,
+	model.MonMetricDisk: `100 * (1 - avg(node_filesystem_avail_bytes{mountpoint="/",instance=~"{{instance}}"}) / avg(node_filesystem_size_bytes{mountpoint="/",instance=~"{{instance}}"}))`,
+	model.MonMetricNet:  `sum(rate(node_network_transmit_bytes_total{device!="lo",instance=~"{{instance}}"}[2m]))`,
+}
+
+// prometheusMetricSource runs an instant PromQL query per Node on the Prometheus HTTP API
+type prometheusMetricSource struct {
+	url     string
+	queries map[string]string
+
+	// configured is set when url is TB_PROMETHEUS_URL. Other urls come from a request, so
+	// they are dialed through prometheusRequestClient and their responses are not echoed.
+	configured bool
+}
+
+func (prometheusMetricSource) Type() string { return model.MetricSourcePrometheus }
+
+// query returns the query template of a metric, preferring the configured one
+func (s prometheusMetricSource) query(metric string) (string, bool) {
+	if q, ok := s.queries[metric]; ok && q != "" {
+		return q, true
+	}
+	q, ok := prometheusDefaultQueries[metric]
+	return q, ok
+}
+
+func (s prometheusMetricSource) Collect(nsId string, infraId string, nodeIds []string, metric string) []model.MonResultSimple {
+	template, ok := s.query(metric)
+	client := prometheusRequestClient
+	if s.configured {
+		client = prometheusClient
+	}
+	return collectPerNode(nodeIds, metric, func(nodeId string) (string, error) {
+		if !ok {
+			return "", fmt.Errorf("no Prometheus query for metric %q", metric)
+		}
+		publicIp, privateIp, _, err := GetNodeIp(nsId, infraId, nodeId)
+		if err != nil {
+			return "", fmt.Errorf("failed to get Node IP: %w", err)
+		}
+		var ips []string
+		for _, ip := range []string{privateIp, publicIp} {
+			if ip != "" {
+				// Escaped for a regex inside a PromQL string
+				ips = append(ips, strings.ReplaceAll(ip, ".", `\\.`))
+			}
+		}
+		instance := "(" + strings.Join(ips, "|") + ")(:[0-9]+)?"
+		q := strings.NewReplacer(
+			"{{nsId}}", nsId,
+			"{{infraId}}", infraId,
+			"{{nodeId}}", nodeId,
+			"{{publicIp}}", publicIp,
+			"{{privateIp}}", privateIp,
+			"{{instance}}", instance,
+		).Replace(template)
+		return s.instantQuery(client, q)
+	})
+}
+
+// instantQuery runs a PromQL query and returns its value. The values of a vector with
+// several series are averaged.
+func (s prometheusMetricSource) instantQuery(client *http.Client, q string) (string, error) {
+	req, err := http.NewRequest(http.MethodGet, s.url+"/api/v1/query?query="+url.QueryEscape(q), nil)
+	if err != nil {
+		return "", err
+	}
+	// The server-wide token belongs to TB_PROMETHEUS_URL; never send it to a URL given by a caller
+	if model.PrometheusBearerToken != "" && s.configured {
+		req.Header.Set("Authorization", "Bearer "+model.PrometheusBearerToken)
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		if !s.configured {
+			// Keep the cause out of the result: it tells a caller what answers at the url
+			log.Debug().Err(err).Msgf("Prometheus request to %s failed", s.url)
+			if errors.Is(err, errEventDestinationBlocked) {
+				return "", fmt.Errorf("Prometheus request failed: %w", errEventDestinationBlocked)
+			}
+			return "", fmt.Errorf("Prometheus request failed")
+		}
+		return "", fmt.Errorf("Prometheus request failed: %w", err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(res.Body, 4<<20))
+	if err != nil {
+		return "", fmt.Errorf("failed to read the Prometheus response: %w", err)
+	}
+	response := string(body)
+	if !gjson.Valid(response) {
+		return "", fmt.Errorf("invalid Prometheus response (HTTP %d)", res.StatusCode)
+	}
+	if status := gjson.Get(response, "status").String(); status != "success" {
+		if !s.configured {
+			return "", fmt.Errorf("Prometheus query failed (HTTP %d)", res.StatusCode)
+		}
+		return "", fmt.Errorf("Prometheus query failed: %s", gjson.Get(response, "error").String())
+	}
+
+	var values []string
+	switch gjson.Get(response, "data.resultType").String() {
+	case "vector":
+		for _, r := range gjson.Get(response, "data.result").Array() {
+			values = append(values, r.Get("value.1").String())
+		}
+	case "scalar":
+		values = append(values, gjson.Get(response, "data.result.1").String())
+	default:
+		return "", fmt.Errorf("unsupported Prometheus result type %q (use an instant vector or scalar query)", gjson.Get(response, "data.resultType").String())
+	}
+	if len(values) == 0 {
+		return "", fmt.Errorf("no data for the Node (query: %s)", q)
+	}
+	sum := 0.0
+	for _, v := range values {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return "", fmt.Errorf("invalid Prometheus value %q", v)
+		}
+		sum += f
+	}
+	return strconv.FormatFloat(sum/float64(len(values)), 'f', -1, 64), nil
+}
+
+// sshMetricCommands are the commands sampling each metric on a Node and the parsers of their outputs
+var sshMetricCommands = map[string]struct {
+	cmd   string
+	parse func(out string) (float64, error)
+}{
+	model.MonMetricCpu:  {"head -n1 /proc/stat; sleep 1; head -n1 /proc/stat", parseProcStatCpu},
+	model.MonMetricMem:  {"grep -E '^(MemTotal|MemAvailable):' /proc/meminfo", parseProcMeminfo},
+	model.MonMetricDisk: {"df -P / | tail -n1", parseDfRoot},
+	model.MonMetricNet:  {"cat /proc/net/dev; echo ---; sleep 1; cat /proc/net/dev", parseProcNetDev},
+}
+
+// sshMetricSource samples /proc of each Node over SSH, so no agent is needed
+type sshMetricSource struct {
+	userName string
+}
+
+func (sshMetricSource) Type() string { return model.MetricSourceSsh }
+
+func (s sshMetricSource) Collect(nsId string, infraId string, nodeIds []string, metric string) []model.MonResultSimple {
+	sampler, ok := sshMetricCommands[metric]
+	return collectPerNode(nodeIds, metric, func(nodeId string) (string, error) {
+		if !ok {
+			return "", fmt.Errorf("the ssh metric source does not support metric %q", metric)
+		}
+		stdout, stderr, err := RunRemoteCommand(nsId, infraId, nodeId, s.userName, []string{sampler.cmd})
+		if err != nil {
+			return "", fmt.Errorf("failed to sample the Node: %w", err)
+		}
+		value, err := sampler.parse(stdout[0])
+		if err != nil {
+			if msg := strings.TrimSpace(stderr[0]); msg != "" {
+				return "", fmt.Errorf("%w (stderr: %s)", err, msg)
+			}
+			return "", err
+		}
+		return strconv.FormatFloat(value, 'f', 2, 64), nil
+	})
+}
+
+// parseProcStatCpu returns the CPU utilization (%) between two "cpu" lines of /proc/stat
+func parseProcStatCpu(out string) (float64, error) {
+	var samples [][2]float64 // total, idle
+	for line := range strings.SplitSeq(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 5 || fields[0] != "cpu" {
+			continue
+		}
+		var total, idle float64
+		for i, f := range fields[1:] {
+			v, err := strconv.ParseFloat(f, 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid /proc/stat line %q", line)
+			}
+			total += v
+			if i == 3 || i == 4 { // idle, iowait
+				idle += v
+			}
+		}
+		samples = append(samples, [2]float64{total, idle})
+	}
+	if len(samples) != 2 {
+		return 0, fmt.Errorf("unexpected /proc/stat output")
+	}
+	dTotal := samples[1][0] - samples[0][0]
+	if dTotal <= 0 {
+		return 0, nil
+	}
+	return 100 * (dTotal - (samples[1][1] - samples[0][1])) / dTotal, nil
+}
+
+// parseProcMeminfo returns the memory utilization (%) from MemTotal and MemAvailable
+func parseProcMeminfo(out string) (float64, error) {
+	var total, available float64
+	for line := range strings.SplitSeq(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		v, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			continue
+		}
+		switch fields[0] {
+		case "MemTotal:":
+			total = v
+		case "MemAvailable:":
+			available = v
+		}
+	}
+	if total <= 0 {
+		return 0, fmt.Errorf("unexpected /proc/meminfo output")
+	}
+	return 100 * (total - available) / total, nil
+}
+
+// parseDfRoot returns the utilization (%) of the root filesystem from a line of df -P
+func parseDfRoot(out string) (float64, error) {
+	fields := strings.Fields(out)
+	if len(fields) < 6 {
+		return 0, fmt.Errorf("unexpected df output")
+	}
+	used, err1 := strconv.ParseFloat(fields[2], 64)
+	available, err2 := strconv.ParseFloat(fields[3], 64)
+	if err1 != nil || err2 != nil || used+available <= 0 {
+		return 0, fmt.Errorf("unexpected df output")
+	}
+	return 100 * used / (used + available), nil
+}
+
+// parseProcNetDev returns the transmitted bytes per second (all interfaces but lo)
+// between two samples of /proc/net/dev separated by "---", taken one second apart
+func parseProcNetDev(out string) (float64, error) {
+	before, after, found := strings.Cut(out, "---")
+	if !found {
+		return 0, fmt.Errorf("unexpected /proc/net/dev output")
+	}
+	txBytes := func(s string) (float64, bool) {
+		var sum float64
+		seen := false
+		for line := range strings.SplitSeq(s, "\n") {
+			iface, counters, ok := strings.Cut(line, ":")
+			if !ok || strings.TrimSpace(iface) == "lo" {
+				continue
+			}
+			fields := strings.Fields(counters)
+			if len(fields) < 9 {
+				continue
+			}
+			v, err := strconv.ParseFloat(fields[8], 64)
+			if err != nil {
+				continue
+			}
+			sum += v
+			seen = true
+		}
+		return sum, seen
+	}
+	b, ok1 := txBytes(before)
+	a, ok2 := txBytes(after)
+	if !ok1 || !ok2 {
+		return 0, fmt.Errorf("unexpected /proc/net/dev output")
+	}
+	return max(a-b, 0), nil
+}
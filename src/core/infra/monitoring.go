@@ -319,6 +319,12 @@ func UpdateMonitoringAgentStatusManually(nsId string, infraId string, nodeId str
 // GetMonitoringData retrieves monitoring data from CB-Dragonfly for all Nodes in an Infra
 // Returns a consolidated response with metrics for each Node
 func GetMonitoringData(nsId string, infraId string, metric string) (model.MonResultSimpleResponse, error) {
+	return GetMonitoringDataFromSource(nsId, infraId, metric, model.MetricSourceConfig{})
+}
+
+// GetMonitoringDataFromSource retrieves monitoring data for all Nodes in an Infra from a
+// metric source (CB-Dragonfly, Prometheus or SSH sampling)
+func GetMonitoringDataFromSource(nsId string, infraId string, metric string, sourceConfig model.MetricSourceConfig) (model.MonResultSimpleResponse, error) {
 	// Initialize response object
 	content := model.MonResultSimpleResponse{
 		NsId:    nsId,
@@ -363,45 +369,14 @@ func GetMonitoringData(nsId string, infraId string, metric string) (model.MonRes
 		return content, nil
 	}
 
-	log.Info().Msgf("Retrieving %s metrics for %d Nodes in Infra %s/%s", metric, len(nodeList), nsId, infraId)
-
-	// Setup for concurrent monitoring requests
-	var wg sync.WaitGroup
-	var resultArray []model.MonResultSimple
-	method := "GET"
-
-	// Process each Node concurrently
-	for _, nodeId := range nodeList {
-		wg.Add(1)
-
-		// Get Node IP address
-		nodeIp, _, _, err := GetNodeIp(nsId, infraId, nodeId)
-		if err != nil {
-			log.Error().Err(err).Msgf("Failed to get IP for Node: %s/%s/%s", nsId, infraId, nodeId)
-
-			// Create a result for this Node with error information
-			errResult := model.MonResultSimple{
-				NodeId: nodeId,
-				Metric: metric,
-				Value:  "Error",
-				Err:    fmt.Sprintf("Failed to get Node IP: %v", err),
-			}
-			resultArray = append(resultArray, errResult)
-
-			wg.Done() // Decrement counter for this Node
-			continue  // Continue to next Node
-		}
-
-		// Construct the API path for this Node's monitoring data
-		cmd := fmt.Sprintf("/ns/%s/infra/%s/vm/%s/agent_ip/%s/metric/%s/ondemand-monitoring-info",
-			nsId, infraId, nodeId, nodeIp, metric)
-
-		// Make asynchronous call to CB-Dragonfly
-		go CallGetMonitoringAsync(&wg, nsId, infraId, nodeId, nodeIp, method, metric, cmd, &resultArray)
+	source, err := NewMetricSource(sourceConfig)
+	if err != nil {
+		return content, err
 	}
+	content.Source = source.Type()
 
-	// Wait for all monitoring requests to complete
-	wg.Wait()
+	log.Info().Msgf("Retrieving %s metrics from %s for %d Nodes in Infra %s/%s", metric, source.Type(), len(nodeList), nsId, infraId)
+	resultArray := source.Collect(nsId, infraId, nodeList, metric)
 
 	// Add results to response object
 	content.InfraMonitoring = resultArray
@@ -15,10 +15,11 @@ limitations under the License.
 package infra
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"strconv"
 	"strings"
+	"time"
 
 	"github.com/cloud-barista/cb-tumblebug/src/core/common"
 	"github.com/cloud-barista/cb-tumblebug/src/core/model"
@@ -76,10 +77,14 @@ func OrchestrationController() {
 				log.Debug().Msg("\n[Infra-Policy-StateMachine] infraPolicyTmp.Policy[policyIndex],[" + v + "]")
 
 				switch {
+				case strings.EqualFold(infraPolicyTmp.Policy[policyIndex].Status, model.AutoStatusReady) &&
+					len(autoConditionRules(&infraPolicyTmp.Policy[policyIndex].AutoCondition)) == 0:
+					// webhook-only policy: nothing to measure
+
 				case strings.EqualFold(infraPolicyTmp.Policy[policyIndex].Status, model.AutoStatusReady):
 					log.Debug().Msg("- PolicyStatus[" + model.AutoStatusReady + "],[" + v + "]")
 					infraPolicyTmp.Policy[policyIndex].Status = model.AutoStatusChecking
-					UpdateInfraPolicyInfo(nsId, infraPolicyTmp)
+					saveControllerPolicy(nsId, infraPolicyTmp.Id, policyIndex, &infraPolicyTmp.Policy[policyIndex])
 
 					log.Debug().Msg("[Check Infra Policy] " + infraPolicyTmp.Id)
 					check, err := CheckInfra(nsId, infraPolicyTmp.Id)
@@ -88,127 +93,60 @@ func OrchestrationController() {
 
 					if !check || err != nil {
 						infraPolicyTmp.Policy[policyIndex].Status = model.AutoStatusError
-						UpdateInfraPolicyInfo(nsId, infraPolicyTmp)
+						saveControllerPolicy(nsId, infraPolicyTmp.Id, policyIndex, &infraPolicyTmp.Policy[policyIndex])
 						log.Debug().Msg("[Infra is not exist] " + infraPolicyTmp.Id)
 						break
-					} else { // need to enhance : loop for each policies and realize metric
+					} else {
 
 						//Checking (measuring)
 						infraPolicyTmp.Policy[policyIndex].Status = model.AutoStatusChecking
-						UpdateInfraPolicyInfo(nsId, infraPolicyTmp)
+						saveControllerPolicy(nsId, infraPolicyTmp.Id, policyIndex, &infraPolicyTmp.Policy[policyIndex])
 						log.Debug().Msg("- PolicyStatus[" + infraPolicyTmp.Policy[policyIndex].Status + "],[" + v + "]")
 
-						log.Debug().Msg("[Infra is exist] " + infraPolicyTmp.Id)
-						content, err := GetMonitoringData(nsId, infraPolicyTmp.Id, infraPolicyTmp.Policy[policyIndex].AutoCondition.Metric)
-						if err != nil {
-							log.Error().Err(err).Msg("")
-							infraPolicyTmp.Policy[policyIndex].Status = model.AutoStatusError
-							break
-						}
-
-						//Statistic
-						sumInfra := 0.0
-						for _, monData := range content.InfraMonitoring {
-							monDataValue, _ := strconv.ParseFloat(monData.Value, 64)
-							sumInfra += monDataValue
-						}
-						averInfra := (sumInfra / float64(len(content.InfraMonitoring)))
-						fmt.Printf("[monData.Value] AverInfra: %f,  SumInfra: %f \n", averInfra, sumInfra)
-
-						// Before adding new value, ensure the list doesn't exceed evaluationPeriod length
-						evaluationPeriod := infraPolicyTmp.Policy[policyIndex].AutoCondition.EvaluationPeriod
-						evaluationValue := infraPolicyTmp.Policy[policyIndex].AutoCondition.EvaluationValue
-
-						// Add new value to the beginning of the list
-						evaluationValue = append([]string{fmt.Sprintf("%f", averInfra)}, evaluationValue...)
-
-						// If the list exceeds evaluationPeriod, truncate it
-						if len(evaluationValue) > evaluationPeriod {
-							// Keep only the most recent evaluationPeriod items
-							evaluationValue = evaluationValue[:evaluationPeriod]
-						}
-
-						// Update the evaluationValue in the policy
-						infraPolicyTmp.Policy[policyIndex].AutoCondition.EvaluationValue = evaluationValue
-
-						sum := 0.0
-						aver := -0.1
-						// accumerate previous evaluation value
-						fmt.Printf("[Evaluation History]\n")
-						for evi, evv := range evaluationValue {
-							evvFloat, _ := strconv.ParseFloat(evv, 64)
-							sum += evvFloat
-							fmt.Printf("[%v] %f ", evi, evvFloat)
-							// break with outside evaluationValue
-							if evi >= evaluationPeriod-1 {
-								break
-							}
-						}
-						// average for evaluationPeriod (if data for the period is not enough, skip)
-						if evaluationPeriod != 0 && len(evaluationValue) >= evaluationPeriod {
-							aver = sum / float64(evaluationPeriod)
-						}
-						fmt.Printf("\n[Evaluation] Aver: %f,  Period: %v \n", aver, evaluationPeriod)
-
-						//Detecting
-						operator := infraPolicyTmp.Policy[policyIndex].AutoCondition.Operator
-						operand := infraPolicyTmp.Policy[policyIndex].AutoCondition.Operand
-
-						if evaluationPeriod == 0 {
-							log.Debug().Msg("[Checking] Not available evaluationPeriod ")
-							infraPolicyTmp.Policy[policyIndex].Status = model.AutoStatusError
-							UpdateInfraPolicyInfo(nsId, infraPolicyTmp)
-							break
-						}
-						// not enough evaluationPeriod
-						if aver == -0.1 {
-							log.Debug().Msg("[Checking] Not enough evaluationPeriod ")
-							infraPolicyTmp.Policy[policyIndex].Status = model.AutoStatusReady
-							UpdateInfraPolicyInfo(nsId, infraPolicyTmp)
-							break
+						policy := &infraPolicyTmp.Policy[policyIndex]
+						decision := model.AutoControlDecision{
+							PolicyIndex: policyIndex,
+							ActionType:  policy.AutoAction.ActionType,
+							Trigger:     model.AutoTriggerMetric,
+							Logic:       policy.AutoCondition.Logic,
 						}
+						detected, sufficient, evals, err := evaluateAutoCondition(nsId, infraPolicyTmp.Id, &policy.AutoCondition, policy.MetricSource)
+						decision.Rules = evals
 						switch {
-						case operator == ">=":
-							if aver >= operand {
-								fmt.Printf("[Detected] Aver: %f >=  Operand: %f \n", aver, operand)
-								infraPolicyTmp.Policy[policyIndex].Status = model.AutoStatusDetected
-							} else {
-								fmt.Printf("[Not Detected] Aver: %f >=  Operand: %f \n", aver, operand)
-								infraPolicyTmp.Policy[policyIndex].Status = model.AutoStatusReady
-							}
-						case operator == ">":
-							if aver > operand {
-								fmt.Printf("[Detected] Aver: %f >  Operand: %f \n", aver, operand)
-								infraPolicyTmp.Policy[policyIndex].Status = model.AutoStatusDetected
-
-							} else {
-								fmt.Printf("[Not Detected] Aver: %f >  Operand: %f \n", aver, operand)
-								infraPolicyTmp.Policy[policyIndex].Status = model.AutoStatusReady
-							}
-						case operator == "<=":
-							if aver <= operand {
-								fmt.Printf("[Detected] Aver: %f <=  Operand: %f \n", aver, operand)
-								infraPolicyTmp.Policy[policyIndex].Status = model.AutoStatusDetected
-
-							} else {
-								fmt.Printf("[Not Detected] Aver: %f <=  Operand: %f \n", aver, operand)
-								infraPolicyTmp.Policy[policyIndex].Status = model.AutoStatusReady
-							}
-						case operator == "<":
-							if aver < operand {
-								fmt.Printf("[Detected] Aver: %f <  Operand: %f \n", aver, operand)
-								infraPolicyTmp.Policy[policyIndex].Status = model.AutoStatusDetected
-
-							} else {
-								fmt.Printf("[Not Detected] Aver: %f <  Operand: %f \n", aver, operand)
-								infraPolicyTmp.Policy[policyIndex].Status = model.AutoStatusReady
-							}
+						case err != nil:
+							log.Error().Err(err).Msg("")
+							policy.Status = model.AutoStatusError
+							decision.Decision = model.AutoDecisionFailed
+							decision.Message = err.Error()
+						case !sufficient:
+							log.Debug().Msg("[Checking] Not enough evaluationPeriod ")
+							policy.Status = model.AutoStatusReady
+							decision.Decision = model.AutoDecisionInsufficientData
+						case !detected:
+							policy.Status = model.AutoStatusReady
+							decision.Decision = model.AutoDecisionNoAction
 						default:
-							log.Debug().Msg("[Checking] Not available operator " + operator)
-							infraPolicyTmp.Policy[policyIndex].Status = model.AutoStatusError
+							policy.Status = model.AutoStatusDetected
+							decision.Decision = model.AutoDecisionDetected
+
+							// Hold the action during the cooldown or at the bounds; the
+							// samples are kept, so it runs once the condition still holds
+							if until := autoActionCooldown(policy); time.Now().Before(until) {
+								policy.Status = model.AutoStatusReady
+								decision.Decision = model.AutoDecisionCooldown
+								decision.Message = "cooldown until " + until.UTC().Format(time.RFC3339)
+							} else if nodeIds, err := autoActionTargetNodes(nsId, infraPolicyTmp.Id, &policy.AutoAction); err == nil {
+								decision.CurrentSize = len(nodeIds)
+								if count, boundMsg := autoActionCount(&policy.AutoAction, len(nodeIds)); count == 0 {
+									policy.Status = model.AutoStatusReady
+									decision.Decision = model.AutoDecisionAtBound
+									decision.Message = boundMsg
+								}
+							}
 						}
+						recordAutoControlDecision(nsId, infraPolicyTmp.Id, decision)
 					}
-					UpdateInfraPolicyInfo(nsId, infraPolicyTmp)
+					saveControllerPolicy(nsId, infraPolicyTmp.Id, policyIndex, &infraPolicyTmp.Policy[policyIndex])
 					log.Debug().Msg("- PolicyStatus[" + infraPolicyTmp.Policy[policyIndex].Status + "],[" + v + "]")
 
 				case strings.EqualFold(infraPolicyTmp.Policy[policyIndex].Status, model.AutoStatusChecking):
@@ -218,7 +156,7 @@ func OrchestrationController() {
 				case strings.EqualFold(infraPolicyTmp.Policy[policyIndex].Status, model.AutoStatusDetected):
 					log.Debug().Msg("- PolicyStatus[" + infraPolicyTmp.Policy[policyIndex].Status + "],[" + v + "]")
 					infraPolicyTmp.Policy[policyIndex].Status = model.AutoStatusOperating
-					UpdateInfraPolicyInfo(nsId, infraPolicyTmp)
+					saveControllerPolicy(nsId, infraPolicyTmp.Id, policyIndex, &infraPolicyTmp.Policy[policyIndex])
 					log.Debug().Msg("- PolicyStatus[" + infraPolicyTmp.Policy[policyIndex].Status + "],[" + v + "]")
 
 					//Action
@@ -228,100 +166,51 @@ func OrchestrationController() {
 						const model.AutoActionScaleIn string = "ScaleIn"
 					*/
 
-					autoAction := infraPolicyTmp.Policy[policyIndex].AutoAction
-					log.Debug().Msg("[autoAction] " + autoAction.ActionType)
-
-					switch {
-					case strings.EqualFold(autoAction.ActionType, model.AutoActionScaleOut):
-
-						labels := map[string]string{
-							model.LabelDeploymentType: model.StrAutoGen,
-						}
-						autoAction.NodeGroupDynamicReq.Label = labels
-						// append uid to given vm name to avoid duplicated vm ID.
-						autoAction.NodeGroupDynamicReq.Name = common.ToLower(autoAction.NodeGroupDynamicReq.Name) + "-" + common.GenUid()
-						//nodeReqTmp := autoAction.Vm
-						// autoAction.NodeGroupDynamicReq.NodeGroupSize = "1"
-
-						if strings.EqualFold(autoAction.PlacementAlgo, "random") {
-							log.Debug().Msg("[autoAction.PlacementAlgo] " + autoAction.PlacementAlgo)
-							// var nodeTmpErr error
-							// existingNode, nodeTmpErr := GetNodeTemplate(nsId, infraPolicyTmp.Id, autoAction.PlacementAlgo)
-							// if nodeTmpErr != nil {
-							// 	infraPolicyTmp.Policy[policyIndex].Status = model.AutoStatusError
-							// 	UpdateInfraPolicyInfo(nsId, infraPolicyTmp)
-							// }
-
-							autoAction.NodeGroupDynamicReq.ImageId = "ubuntu18.04"                // temporal default value. will be changed
-							autoAction.NodeGroupDynamicReq.SpecId = "aws-ap-northeast-2-t2-small" // temporal default value. will be changed
-
-							recommendSpecReq := model.RecommendSpecReq{}
-
-							recommendSpecReq.Priority.Policy = append(recommendSpecReq.Priority.Policy, model.PriorityCondition{Metric: "random"})
-							specList, err := RecommendSpec(common.NewDefaultContext(), model.SystemCommonNs, recommendSpecReq)
-							if err != nil {
-								infraPolicyTmp.Policy[policyIndex].Status = model.AutoStatusError
-								UpdateInfraPolicyInfo(nsId, infraPolicyTmp)
-							}
-							if len(specList) != 0 {
-								recommendedSpec := specList[0].Id
-								autoAction.NodeGroupDynamicReq.SpecId = recommendedSpec
-							}
-
-							// autoAction.NodeGroupDynamicReq.Name = autoAction.NodeGroupDynamicReq.Name + "-random"
-							// autoAction.NodeGroupDynamicReq.Label = model.LabelAutoGen
-						}
-
-						common.PrintJsonPretty(autoAction.NodeGroupDynamicReq)
-						log.Debug().Msg("[Action] " + autoAction.ActionType)
-
-						// ScaleOut Infra according to the Node requirement.
-						log.Debug().Msg("[Generating Node]")
-						result, nodeCreateErr := CreateInfraNodeGroupDynamic(common.NewDefaultContext(), nsId, infraPolicyTmp.Id,
-							&model.AddNodeGroupDynamicReq{CreateNodeGroupDynamicReq: autoAction.NodeGroupDynamicReq})
-						if nodeCreateErr != nil {
-							infraPolicyTmp.Policy[policyIndex].Status = model.AutoStatusError
-							UpdateInfraPolicyInfo(nsId, infraPolicyTmp)
-						}
-						common.PrintJsonPretty(result)
-
-						if len(autoAction.PostCommands) != 0 {
+					policy := &infraPolicyTmp.Policy[policyIndex]
+					log.Debug().Msg("[autoAction] " + policy.AutoAction.ActionType)
 
-							log.Debug().Msgf("[Post Command to Node] %v", autoAction.PostCommands)
-							// Shared helper: aggregates per-node outcomes and persists status/results
-							status, cmdErr := executePostCommands(nsId, infraPolicyTmp.Id, common.ToLower(autoAction.NodeGroupDynamicReq.Name),
-								autoAction.PostCommands, newPostCommandRequestId(infraPolicyTmp.Id))
-							if cmdErr != nil || status == model.PostCommandStatusFailed || status == model.PostCommandStatusCompletedWithErrors {
-								infraPolicyTmp.Policy[policyIndex].Status = model.AutoStatusError
-								UpdateInfraPolicyInfo(nsId, infraPolicyTmp)
-							}
-						}
-
-					case strings.EqualFold(autoAction.ActionType, model.AutoActionScaleIn):
-						log.Debug().Msg("[Action] " + autoAction.ActionType)
-
-						// ScaleIn Infra.
-						log.Debug().Msg("[Removing Node]")
-						nodeList, nodeListErr := ListNodeByLabel(nsId, infraPolicyTmp.Id, model.StrAutoGen)
-						if nodeListErr != nil {
-							infraPolicyTmp.Policy[policyIndex].Status = model.AutoStatusError
-							UpdateInfraPolicyInfo(nsId, infraPolicyTmp)
-						}
-						if len(nodeList) != 0 {
-							removeTargetNode := nodeList[len(nodeList)-1]
-							log.Debug().Msg("[Removing Node ID] " + removeTargetNode)
-							delNodeErr := DelInfraNode(nsId, infraPolicyTmp.Id, removeTargetNode, "")
-							if delNodeErr != nil {
-								infraPolicyTmp.Policy[policyIndex].Status = model.AutoStatusError
-								UpdateInfraPolicyInfo(nsId, infraPolicyTmp)
-							}
-						}
+					decision := model.AutoControlDecision{
+						PolicyIndex: policyIndex,
+						ActionType:  policy.AutoAction.ActionType,
+						Trigger:     model.AutoTriggerMetric,
+					}
 
-					default:
+					// Webhooks of the policy may act from any replica: take the lock of
+					// the Infra for the action only, and retry on the next tick if busy
+					unlock, err := lockAutoControl(nsId, infraPolicyTmp.Id)
+					if err != nil {
+						log.Info().Err(err).Msgf("Auto-control action of Infra %s deferred", infraPolicyTmp.Id)
+						policy.Status = model.AutoStatusDetected
+						saveControllerPolicy(nsId, infraPolicyTmp.Id, policyIndex, policy)
+						break
 					}
+					// A webhook may have acted since the condition was evaluated
+					if current, err := GetInfraPolicyObject(nsId, infraPolicyTmp.Id); err == nil && policyIndex < len(current.Policy) &&
+						current.Policy[policyIndex].LastActionTime > policy.LastActionTime {
+						policy.LastActionTime = current.Policy[policyIndex].LastActionTime
+					}
+					if until := autoActionCooldown(policy); time.Now().Before(until) {
+						decision.Decision = model.AutoDecisionCooldown
+						decision.Message = "cooldown until " + until.UTC().Format(time.RFC3339)
+						recordAutoControlDecision(nsId, infraPolicyTmp.Id, decision)
+						policy.Status = model.AutoStatusReady
+						saveControllerPolicy(nsId, infraPolicyTmp.Id, policyIndex, policy)
+						unlock()
+						break
+					}
+					if err := runAutoAction(nsId, infraPolicyTmp.Id, policy, &decision); err != nil {
+						log.Error().Err(err).Msg("")
+						decision.Decision = model.AutoDecisionFailed
+						decision.Message = strings.TrimSpace(decision.Message + " " + err.Error())
+					}
+					if decision.Decision != model.AutoDecisionAtBound {
+						policy.LastActionTime = time.Now().UTC().Format(time.RFC3339)
+					}
+					recordAutoControlDecision(nsId, infraPolicyTmp.Id, decision)
 
 					infraPolicyTmp.Policy[policyIndex].Status = model.AutoStatusStabilizing
-					UpdateInfraPolicyInfo(nsId, infraPolicyTmp)
+					saveControllerPolicy(nsId, infraPolicyTmp.Id, policyIndex, &infraPolicyTmp.Policy[policyIndex])
+					unlock()
 					log.Debug().Msg("- PolicyStatus[" + infraPolicyTmp.Policy[policyIndex].Status + "],[" + v + "]")
 
 				case strings.EqualFold(infraPolicyTmp.Policy[policyIndex].Status, model.AutoStatusStabilizing):
@@ -330,10 +219,10 @@ func OrchestrationController() {
 					//initialize Evaluation history so that controller does not act too early.
 					//with this we can stablize Infra by init previously measures.
 					//Will invoke [Checking] Not enough evaluationPeriod
-					infraPolicyTmp.Policy[policyIndex].AutoCondition.EvaluationValue = nil
+					resetAutoConditionHistory(&infraPolicyTmp.Policy[policyIndex].AutoCondition)
 
 					infraPolicyTmp.Policy[policyIndex].Status = model.AutoStatusReady
-					UpdateInfraPolicyInfo(nsId, infraPolicyTmp)
+					saveControllerPolicy(nsId, infraPolicyTmp.Id, policyIndex, &infraPolicyTmp.Policy[policyIndex])
 
 				case strings.EqualFold(infraPolicyTmp.Policy[policyIndex].Status, model.AutoStatusOperating):
 					log.Debug().Msg("- PolicyStatus[" + infraPolicyTmp.Policy[policyIndex].Status + "],[" + v + "]")
@@ -346,7 +235,7 @@ func OrchestrationController() {
 				case strings.EqualFold(infraPolicyTmp.Policy[policyIndex].Status, model.AutoStatusError):
 					log.Debug().Msg("- PolicyStatus[" + infraPolicyTmp.Policy[policyIndex].Status + "],[" + v + "]")
 					infraPolicyTmp.Policy[policyIndex].Status = model.AutoStatusReady
-					UpdateInfraPolicyInfo(nsId, infraPolicyTmp)
+					saveControllerPolicy(nsId, infraPolicyTmp.Id, policyIndex, &infraPolicyTmp.Policy[policyIndex])
 
 				case strings.EqualFold(infraPolicyTmp.Policy[policyIndex].Status, model.AutoStatusSuspended):
 					log.Debug().Msg("- PolicyStatus[" + infraPolicyTmp.Policy[policyIndex].Status + "],[" + v + "]")
@@ -371,6 +260,46 @@ func UpdateInfraPolicyInfo(nsId string, infraPolicyInfoData model.InfraPolicyInf
 	}
 }
 
+// updateInfraPolicyEntry applies update to the stored policy policyIndex of an Infra in a
+// compare-and-swap loop, so that the controller (on the leader) and the webhooks (on any
+// replica) do not overwrite each other. It does nothing if the policy no longer exists.
+func updateInfraPolicyEntry(nsId string, infraId string, policyIndex int, update func(p *model.Policy)) error {
+	key := common.GenInfraPolicyKey(nsId, infraId, "")
+	return kvstore.UpdateWithRetry(context.Background(), key, func(current string, exists bool) (string, bool, error) {
+		if !exists {
+			return "", false, nil
+		}
+		info := model.InfraPolicyInfo{}
+		if err := json.Unmarshal([]byte(current), &info); err != nil {
+			return "", false, err
+		}
+		if policyIndex >= len(info.Policy) {
+			return "", false, nil
+		}
+		update(&info.Policy[policyIndex])
+		val, err := json.Marshal(info)
+		if err != nil {
+			return "", false, err
+		}
+		return string(val), true, nil
+	})
+}
+
+// saveControllerPolicy stores the controller's copy of a policy. A later action time,
+// written by a webhook meanwhile, is kept (RFC3339 UTC times compare as strings).
+func saveControllerPolicy(nsId string, infraId string, policyIndex int, policy *model.Policy) {
+	err := updateInfraPolicyEntry(nsId, infraId, policyIndex, func(p *model.Policy) {
+		lastActionTime := p.LastActionTime
+		*p = *policy
+		if lastActionTime > policy.LastActionTime {
+			p.LastActionTime = lastActionTime
+		}
+	})
+	if err != nil {
+		log.Error().Err(err).Msgf("Failed to update policy %d of Infra %s", policyIndex, infraId)
+	}
+}
+
 // CreateInfraPolicy create model.InfraPolicyInfo object in DB according to user's requirements.
 func CreateInfraPolicy(nsId string, infraId string, u *model.InfraPolicyReq) (model.InfraPolicyInfo, error) {
 
@@ -399,6 +328,17 @@ func CreateInfraPolicy(nsId string, infraId string, u *model.InfraPolicyReq) (mo
 
 	for policyIndex := range u.Policy {
 		u.Policy[policyIndex].Status = model.AutoStatusReady
+		if err := validateInfraPolicy(&u.Policy[policyIndex]); err != nil {
+			return model.InfraPolicyInfo{}, fmt.Errorf("policy[%d]: %w", policyIndex, err)
+		}
+		if err := ValidatePostCommandRunbooks(nsId, u.Policy[policyIndex].AutoAction.PostCommands); err != nil {
+			return model.InfraPolicyInfo{}, fmt.Errorf("policy[%d]: %w", policyIndex, err)
+		}
+		if act := u.Policy[policyIndex].AutoAction; strings.EqualFold(act.ActionType, model.AutoActionRunRunbook) {
+			if _, err := GetRunbook(nsId, act.RunbookId, act.RunbookRunReq.Version); err != nil {
+				return model.InfraPolicyInfo{}, fmt.Errorf("policy[%d]: %w", policyIndex, err)
+			}
+		}
 	}
 
 	req := *u
@@ -545,6 +485,14 @@ func DelInfraPolicy(nsId string, infraId string) error {
 		return err
 	}
 
+	// the decision log and the webhook idempotency keys go with the policy
+	if err := kvstore.DeleteWithPrefix(autoControlDecisionKey(nsId, infraId) + "/"); err != nil {
+		log.Warn().Err(err).Msg("Failed to delete the auto-control decision log")
+	}
+	if err := kvstore.DeleteWithPrefix(autoWebhookIdempotencyPrefix(nsId, infraId) + "/"); err != nil {
+		log.Warn().Err(err).Msg("Failed to delete the webhook idempotency keys")
+	}
+
 	return nil
 }
 
@@ -0,0 +1,226 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package infra is to manage multi-cloud infra
+package infra
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/cloud-barista/cb-tumblebug/src/core/common"
+	"github.com/cloud-barista/cb-tumblebug/src/core/model"
+	"github.com/rs/zerolog/log"
+)
+
+// scheduledPowerActions maps the power actions of scheduled jobs to Node control actions
+var scheduledPowerActions = map[string]string{
+	"suspend": model.ActionSuspend,
+	"resume":  model.ActionResume,
+	"reboot":  model.ActionReboot,
+}
+
+// powerJobMaxConcurrency caps the scheduled power actions running at once, so that a
+// schedule shared by many Infras does not take the whole Node control budget.
+const powerJobMaxConcurrency = 10
+
+func init() {
+	RegisterJobType(JobTypeInfraAction, JobTypeHandlers{
+		Validate: func(nsId string, payload json.RawMessage) (json.RawMessage, error) {
+			return validatePowerJobPayload(JobTypeInfraAction, nsId, payload)
+		},
+		Run: func(_ context.Context, jobId string, nsId string, payload json.RawMessage) (any, error) {
+			p, err := decodeJobPayload[model.PowerActionJobPayload](payload)
+			if err != nil {
+				return nil, err
+			}
+			return runScheduledInfraAction(jobId, nsId, p.InfraId, p.Action)
+		},
+		MaxConcurrency: powerJobMaxConcurrency,
+		RequireCron:    true,
+	})
+	RegisterJobType(JobTypeNodeGroupAction, JobTypeHandlers{
+		Validate: func(nsId string, payload json.RawMessage) (json.RawMessage, error) {
+			return validatePowerJobPayload(JobTypeNodeGroupAction, nsId, payload)
+		},
+		Run: func(_ context.Context, jobId string, nsId string, payload json.RawMessage) (any, error) {
+			p, err := decodeJobPayload[model.PowerActionJobPayload](payload)
+			if err != nil {
+				return nil, err
+			}
+			return runScheduledNodeGroupAction(jobId, nsId, p.InfraId, p.NodeGroupId, p.Action)
+		},
+		MaxConcurrency: powerJobMaxConcurrency,
+		RequireCron:    true,
+	})
+}
+
+// validatePowerJobPayload checks the target and the action of an infraAction or
+// nodeGroupAction job and returns the payload with the action normalized.
+func validatePowerJobPayload(jobType JobType, nsId string, payload json.RawMessage) (json.RawMessage, error) {
+	p, err := decodeJobPayload[model.PowerActionJobPayload](payload)
+	if err != nil {
+		return nil, err
+	}
+	p.Action = strings.ToLower(p.Action)
+	if _, ok := scheduledPowerActions[p.Action]; !ok {
+		return nil, fmt.Errorf("invalid action %q for %s (use suspend, resume or reboot)", p.Action, jobType)
+	}
+	if p.InfraId == "" {
+		return nil, fmt.Errorf("%s jobs require infraId", jobType)
+	}
+	exists, err := CheckInfra(nsId, p.InfraId)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("the infra %s does not exist", p.InfraId)
+	}
+
+	if jobType == JobTypeInfraAction {
+		if p.NodeGroupId != "" {
+			return nil, fmt.Errorf("nodeGroupId applies to %s jobs only", JobTypeNodeGroupAction)
+		}
+		return encodeJobPayload(p)
+	}
+	if p.NodeGroupId == "" {
+		return nil, fmt.Errorf("%s jobs require nodeGroupId", jobType)
+	}
+	nodeIds, err := ListNodeByNodeGroup(nsId, p.InfraId, p.NodeGroupId)
+	if err != nil {
+		return nil, err
+	}
+	if len(nodeIds) == 0 {
+		return nil, fmt.Errorf("the NodeGroup %s of infra %s has no Node", p.NodeGroupId, p.InfraId)
+	}
+	return encodeJobPayload(p)
+}
+
+// checkScheduledResume refuses to resume an Infra that its lease suspended on expiry;
+// the lease has to be extended first.
+func checkScheduledResume(nsId string, infraId string, action string) error {
+	if action != "resume" {
+		return nil
+	}
+	lease, exists, err := common.GetLease(nsId, model.StrInfra, infraId)
+	if err != nil || !exists {
+		return err
+	}
+	if lease.Status == model.LeaseSuspended {
+		return fmt.Errorf("infra %s was suspended because its lease expired at %s; extend the lease to resume it", infraId, lease.ExpiresAt)
+	}
+	return nil
+}
+
+// runScheduledInfraAction runs a power action of a scheduled job on an Infra.
+func runScheduledInfraAction(jobId string, nsId string, infraId string, action string) (string, error) {
+	if err := checkScheduledResume(nsId, infraId, action); err != nil {
+		return "", err
+	}
+	result, err := HandleInfraAction(nsId, infraId, action, false)
+	if err != nil {
+		appendInfraSystemMessage(nsId, infraId, fmt.Sprintf("[schedule] %s by job %s failed: %v", action, jobId, err))
+		return "", err
+	}
+	appendInfraSystemMessage(nsId, infraId, fmt.Sprintf("[schedule] %s by job %s done", action, jobId))
+	return result, nil
+}
+
+// runScheduledNodeGroupAction runs a power action of a scheduled job on the Nodes of a
+// NodeGroup. Nodes already in the target state are skipped.
+func runScheduledNodeGroupAction(jobId string, nsId string, infraId string, nodeGroupId string, action string) (string, error) {
+	controlAction, ok := scheduledPowerActions[action]
+	if !ok {
+		return "", fmt.Errorf("invalid action %q", action)
+	}
+	if err := checkScheduledResume(nsId, infraId, action); err != nil {
+		return "", err
+	}
+
+	infraObj, _, err := GetInfraObject(nsId, infraId)
+	if err != nil {
+		return "", err
+	}
+	if infraObj.TargetAction != "" && infraObj.TargetAction != model.ActionComplete {
+		return "", fmt.Errorf("infra %s is under %s, skipping scheduled %s of NodeGroup %s", infraId, infraObj.TargetAction, action, nodeGroupId)
+	}
+	if rollingUpdateInProgress(nsId, infraId, nodeGroupId) {
+		return "", fmt.Errorf("a rolling update of NodeGroup %s is in progress, skipping scheduled %s", nodeGroupId, action)
+	}
+
+	nodeIds, err := ListNodeByNodeGroup(nsId, infraId, nodeGroupId)
+	if err != nil {
+		return "", err
+	}
+	if len(nodeIds) == 0 {
+		return "", fmt.Errorf("the NodeGroup %s of infra %s has no Node", nodeGroupId, infraId)
+	}
+
+	log.Info().Str("jobId", jobId).Msgf("Scheduled %s of %d Nodes in NodeGroup %s of infra %s", action, len(nodeIds), nodeGroupId, infraId)
+	if err := ControlNodesInParallel(nsId, infraId, nodeIds, controlAction, false); err != nil {
+		appendInfraSystemMessage(nsId, infraId, fmt.Sprintf("[schedule] %s of NodeGroup %s by job %s failed: %v", action, nodeGroupId, jobId, err))
+		return "", err
+	}
+	appendInfraSystemMessage(nsId, infraId, fmt.Sprintf("[schedule] %s of NodeGroup %s by job %s done", action, nodeGroupId, jobId))
+	return fmt.Sprintf("%s of NodeGroup %s (%d Nodes) done", action, nodeGroupId, len(nodeIds)), nil
+}
+
+// ListInfraScheduledJobs returns the scheduled power jobs of an Infra and its NodeGroups
+func (sm *SchedulerManager) ListInfraScheduledJobs(nsId string, infraId string) []*ScheduledJob {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	jobs := []*ScheduledJob{}
+	for _, job := range sm.jobs {
+		if isInfraPowerJob(job, nsId, infraId) {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs
+}
+
+// stopInfraScheduledJobs stops and deletes the scheduled jobs that target a deleted Infra
+func (sm *SchedulerManager) stopInfraScheduledJobs(nsId string, infraId string) {
+	sm.mu.RLock()
+	jobs := []*ScheduledJob{}
+	for _, job := range sm.jobs {
+		if job.NsId == nsId && jobTargetsInfra(job, infraId) {
+			jobs = append(jobs, job)
+		}
+	}
+	sm.mu.RUnlock()
+
+	for _, job := range jobs {
+		if err := sm.StopScheduledJob(job.JobId); err != nil {
+			log.Warn().Err(err).Msgf("Cannot delete the scheduled job %s of Infra %s", job.JobId, infraId)
+		}
+	}
+}
+
+func isInfraPowerJob(job *ScheduledJob, nsId string, infraId string) bool {
+	if (job.JobType != JobTypeInfraAction && job.JobType != JobTypeNodeGroupAction) || job.NsId != nsId {
+		return false
+	}
+	var p model.PowerActionJobPayload
+	return json.Unmarshal(job.Payload, &p) == nil && p.InfraId == infraId
+}
+
+// jobTargetsInfra tells whether the payload of a job names the Infra as its target
+func jobTargetsInfra(job *ScheduledJob, infraId string) bool {
+	var p struct {
+		InfraId string `json:"infraId"`
+	}
+	return json.Unmarshal(job.Payload, &p) == nil && p.InfraId == infraId
+}
@@ -498,6 +498,15 @@ func executePostCommands(nsId, infraId, defaultNodeGroupId string, phases []mode
 	}
 	startedAt := time.Now()
 
+	// Runbooks are resolved at run time, so phases that follow the latest version of a
+	// runbook pick up its updates (e.g., when healing re-runs them on a new Node)
+	phases, err := expandRunbookPhases(nsId, phases)
+	if err != nil {
+		persistPostCommandOutcome(nsId, infraId, model.PostCommandStatusFailed, nil)
+		publishPostCommandDone(xRequestId, nil, model.PostCommandStatusFailed, startedAt, err)
+		return model.PostCommandStatusFailed, err
+	}
+
 	// SSH readiness gate: fresh nodes often refuse SSH for a short while
 	// (cloud-init). Proceed early when reachable; on timeout run anyway so
 	// genuine auth/config errors are reported per node rather than hidden.
@@ -572,6 +581,55 @@ func executePostCommands(nsId, infraId, defaultNodeGroupId string, phases []mode
 	return overall, firstErr
 }
 
+// nodeGroupPostCommands returns the post-deployment phases of the Infra that bootstrap
+// the Nodes of a NodeGroup, without their target. Phases without a target ran on every
+// Node at creation, so they belong to the NodeGroup as well.
+func nodeGroupPostCommands(infraObj model.InfraInfo, nodeGroupId string) []model.PostCommandReq {
+	var phases []model.PostCommandReq
+	for _, phase := range infraObj.PostCommands {
+		if strings.EqualFold(phase.NodeGroupId, nodeGroupId) || (phase.NodeGroupId == "" && phase.NodeId == "" && phase.LabelSelector == "") {
+			phase.NodeGroupId = ""
+			phases = append(phases, phase)
+		}
+	}
+	return normalizePostCommandPhases(phases)
+}
+
+// runPostCommandsOnNode runs post-deployment phases on a single Node, in order. Unlike
+// executePostCommands, the outcome is not recorded on the Infra.
+func runPostCommandsOnNode(nsId, infraId, nodeId string, phases []model.PostCommandReq) error {
+	if len(phases) == 0 {
+		return nil
+	}
+	// Fresh Nodes may refuse SSH for a while; the phases report the error if it persists
+	phases, err := expandRunbookPhases(nsId, phases)
+	if err != nil {
+		return err
+	}
+	if err := waitForNodeSsh(nsId, infraId, nodeId, sshReadinessTimeout); err != nil {
+		log.Warn().Err(err).Msgf("SSH readiness wait for Node %s timed out; running post-deployment commands anyway", nodeId)
+	}
+	for i, phase := range phases {
+		cmdReq := phase.InfraCmdReq
+		results, err := RemoteCommandToInfra(nsId, infraId, "", nodeId, "", &cmdReq, "")
+		if err == nil {
+			for _, r := range results {
+				if r.Err != nil {
+					err = r.Err
+				}
+			}
+		}
+		if err != nil {
+			if phase.ContinueOnError {
+				log.Warn().Err(err).Msgf("Post-deployment phase %d failed on Node %s; continuing", i+1, nodeId)
+				continue
+			}
+			return fmt.Errorf("post-deployment phase %d failed on Node %s: %w", i+1, nodeId, err)
+		}
+	}
+	return nil
+}
+
 // publishPostCommandDone emits the terminal SSE event so streaming clients can close
 func publishPostCommandDone(xRequestId string, phases []model.PostCommandPhaseResult,
 	overall model.PostCommandStatus, startedAt time.Time, err error) {
@@ -640,6 +698,16 @@ func ValidatePostCommandRequest(phases []model.PostCommandReq) error {
 		if targets > 1 {
 			return fmt.Errorf("postCommands[%d]: set at most one of nodeGroupId, nodeId, labelSelector", i)
 		}
+		if p.Runbook != nil {
+			if len(p.Command) > 0 {
+				return fmt.Errorf("postCommands[%d]: set either command or runbook", i)
+			}
+			if p.Runbook.RunbookId == "" {
+				return fmt.Errorf("postCommands[%d]: runbook.runbookId is empty", i)
+			}
+			// The steps of the runbook are checked by ValidatePostCommandRunbooks
+			continue
+		}
 		if len(p.Command) == 0 {
 			return fmt.Errorf("postCommands[%d]: command is empty", i)
 		}
@@ -655,11 +723,11 @@ func ValidatePostCommandRequest(phases []model.PostCommandReq) error {
 // postCommandTotalTimeoutBudgetMinutes bounds the sum of phase timeouts
 const postCommandTotalTimeoutBudgetMinutes = 120
 
-// normalizePostCommandPhases drops phases without commands
+// normalizePostCommandPhases drops phases without commands or runbook
 func normalizePostCommandPhases(phases []model.PostCommandReq) []model.PostCommandReq {
 	normalized := make([]model.PostCommandReq, 0, len(phases))
 	for _, p := range phases {
-		if len(p.Command) > 0 {
+		if len(p.Command) > 0 || p.Runbook != nil {
 			normalized = append(normalized, p)
 		}
 	}
@@ -709,6 +777,30 @@ func waitForSshReadiness(nsId, infraId, nodeGroupId string) {
 	log.Warn().Msg("SSH readiness wait timed out; running post-deployment commands anyway")
 }
 
+// waitForNodeSsh polls a single Node until SSH accepts a trivial command.
+func waitForNodeSsh(nsId string, infraId string, nodeId string, timeout time.Duration) error {
+	probe := model.InfraCmdReq{Command: []string{"true"}, TimeoutMinutes: 1}
+	deadline := time.Now().Add(timeout)
+	var lastErr error
+	for {
+		results, err := RemoteCommandToInfra(nsId, infraId, "", nodeId, "", &probe, "")
+		if err == nil && len(results) == 0 {
+			err = fmt.Errorf("no result from Node %s", nodeId)
+		}
+		if err == nil {
+			err = results[0].Err
+		}
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+		if time.Now().Add(sshReadinessInterval).After(deadline) {
+			return fmt.Errorf("SSH to Node %s is not ready after %s: %w", nodeId, timeout, lastErr)
+		}
+		time.Sleep(sshReadinessInterval)
+	}
+}
+
 // aggregatePostCommandResults derives the overall status from per-node results
 // and rewrites timeout errors to be distinguishable from auth/exec failures.
 func aggregatePostCommandResults(result *model.InfraSshCmdResultForAPI, timeoutMinutes int) (model.PostCommandStatus, int) {
@@ -959,6 +1051,21 @@ func ScaleOutInfraNodeGroup(ctx context.Context, nsId string, infraId string, no
 		return temp, err
 	}
 
+	nodeGroupReqTemplate := nodeGroupReqFromNode(nsId, infraId, nodeGroupId, nodeObj)
+	nodeGroupReqTemplate.NodeGroupSize = numNodesToAdd
+
+	result, err := CreateInfraGroupNode(ctx, nsId, infraId, nodeGroupReqTemplate, true)
+	if err != nil {
+		temp := &model.InfraInfo{}
+		return temp, err
+	}
+	return result, nil
+
+}
+
+// nodeGroupReqFromNode builds a request that creates Nodes configured like nodeObj in
+// the NodeGroup nodeGroupId. NodeGroupSize is left for the caller to set.
+func nodeGroupReqFromNode(nsId string, infraId string, nodeGroupId string, nodeObj model.NodeInfo) *model.CreateNodeGroupReq {
 	nodeGroupReqTemplate := &model.CreateNodeGroupReq{}
 
 	// only take template required to create Node
@@ -987,15 +1094,44 @@ func ScaleOutInfraNodeGroup(ctx context.Context, nsId string, infraId string, no
 	}
 	nodeGroupReqTemplate.Description = nodeObj.Description
 
-	nodeGroupReqTemplate.NodeGroupSize = numNodesToAdd
+	return nodeGroupReqTemplate
+}
 
-	result, err := CreateInfraGroupNode(ctx, nsId, infraId, nodeGroupReqTemplate, true)
+// createNodesInNodeGroup creates the Nodes of req in the existing NodeGroup and returns
+// their ids, also when some of them failed. An error is returned unless all of them run.
+func createNodesInNodeGroup(ctx context.Context, nsId string, infraId string, nodeGroupId string, req *model.CreateNodeGroupReq) ([]string, error) {
+	before, err := ListNodeByNodeGroup(nsId, infraId, nodeGroupId)
 	if err != nil {
-		temp := &model.InfraInfo{}
-		return temp, err
+		return nil, err
+	}
+
+	_, createErr := CreateInfraGroupNode(ctx, nsId, infraId, req, true)
+
+	after, err := ListNodeByNodeGroup(nsId, infraId, nodeGroupId)
+	if err != nil {
+		return nil, err
+	}
+	created := []string{}
+	for _, nodeId := range after {
+		if !contains(before, nodeId) {
+			created = append(created, nodeId)
+		}
+	}
+	if createErr != nil {
+		return created, fmt.Errorf("failed to create Nodes in NodeGroup %s: %w", nodeGroupId, createErr)
 	}
-	return result, nil
 
+	var notRunning []string
+	for _, nodeId := range created {
+		nodeObj, err := GetNodeObject(nsId, infraId, nodeId)
+		if err != nil || nodeObj.Status != model.StatusRunning {
+			notRunning = append(notRunning, nodeId)
+		}
+	}
+	if len(notRunning) > 0 {
+		return created, fmt.Errorf("new Nodes are not running: %s", strings.Join(notRunning, ", "))
+	}
+	return created, nil
 }
 
 // CreateInfraGroupNode is func to create Infra groupNode
@@ -1343,6 +1479,9 @@ func CreateInfra(ctx context.Context, nsId string, req *model.InfraReq, option s
 	if len(req.NodeGroups) == 0 {
 		return nil, fmt.Errorf("no VM requests provided")
 	}
+	if _, _, err := common.ResolveExpiration(req.ExpirationOption, time.Now()); err != nil {
+		return nil, err
+	}
 
 	for i, nodeGroupReq := range req.NodeGroups {
 		if err := common.CheckString(nodeGroupReq.Name); err != nil {
@@ -1409,6 +1548,11 @@ func CreateInfra(ctx context.Context, nsId string, req *model.InfraReq, option s
 		}
 	}
 
+	// The lease is taken before any Node exists, so a partially created Infra expires as well
+	if err := common.RegisterLease(nsId, model.StrInfra, infraId, req.ExpirationOption); err != nil {
+		return nil, fmt.Errorf("failed to register the lease of Infra '%s': %w", infraId, err)
+	}
+
 	// Process VM requests and build configurations
 	for _, nodeGroupReq := range req.NodeGroups {
 		nodeGroupSize := max(nodeGroupReq.NodeGroupSize, 1)
@@ -1903,12 +2047,21 @@ func CreateInfraDynamic(ctx context.Context, nsId string, req *model.InfraDynami
 	infraReq.PostCommands = req.PostCommands
 	infraReq.PostCommandAsync = req.PostCommandAsync
 	infraReq.PolicyOnPartialFailure = req.PolicyOnPartialFailure
+	infraReq.ExpirationOption = req.ExpirationOption
 
 	// Validate post-deployment command request shape early (before any provisioning)
 	if err := ValidatePostCommandRequest(req.PostCommands); err != nil {
 		log.Error().Err(err).Msg("")
 		return &model.InfraInfo{}, err
 	}
+	if err := ValidatePostCommandRunbooks(nsId, req.PostCommands); err != nil {
+		log.Error().Err(err).Msg("")
+		return &model.InfraInfo{}, err
+	}
+	if _, _, err := common.ResolveExpiration(req.ExpirationOption, time.Now()); err != nil {
+		log.Error().Err(err).Msg("")
+		return &model.InfraInfo{}, err
+	}
 
 	emptyInfra := &model.InfraInfo{}
 	err := common.CheckString(nsId)
@@ -3093,6 +3246,10 @@ func ReviewInfraDynamicReq(ctx context.Context, nsId string, req *model.InfraDyn
 		log.Error().Err(err).Msg("")
 		return nil, err
 	}
+	if err := ValidatePostCommandRunbooks(nsId, req.PostCommands); err != nil {
+		log.Error().Err(err).Msg("")
+		return nil, err
+	}
 
 	reviewResult := &model.ReviewInfraDynamicReqInfo{
 		InfraName:      req.Name,
@@ -3521,6 +3678,10 @@ func CreateInfraNodeGroupDynamic(ctx context.Context, nsId string, infraId strin
 		err := fmt.Errorf("The name for NodeGroup (prefix of VM Id) %s already exists.", req.Name)
 		return emptyInfra, err
 	}
+	if err := ValidatePostCommandRunbooks(nsId, req.PostCommands); err != nil {
+		log.Error().Err(err).Msg("")
+		return emptyInfra, err
+	}
 
 	err = checkCommonResAvailableForNodeGroupDynamicReq(ctx, &req.CreateNodeGroupDynamicReq, nsId)
 	if err != nil {
@@ -4538,6 +4699,25 @@ func CreateNode(ctx context.Context, wg *sync.WaitGroup, nsId string, infraId st
 	//goroutin
 	defer wg.Done()
 
+	// Report the outcome on the event bus; every exit path has stored the final status by then
+	defer func() {
+		data := model.EventData{
+			NsId:         nsId,
+			ResourceType: model.StrNode,
+			ResourceId:   nodeInfoData.Id,
+			InfraId:      infraId,
+			NewStatus:    nodeInfoData.Status,
+			RequestId:    common.RequestIDFromContext(ctx),
+			Labels:       nodeInfoData.Label,
+		}
+		if nodeInfoData.Status == model.StatusFailed || nodeInfoData.Status == model.StatusTerminated {
+			data.Message = nodeInfoData.SystemMessage
+			common.PublishEvent(model.EventTypeNodeCreateFailed, data)
+			return
+		}
+		common.PublishEvent(model.EventTypeNodeCreated, data)
+	}()
+
 	var err error = nil
 	switch {
 	case nodeInfoData.Name == "":
@@ -5545,6 +5725,7 @@ func getK8sClusterReqFromDynamicReq(ctx context.Context, nsId string, dReq *mode
 		log.Info().Msg("Need to Add NodeGroups To Use This K8sCluster")
 	}
 	k8sReq.Label = dReq.Label
+	k8sReq.ExpirationOption = dReq.ExpirationOption
 
 	common.PrintJsonPretty(k8sReq)
 	clientManager.UpdateRequestProgress(reqID, clientManager.ProgressInfo{Title: "Prepared resources for K8sCluster:" + k8sReq.Name, Info: k8sReq, Time: time.Now()})
@@ -5568,6 +5749,10 @@ func CreateK8sClusterDynamic(ctx context.Context, nsId string, dReq *model.K8sCl
 		log.Err(err).Msg("")
 		return emptyK8sCluster, err
 	}
+	if err := resource.ValidateK8sClusterExpiration(dReq.ExpirationOption); err != nil {
+		log.Err(err).Msg("")
+		return emptyK8sCluster, err
+	}
 
 	check, err := resource.CheckK8sCluster(nsId, dReq.Name)
 	if err != nil {
@@ -325,6 +325,11 @@ type cancelInfo struct {
 // This allows cancelling running SSH commands per Node and updating their status
 var cancelFuncs sync.Map
 
+// requestCancelFuncs stores, per xRequestId, the cancel function of a command request that
+// runs in several steps (e.g., rolling batches), so that a cancellation also stops the
+// steps that have not started yet
+var requestCancelFuncs sync.Map
+
 // makeCancelKey creates a unique key for cancel function storage
 func makeCancelKey(xRequestId, nodeId string) string {
 	return xRequestId + ":" + nodeId
@@ -446,6 +451,12 @@ func RemoteCommandToInfra(nsId string, infraId string, nodeGroupId string, nodeI
 		return temp, err
 	}
 
+	if req.Rolling != nil {
+		if err := validateCommandRolling(req.Rolling); err != nil {
+			return []model.SshCmdResult{}, err
+		}
+	}
+
 	check, _ := CheckInfra(nsId, infraId)
 
 	if !check {
@@ -613,6 +624,11 @@ func RemoteCommandToInfra(nsId string, infraId string, nodeGroupId string, nodeI
 		}
 	}
 
+	// Rolling mode runs the targets batch by batch, each batch with its own timeout
+	if req.Rolling != nil {
+		return runCommandInBatches(nsId, infraId, nodeList, nodeCommands, nodeCommandIndices, req, xRequestId), nil
+	}
+
 	// Execute commands in parallel using goroutines with per-Node context.
 	//
 	// DEPENDENCY-BASED SCHEDULING: when a target VM is *also* serving as the
@@ -4401,6 +4417,24 @@ func UpdateCommandStatusInfo(nsId, infraId, nodeId string, index int, status mod
 		})
 	}
 
+	switch status {
+	case model.CommandStatusCompleted, model.CommandStatusCompletedWithError, model.CommandStatusFailed,
+		model.CommandStatusTimeout, model.CommandStatusCancelled, model.CommandStatusInterrupted:
+		message := fmt.Sprintf("Command %d on Node %s: %s", publishIndex, nodeId, resultSummary)
+		if errorMessage != "" {
+			message += " (" + errorMessage + ")"
+		}
+		common.PublishEvent(model.EventTypeCommandCompleted, model.EventData{
+			NsId:         nsId,
+			ResourceType: model.StrNode,
+			ResourceId:   nodeId,
+			InfraId:      infraId,
+			NewStatus:    string(status),
+			RequestId:    updatedXRequestId,
+			Message:      message,
+		})
+	}
+
 	log.Info().
 		Str("nsId", nsId).
 		Str("infraId", infraId).
@@ -4963,6 +4997,16 @@ func CancelInfraCommand(nsId, infraId, nodeId, xRequestId string, index int, rea
 		CancelledAt: time.Now().Format(time.RFC3339),
 	}
 
+	// Without a nodeId, the whole request is cancelled, including its rolling batches
+	// that have not started yet
+	if nodeId == "" && xRequestId != "" {
+		cancelled := cancelCommandsOfRequest(xRequestId)
+		response.Success = true
+		response.Status = model.CommandStatusCancelled
+		response.Message = fmt.Sprintf("Request cancelled (%d running commands)", cancelled)
+		return response, nil
+	}
+
 	// Update the command status in VM info
 	err = UpdateCommandStatusInfo(nsId, infraId, nodeId, index,
 		model.CommandStatusCancelled,
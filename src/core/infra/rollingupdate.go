@@ -0,0 +1,750 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package infra is to manage multi-cloud infra
+package infra
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloud-barista/cb-tumblebug/src/core/common"
+	"github.com/cloud-barista/cb-tumblebug/src/core/model"
+	"github.com/cloud-barista/cb-tumblebug/src/core/resource"
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvstore"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// rollingUpdateHealthTimeout is the default time a replacement Node gets to become healthy
+	rollingUpdateHealthTimeout = 300 * time.Second
+	// rollingUpdateHealthInterval is the retry interval of the HTTP health check
+	rollingUpdateHealthInterval = 5 * time.Second
+)
+
+var (
+	errRollingUpdatePaused   = errors.New("rolling update paused")
+	errRollbackRequested     = errors.New("rollback requested")
+	rollingUpdateRuns        sync.Map // rollingUpdateKey -> *rollingUpdateRun
+	rollingUpdateStartMu     sync.Mutex
+	rollingUpdateHealthProbe = &http.Client{Timeout: 5 * time.Second}
+)
+
+// rollingUpdateRun is the in-memory handle of a NodeGroup rolling update. The status is
+// persisted on every change so it survives a restart; the flags are not.
+type rollingUpdateRun struct {
+	mu     sync.Mutex
+	status model.NodeGroupRollingUpdateStatus
+	// active is true while a goroutine drives the update
+	active            bool
+	pauseRequested    bool
+	rollbackRequested bool
+}
+
+// rollingUpdateKey is the kvstore key of the rolling update of a NodeGroup. It is kept
+// outside the Infra subtree (like Infra policies) so Infra listings do not see it.
+func rollingUpdateKey(nsId string, infraId string, nodeGroupId string) string {
+	return "/" + model.StrNamespace + "/" + nsId + "/rollingUpdate/" + model.StrInfra + "/" + infraId + "/" + model.StrNodeGroup + "/" + common.ToLower(nodeGroupId)
+}
+
+// delInfraRollingUpdates forgets the rolling updates of the NodeGroups of a deleted Infra.
+func delInfraRollingUpdates(nsId string, infraId string) error {
+	prefix := "/" + model.StrNamespace + "/" + nsId + "/rollingUpdate/" + model.StrInfra + "/" + infraId + "/"
+	rollingUpdateRuns.Range(func(key, _ any) bool {
+		if strings.HasPrefix(key.(string), prefix) {
+			rollingUpdateRuns.Delete(key)
+		}
+		return true
+	})
+	return kvstore.DeleteWithPrefix(prefix)
+}
+
+// update applies fn to the status and persists it.
+func (r *rollingUpdateRun) update(fn func(st *model.NodeGroupRollingUpdateStatus)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fn(&r.status)
+	r.status.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	r.persistLocked()
+}
+
+func (r *rollingUpdateRun) persistLocked() {
+	st := r.status
+	val, err := json.Marshal(st)
+	if err != nil {
+		log.Error().Err(err).Msg("Cannot encode the rolling update status")
+		return
+	}
+	if err := kvstore.Put(rollingUpdateKey(st.NsId, st.InfraId, st.NodeGroupId), string(val)); err != nil {
+		log.Error().Err(err).Msgf("Cannot store the rolling update status of NodeGroup %s", st.NodeGroupId)
+	}
+}
+
+func (r *rollingUpdateRun) snapshot() model.NodeGroupRollingUpdateStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.status
+}
+
+func (r *rollingUpdateRun) rollbackWanted() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.rollbackRequested
+}
+
+// loadRollingUpdateRun returns the rolling update of the NodeGroup from memory or, after
+// a restart, from the kvstore. An update that was in progress when Tumblebug stopped is
+// reported as Paused so it can be resumed or rolled back.
+func loadRollingUpdateRun(nsId string, infraId string, nodeGroupId string) (*rollingUpdateRun, bool, error) {
+	key := rollingUpdateKey(nsId, infraId, nodeGroupId)
+	if v, ok := rollingUpdateRuns.Load(key); ok {
+		return v.(*rollingUpdateRun), true, nil
+	}
+	keyValue, exists, err := kvstore.GetKv(key)
+	if err != nil || !exists {
+		return nil, false, err
+	}
+	run := &rollingUpdateRun{}
+	if err := json.Unmarshal([]byte(keyValue.Value), &run.status); err != nil {
+		return nil, false, err
+	}
+	if run.status.Phase == model.RollingUpdateRunning || run.status.Phase == model.RollingUpdateRollingBack {
+		run.status.Phase = model.RollingUpdatePaused
+		run.status.Message = "interrupted by a restart of Tumblebug; resume or roll back the update"
+	}
+	v, _ := rollingUpdateRuns.LoadOrStore(key, run)
+	return v.(*rollingUpdateRun), true, nil
+}
+
+// StartNodeGroupRollingUpdate replaces the Nodes of a NodeGroup with Nodes of the spec
+// and/or image of req, a batch at a time, and returns the initial status.
+//
+// A batch deletes up to maxUnavailable old Nodes, creates maxSurge+maxUnavailable
+// replacements via CreateInfraGroupNode, bootstraps them with the post-deployment
+// commands, health-checks them, moves the NLB membership of the NodeGroup to them and
+// then deletes the rest of the old Nodes of the batch. The update runs in the background;
+// follow it with GetNodeGroupRollingUpdate and steer it with ControlNodeGroupRollingUpdate.
+func StartNodeGroupRollingUpdate(ctx context.Context, nsId string, infraId string, nodeGroupId string, req *model.NodeGroupRollingUpdateReq) (model.NodeGroupRollingUpdateStatus, error) {
+	if err := common.CheckString(nsId); err != nil {
+		return model.NodeGroupRollingUpdateStatus{}, err
+	}
+	if err := common.CheckString(infraId); err != nil {
+		return model.NodeGroupRollingUpdateStatus{}, err
+	}
+	nodeGroupId = common.ToLower(nodeGroupId)
+	rollingUpdateStartMu.Lock()
+	defer rollingUpdateStartMu.Unlock()
+
+	infraObj, _, err := GetInfraObject(nsId, infraId)
+	if err != nil {
+		return model.NodeGroupRollingUpdateStatus{}, err
+	}
+
+	if prev, found, _ := loadRollingUpdateRun(nsId, infraId, nodeGroupId); found {
+		st := prev.snapshot()
+		switch st.Phase {
+		case model.RollingUpdateRunning, model.RollingUpdatePaused, model.RollingUpdateRollingBack:
+			return st, fmt.Errorf("a rolling update of NodeGroup %s is %s; resume, roll back or wait for it first", nodeGroupId, st.Phase)
+		}
+	}
+
+	if err := normalizeRollingUpdateReq(req); err != nil {
+		return model.NodeGroupRollingUpdateStatus{}, err
+	}
+
+	nodeIds, err := ListNodeByNodeGroup(nsId, infraId, nodeGroupId)
+	if err != nil {
+		return model.NodeGroupRollingUpdateStatus{}, err
+	}
+	if len(nodeIds) == 0 {
+		return model.NodeGroupRollingUpdateStatus{}, fmt.Errorf("NodeGroup %s has no Node in Infra %s", nodeGroupId, infraId)
+	}
+	sort.Slice(nodeIds, func(i, j int) bool {
+		return nodeIndex(nodeGroupId, nodeIds[i]) < nodeIndex(nodeGroupId, nodeIds[j])
+	})
+	ref, err := GetNodeObject(nsId, infraId, nodeIds[0])
+	if err != nil {
+		return model.NodeGroupRollingUpdateStatus{}, err
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	st := model.NodeGroupRollingUpdateStatus{
+		NsId:             nsId,
+		InfraId:          infraId,
+		NodeGroupId:      nodeGroupId,
+		Phase:            model.RollingUpdateRunning,
+		FromSpecId:       ref.SpecId,
+		FromImageId:      ref.ImageId,
+		FromCspImageName: ref.CspImageName,
+		ToSpecId:         ref.SpecId,
+		ToImageId:        ref.ImageId,
+		ToCspImageName:   ref.CspImageName,
+		OldNodeIds:       nodeIds,
+		ReplacedNodeIds:  []string{},
+		NewNodeIds:       []string{},
+		StartedAt:        now,
+		UpdatedAt:        now,
+	}
+
+	if req.SpecId != "" {
+		specInfo, err := resource.GetSpec(model.SystemCommonNs, req.SpecId)
+		if err != nil {
+			return model.NodeGroupRollingUpdateStatus{}, fmt.Errorf("cannot find spec %s: %w", req.SpecId, err)
+		}
+		if specInfo.ConnectionName != "" && specInfo.ConnectionName != ref.ConnectionName {
+			return model.NodeGroupRollingUpdateStatus{}, fmt.Errorf("spec %s belongs to connection %s, but NodeGroup %s runs on %s",
+				req.SpecId, specInfo.ConnectionName, nodeGroupId, ref.ConnectionName)
+		}
+		st.ToSpecId = specInfo.Id
+	}
+	if req.ImageId != "" {
+		imageInfo, _, err := resource.EnsureImageAvailable(ctx, nsId, ref.ConnectionName, req.ImageId)
+		if err != nil {
+			return model.NodeGroupRollingUpdateStatus{}, fmt.Errorf("cannot find image %s for connection %s: %w", req.ImageId, ref.ConnectionName, err)
+		}
+		st.ToImageId = imageInfo.Id
+		// Custom images leave CspImageName empty and go through the full lookup in CreateNode
+		st.ToCspImageName = ""
+		if imageInfo.ResourceType != model.StrCustomImage {
+			st.ToCspImageName = imageInfo.CspImageName
+		}
+	}
+	if st.ToSpecId == st.FromSpecId && st.ToImageId == st.FromImageId {
+		return model.NodeGroupRollingUpdateStatus{}, fmt.Errorf("NodeGroup %s already runs spec %s and image %s", nodeGroupId, st.ToSpecId, st.ToImageId)
+	}
+
+	if len(req.PostCommands) == 0 {
+		req.PostCommands = nodeGroupPostCommands(infraObj, nodeGroupId)
+	}
+	req.PostCommands = normalizePostCommandPhases(req.PostCommands)
+	if err := ValidatePostCommandRequest(req.PostCommands); err != nil {
+		return model.NodeGroupRollingUpdateStatus{}, err
+	}
+	if err := ValidatePostCommandRunbooks(nsId, req.PostCommands); err != nil {
+		return model.NodeGroupRollingUpdateStatus{}, err
+	}
+	for i, phase := range req.PostCommands {
+		if phase.NodeGroupId != "" || phase.NodeId != "" || phase.LabelSelector != "" {
+			return model.NodeGroupRollingUpdateStatus{}, fmt.Errorf("postCommands[%d]: phases of a rolling update run on the replacement Nodes and take no target", i)
+		}
+	}
+
+	st.Request = *req
+	st.NLBIds = nodeGroupNLBs(nsId, infraId, nodeGroupId, nodeIds)
+
+	run := &rollingUpdateRun{status: st, active: true}
+	run.mu.Lock()
+	run.persistLocked()
+	run.mu.Unlock()
+	rollingUpdateRuns.Store(rollingUpdateKey(nsId, infraId, nodeGroupId), run)
+
+	log.Info().Msgf("Rolling update of NodeGroup %s/%s started: spec %s -> %s, image %s -> %s, %d Node(s), maxSurge %d, maxUnavailable %d",
+		infraId, nodeGroupId, st.FromSpecId, st.ToSpecId, st.FromImageId, st.ToImageId, len(nodeIds), req.MaxSurge, req.MaxUnavailable)
+	go runRollingUpdate(context.WithoutCancel(ctx), run)
+
+	return st, nil
+}
+
+// normalizeRollingUpdateReq validates req and fills its defaults.
+func normalizeRollingUpdateReq(req *model.NodeGroupRollingUpdateReq) error {
+	if req.SpecId == "" && req.ImageId == "" {
+		return fmt.Errorf("specId or imageId is required")
+	}
+	if req.MaxSurge < 0 || req.MaxUnavailable < 0 {
+		return fmt.Errorf("maxSurge and maxUnavailable must not be negative")
+	}
+	if req.MaxSurge == 0 && req.MaxUnavailable == 0 {
+		req.MaxSurge = 1
+	}
+	if hc := req.HealthCheck; hc != nil {
+		hc.Type = strings.ToLower(hc.Type)
+		switch hc.Type {
+		case model.RollingUpdateHealthCheckSsh:
+		case model.RollingUpdateHealthCheckHttp:
+			if hc.Port == 0 {
+				hc.Port = 80
+			}
+			if hc.Port < 1 || hc.Port > 65535 {
+				return fmt.Errorf("invalid health check port %d", hc.Port)
+			}
+			if !strings.HasPrefix(hc.Path, "/") {
+				hc.Path = "/" + hc.Path
+			}
+		default:
+			return fmt.Errorf("invalid health check type %q (use %s or %s)", hc.Type, model.RollingUpdateHealthCheckSsh, model.RollingUpdateHealthCheckHttp)
+		}
+		if hc.TimeoutSeconds <= 0 {
+			hc.TimeoutSeconds = int(rollingUpdateHealthTimeout.Seconds())
+		}
+	}
+	return nil
+}
+
+// GetNodeGroupRollingUpdate returns the status of the latest rolling update of a NodeGroup.
+func GetNodeGroupRollingUpdate(nsId string, infraId string, nodeGroupId string) (model.NodeGroupRollingUpdateStatus, error) {
+	run, found, err := loadRollingUpdateRun(nsId, infraId, nodeGroupId)
+	if err != nil {
+		return model.NodeGroupRollingUpdateStatus{}, err
+	}
+	if !found {
+		return model.NodeGroupRollingUpdateStatus{}, fmt.Errorf("NodeGroup %s of Infra %s has no rolling update", nodeGroupId, infraId)
+	}
+	return run.snapshot(), nil
+}
+
+// ControlNodeGroupRollingUpdate pauses, resumes or rolls back the rolling update of a NodeGroup.
+//
+// A pause takes effect at the end of the current batch. Resume continues a Paused or
+// Failed update; the unfinished batch is redone. Rollback recreates the deleted Nodes
+// with the previous spec and image, moves the NLB membership back to them and deletes
+// the replacement Nodes.
+func ControlNodeGroupRollingUpdate(ctx context.Context, nsId string, infraId string, nodeGroupId string, action string) (model.NodeGroupRollingUpdateStatus, error) {
+	run, found, err := loadRollingUpdateRun(nsId, infraId, nodeGroupId)
+	if err != nil {
+		return model.NodeGroupRollingUpdateStatus{}, err
+	}
+	if !found {
+		return model.NodeGroupRollingUpdateStatus{}, fmt.Errorf("NodeGroup %s of Infra %s has no rolling update", nodeGroupId, infraId)
+	}
+
+	run.mu.Lock()
+	defer run.mu.Unlock()
+	phase := run.status.Phase
+	start := false
+
+	switch strings.ToLower(action) {
+	case model.RollingUpdateActionPause:
+		if phase != model.RollingUpdateRunning {
+			return run.status, fmt.Errorf("cannot pause a rolling update that is %s", phase)
+		}
+		run.pauseRequested = true
+		run.status.Message = "pause requested; the update pauses after the current batch"
+	case model.RollingUpdateActionResume:
+		if phase != model.RollingUpdatePaused && phase != model.RollingUpdateFailed {
+			return run.status, fmt.Errorf("cannot resume a rolling update that is %s", phase)
+		}
+		if run.active {
+			return run.status, fmt.Errorf("the rolling update is still stopping; retry shortly")
+		}
+		run.pauseRequested = false
+		run.status.Phase = model.RollingUpdateRunning
+		run.status.Message = "resumed"
+		start = true
+	case model.RollingUpdateActionRollback:
+		if phase == model.RollingUpdateCompleted || phase == model.RollingUpdateRolledBack || phase == model.RollingUpdateRollingBack {
+			return run.status, fmt.Errorf("cannot roll back a rolling update that is %s", phase)
+		}
+		run.rollbackRequested = true
+		run.status.Message = "rollback requested"
+		// A running update rolls back at its next step; otherwise start one here
+		start = !run.active
+	default:
+		return run.status, fmt.Errorf("invalid action %q (use %s, %s or %s)", action,
+			model.RollingUpdateActionPause, model.RollingUpdateActionResume, model.RollingUpdateActionRollback)
+	}
+
+	run.status.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	run.persistLocked()
+	if start {
+		run.active = true
+		go runRollingUpdate(context.WithoutCancel(ctx), run)
+	}
+	return run.status, nil
+}
+
+// runRollingUpdate drives the update until it completes, pauses or fails, rolling back
+// instead when asked to.
+func runRollingUpdate(ctx context.Context, run *rollingUpdateRun) {
+	defer func() {
+		run.mu.Lock()
+		run.active = false
+		run.mu.Unlock()
+	}()
+
+	if !run.rollbackWanted() {
+		err := rollOutNodeGroup(ctx, run)
+		switch {
+		case err == nil:
+			run.update(func(st *model.NodeGroupRollingUpdateStatus) {
+				st.Phase = model.RollingUpdateCompleted
+				st.Message = fmt.Sprintf("%d Node(s) replaced", len(st.NewNodeIds))
+			})
+			log.Info().Msgf("Rolling update of NodeGroup %s completed", run.snapshot().NodeGroupId)
+			return
+		case errors.Is(err, errRollingUpdatePaused):
+			return
+		case !errors.Is(err, errRollbackRequested):
+			log.Error().Err(err).Msgf("Rolling update of NodeGroup %s failed", run.snapshot().NodeGroupId)
+			run.update(func(st *model.NodeGroupRollingUpdateStatus) {
+				st.Phase = model.RollingUpdateFailed
+				st.Message = err.Error()
+			})
+			return
+		}
+	}
+
+	run.update(func(st *model.NodeGroupRollingUpdateStatus) {
+		st.Phase = model.RollingUpdateRollingBack
+		st.Message = "rolling back"
+	})
+	err := rollBackNodeGroup(ctx, run)
+
+	run.mu.Lock()
+	run.rollbackRequested = false
+	run.mu.Unlock()
+	if err != nil {
+		log.Error().Err(err).Msgf("Rollback of NodeGroup %s failed", run.snapshot().NodeGroupId)
+		run.update(func(st *model.NodeGroupRollingUpdateStatus) {
+			st.Phase = model.RollingUpdateFailed
+			st.Message = "rollback failed: " + err.Error()
+		})
+		return
+	}
+	run.update(func(st *model.NodeGroupRollingUpdateStatus) {
+		st.Phase = model.RollingUpdateRolledBack
+		st.Message = fmt.Sprintf("spec %s and image %s restored", st.FromSpecId, st.FromImageId)
+	})
+	log.Info().Msgf("Rolling update of NodeGroup %s rolled back", run.snapshot().NodeGroupId)
+}
+
+// rollOutNodeGroup replaces the remaining old Nodes batch by batch.
+func rollOutNodeGroup(ctx context.Context, run *rollingUpdateRun) error {
+	st := run.snapshot()
+	base, err := rollingUpdateBaseReq(st)
+	if err != nil {
+		return err
+	}
+
+	// The batch left unfinished by a pause, failure or restart is redone from scratch
+	if len(st.PendingNodeIds) > 0 {
+		if err := retireRollingUpdateNodes(st, st.PendingNodeIds, func(nodeId string) {
+			run.update(func(s *model.NodeGroupRollingUpdateStatus) { s.PendingNodeIds = removeString(s.PendingNodeIds, nodeId) })
+		}); err != nil {
+			return fmt.Errorf("cannot clean up the unfinished batch: %w", err)
+		}
+	}
+
+	for {
+		if run.rollbackWanted() {
+			return errRollbackRequested
+		}
+		run.mu.Lock()
+		pause := run.pauseRequested
+		run.pauseRequested = false
+		run.mu.Unlock()
+		if pause {
+			run.update(func(s *model.NodeGroupRollingUpdateStatus) {
+				s.Phase = model.RollingUpdatePaused
+				s.Message = fmt.Sprintf("paused after replacing %d of %d Node(s)", len(s.ReplacedNodeIds), len(s.OldNodeIds))
+			})
+			return errRollingUpdatePaused
+		}
+
+		st = run.snapshot()
+		remaining := subtractStrings(st.OldNodeIds, st.ReplacedNodeIds)
+		if len(remaining) == 0 {
+			return nil
+		}
+		batchSize := min(st.Request.MaxSurge+st.Request.MaxUnavailable, len(remaining))
+		down := min(st.Request.MaxUnavailable, batchSize)
+		batch := remaining[:batchSize]
+		log.Info().Msgf("Rolling update of NodeGroup %s: replacing %v", st.NodeGroupId, batch)
+
+		markReplaced := func(nodeId string) {
+			run.update(func(s *model.NodeGroupRollingUpdateStatus) { s.ReplacedNodeIds = append(s.ReplacedNodeIds, nodeId) })
+		}
+		// Old Nodes within maxUnavailable go first to make room for their replacements
+		if err := retireRollingUpdateNodes(st, batch[:down], markReplaced); err != nil {
+			return err
+		}
+
+		newIds, err := createRollingUpdateNodes(ctx, st, base, st.ToSpecId, st.ToImageId, st.ToCspImageName, batchSize)
+		run.update(func(s *model.NodeGroupRollingUpdateStatus) { s.PendingNodeIds = newIds })
+		if err != nil {
+			return err
+		}
+		if run.rollbackWanted() {
+			return errRollbackRequested
+		}
+		if err := prepareRollingUpdateNodes(st, newIds); err != nil {
+			return err
+		}
+		if run.rollbackWanted() {
+			return errRollbackRequested
+		}
+		if err := attachRollingUpdateNodes(st, newIds); err != nil {
+			return err
+		}
+		run.update(func(s *model.NodeGroupRollingUpdateStatus) {
+			s.NewNodeIds = append(s.NewNodeIds, newIds...)
+			s.PendingNodeIds = nil
+		})
+
+		if err := retireRollingUpdateNodes(st, batch[down:], markReplaced); err != nil {
+			return err
+		}
+
+		if st.Request.PauseAfterEachBatch && len(remaining) > batchSize {
+			run.mu.Lock()
+			run.pauseRequested = true
+			run.mu.Unlock()
+		}
+	}
+}
+
+// rollBackNodeGroup restores the NodeGroup to its previous spec and image. Deleted old
+// Nodes are recreated before the replacement Nodes are removed, so capacity is kept.
+// Progress is recorded step by step so a failed rollback can be retried.
+func rollBackNodeGroup(ctx context.Context, run *rollingUpdateRun) error {
+	st := run.snapshot()
+	base, err := rollingUpdateBaseReq(st)
+	if err != nil {
+		return err
+	}
+
+	// Pending Nodes never took traffic (of the rollout, or of an interrupted rollback)
+	if err := retireRollingUpdateNodes(st, st.PendingNodeIds, func(nodeId string) {
+		run.update(func(s *model.NodeGroupRollingUpdateStatus) { s.PendingNodeIds = removeString(s.PendingNodeIds, nodeId) })
+	}); err != nil {
+		return err
+	}
+
+	st = run.snapshot()
+	if len(st.ReplacedNodeIds) > 0 {
+		restoredIds, err := createRollingUpdateNodes(ctx, st, base, st.FromSpecId, st.FromImageId, st.FromCspImageName, len(st.ReplacedNodeIds))
+		run.update(func(s *model.NodeGroupRollingUpdateStatus) { s.PendingNodeIds = restoredIds })
+		if err != nil {
+			return err
+		}
+		if err := prepareRollingUpdateNodes(st, restoredIds); err != nil {
+			return err
+		}
+		if err := attachRollingUpdateNodes(st, restoredIds); err != nil {
+			return err
+		}
+		run.update(func(s *model.NodeGroupRollingUpdateStatus) {
+			s.OldNodeIds = append(subtractStrings(s.OldNodeIds, s.ReplacedNodeIds), restoredIds...)
+			s.ReplacedNodeIds = []string{}
+			s.PendingNodeIds = nil
+		})
+	}
+
+	st = run.snapshot()
+	return retireRollingUpdateNodes(st, st.NewNodeIds, func(nodeId string) {
+		run.update(func(s *model.NodeGroupRollingUpdateStatus) { s.NewNodeIds = removeString(s.NewNodeIds, nodeId) })
+	})
+}
+
+// rollingUpdateBaseReq returns the configuration shared by old and new Nodes, taken
+// from a Node of the NodeGroup. Spec and image are set per use.
+func rollingUpdateBaseReq(st model.NodeGroupRollingUpdateStatus) (*model.CreateNodeGroupReq, error) {
+	nodeIds, err := ListNodeByNodeGroup(st.NsId, st.InfraId, st.NodeGroupId)
+	if err != nil {
+		return nil, err
+	}
+	if len(nodeIds) == 0 {
+		return nil, fmt.Errorf("NodeGroup %s has no Node left to copy the configuration from", st.NodeGroupId)
+	}
+	sort.Strings(nodeIds)
+	nodeObj, err := GetNodeObject(st.NsId, st.InfraId, nodeIds[0])
+	if err != nil {
+		return nil, err
+	}
+	return nodeGroupReqFromNode(st.NsId, st.InfraId, st.NodeGroupId, nodeObj), nil
+}
+
+// createRollingUpdateNodes adds count Nodes with the given spec and image to the NodeGroup
+// and returns their ids, also when some of them failed.
+func createRollingUpdateNodes(ctx context.Context, st model.NodeGroupRollingUpdateStatus, base *model.CreateNodeGroupReq, specId string, imageId string, cspImageName string, count int) ([]string, error) {
+	req := *base
+	req.SpecId = specId
+	req.ImageId = imageId
+	req.CspImageName = cspImageName
+	req.NodeGroupSize = count
+	return createNodesInNodeGroup(ctx, st.NsId, st.InfraId, st.NodeGroupId, &req)
+}
+
+// prepareRollingUpdateNodes runs the post-deployment commands of the update on the Nodes
+// and then its health check, in parallel per Node.
+func prepareRollingUpdateNodes(st model.NodeGroupRollingUpdateStatus, nodeIds []string) error {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var errs []string
+	for _, nodeId := range nodeIds {
+		wg.Add(1)
+		go func(nodeId string) {
+			defer wg.Done()
+			err := runPostCommandsOnNode(st.NsId, st.InfraId, nodeId, st.Request.PostCommands)
+			if err == nil && st.Request.HealthCheck != nil {
+				err = checkRollingUpdateNodeHealth(st, nodeId)
+			}
+			if err != nil {
+				mu.Lock()
+				errs = append(errs, err.Error())
+				mu.Unlock()
+			}
+		}(nodeId)
+	}
+	wg.Wait()
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func checkRollingUpdateNodeHealth(st model.NodeGroupRollingUpdateStatus, nodeId string) error {
+	hc := st.Request.HealthCheck
+	timeout := time.Duration(hc.TimeoutSeconds) * time.Second
+	if hc.Type == model.RollingUpdateHealthCheckSsh {
+		return waitForNodeSsh(st.NsId, st.InfraId, nodeId, timeout)
+	}
+
+	deadline := time.Now().Add(timeout)
+	var lastErr error
+	for {
+		lastErr = probeNodeHttp(st.NsId, st.InfraId, nodeId, hc)
+		if lastErr == nil {
+			return nil
+		}
+		if time.Now().Add(rollingUpdateHealthInterval).After(deadline) {
+			return fmt.Errorf("Node %s is not healthy after %s: %w", nodeId, timeout, lastErr)
+		}
+		time.Sleep(rollingUpdateHealthInterval)
+	}
+}
+
+// probeNodeHttp sends one GET to the Node (public IP, else private IP) and accepts 2xx and 3xx.
+func probeNodeHttp(nsId string, infraId string, nodeId string, hc *model.RollingUpdateHealthCheck) error {
+	nodeObj, err := GetNodeObject(nsId, infraId, nodeId)
+	if err != nil {
+		return err
+	}
+	ip := nodeObj.PublicIP
+	if ip == "" {
+		ip = nodeObj.PrivateIP
+	}
+	if ip == "" {
+		return fmt.Errorf("Node %s has no IP address yet", nodeId)
+	}
+	url := "http://" + net.JoinHostPort(ip, strconv.Itoa(hc.Port)) + hc.Path
+	resp, err := rollingUpdateHealthProbe.Get(url)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+		return fmt.Errorf("GET %s returned %d", url, resp.StatusCode)
+	}
+	return nil
+}
+
+// nodeGroupNLBs returns the NLBs of the Infra that target the NodeGroup or any of its Nodes.
+func nodeGroupNLBs(nsId string, infraId string, nodeGroupId string, nodeIds []string) []string {
+	nlbIds, err := ListNLBId(nsId, infraId)
+	if err != nil {
+		log.Warn().Err(err).Msgf("Cannot list the NLBs of Infra %s", infraId)
+		return nil
+	}
+	var result []string
+	for _, nlbId := range nlbIds {
+		nlb, err := GetNLB(nsId, infraId, nlbId)
+		if err != nil {
+			continue
+		}
+		if strings.EqualFold(nlb.TargetGroup.NodeGroupId, nodeGroupId) || len(intersectStrings(nlb.TargetGroup.Nodes, nodeIds)) > 0 {
+			result = append(result, nlbId)
+		}
+	}
+	return result
+}
+
+// attachRollingUpdateNodes adds the Nodes to the NLBs of the update.
+func attachRollingUpdateNodes(st model.NodeGroupRollingUpdateStatus, nodeIds []string) error {
+	if len(nodeIds) == 0 {
+		return nil
+	}
+	for _, nlbId := range st.NLBIds {
+		req := &model.NLBAddRemoveNodeReq{TargetGroup: model.NLBTargetGroupInfo{Nodes: nodeIds}}
+		if _, err := AddNLBNodes(st.NsId, st.InfraId, nlbId, req); err != nil {
+			return fmt.Errorf("cannot add %v to NLB %s: %w", nodeIds, nlbId, err)
+		}
+	}
+	return nil
+}
+
+// retireRollingUpdateNodes takes the Nodes out of the NLBs of the update and deletes
+// them, calling done after each deletion so progress is recorded as it happens.
+func retireRollingUpdateNodes(st model.NodeGroupRollingUpdateStatus, nodeIds []string, done func(nodeId string)) error {
+	if len(nodeIds) == 0 {
+		return nil
+	}
+	for _, nlbId := range st.NLBIds {
+		nlb, err := GetNLB(st.NsId, st.InfraId, nlbId)
+		if err != nil {
+			return fmt.Errorf("cannot read NLB %s: %w", nlbId, err)
+		}
+		members := intersectStrings(nlb.TargetGroup.Nodes, nodeIds)
+		if len(members) == 0 {
+			continue
+		}
+		req := &model.NLBAddRemoveNodeReq{TargetGroup: model.NLBTargetGroupInfo{Nodes: members}}
+		if err := RemoveNLBNodes(st.NsId, st.InfraId, nlbId, req); err != nil {
+			return fmt.Errorf("cannot remove %v from NLB %s: %w", members, nlbId, err)
+		}
+	}
+	for _, nodeId := range nodeIds {
+		if exists, _ := CheckNode(st.NsId, st.InfraId, nodeId); exists {
+			if err := DelInfraNode(st.NsId, st.InfraId, nodeId, ""); err != nil {
+				return fmt.Errorf("cannot delete Node %s: %w", nodeId, err)
+			}
+		}
+		done(nodeId)
+	}
+	return nil
+}
+
+// subtractStrings returns the items of a that are not in b, keeping the order of a.
+func subtractStrings(a []string, b []string) []string {
+	result := []string{}
+	for _, v := range a {
+		if !contains(b, v) {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// intersectStrings returns the items of a that are also in b.
+func intersectStrings(a []string, b []string) []string {
+	var result []string
+	for _, v := range a {
+		if contains(b, v) {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+func removeString(list []string, item string) []string {
+	return subtractStrings(list, []string{item})
+}
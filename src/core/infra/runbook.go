@@ -0,0 +1,598 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package infra is to manage multi-cloud infra
+package infra
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cloud-barista/cb-tumblebug/src/core/common"
+	"github.com/cloud-barista/cb-tumblebug/src/core/model"
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvstore"
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvutil"
+	"github.com/rs/zerolog/log"
+)
+
+// runbookParamNameRegex is the syntax of runbook parameter names
+var runbookParamNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// runbookPlaceholderRegex matches the {{name}} placeholders in runbook commands
+var runbookPlaceholderRegex = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+// genRunbookKey generates the kvstore key of a runbook (its latest version), or of the
+// runbooks of a namespace when runbookId is empty
+func genRunbookKey(nsId string, runbookId string) string {
+	key := "/ns/" + nsId + "/" + model.StrRunbook
+	if runbookId != "" {
+		key += "/" + runbookId
+	}
+	return key
+}
+
+// genRunbookVersionKey generates the kvstore key of a version of a runbook, or of all its
+// versions when version is 0
+func genRunbookVersionKey(nsId string, runbookId string, version int) string {
+	key := genRunbookKey(nsId, runbookId) + "/version/"
+	if version > 0 {
+		key += fmt.Sprintf("%06d", version)
+	}
+	return key
+}
+
+// validateRunbookReq checks the parameters and steps of a runbook request
+func validateRunbookReq(req *model.RunbookReq) error {
+	if err := validate.Struct(req); err != nil {
+		return err
+	}
+	declared := map[string]bool{}
+	for i, p := range req.Parameters {
+		if !runbookParamNameRegex.MatchString(p.Name) {
+			return fmt.Errorf("parameters[%d]: invalid name %q (use letters, digits and '_')", i, p.Name)
+		}
+		if declared[p.Name] {
+			return fmt.Errorf("parameters[%d]: duplicate name %q", i, p.Name)
+		}
+		declared[p.Name] = true
+
+		switch p.Type {
+		case "", model.RunbookParamString, model.RunbookParamInt, model.RunbookParamBool:
+			if len(p.AllowedValues) > 0 {
+				return fmt.Errorf("parameter %s: allowedValues applies to enum parameters only", p.Name)
+			}
+		case model.RunbookParamEnum:
+			if len(p.AllowedValues) == 0 {
+				return fmt.Errorf("parameter %s: enum parameters require allowedValues", p.Name)
+			}
+		default:
+			return fmt.Errorf("parameter %s: invalid type %q (use string, int, bool or enum)", p.Name, p.Type)
+		}
+		if p.Pattern != "" {
+			if p.Type != "" && p.Type != model.RunbookParamString {
+				return fmt.Errorf("parameter %s: pattern applies to string parameters only", p.Name)
+			}
+			if _, err := regexp.Compile(p.Pattern); err != nil {
+				return fmt.Errorf("parameter %s: invalid pattern: %w", p.Name, err)
+			}
+		}
+		if p.Default != "" {
+			if _, err := checkRunbookParamValue(p, p.Default); err != nil {
+				return fmt.Errorf("parameter %s: invalid default: %w", p.Name, err)
+			}
+		}
+	}
+
+	if len(req.Steps) == 0 {
+		return fmt.Errorf("a runbook requires at least one step")
+	}
+	for i, step := range req.Steps {
+		if len(step.Command) == 0 {
+			return fmt.Errorf("steps[%d]: command is empty", i)
+		}
+		if step.TimeoutMinutes < 0 || step.TimeoutMinutes > model.SSHCommandMaxTimeoutMinutes {
+			return fmt.Errorf("steps[%d]: timeoutMinutes must be between 0 (default) and %d", i, model.SSHCommandMaxTimeoutMinutes)
+		}
+		for _, cmd := range step.Command {
+			for _, m := range runbookPlaceholderRegex.FindAllStringSubmatch(cmd, -1) {
+				if !declared[m[1]] {
+					return fmt.Errorf("steps[%d]: {{%s}} is not a parameter of the runbook", i, m[1])
+				}
+			}
+		}
+	}
+	if req.TimeoutMinutes < 0 || req.TimeoutMinutes > model.SSHCommandMaxTimeoutMinutes {
+		return fmt.Errorf("timeoutMinutes must be between 0 (default) and %d", model.SSHCommandMaxTimeoutMinutes)
+	}
+	if req.Target.NodeGroupId != "" && req.Target.LabelSelector != "" {
+		return fmt.Errorf("set at most one of target.nodeGroupId and target.labelSelector")
+	}
+	return nil
+}
+
+// checkRunbookParamValue checks a value against the type of a parameter and returns it normalized
+func checkRunbookParamValue(p model.RunbookParameter, value string) (string, error) {
+	switch p.Type {
+	case model.RunbookParamInt:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return "", fmt.Errorf("%q is not an integer", value)
+		}
+		return strconv.Itoa(n), nil
+	case model.RunbookParamBool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return "", fmt.Errorf("%q is not a boolean", value)
+		}
+		return strconv.FormatBool(b), nil
+	case model.RunbookParamEnum:
+		if !slices.Contains(p.AllowedValues, value) {
+			return "", fmt.Errorf("%q is not one of %v", value, p.AllowedValues)
+		}
+	default:
+		if p.Pattern != "" {
+			re, err := regexp.Compile("^(?:" + p.Pattern + ")$")
+			if err != nil {
+				return "", err
+			}
+			if !re.MatchString(value) {
+				return "", fmt.Errorf("%q does not match %s", value, p.Pattern)
+			}
+		}
+	}
+	return value, nil
+}
+
+// resolveRunbookParams returns the value of every parameter of a runbook, from the given
+// values and the defaults
+func resolveRunbookParams(rb model.RunbookInfo, values map[string]string) (map[string]string, error) {
+	resolved := make(map[string]string, len(rb.Parameters))
+	for name := range values {
+		if !slices.ContainsFunc(rb.Parameters, func(p model.RunbookParameter) bool { return p.Name == name }) {
+			return nil, fmt.Errorf("runbook %s has no parameter %q", rb.Id, name)
+		}
+	}
+	for _, p := range rb.Parameters {
+		value, ok := values[p.Name]
+		if !ok || value == "" {
+			value = p.Default
+		}
+		if value == "" {
+			if p.Required {
+				return nil, fmt.Errorf("runbook %s requires parameter %q", rb.Id, p.Name)
+			}
+			resolved[p.Name] = ""
+			continue
+		}
+		normalized, err := checkRunbookParamValue(p, value)
+		if err != nil {
+			return nil, fmt.Errorf("runbook %s parameter %s: %w", rb.Id, p.Name, err)
+		}
+		resolved[p.Name] = normalized
+	}
+	return resolved, nil
+}
+
+// renderRunbookCommands replaces the placeholders of runbook commands with parameter values.
+// String values are free text, so they are substituted as single-quoted shell words; int,
+// bool and enum values are normalized or chosen by the author and substituted as they are.
+func renderRunbookCommands(cmds []string, parameters []model.RunbookParameter, params map[string]string) []string {
+	quoted := make(map[string]bool, len(parameters))
+	for _, p := range parameters {
+		quoted[p.Name] = p.Type == "" || p.Type == model.RunbookParamString
+	}
+	rendered := make([]string, len(cmds))
+	for i, cmd := range cmds {
+		rendered[i] = runbookPlaceholderRegex.ReplaceAllStringFunc(cmd, func(m string) string {
+			name := runbookPlaceholderRegex.FindStringSubmatch(m)[1]
+			if quoted[name] {
+				return shellQuote(params[name])
+			}
+			return params[name]
+		})
+	}
+	return rendered
+}
+
+// CreateRunbook creates version 1 of a runbook in a namespace
+func CreateRunbook(nsId string, req *model.RunbookReq) (model.RunbookInfo, error) {
+	emptyResult := model.RunbookInfo{}
+
+	err := common.CheckString(req.Name)
+	if err != nil {
+		log.Error().Err(err).Msg("invalid runbook name")
+		return emptyResult, err
+	}
+	check, err := common.CheckNs(nsId)
+	if !check {
+		return emptyResult, fmt.Errorf("namespace '%s' does not exist", nsId)
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return emptyResult, err
+	}
+	if err := validateRunbookReq(req); err != nil {
+		return emptyResult, err
+	}
+
+	now := time.Now().Format(time.RFC3339)
+	rb := runbookFromReq(req)
+	rb.Version = 1
+	rb.CreatedAt = now
+	rb.UpdatedAt = now
+
+	val, err := json.Marshal(rb)
+	if err != nil {
+		return emptyResult, err
+	}
+	created := false
+	err = kvstore.UpdateWithRetry(context.Background(), genRunbookKey(nsId, rb.Id), func(_ string, exists bool) (string, bool, error) {
+		if exists {
+			return "", false, fmt.Errorf("runbook '%s' already exists in namespace '%s'", rb.Id, nsId)
+		}
+		created = true
+		return string(val), true, nil
+	})
+	if err != nil {
+		return emptyResult, err
+	}
+	if created {
+		putRunbookVersion(nsId, rb)
+	}
+	return rb, nil
+}
+
+// runbookFromReq returns the runbook described by a request, without version or timestamps
+func runbookFromReq(req *model.RunbookReq) model.RunbookInfo {
+	return model.RunbookInfo{
+		ResourceType:   model.StrRunbook,
+		Id:             req.Name,
+		Name:           req.Name,
+		Description:    req.Description,
+		Parameters:     req.Parameters,
+		Steps:          req.Steps,
+		UserName:       req.UserName,
+		TimeoutMinutes: req.TimeoutMinutes,
+		Target:         req.Target,
+	}
+}
+
+// putRunbookVersion keeps a copy of a runbook version, so that references pinned to it
+// keep working after updates
+func putRunbookVersion(nsId string, rb model.RunbookInfo) {
+	val, err := json.Marshal(rb)
+	if err != nil {
+		return
+	}
+	if err := kvstore.Put(genRunbookVersionKey(nsId, rb.Id, rb.Version), string(val)); err != nil {
+		log.Error().Err(err).Msgf("failed to store version %d of runbook %s", rb.Version, rb.Id)
+	}
+}
+
+// GetRunbook returns a version of a runbook, or its latest version when version is 0
+func GetRunbook(nsId string, runbookId string, version int) (model.RunbookInfo, error) {
+	emptyResult := model.RunbookInfo{}
+
+	err := common.CheckString(nsId)
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return emptyResult, err
+	}
+	err = common.CheckString(runbookId)
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return emptyResult, err
+	}
+
+	key := genRunbookKey(nsId, runbookId)
+	if version > 0 {
+		key = genRunbookVersionKey(nsId, runbookId, version)
+	}
+	keyValue, exists, err := kvstore.GetKv(key)
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return emptyResult, err
+	}
+	if !exists {
+		if version > 0 {
+			return emptyResult, fmt.Errorf("version %d of runbook '%s' not found in namespace '%s'", version, runbookId, nsId)
+		}
+		return emptyResult, fmt.Errorf("runbook '%s' not found in namespace '%s'", runbookId, nsId)
+	}
+
+	result := model.RunbookInfo{}
+	if err := json.Unmarshal([]byte(keyValue.Value), &result); err != nil {
+		log.Error().Err(err).Msg("failed to unmarshal runbook")
+		return emptyResult, err
+	}
+	return result, nil
+}
+
+// ListRunbook lists the latest version of the runbooks in a namespace. filterKeyword is
+// optional; if non-empty, only runbooks whose Name or Description contains it are returned.
+func ListRunbook(nsId string, filterKeyword string) ([]model.RunbookInfo, error) {
+	err := common.CheckString(nsId)
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return nil, err
+	}
+
+	key := genRunbookKey(nsId, "")
+	keyValue, err := kvstore.GetKvList(key)
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return nil, err
+	}
+	keyValue = kvutil.FilterKvListBy(keyValue, key, 1)
+
+	runbooks := []model.RunbookInfo{}
+	keyword := strings.ToLower(strings.TrimSpace(filterKeyword))
+	for _, v := range keyValue {
+		rb := model.RunbookInfo{}
+		if err := json.Unmarshal([]byte(v.Value), &rb); err != nil {
+			log.Error().Err(err).Msg("failed to unmarshal runbook")
+			continue
+		}
+		if keyword != "" && !strings.Contains(strings.ToLower(rb.Name), keyword) && !strings.Contains(strings.ToLower(rb.Description), keyword) {
+			continue
+		}
+		runbooks = append(runbooks, rb)
+	}
+	return runbooks, nil
+}
+
+// ListRunbookVersions lists the versions of a runbook, oldest first
+func ListRunbookVersions(nsId string, runbookId string) ([]model.RunbookInfo, error) {
+	if _, err := GetRunbook(nsId, runbookId, 0); err != nil {
+		return nil, err
+	}
+	keyValue, err := kvstore.GetKvList(genRunbookVersionKey(nsId, runbookId, 0))
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return nil, err
+	}
+
+	versions := []model.RunbookInfo{}
+	for _, v := range keyValue {
+		rb := model.RunbookInfo{}
+		if err := json.Unmarshal([]byte(v.Value), &rb); err != nil {
+			continue
+		}
+		versions = append(versions, rb)
+	}
+	slices.SortFunc(versions, func(a, b model.RunbookInfo) int { return a.Version - b.Version })
+	return versions, nil
+}
+
+// UpdateRunbook stores a request as the next version of a runbook
+func UpdateRunbook(nsId string, runbookId string, req *model.RunbookReq) (model.RunbookInfo, error) {
+	emptyResult := model.RunbookInfo{}
+
+	err := common.CheckString(nsId)
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return emptyResult, err
+	}
+	err = common.CheckString(runbookId)
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return emptyResult, err
+	}
+
+	// Name is not changeable; it is tied to Id and the kvstore key
+	if req.Name == "" {
+		req.Name = runbookId
+	}
+	if req.Name != runbookId {
+		return emptyResult, fmt.Errorf("runbook name cannot be changed (name '%s' does not match runbook ID '%s')", req.Name, runbookId)
+	}
+	if err := validateRunbookReq(req); err != nil {
+		return emptyResult, err
+	}
+
+	var updated model.RunbookInfo
+	err = kvstore.UpdateWithRetry(context.Background(), genRunbookKey(nsId, runbookId), func(current string, exists bool) (string, bool, error) {
+		if !exists {
+			return "", false, fmt.Errorf("runbook '%s' not found in namespace '%s'", runbookId, nsId)
+		}
+		existing := model.RunbookInfo{}
+		if err := json.Unmarshal([]byte(current), &existing); err != nil {
+			return "", false, err
+		}
+		updated = runbookFromReq(req)
+		updated.Version = existing.Version + 1
+		updated.CreatedAt = existing.CreatedAt
+		updated.UpdatedAt = time.Now().Format(time.RFC3339)
+		val, err := json.Marshal(updated)
+		if err != nil {
+			return "", false, err
+		}
+		return string(val), true, nil
+	})
+	if err != nil {
+		return emptyResult, err
+	}
+	putRunbookVersion(nsId, updated)
+	return updated, nil
+}
+
+// DeleteRunbook deletes a runbook and all its versions
+func DeleteRunbook(nsId string, runbookId string) error {
+	if _, err := GetRunbook(nsId, runbookId, 0); err != nil {
+		return err
+	}
+	if err := kvstore.DeleteWithPrefix(genRunbookVersionKey(nsId, runbookId, 0)); err != nil {
+		log.Error().Err(err).Msg("failed to delete runbook versions")
+		return err
+	}
+	if err := kvstore.Delete(genRunbookKey(nsId, runbookId)); err != nil {
+		log.Error().Err(err).Msg("failed to delete runbook")
+		return err
+	}
+	return nil
+}
+
+// DeleteAllRunbook deletes all runbooks in a namespace
+func DeleteAllRunbook(nsId string) error {
+	runbooks, err := ListRunbook(nsId, "")
+	if err != nil {
+		return err
+	}
+	for _, rb := range runbooks {
+		if err := DeleteRunbook(nsId, rb.Id); err != nil {
+			log.Error().Err(err).Msgf("failed to delete runbook '%s'", rb.Id)
+			return err
+		}
+	}
+	return nil
+}
+
+// runbookStepCmdReq returns the command request of a runbook step, rendered with the
+// parameters. userName and timeoutMinutes override the runbook defaults when set.
+func runbookStepCmdReq(rb model.RunbookInfo, step model.RunbookStep, params map[string]string, userName string, timeoutMinutes int) model.InfraCmdReq {
+	req := model.InfraCmdReq{
+		UserName:       rb.UserName,
+		Command:        renderRunbookCommands(step.Command, rb.Parameters, params),
+		TimeoutMinutes: rb.TimeoutMinutes,
+	}
+	if userName != "" {
+		req.UserName = userName
+	}
+	if timeoutMinutes > 0 {
+		req.TimeoutMinutes = timeoutMinutes
+	}
+	if step.TimeoutMinutes > 0 {
+		req.TimeoutMinutes = step.TimeoutMinutes
+	}
+	return req
+}
+
+// expandRunbookPhases replaces each post-deployment phase that refers to a runbook with
+// one phase per runbook step. A failed step stops the run unless the step or the phase
+// continues on error.
+func expandRunbookPhases(nsId string, phases []model.PostCommandReq) ([]model.PostCommandReq, error) {
+	expanded := make([]model.PostCommandReq, 0, len(phases))
+	for i, phase := range phases {
+		if phase.Runbook == nil {
+			expanded = append(expanded, phase)
+			continue
+		}
+		rb, err := GetRunbook(nsId, phase.Runbook.RunbookId, phase.Runbook.Version)
+		if err != nil {
+			return nil, fmt.Errorf("postCommands[%d]: %w", i, err)
+		}
+		params, err := resolveRunbookParams(rb, phase.Runbook.Parameters)
+		if err != nil {
+			return nil, fmt.Errorf("postCommands[%d]: %w", i, err)
+		}
+
+		nodeGroupId, labelSelector := phase.NodeGroupId, phase.LabelSelector
+		if phase.NodeGroupId == "" && phase.NodeId == "" && phase.LabelSelector == "" {
+			nodeGroupId, labelSelector = rb.Target.NodeGroupId, rb.Target.LabelSelector
+		}
+		for _, step := range rb.Steps {
+			stepPhase := model.PostCommandReq{
+				InfraCmdReq:     runbookStepCmdReq(rb, step, params, phase.UserName, phase.TimeoutMinutes),
+				NodeGroupId:     nodeGroupId,
+				NodeId:          phase.NodeId,
+				LabelSelector:   labelSelector,
+				ContinueOnError: phase.ContinueOnError || step.ContinueOnError,
+			}
+			stepPhase.Rolling = phase.Rolling
+			expanded = append(expanded, stepPhase)
+		}
+	}
+	return expanded, nil
+}
+
+// ValidatePostCommandRunbooks checks that the runbooks referenced by post-deployment
+// phases exist in the namespace and accept the given parameters, and that the expanded
+// phases fit the post-deployment limits.
+func ValidatePostCommandRunbooks(nsId string, phases []model.PostCommandReq) error {
+	if !slices.ContainsFunc(phases, func(p model.PostCommandReq) bool { return p.Runbook != nil }) {
+		return nil
+	}
+	expanded, err := expandRunbookPhases(nsId, phases)
+	if err != nil {
+		return err
+	}
+	return ValidatePostCommandRequest(expanded)
+}
+
+// RunRunbook runs a runbook on the Nodes of an Infra, one step after another. The target
+// given by nodeGroupId, nodeId or labelSelector overrides the target of the runbook.
+func RunRunbook(nsId string, infraId string, runbookId string, nodeGroupId string, nodeId string, labelSelector string, req *model.RunbookRunReq, xRequestId string) (model.RunbookRunResult, error) {
+	result := model.RunbookRunResult{RunbookId: runbookId, InfraId: infraId, Steps: []model.PostCommandPhaseResult{}}
+
+	rb, err := GetRunbook(nsId, runbookId, req.Version)
+	if err != nil {
+		return result, err
+	}
+	result.Version = rb.Version
+	params, err := resolveRunbookParams(rb, req.Parameters)
+	if err != nil {
+		return result, err
+	}
+	if nodeGroupId == "" && nodeId == "" && labelSelector == "" {
+		nodeGroupId = rb.Target.NodeGroupId
+		labelSelector = rb.Target.LabelSelector
+	}
+
+	scope := model.PostCommandReq{NodeGroupId: nodeGroupId, NodeId: nodeId, LabelSelector: labelSelector}.Target()
+
+	log.Info().Str("xRequestId", xRequestId).Msgf("Running version %d of runbook %s on infra %s (%s)", rb.Version, runbookId, infraId, scope)
+	result.Status = model.PostCommandStatusCompleted
+	stopped := false
+	for i, step := range rb.Steps {
+		stepResult := model.PostCommandPhaseResult{Phase: i + 1, Target: scope}
+		if stopped {
+			stepResult.Status = model.PostCommandStatusSkipped
+			result.Steps = append(result.Steps, stepResult)
+			continue
+		}
+
+		cmdReq := runbookStepCmdReq(rb, step, params, req.UserName, 0)
+		output, err := RemoteCommandToInfra(nsId, infraId, nodeGroupId, nodeId, labelSelector, &cmdReq, xRequestId)
+		if err != nil {
+			// The target or the request is wrong; the next steps would fail the same way
+			if i == 0 {
+				return result, err
+			}
+			stepResult.Status = model.PostCommandStatusFailed
+			result.Steps = append(result.Steps, stepResult)
+			result.Status = model.PostCommandStatusFailed
+			stopped = true
+			continue
+		}
+
+		cmdResult := model.ConvertSshCmdResultsForAPI(output)
+		status, failed := aggregatePostCommandResults(&cmdResult, cmdReq.GetEffectiveTimeout())
+		stepResult.Status = status
+		stepResult.Results = cmdResult
+		result.Steps = append(result.Steps, stepResult)
+		result.Status = mergePostCommandStatus(result.Status, status)
+		if status != model.PostCommandStatusCompleted {
+			log.Warn().Str("xRequestId", xRequestId).Msgf("Step %d of runbook %s failed on %d/%d Nodes", i+1, runbookId, failed, len(cmdResult.Results))
+			if !step.ContinueOnError {
+				stopped = true
+			}
+		}
+	}
+	return result, nil
+}
@@ -15,17 +15,25 @@ limitations under the License.
 package infra
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"math"
+	"math/rand"
 	"runtime"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
+	// Cron time zones must resolve in images without a zoneinfo database
+	_ "time/tzdata"
+
 	"github.com/cloud-barista/cb-tumblebug/src/core/common"
 	"github.com/cloud-barista/cb-tumblebug/src/core/model"
 	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvstore"
+	"github.com/robfig/cron/v3"
 	"github.com/rs/zerolog/log"
 )
 
@@ -39,8 +47,20 @@ const (
 
 	// Max consecutive failures before auto-disabling job
 	maxConsecutiveFailures = 5
+
+	// Number of the latest execution records shown in the run history of a job
+	maxRunHistory = 20
+
+	// Layout of the dates in ExcludeDates
+	excludeDateLayout = "2006-01-02"
+
+	// How often every replica reconciles its jobs with the kvstore
+	schedulerSyncInterval = 15 * time.Second
 )
 
+// cronParser parses the standard 5-field cron syntax and descriptors such as @daily
+var cronParser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
 // JobType represents the type of scheduled job
 type JobType string
 
@@ -49,8 +69,23 @@ const (
 	JobTypeRegisterCspResources JobType = "registerCspResources"
 	// JobTypeRegisterCspResourcesAll represents all CSP resources registration job
 	JobTypeRegisterCspResourcesAll JobType = "registerCspResourcesAll"
+	// JobTypeInfraAction represents a power action (suspend/resume/reboot) on an Infra
+	JobTypeInfraAction JobType = "infraAction"
+	// JobTypeNodeGroupAction represents a power action (suspend/resume/reboot) on the Nodes of a NodeGroup
+	JobTypeNodeGroupAction JobType = "nodeGroupAction"
 )
 
+func init() {
+	RegisterJobType(JobTypeRegisterCspResources, JobTypeHandlers{
+		Validate: validateRegisterCspResourcesPayload,
+		Run:      runRegisterCspResourcesJob,
+	})
+	RegisterJobType(JobTypeRegisterCspResourcesAll, JobTypeHandlers{
+		Validate: validateRegisterCspResourcesPayload,
+		Run:      runRegisterCspResourcesAllJob,
+	})
+}
+
 // JobStatus represents the current status of a scheduled job
 type JobStatus string
 
@@ -74,18 +109,21 @@ type ScheduledJob struct {
 	CreatedAt time.Time `json:"createdAt"`
 
 	// Job configuration
-	IntervalSeconds  int  `json:"intervalSeconds"`  // Interval between executions in seconds
-	ExecutionTimeout int  `json:"executionTimeout"` // Max execution time in seconds (0 = use default)
+	IntervalSeconds  int  `json:"intervalSeconds"`         // Interval between executions in seconds
+	ExecutionTimeout int  `json:"executionTimeout"`        // Max execution time in seconds (0 = use default)
+	JitterSeconds    int  `json:"jitterSeconds,omitempty"` // Max random delay before each scheduled execution
 	Enabled          bool `json:"enabled"`
 
-	// Job-specific parameters
-	ConnectionName  string `json:"connectionName,omitempty"`  // (Deprecated) For registerCspResources
-	Provider        string `json:"provider,omitempty"`        // For registerCspResources
-	Region          string `json:"region,omitempty"`          // For registerCspResources
-	Zone            string `json:"zone,omitempty"`            // For registerCspResources
-	InfraNamePrefix string `json:"infraNamePrefix,omitempty"` // For registerCspResources
-	Option          string `json:"option,omitempty"`          // For registerCspResources
-	InfraFlag       string `json:"infraFlag,omitempty"`       // For registerCspResources
+	// Calendar schedule (replaces IntervalSeconds when CronExpression is set)
+	CronExpression string   `json:"cronExpression,omitempty"`
+	TimeZone       string   `json:"timeZone,omitempty"`
+	ExcludeDates   []string `json:"excludeDates,omitempty"`
+
+	// Job-specific parameters, normalized by the Validate handler of the job type
+	Payload json.RawMessage `json:"payload,omitempty"`
+
+	// UpdatedAt is when the configuration last changed; replicas apply newer stored configurations
+	UpdatedAt time.Time `json:"updatedAt,omitempty"`
 
 	// Job status
 	Status              JobStatus `json:"status"`
@@ -103,6 +141,7 @@ type ScheduledJob struct {
 	ctx        context.Context
 	cancelFunc context.CancelFunc
 	ticker     *time.Ticker
+	reschedule chan struct{} // Wakes a cron job up after its schedule changed
 	mu         sync.RWMutex
 }
 
@@ -128,6 +167,7 @@ func GetSchedulerManager() *SchedulerManager {
 			log.Error().Err(err).Msg("Failed to load jobs from kvstore, starting with empty scheduler")
 		}
 		log.Info().Msgf("Scheduler manager initialized with %d jobs", len(schedulerManager.jobs))
+		go schedulerManager.syncLoop()
 	})
 	return schedulerManager
 }
@@ -150,11 +190,13 @@ func (sm *SchedulerManager) saveJobToStore(job *ScheduledJob) error {
 		CreatedAt:           job.CreatedAt,
 		IntervalSeconds:     job.IntervalSeconds,
 		ExecutionTimeout:    job.ExecutionTimeout,
+		JitterSeconds:       job.JitterSeconds,
 		Enabled:             job.Enabled,
-		ConnectionName:      job.ConnectionName,
-		InfraNamePrefix:     job.InfraNamePrefix,
-		Option:              job.Option,
-		InfraFlag:           job.InfraFlag,
+		CronExpression:      job.CronExpression,
+		TimeZone:            job.TimeZone,
+		ExcludeDates:        job.ExcludeDates,
+		Payload:             job.Payload,
+		UpdatedAt:           job.UpdatedAt,
 		Status:              job.Status,
 		LastExecutedAt:      job.LastExecutedAt,
 		NextExecutionAt:     job.NextExecutionAt,
@@ -189,14 +231,14 @@ func (sm *SchedulerManager) loadJobsFromStore() error {
 
 	recoveredCount := 0
 	for _, kv := range keyValues {
-		var job ScheduledJob
-		if err := json.Unmarshal([]byte(kv.Value), &job); err != nil {
-			log.Error().Err(err).Str("key", kv.Key).Msg("Failed to unmarshal job, skipping")
+		job, err := decodeStoredJob(kv)
+		if err != nil {
+			log.Error().Err(err).Str("key", kv.Key).Msg("Failed to decode job, skipping")
 			continue
 		}
 
 		// Recover job based on its previous status
-		if err := sm.recoverJob(&job); err != nil {
+		if err := sm.recoverJob(job); err != nil {
 			log.Error().Err(err).Str("jobId", job.JobId).Msg("Failed to recover job")
 			continue
 		}
@@ -208,6 +250,189 @@ func (sm *SchedulerManager) loadJobsFromStore() error {
 	return nil
 }
 
+// decodeStoredJob decodes a job record of the kvstore
+func decodeStoredJob(kv kvstore.KeyValue) (*ScheduledJob, error) {
+	job := &ScheduledJob{}
+	if err := json.Unmarshal([]byte(kv.Value), job); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal job: %w", err)
+	}
+	if len(job.Payload) == 0 {
+		// Stored before jobs carried a payload: parameters are inline in the record
+		payload, err := legacyJobPayload(job.JobType, []byte(kv.Value))
+		if err != nil {
+			return nil, fmt.Errorf("failed to migrate job parameters: %w", err)
+		}
+		job.Payload = payload
+	}
+	return job, nil
+}
+
+// updateStoredJob applies update to the stored record of a job. Replicas own different
+// parts of a job (any replica its settings, the leader its execution status), so each one
+// writes its part over the current record instead of replacing it. A job deleted in the
+// meantime is not written back.
+func updateStoredJob(jobId string, update func(stored *ScheduledJob)) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err := kvstore.UpdateWithRetry(ctx, genJobKey(jobId), func(current string, exists bool) (string, bool, error) {
+		if !exists {
+			return "", false, nil
+		}
+		stored := &ScheduledJob{}
+		if err := json.Unmarshal([]byte(current), stored); err != nil {
+			return "", false, fmt.Errorf("failed to unmarshal stored job: %w", err)
+		}
+		update(stored)
+		val, err := json.Marshal(stored)
+		if err != nil {
+			return "", false, fmt.Errorf("failed to marshal job: %w", err)
+		}
+		return string(val), true, nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store job to kvstore: %w", err)
+	}
+	return nil
+}
+
+// saveJobConfigToStore persists the settings of a job. The caller holds job.mu.
+func (sm *SchedulerManager) saveJobConfigToStore(job *ScheduledJob) error {
+	return updateStoredJob(job.JobId, func(stored *ScheduledJob) {
+		copyJobConfig(stored, job)
+	})
+}
+
+// saveJobStatusToStore persists the execution status of a job
+func (sm *SchedulerManager) saveJobStatusToStore(job *ScheduledJob) error {
+	job.mu.RLock()
+	defer job.mu.RUnlock()
+	return updateStoredJob(job.JobId, func(stored *ScheduledJob) {
+		if job.AutoDisabled && !stored.AutoDisabled {
+			stored.Enabled = false
+		}
+		if len(stored.Payload) == 0 {
+			stored.Payload = job.Payload
+		}
+		copyJobStatus(stored, job)
+	})
+}
+
+// copyJobConfig copies the settings of src that can change after creation to dst
+func copyJobConfig(dst *ScheduledJob, src *ScheduledJob) {
+	dst.IntervalSeconds = src.IntervalSeconds
+	dst.JitterSeconds = src.JitterSeconds
+	dst.Enabled = src.Enabled
+	dst.CronExpression = src.CronExpression
+	dst.TimeZone = src.TimeZone
+	dst.ExcludeDates = append([]string(nil), src.ExcludeDates...)
+	dst.UpdatedAt = src.UpdatedAt
+}
+
+// copyJobStatus copies the execution status of src to dst
+func copyJobStatus(dst *ScheduledJob, src *ScheduledJob) {
+	dst.Status = src.Status
+	dst.LastExecutedAt = src.LastExecutedAt
+	dst.NextExecutionAt = src.NextExecutionAt
+	dst.ExecutionCount = src.ExecutionCount
+	dst.SuccessCount = src.SuccessCount
+	dst.FailureCount = src.FailureCount
+	dst.ConsecutiveFailures = src.ConsecutiveFailures
+	dst.LastError = src.LastError
+	dst.LastResult = src.LastResult
+	dst.AutoDisabled = src.AutoDisabled
+}
+
+// syncLoop keeps the jobs of this replica in line with the kvstore, where the other
+// replicas create, change and delete jobs.
+func (sm *SchedulerManager) syncLoop() {
+	ticker := time.NewTicker(schedulerSyncInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := sm.syncJobsFromStore(); err != nil {
+			log.Warn().Err(err).Msg("Failed to sync scheduled jobs from kvstore")
+		}
+	}
+}
+
+// syncJobsFromStore starts the jobs created through other replicas, stops the ones deleted
+// through them and applies newer settings. Followers also mirror the status the leader writes.
+func (sm *SchedulerManager) syncJobsFromStore() error {
+	keyPrefix := keyScheduledJob + "/"
+	keyValues, err := kvstore.GetKvList(keyPrefix)
+	if err != nil {
+		return fmt.Errorf("failed to list jobs from kvstore: %w", err)
+	}
+	leader := common.IsLeader()
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	stored := make(map[string]bool, len(keyValues))
+	for _, kv := range keyValues {
+		jobId := strings.TrimPrefix(kv.Key, keyPrefix)
+		stored[jobId] = true
+		storedJob, err := decodeStoredJob(kv)
+		if err != nil {
+			log.Debug().Err(err).Str("key", kv.Key).Msg("Skipping undecodable job record")
+			continue
+		}
+		if job, exists := sm.jobs[jobId]; exists {
+			job.syncFrom(storedJob, leader)
+			continue
+		}
+		sm.adoptJob(storedJob)
+	}
+
+	for jobId, job := range sm.jobs {
+		if !stored[jobId] {
+			job.stop()
+			delete(sm.jobs, jobId)
+			log.Info().Msgf("Removed scheduled job %s deleted through another replica", jobId)
+		}
+	}
+	return nil
+}
+
+// adoptJob starts a job created through another replica. sm.mu must be held.
+func (sm *SchedulerManager) adoptJob(job *ScheduledJob) {
+	ctx, cancel := context.WithCancel(context.Background())
+	job.ctx = ctx
+	job.cancelFunc = cancel
+	job.reschedule = make(chan struct{}, 1)
+	sm.jobs[job.JobId] = job
+
+	if job.Enabled {
+		go job.start()
+	}
+	log.Info().Str("jobId", job.JobId).Bool("enabled", job.Enabled).Msg("Adopted scheduled job created through another replica")
+}
+
+// syncFrom applies the stored record of the job: the settings changed through another
+// replica and, unless this replica leads, the status written by the leader.
+func (job *ScheduledJob) syncFrom(stored *ScheduledJob, leader bool) {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+
+	if !leader || stored.UpdatedAt.After(job.UpdatedAt) {
+		intervalChanged := stored.IntervalSeconds != job.IntervalSeconds
+		scheduleChanged := stored.CronExpression != job.CronExpression || stored.TimeZone != job.TimeZone ||
+			!slices.Equal(stored.ExcludeDates, job.ExcludeDates)
+		copyJobConfig(job, stored)
+		if intervalChanged && job.ticker != nil && job.IntervalSeconds > 0 {
+			job.ticker.Reset(time.Duration(job.IntervalSeconds) * time.Second)
+		}
+		if scheduleChanged {
+			select {
+			case job.reschedule <- struct{}{}:
+			default:
+			}
+		}
+	}
+	if !leader {
+		copyJobStatus(job, stored)
+	}
+}
+
 // recoverJob handles job recovery logic based on previous state
 func (sm *SchedulerManager) recoverJob(job *ScheduledJob) error {
 	// Check if job was in Executing state - could be interrupted or stuck
@@ -247,6 +472,7 @@ func (sm *SchedulerManager) recoverJob(job *ScheduledJob) error {
 	ctx, cancel := context.WithCancel(context.Background())
 	job.ctx = ctx
 	job.cancelFunc = cancel
+	job.reschedule = make(chan struct{}, 1)
 
 	// Store recovered job
 	sm.jobs[job.JobId] = job
@@ -275,20 +501,35 @@ func (sm *SchedulerManager) deleteJobFromStore(jobId string) error {
 	return nil
 }
 
-// findDuplicateJob checks if a job with same configuration already exists
-func (sm *SchedulerManager) findDuplicateJob(req model.ScheduleJobRequest) (*ScheduledJob, bool) {
+// legacyJobPayload builds the payload of a built-in job type from parameters given inline,
+// as in job requests and stored jobs that predate payloads.
+func legacyJobPayload(jobType JobType, inline []byte) (json.RawMessage, error) {
+	var fields struct {
+		model.RegisterCspResourcesJobPayload
+		model.PowerActionJobPayload
+	}
+	if err := json.Unmarshal(inline, &fields); err != nil {
+		return nil, err
+	}
+	switch jobType {
+	case JobTypeRegisterCspResources, JobTypeRegisterCspResourcesAll:
+		return encodeJobPayload(fields.RegisterCspResourcesJobPayload)
+	case JobTypeInfraAction, JobTypeNodeGroupAction:
+		return encodeJobPayload(fields.PowerActionJobPayload)
+	}
+	return nil, nil
+}
+
+// findDuplicateJob checks if a job with same configuration already exists.
+// payload is the normalized payload of the requested job.
+func (sm *SchedulerManager) findDuplicateJob(req model.ScheduleJobRequest, payload json.RawMessage) (*ScheduledJob, bool) {
 	for _, job := range sm.jobs {
 		// Check if job has same configuration (regardless of jobId)
-		// Support both old (ConnectionName) and new (Provider/Region/Zone) fields
 		if job.NsId == req.NsId &&
 			string(job.JobType) == req.JobType &&
-			job.ConnectionName == req.ConnectionName &&
-			job.Provider == req.Provider &&
-			job.Region == req.Region &&
-			job.Zone == req.Zone &&
-			job.InfraNamePrefix == req.InfraNamePrefix &&
-			job.Option == req.Option &&
-			job.InfraFlag == req.InfraFlag {
+			job.CronExpression == req.CronExpression &&
+			job.TimeZone == req.TimeZone &&
+			bytes.Equal(job.Payload, payload) {
 			return job, true
 		}
 	}
@@ -300,30 +541,66 @@ func (sm *SchedulerManager) CreateScheduledJob(req model.ScheduleJobRequest) (*S
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
+	jobType, ok := getJobType(JobType(req.JobType))
+	if !ok {
+		return nil, fmt.Errorf("unknown job type: %s (registered: %s)", req.JobType, strings.Join(ListJobTypes(), ", "))
+	}
+
+	// Validate the job parameters early (before job creation)
+	payload := req.Payload
+	if len(payload) == 0 {
+		inline, err := json.Marshal(req)
+		if err != nil {
+			return nil, err
+		}
+		if payload, err = legacyJobPayload(JobType(req.JobType), inline); err != nil {
+			return nil, err
+		}
+	}
+	payload, err := jobType.Validate(req.NsId, payload)
+	if err != nil {
+		return nil, err
+	}
+
 	// Check for duplicate job configuration
-	if existingJob, isDuplicate := sm.findDuplicateJob(req); isDuplicate {
-		return nil, fmt.Errorf("duplicate job already exists: %s (jobType=%s, nsId=%s, connectionName=%s, provider=%s, region=%s, zone=%s, infraNamePrefix=%s, option=%s, infraFlag=%s)",
+	if existingJob, isDuplicate := sm.findDuplicateJob(req, payload); isDuplicate {
+		return nil, fmt.Errorf("duplicate job already exists: %s (jobType=%s, nsId=%s, cronExpression=%s, timeZone=%s, payload=%s)",
 			existingJob.JobId, existingJob.JobType, existingJob.NsId,
-			existingJob.ConnectionName, existingJob.Provider, existingJob.Region, existingJob.Zone,
-			existingJob.InfraNamePrefix, existingJob.Option, existingJob.InfraFlag)
+			existingJob.CronExpression, existingJob.TimeZone, string(existingJob.Payload))
 	}
 
 	minimumInterval := 10
 
 	// Validate input
-	if req.IntervalSeconds < minimumInterval {
-		return nil, fmt.Errorf("interval must be at least %d seconds", minimumInterval)
-	}
-
-	// Validate option parameters early (before job creation)
-	if req.JobType == "registerCspResources" || req.JobType == "registerCspResourcesAll" {
-		if _, err := getValidatedOptionMap(req.Option); err != nil {
+	if req.CronExpression != "" {
+		if _, _, err := parseJobSchedule(req.CronExpression, req.TimeZone); err != nil {
 			return nil, err
 		}
+		if err := validateExcludeDates(req.ExcludeDates); err != nil {
+			return nil, err
+		}
+	} else {
+		if jobType.RequireCron {
+			return nil, fmt.Errorf("%s jobs require cronExpression", req.JobType)
+		}
+		if req.TimeZone != "" || len(req.ExcludeDates) > 0 {
+			return nil, fmt.Errorf("timeZone and excludeDates require cronExpression")
+		}
+		if req.IntervalSeconds < minimumInterval {
+			return nil, fmt.Errorf("interval must be at least %d seconds", minimumInterval)
+		}
+	}
+	if req.JitterSeconds < 0 {
+		return nil, fmt.Errorf("jitterSeconds must not be negative")
 	}
 
 	// Generate job ID
 	jobId := fmt.Sprintf("%s-%s-%d", req.JobType, req.NsId, time.Now().Unix())
+	if _, taken, _ := kvstore.Get(genJobKey(jobId)); taken || sm.jobs[jobId] != nil {
+		// Jobs of a type are often created together (e.g. a suspend and a resume schedule),
+		// possibly through different replicas
+		jobId = fmt.Sprintf("%s-%s-%d", req.JobType, req.NsId, time.Now().UnixNano())
+	}
 
 	// Check if job already exists
 	if _, exists := sm.jobs[jobId]; exists {
@@ -339,18 +616,26 @@ func (sm *SchedulerManager) CreateScheduledJob(req model.ScheduleJobRequest) (*S
 		NsId:            req.NsId,
 		CreatedAt:       now,
 		IntervalSeconds: req.IntervalSeconds,
+		JitterSeconds:   req.JitterSeconds,
 		Enabled:         true,
-		ConnectionName:  req.ConnectionName,
-		Provider:        req.Provider,
-		Region:          req.Region,
-		Zone:            req.Zone,
-		InfraNamePrefix: req.InfraNamePrefix,
-		Option:          req.Option,
-		InfraFlag:       req.InfraFlag,
+		CronExpression:  req.CronExpression,
+		TimeZone:        req.TimeZone,
+		ExcludeDates:    req.ExcludeDates,
+		Payload:         payload,
+		UpdatedAt:       now,
 		Status:          JobStatusScheduled,
 		NextExecutionAt: now.Add(time.Duration(req.IntervalSeconds) * time.Second),
 		ctx:             ctx,
 		cancelFunc:      cancel,
+		reschedule:      make(chan struct{}, 1),
+	}
+	if job.CronExpression != "" {
+		next, err := job.nextCronRun(now)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		job.NextExecutionAt = next
 	}
 
 	// Store job in memory
@@ -367,8 +652,13 @@ func (sm *SchedulerManager) CreateScheduledJob(req model.ScheduleJobRequest) (*S
 	// Start job execution
 	go job.start()
 
-	log.Info().Msgf("Created scheduled job: %s (type: %s, interval: %ds, next execution: %s)",
-		jobId, req.JobType, req.IntervalSeconds, job.NextExecutionAt.Format(time.RFC3339))
+	if job.CronExpression != "" {
+		log.Info().Msgf("Created scheduled job: %s (type: %s, cron: %q, timeZone: %s, next execution: %s)",
+			jobId, req.JobType, job.CronExpression, job.TimeZone, job.NextExecutionAt.Format(time.RFC3339))
+	} else {
+		log.Info().Msgf("Created scheduled job: %s (type: %s, interval: %ds, next execution: %s)",
+			jobId, req.JobType, req.IntervalSeconds, job.NextExecutionAt.Format(time.RFC3339))
+	}
 
 	return job, nil
 }
@@ -417,6 +707,9 @@ func (sm *SchedulerManager) StopScheduledJob(jobId string) error {
 	if err := sm.deleteJobFromStore(jobId); err != nil {
 		log.Error().Err(err).Str("jobId", jobId).Msg("Failed to delete job from kvstore, continuing with memory cleanup")
 	}
+	if err := deleteJobExecutions(jobId); err != nil {
+		log.Error().Err(err).Str("jobId", jobId).Msg("Failed to delete job execution records")
+	}
 
 	// Remove from memory
 	delete(sm.jobs, jobId)
@@ -457,6 +750,9 @@ func (sm *SchedulerManager) StopAllScheduledJobs() (int, error) {
 			log.Error().Err(err).Str("jobId", jobId).Msg("Failed to delete job from kvstore, continuing with cleanup")
 			lastErr = err
 		}
+		if err := deleteJobExecutions(jobId); err != nil {
+			log.Error().Err(err).Str("jobId", jobId).Msg("Failed to delete job execution records")
+		}
 
 		// Remove from memory
 		delete(sm.jobs, jobId)
@@ -483,6 +779,44 @@ func (sm *SchedulerManager) UpdateScheduledJob(jobId string, req model.UpdateSch
 	job.mu.Lock()
 	defer job.mu.Unlock()
 
+	// Validate the schedule changes before applying any of them
+	scheduleChanged := req.CronExpression != nil || req.TimeZone != nil || req.ExcludeDates != nil
+	if job.CronExpression != "" && req.IntervalSeconds != nil {
+		return nil, fmt.Errorf("job %s runs on a cron schedule; update cronExpression instead of intervalSeconds", jobId)
+	}
+	if scheduleChanged {
+		if job.CronExpression == "" {
+			return nil, fmt.Errorf("job %s runs on an interval; cronExpression, timeZone and excludeDates do not apply", jobId)
+		}
+		cronExpression, timeZone, excludeDates := job.CronExpression, job.TimeZone, job.ExcludeDates
+		if req.CronExpression != nil {
+			cronExpression = *req.CronExpression
+		}
+		if req.TimeZone != nil {
+			timeZone = *req.TimeZone
+		}
+		if req.ExcludeDates != nil {
+			excludeDates = *req.ExcludeDates
+		}
+		if _, _, err := parseJobSchedule(cronExpression, timeZone); err != nil {
+			return nil, err
+		}
+		if err := validateExcludeDates(excludeDates); err != nil {
+			return nil, err
+		}
+		job.CronExpression, job.TimeZone, job.ExcludeDates = cronExpression, timeZone, excludeDates
+		if next, err := job.nextCronRun(time.Now()); err == nil {
+			job.NextExecutionAt = next
+		}
+		// Wake the job up so it waits for the new schedule
+		select {
+		case job.reschedule <- struct{}{}:
+		default:
+		}
+		log.Info().Msgf("Updated job %s schedule to cron %q (timeZone: %s, excluded dates: %d)",
+			jobId, job.CronExpression, job.TimeZone, len(job.ExcludeDates))
+	}
+
 	// Update interval if provided
 	if req.IntervalSeconds != nil && *req.IntervalSeconds >= 60 {
 		job.IntervalSeconds = *req.IntervalSeconds
@@ -493,6 +827,12 @@ func (sm *SchedulerManager) UpdateScheduledJob(jobId string, req model.UpdateSch
 		log.Info().Msgf("Updated job %s interval to %ds", jobId, job.IntervalSeconds)
 	}
 
+	// Update jitter if provided
+	if req.JitterSeconds != nil && *req.JitterSeconds >= 0 {
+		job.JitterSeconds = *req.JitterSeconds
+		log.Info().Msgf("Updated job %s jitter to %ds", jobId, job.JitterSeconds)
+	}
+
 	// Update enabled status if provided
 	if req.Enabled != nil {
 		job.Enabled = *req.Enabled
@@ -500,7 +840,8 @@ func (sm *SchedulerManager) UpdateScheduledJob(jobId string, req model.UpdateSch
 	}
 
 	// Persist updated job to kvstore
-	if err := sm.saveJobToStore(job); err != nil {
+	job.UpdatedAt = time.Now()
+	if err := sm.saveJobConfigToStore(job); err != nil {
 		log.Error().Err(err).Str("jobId", jobId).Msg("Failed to persist job update")
 		return nil, fmt.Errorf("failed to persist job update: %w", err)
 	}
@@ -510,6 +851,11 @@ func (sm *SchedulerManager) UpdateScheduledJob(jobId string, req model.UpdateSch
 
 // start begins the scheduled job execution loop
 func (job *ScheduledJob) start() {
+	if job.CronExpression != "" {
+		job.startCron()
+		return
+	}
+
 	log.Info().Msgf("Starting scheduled job: %s (next execution: %s)",
 		job.JobId, job.NextExecutionAt.Format(time.RFC3339))
 
@@ -532,6 +878,10 @@ func (job *ScheduledJob) start() {
 
 		case <-job.ticker.C:
 			if job.Enabled {
+				if !job.waitJitter() {
+					log.Info().Msgf("Scheduled job stopped: %s", job.JobId)
+					return
+				}
 				job.execute()
 			} else {
 				log.Debug().Msgf("Job %s is disabled, skipping execution", job.JobId)
@@ -545,6 +895,134 @@ func (job *ScheduledJob) start() {
 	}
 }
 
+// startCron runs the job at the times of its cron expression, skipping excluded dates.
+// Unlike interval jobs, cron jobs do not execute on start: a power action must not fire
+// just because the job was created or the server restarted.
+func (job *ScheduledJob) startCron() {
+	job.mu.Lock()
+	job.Status = JobStatusScheduled
+	job.mu.Unlock()
+
+	for {
+		job.mu.Lock()
+		next, err := job.nextCronRun(time.Now())
+		if err == nil {
+			job.NextExecutionAt = next
+		}
+		job.mu.Unlock()
+
+		if err != nil {
+			log.Error().Err(err).Str("jobId", job.JobId).Msg("Cron job has no next execution, waiting for a schedule update")
+			select {
+			case <-job.ctx.Done():
+				log.Info().Msgf("Scheduled job stopped: %s", job.JobId)
+				return
+			case <-job.reschedule:
+				continue
+			}
+		}
+
+		log.Info().Msgf("Cron job %s waiting for next execution: %s", job.JobId, next.Format(time.RFC3339))
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-job.ctx.Done():
+			timer.Stop()
+			log.Info().Msgf("Scheduled job stopped: %s", job.JobId)
+			return
+
+		case <-job.reschedule:
+			timer.Stop()
+
+		case <-timer.C:
+			if job.Enabled {
+				if !job.waitJitter() {
+					log.Info().Msgf("Scheduled job stopped: %s", job.JobId)
+					return
+				}
+				job.execute()
+			} else {
+				log.Debug().Msgf("Job %s is disabled, skipping execution", job.JobId)
+			}
+		}
+	}
+}
+
+// waitJitter delays a scheduled execution by a random part of JitterSeconds, so that jobs
+// due at the same time do not hit the CSPs at once. It returns false if the job was stopped.
+func (job *ScheduledJob) waitJitter() bool {
+	if job.JitterSeconds <= 0 {
+		return true
+	}
+	delay := time.Duration(rand.Int63n(int64(job.JitterSeconds) * int64(time.Second)))
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-job.ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// nextCronRun returns the first time of the cron schedule of the job after the given
+// time that does not fall on an excluded date. The caller holds job.mu.
+func (job *ScheduledJob) nextCronRun(after time.Time) (time.Time, error) {
+	schedule, loc, err := parseJobSchedule(job.CronExpression, job.TimeZone)
+	if err != nil {
+		return time.Time{}, err
+	}
+	excluded := make(map[string]bool, len(job.ExcludeDates))
+	for _, d := range job.ExcludeDates {
+		excluded[d] = true
+	}
+
+	t := after.In(loc)
+	// Each excluded date costs one iteration, so this bounds the dates skipped in a row
+	for i := 0; i < 1000; i++ {
+		t = schedule.Next(t)
+		if t.IsZero() {
+			break
+		}
+		if !excluded[t.Format(excludeDateLayout)] {
+			return t, nil
+		}
+		// Skip the rest of the excluded date
+		y, m, d := t.Date()
+		t = time.Date(y, m, d+1, 0, 0, 0, 0, loc).Add(-time.Second)
+	}
+	return time.Time{}, fmt.Errorf("cron expression %q has no execution outside the excluded dates", job.CronExpression)
+}
+
+// parseJobSchedule parses a cron expression and the time zone it is evaluated in.
+// An empty time zone means the local time of the server.
+func parseJobSchedule(cronExpression string, timeZone string) (cron.Schedule, *time.Location, error) {
+	if strings.HasPrefix(cronExpression, "TZ=") || strings.HasPrefix(cronExpression, "CRON_TZ=") {
+		return nil, nil, fmt.Errorf("set the time zone with timeZone, not inside cronExpression")
+	}
+	schedule, err := cronParser.Parse(cronExpression)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid cronExpression %q: %w", cronExpression, err)
+	}
+	loc := time.Local
+	if timeZone != "" {
+		loc, err = time.LoadLocation(timeZone)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid timeZone %q: %w", timeZone, err)
+		}
+	}
+	return schedule, loc, nil
+}
+
+// validateExcludeDates checks that every excluded date is a YYYY-MM-DD date
+func validateExcludeDates(dates []string) error {
+	for _, d := range dates {
+		if _, err := time.Parse(excludeDateLayout, d); err != nil {
+			return fmt.Errorf("invalid excludeDates entry %q (YYYY-MM-DD expected)", d)
+		}
+	}
+	return nil
+}
+
 // stop halts the scheduled job
 func (job *ScheduledJob) stop() {
 	job.mu.Lock()
@@ -561,8 +1039,14 @@ func (job *ScheduledJob) stop() {
 	log.Info().Msgf("Job stopped: %s", job.JobId)
 }
 
-// execute runs the actual job task with timeout protection
+// execute runs the actual job task with timeout protection.
+// Every replica keeps the schedule of a job, but only the leader executes it.
 func (job *ScheduledJob) execute() {
+	if !common.IsLeader() {
+		log.Debug().Msgf("Skipping job %s: replica %s is not the leader", job.JobId, common.ReplicaId())
+		return
+	}
+
 	// Memory monitoring - capture stats before execution
 	var memBefore, memAfter runtime.MemStats
 	runtime.ReadMemStats(&memBefore)
@@ -615,7 +1099,7 @@ func (job *ScheduledJob) execute() {
 
 			// Persist panic status
 			sm := GetSchedulerManager()
-			if err := sm.saveJobToStore(job); err != nil {
+			if err := sm.saveJobStatusToStore(job); err != nil {
 				log.Error().Err(err).Str("jobId", job.JobId).Msg("Failed to persist panic status")
 			}
 		}
@@ -625,13 +1109,14 @@ func (job *ScheduledJob) execute() {
 	job.mu.Lock()
 	job.Status = JobStatusExecuting
 	job.LastExecutedAt = time.Now()
+	startedAt := job.LastExecutedAt
 	job.ExecutionCount++
 	executionNum := job.ExecutionCount
 	job.mu.Unlock()
 
 	// Persist executing status to kvstore (for crash recovery)
 	sm := GetSchedulerManager()
-	if err := sm.saveJobToStore(job); err != nil {
+	if err := sm.saveJobStatusToStore(job); err != nil {
 		log.Error().Err(err).Str("jobId", job.JobId).Msg("Failed to persist executing status")
 	}
 
@@ -674,95 +1159,10 @@ func (job *ScheduledJob) execute() {
 		var result any
 		var err error
 
-		// Execute based on job type
-		switch job.JobType {
-		case JobTypeRegisterCspResources:
-			// Determine connection names to process
-			var connectionNames []string
-
-			// Priority 1: Use Provider/Region/Zone if provided
-			if job.Provider != "" || job.Region != "" || job.Zone != "" {
-				log.Info().Msgf("Job %s: Filtering connections by Provider=%s, Region=%s, Zone=%s",
-					job.JobId, job.Provider, job.Region, job.Zone)
-				connectionNames, err = common.GetConnConfigListByProviderRegionZone(job.Provider, job.Region, job.Zone)
-				if err != nil {
-					break
-				}
-				if len(connectionNames) == 0 {
-					err = fmt.Errorf("no connections found matching Provider=%s, Region=%s, Zone=%s",
-						job.Provider, job.Region, job.Zone)
-					break
-				}
-				log.Info().Msgf("Job %s: Found %d matching connections", job.JobId, len(connectionNames))
-			} else if job.ConnectionName != "" {
-				// Priority 2: Use ConnectionName (backward compatibility)
-				connectionNames = []string{job.ConnectionName}
-			} else {
-				// Priority 3: Empty - process all connections
-				result, err = RegisterCspNativeResourcesAll(
-					context.Background(),
-					job.NsId,
-					job.InfraNamePrefix,
-					job.Option,
-					job.InfraFlag,
-				)
-				break
-			}
-
-			// Process single connection
-			if len(connectionNames) == 1 {
-				result, err = RegisterCspNativeResources(
-					context.Background(),
-					job.NsId,
-					connectionNames[0],
-					job.InfraNamePrefix,
-					job.Option,
-					job.InfraFlag,
-				)
-			} else {
-				// Process multiple connections in parallel (same logic as RegisterCspNativeResourcesAll)
-				connConfigs := make([]model.ConnConfig, 0, len(connectionNames))
-				var skippedConns []string
-				for _, connName := range connectionNames {
-					connConfig, connErr := common.GetConnConfig(connName)
-					if connErr != nil {
-						log.Error().Err(connErr).Msgf("Failed to get ConnConfig for %s, skipping", connName)
-						skippedConns = append(skippedConns, connName)
-						continue
-					}
-					connConfigs = append(connConfigs, connConfig)
-				}
-				if len(skippedConns) > 0 {
-					log.Warn().Strs("skipped", skippedConns).
-						Msgf("Job %s: %d/%d connections skipped due to config lookup failure",
-							job.JobId, len(skippedConns), len(connectionNames))
-				}
-				startTime := time.Now()
-				allResult := registerConnectionsParallel(
-					context.Background(),
-					job.NsId,
-					connConfigs,
-					job.InfraNamePrefix,
-					job.Option,
-					job.InfraFlag,
-				)
-				allResult.ElapsedTime = int(math.Round(time.Since(startTime).Seconds()))
-				// Reflect skipped connections in the totals so callers see the true picture.
-				allResult.RegisteredConnection += len(skippedConns)
-				// Each skipped connection is counted as unavailable (already excluded from AvailableConnection).
-				result = allResult
-			}
-
-		case JobTypeRegisterCspResourcesAll:
-			result, err = RegisterCspNativeResourcesAll(
-				context.Background(),
-				job.NsId,
-				job.InfraNamePrefix,
-				job.Option,
-				job.InfraFlag,
-			)
-
-		default:
+		// Execute with the handlers of the job type
+		if jobType, ok := getJobType(job.JobType); ok {
+			result, err = jobType.run(ctx, job.JobId, job.NsId, job.Payload)
+		} else {
 			err = fmt.Errorf("unknown job type: %s", job.JobType)
 		}
 
@@ -841,10 +1241,28 @@ func (job *ScheduledJob) execute() {
 			Msgf("Job %s execution #%d completed successfully", job.JobId, executionNum)
 	}
 	job.Status = JobStatusScheduled
+
+	rec := model.ScheduleJobExecution{
+		JobId:           job.JobId,
+		JobType:         string(job.JobType),
+		NsId:            job.NsId,
+		ExecutionNumber: executionNum,
+		StartedAt:       startedAt,
+		FinishedAt:      time.Now(),
+		Success:         execResult.err == nil,
+		Result:          job.LastResult,
+		Error:           job.LastError,
+		Output:          execResult.result,
+	}
+	if msg, ok := execResult.result.(string); ok && msg != "" {
+		rec.Result = msg
+	}
 	job.mu.Unlock()
 
+	putJobExecution(rec)
+
 	// Persist completion status to kvstore
-	if err := sm.saveJobToStore(job); err != nil {
+	if err := sm.saveJobStatusToStore(job); err != nil {
 		log.Error().Err(err).Str("jobId", job.JobId).Msg("Failed to persist completion status")
 	}
 
@@ -854,12 +1272,34 @@ func (job *ScheduledJob) execute() {
 	}
 }
 
-// GetStatus returns the current status of the job (thread-safe)
+// GetStatus returns the current status of the job (thread-safe), with the latest
+// execution records as its run history
 func (job *ScheduledJob) GetStatus() model.ScheduleJobStatus {
+	status := job.getStatus()
+
+	executions, err := ListJobExecutions(status.JobId)
+	if err != nil {
+		log.Debug().Err(err).Str("jobId", status.JobId).Msg("Failed to read the run history of the job")
+		return status
+	}
+	for _, rec := range executions.Executions[max(0, len(executions.Executions)-maxRunHistory):] {
+		status.RunHistory = append(status.RunHistory, model.ScheduleJobRun{
+			StartedAt:  rec.StartedAt,
+			FinishedAt: rec.FinishedAt,
+			Success:    rec.Success,
+			Result:     rec.Result,
+			Error:      rec.Error,
+		})
+	}
+	return status
+}
+
+// getStatus returns the current status of the job without its run history
+func (job *ScheduledJob) getStatus() model.ScheduleJobStatus {
 	job.mu.RLock()
 	defer job.mu.RUnlock()
 
-	return model.ScheduleJobStatus{
+	status := model.ScheduleJobStatus{
 		JobId:               job.JobId,
 		JobType:             string(job.JobType),
 		NsId:                job.NsId,
@@ -876,12 +1316,124 @@ func (job *ScheduledJob) GetStatus() model.ScheduleJobStatus {
 		AutoDisabled:        job.AutoDisabled,
 		LastError:           job.LastError,
 		LastResult:          job.LastResult,
-		ConnectionName:      job.ConnectionName,
-		Provider:            job.Provider,
-		Region:              job.Region,
-		Zone:                job.Zone,
-		InfraNamePrefix:     job.InfraNamePrefix,
-		Option:              job.Option,
-		InfraFlag:           job.InfraFlag,
+		JitterSeconds:       job.JitterSeconds,
+		CronExpression:      job.CronExpression,
+		TimeZone:            job.TimeZone,
+		ExcludeDates:        append([]string(nil), job.ExcludeDates...),
+		Payload:             job.Payload,
+	}
+
+	// Mirror the parameters of the built-in job types for clients of the inline fields
+	switch job.JobType {
+	case JobTypeRegisterCspResources, JobTypeRegisterCspResourcesAll:
+		_ = json.Unmarshal(job.Payload, &status.RegisterCspResourcesJobPayload)
+	case JobTypeInfraAction, JobTypeNodeGroupAction:
+		_ = json.Unmarshal(job.Payload, &status.PowerActionJobPayload)
+	}
+	return status
+}
+
+// validateRegisterCspResourcesPayload checks the payload of a CSP resource registration job.
+func validateRegisterCspResourcesPayload(nsId string, payload json.RawMessage) (json.RawMessage, error) {
+	p, err := decodeJobPayload[model.RegisterCspResourcesJobPayload](payload)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := getValidatedOptionMap(p.Option); err != nil {
+		return nil, err
+	}
+	return encodeJobPayload(p)
+}
+
+// runRegisterCspResourcesJob registers CSP-native resources of the connections selected by
+// the payload. The registration runs to completion even if the job times out, as an
+// interrupted registration leaves partially registered resources behind.
+func runRegisterCspResourcesJob(_ context.Context, jobId string, nsId string, payload json.RawMessage) (any, error) {
+	p, err := decodeJobPayload[model.RegisterCspResourcesJobPayload](payload)
+	if err != nil {
+		return nil, err
+	}
+
+	// Determine connection names to process
+	var connectionNames []string
+
+	// Priority 1: Use Provider/Region/Zone if provided
+	if p.Provider != "" || p.Region != "" || p.Zone != "" {
+		log.Info().Msgf("Job %s: Filtering connections by Provider=%s, Region=%s, Zone=%s",
+			jobId, p.Provider, p.Region, p.Zone)
+		connectionNames, err = common.GetConnConfigListByProviderRegionZone(p.Provider, p.Region, p.Zone)
+		if err != nil {
+			return nil, err
+		}
+		if len(connectionNames) == 0 {
+			return nil, fmt.Errorf("no connections found matching Provider=%s, Region=%s, Zone=%s",
+				p.Provider, p.Region, p.Zone)
+		}
+		log.Info().Msgf("Job %s: Found %d matching connections", jobId, len(connectionNames))
+	} else if p.ConnectionName != "" {
+		// Priority 2: Use ConnectionName (backward compatibility)
+		connectionNames = []string{p.ConnectionName}
+	} else {
+		// Priority 3: Empty - process all connections
+		return runRegisterCspResourcesAllJob(context.Background(), jobId, nsId, payload)
+	}
+
+	// Process single connection
+	if len(connectionNames) == 1 {
+		return RegisterCspNativeResources(
+			context.Background(),
+			nsId,
+			connectionNames[0],
+			p.InfraNamePrefix,
+			p.Option,
+			p.InfraFlag,
+		)
+	}
+
+	// Process multiple connections in parallel (same logic as RegisterCspNativeResourcesAll)
+	connConfigs := make([]model.ConnConfig, 0, len(connectionNames))
+	var skippedConns []string
+	for _, connName := range connectionNames {
+		connConfig, connErr := common.GetConnConfig(connName)
+		if connErr != nil {
+			log.Error().Err(connErr).Msgf("Failed to get ConnConfig for %s, skipping", connName)
+			skippedConns = append(skippedConns, connName)
+			continue
+		}
+		connConfigs = append(connConfigs, connConfig)
+	}
+	if len(skippedConns) > 0 {
+		log.Warn().Strs("skipped", skippedConns).
+			Msgf("Job %s: %d/%d connections skipped due to config lookup failure",
+				jobId, len(skippedConns), len(connectionNames))
+	}
+	startTime := time.Now()
+	allResult := registerConnectionsParallel(
+		context.Background(),
+		nsId,
+		connConfigs,
+		p.InfraNamePrefix,
+		p.Option,
+		p.InfraFlag,
+	)
+	allResult.ElapsedTime = int(math.Round(time.Since(startTime).Seconds()))
+	// Reflect skipped connections in the totals so callers see the true picture.
+	allResult.RegisteredConnection += len(skippedConns)
+	// Each skipped connection is counted as unavailable (already excluded from AvailableConnection).
+	return allResult, nil
+}
+
+// runRegisterCspResourcesAllJob registers CSP-native resources of all connections.
+func runRegisterCspResourcesAllJob(_ context.Context, _ string, nsId string, payload json.RawMessage) (any, error) {
+	p, err := decodeJobPayload[model.RegisterCspResourcesJobPayload](payload)
+	if err != nil {
+		return nil, err
 	}
+	return RegisterCspNativeResourcesAll(
+		context.Background(),
+		nsId,
+		p.InfraNamePrefix,
+		p.Option,
+		p.InfraFlag,
+	)
 }
@@ -63,7 +63,7 @@ var GlobalAgent = &NodeStatusAgent{
 	workers:  20,
 }
 
-// Start launches the scan loop, worker pool, and batch sweeper.
+// Start launches the scan loop, worker pool, batch sweeper and healing sweeper.
 // Blocks until ctx is cancelled (call in a goroutine).
 func (a *NodeStatusAgent) Start(ctx context.Context) {
 	log.Info().Msg("[NodeStatusAgent] Starting")
@@ -73,6 +73,7 @@ func (a *NodeStatusAgent) Start(ctx context.Context) {
 	}
 
 	go a.startBatchSweeper(ctx)
+	go startHealingSweeper(ctx)
 
 	ticker := time.NewTicker(time.Second)
 	defer ticker.Stop()
@@ -568,13 +569,7 @@ func (a *NodeStatusAgent) StartupScan() {
 // LastUpdated is zero (never freshly fetched from CSP), so IsFresh() returns false
 // until the daemon or a direct API call polls the node and writes through.
 func buildStatusEntry(nsId, infraId string, nodeInfo model.NodeInfo) StatusEntry {
-	providerName := nodeInfo.ConnectionConfig.ProviderName
-	if providerName == "" {
-		// Fallback: extract provider prefix from connection name (e.g. "aws-ap-northeast-2" → "aws")
-		if parts := strings.SplitN(nodeInfo.ConnectionName, "-", 2); len(parts) > 0 {
-			providerName = strings.ToLower(parts[0])
-		}
-	}
+	providerName := nodeProviderName(nodeInfo)
 	priority := priorityForStatus(nodeInfo.Status, nodeInfo.TargetAction)
 	return StatusEntry{
 		Status:           nodeInfo.Status,
@@ -0,0 +1,480 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package infra is to manage multi-cloud infra
+package infra
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/cloud-barista/cb-tumblebug/src/core/common"
+	"github.com/cloud-barista/cb-tumblebug/src/core/model"
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvstore"
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvutil"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/crypto/ssh"
+)
+
+// terminalIdleTimeoutDefault is the idle timeout (minutes) of terminal sessions that do not set one.
+// Override with TB_TERMINAL_IDLE_TIMEOUT_MINUTES.
+var terminalIdleTimeoutDefault = func() int {
+	if v, err := strconv.Atoi(os.Getenv("TB_TERMINAL_IDLE_TIMEOUT_MINUTES")); err == nil && v > 0 {
+		return v
+	}
+	return 15
+}()
+
+// terminalRecordingMaxBytes caps the asciicast stored per session; the value has to fit in
+// a single kvstore entry. Override with TB_TERMINAL_RECORDING_MAX_KB.
+var terminalRecordingMaxBytes = func() int {
+	if v, err := strconv.Atoi(os.Getenv("TB_TERMINAL_RECORDING_MAX_KB")); err == nil && v > 0 {
+		return v << 10
+	}
+	return 1 << 20
+}()
+
+const terminalIdleTimeoutMax = 240
+
+// NodeTerminal is an interactive PTY session on a Node. Read returns the terminal output
+// (io.EOF once the remote shell exits) and Write sends input; Close ends the session and
+// stores its recording.
+type NodeTerminal struct {
+	info     model.TerminalRecordingInfo
+	idle     time.Duration
+	bastion  *ssh.Client // nil for a direct connection
+	client   *ssh.Client
+	session  *ssh.Session
+	stdin    io.WriteCloser
+	stdout   io.Reader
+	recorder *terminalRecorder
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// OpenNodeTerminal opens a PTY session on a Node with the stored SSH key of the Node,
+// through the bastion chosen for it (or directly when the Node is its own bastion).
+func OpenNodeTerminal(nsId string, infraId string, nodeId string, req *model.TerminalReq, clientIp string) (*NodeTerminal, error) {
+	if req.Cols < 0 || req.Rows < 0 || req.IdleTimeoutMinutes < 0 {
+		return nil, fmt.Errorf("cols, rows and idleTimeoutMinutes must not be negative")
+	}
+	if req.IdleTimeoutMinutes > terminalIdleTimeoutMax {
+		return nil, fmt.Errorf("idleTimeoutMinutes must not exceed %d", terminalIdleTimeoutMax)
+	}
+	cols, rows, term := req.Cols, req.Rows, req.Term
+	if cols == 0 {
+		cols = 80
+	}
+	if rows == 0 {
+		rows = 24
+	}
+	if term == "" {
+		term = "xterm-256color"
+	}
+	idle := req.IdleTimeoutMinutes
+	if idle == 0 {
+		idle = terminalIdleTimeoutDefault
+	}
+
+	nodeInfo, err := GetNodeObject(nsId, infraId, nodeId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Node status: %v", err)
+	}
+	if nodeInfo.Status != model.StatusRunning {
+		return nil, fmt.Errorf("Node '%s' is in '%s' status (not Running). Please change the Node status to Running and try again", nodeId, nodeInfo.Status)
+	}
+
+	bastion, client, userName, err := dialNodeForTerminal(nsId, infraId, nodeId, req.UserName)
+	if err != nil {
+		return nil, err
+	}
+	t := &NodeTerminal{
+		info: model.TerminalRecordingInfo{
+			SessionId: common.GenUid(),
+			NsId:      nsId,
+			InfraId:   infraId,
+			NodeId:    nodeId,
+			UserName:  userName,
+			ClientIp:  clientIp,
+			StartedAt: time.Now().UTC().Format(time.RFC3339),
+		},
+		idle:    time.Duration(idle) * time.Minute,
+		bastion: bastion,
+		client:  client,
+	}
+	fail := func(format string, err error) (*NodeTerminal, error) {
+		t.closeClients()
+		return nil, fmt.Errorf(format, err)
+	}
+
+	if t.session, err = client.NewSession(); err != nil {
+		return fail("failed to create SSH session: %v", err)
+	}
+	if t.stdin, err = t.session.StdinPipe(); err != nil {
+		return fail("failed to set up stdin: %v", err)
+	}
+	if t.stdout, err = t.session.StdoutPipe(); err != nil {
+		return fail("failed to set up stdout: %v", err)
+	}
+	modes := ssh.TerminalModes{ssh.ECHO: 1, ssh.TTY_OP_ISPEED: 14400, ssh.TTY_OP_OSPEED: 14400}
+	if err := t.session.RequestPty(term, rows, cols, modes); err != nil {
+		return fail("failed to request a PTY: %v", err)
+	}
+	if err := t.session.Shell(); err != nil {
+		return fail("failed to start the shell: %v", err)
+	}
+	if req.Record {
+		t.recorder = newTerminalRecorder(cols, rows, term, fmt.Sprintf("%s/%s/%s", nsId, infraId, nodeId))
+	}
+
+	log.Info().
+		Str("sessionId", t.info.SessionId).
+		Str("nodeId", nodeId).
+		Str("userName", userName).
+		Str("clientIp", clientIp).
+		Bool("record", req.Record).
+		Msg("Terminal session opened")
+	return t, nil
+}
+
+// SessionId returns the ID of the session, which is also the ID of its recording
+func (t *NodeTerminal) SessionId() string {
+	return t.info.SessionId
+}
+
+// IdleTimeout returns how long the session may go without input
+func (t *NodeTerminal) IdleTimeout() time.Duration {
+	return t.idle
+}
+
+// Read reads the terminal output
+func (t *NodeTerminal) Read(p []byte) (int, error) {
+	n, err := t.stdout.Read(p)
+	if n > 0 && t.recorder != nil {
+		t.recorder.output(p[:n])
+	}
+	return n, err
+}
+
+// Write sends input to the terminal
+func (t *NodeTerminal) Write(p []byte) (int, error) {
+	return t.stdin.Write(p)
+}
+
+// Resize changes the size of the PTY
+func (t *NodeTerminal) Resize(cols int, rows int) error {
+	if cols <= 0 || rows <= 0 {
+		return fmt.Errorf("invalid terminal size %dx%d", cols, rows)
+	}
+	if t.recorder != nil {
+		t.recorder.resize(cols, rows)
+	}
+	return t.session.WindowChange(rows, cols)
+}
+
+// Close ends the session and stores its recording. reason is kept with the recording.
+func (t *NodeTerminal) Close(reason string) error {
+	t.closeOnce.Do(func() {
+		t.session.Close()
+		t.closeClients()
+
+		ended := time.Now().UTC()
+		started, _ := time.Parse(time.RFC3339, t.info.StartedAt)
+		t.info.EndedAt = ended.Format(time.RFC3339)
+		t.info.DurationSeconds = int64(ended.Sub(started).Seconds())
+		t.info.EndReason = reason
+		log.Info().
+			Str("sessionId", t.info.SessionId).
+			Str("nodeId", t.info.NodeId).
+			Int64("durationSeconds", t.info.DurationSeconds).
+			Str("reason", reason).
+			Msg("Terminal session closed")
+
+		if t.recorder != nil {
+			t.closeErr = t.storeRecording()
+		}
+	})
+	return t.closeErr
+}
+
+func (t *NodeTerminal) closeClients() {
+	if t.client != nil {
+		t.client.Close()
+	}
+	if t.bastion != nil {
+		t.bastion.Close()
+	}
+}
+
+// dialNodeForTerminal connects to a Node the way RunRemoteCommandWithContext does: through
+// the usable bastion of the Node, or directly when the Node is its own bastion.
+// It returns the bastion client (nil when direct), the Node client and the SSH user.
+func dialNodeForTerminal(nsId string, infraId string, nodeId string, givenUserName string) (*ssh.Client, *ssh.Client, string, error) {
+	_, targetNodeIP, targetSshPort, err := GetNodeIp(nsId, infraId, nodeId)
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("failed to get Node IP: %v", err)
+	}
+	targetUserName, targetPrivateKey, err := VerifySshUserName(nsId, infraId, nodeId, targetNodeIP, targetSshPort, givenUserName)
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("failed to verify SSH username: %v", err)
+	}
+
+	bastionNodes, err := GetUsableBastionNodes(nsId, infraId, nodeId)
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("failed to get bastion nodes: %v", err)
+	}
+	bastionNode := pickBastion(bastionNodes, nsId, infraId, nodeId)
+	if bastionNode.NodeId == "" {
+		return nil, nil, "", fmt.Errorf("bastion node has empty Node ID")
+	}
+	bastionNsId := bastionNode.NsId
+	if bastionNsId == "" {
+		bastionNsId = nsId
+	}
+	if resolved := resolveTargetIpForBastion(nsId, infraId, nodeId, bastionNode); resolved != "" {
+		targetNodeIP = resolved
+	}
+	bastionIp, _, bastionSshPort, err := GetNodeIp(bastionNsId, bastionNode.InfraId, bastionNode.NodeId)
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("failed to get bastion Node IP and SSH port: %v", err)
+	}
+	if net.ParseIP(bastionIp) == nil {
+		return nil, nil, "", fmt.Errorf("bastion VM (ID: %s) does not have a valid public IP address", bastionNode.NodeId)
+	}
+	bastionEndpoint := fmt.Sprintf("%s:%d", bastionIp, bastionSshPort)
+	isSelfBastion := bastionNsId == nsId && bastionNode.InfraId == infraId && bastionNode.NodeId == nodeId
+
+	targetSigner, err := ssh.ParsePrivateKey([]byte(targetPrivateKey))
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("failed to parse target private key: %v", err)
+	}
+	targetConfig := &ssh.ClientConfig{
+		User:            targetUserName,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(targetSigner)},
+		HostKeyCallback: createTOFUHostKeyCallback(tofuContext{NsId: nsId, InfraId: infraId, NodeId: nodeId}),
+		Timeout:         30 * time.Second,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	acquireBastionSlot(bastionEndpoint)
+	defer releaseBastionSlot(bastionEndpoint)
+
+	if isSelfBastion {
+		client, err := dialSSHWithContext(ctx, "tcp", bastionEndpoint, targetConfig)
+		if err != nil {
+			return nil, nil, "", fmt.Errorf("[target-direct] failed to connect to %s: %v", bastionEndpoint, err)
+		}
+		return nil, client, targetUserName, nil
+	}
+
+	bastionUserName, bastionPrivateKey, err := VerifySshUserName(bastionNsId, bastionNode.InfraId, bastionNode.NodeId, bastionIp, bastionSshPort, "")
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("failed to verify SSH username for bastion: %v", err)
+	}
+	bastionSigner, err := ssh.ParsePrivateKey([]byte(bastionPrivateKey))
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("failed to parse bastion private key: %v", err)
+	}
+	bastionConfig := &ssh.ClientConfig{
+		User:            bastionUserName,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(bastionSigner)},
+		HostKeyCallback: createTOFUHostKeyCallback(tofuContext{NsId: bastionNsId, InfraId: bastionNode.InfraId, NodeId: bastionNode.NodeId}),
+		Timeout:         30 * time.Second,
+	}
+	bastionClient, err := dialSSHWithContext(ctx, "tcp", bastionEndpoint, bastionConfig)
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("[bastion] failed to connect to bastion %s (bastionNodeId=%s): %v", bastionEndpoint, bastionNode.NodeId, err)
+	}
+
+	targetEndpoint := fmt.Sprintf("%s:%d", targetNodeIP, targetSshPort)
+	conn, err := dialTunnelWithContext(ctx, bastionClient, "tcp", targetEndpoint)
+	if err != nil {
+		bastionClient.Close()
+		return nil, nil, "", fmt.Errorf("[target-via-bastion] failed to dial target %s through bastion %s: %v", targetEndpoint, bastionEndpoint, err)
+	}
+	ncc, chans, reqs, err := ssh.NewClientConn(conn, targetEndpoint, targetConfig)
+	if err != nil {
+		conn.Close()
+		bastionClient.Close()
+		return nil, nil, "", fmt.Errorf("failed to create target SSH connection: %v", err)
+	}
+	return bastionClient, ssh.NewClient(ncc, chans, reqs), targetUserName, nil
+}
+
+// terminalRecorder writes the output of a session as an asciicast v2 stream
+type terminalRecorder struct {
+	mu        sync.Mutex
+	buf       bytes.Buffer
+	start     time.Time
+	pending   []byte // incomplete UTF-8 sequence at the end of the last output
+	truncated bool
+}
+
+func newTerminalRecorder(cols int, rows int, term string, title string) *terminalRecorder {
+	r := &terminalRecorder{start: time.Now()}
+	header, _ := json.Marshal(map[string]any{
+		"version":   2,
+		"width":     cols,
+		"height":    rows,
+		"timestamp": r.start.Unix(),
+		"title":     title,
+		"env":       map[string]string{"TERM": term},
+	})
+	r.buf.Write(header)
+	r.buf.WriteByte('\n')
+	return r
+}
+
+// output records terminal output, holding back a trailing partial UTF-8 sequence
+// until the next read completes it
+func (r *terminalRecorder) output(p []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	data := append(r.pending, p...)
+	cut := len(data)
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				cut = i
+			}
+			break
+		}
+	}
+	r.pending = append([]byte(nil), data[cut:]...)
+	if cut > 0 {
+		r.event("o", string(data[:cut]))
+	}
+}
+
+func (r *terminalRecorder) resize(cols int, rows int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.event("r", fmt.Sprintf("%dx%d", cols, rows))
+}
+
+// event appends an event line; must be called with mu held
+func (r *terminalRecorder) event(kind string, data string) {
+	if r.truncated {
+		return
+	}
+	elapsed := math.Round(time.Since(r.start).Seconds()*1e6) / 1e6
+	line, _ := json.Marshal([]any{elapsed, kind, data})
+	if r.buf.Len()+len(line)+1 > terminalRecordingMaxBytes {
+		r.truncated = true
+		return
+	}
+	r.buf.Write(line)
+	r.buf.WriteByte('\n')
+}
+
+func terminalRecordingKey(nsId string, infraId string, nodeId string, sessionId string) string {
+	return fmt.Sprintf("/log/terminal/ns/%s/infra/%s/node/%s/%s", nsId, infraId, nodeId, sessionId)
+}
+
+func terminalCastKey(nsId string, infraId string, nodeId string, sessionId string) string {
+	return fmt.Sprintf("/log/terminalCast/ns/%s/infra/%s/node/%s/%s", nsId, infraId, nodeId, sessionId)
+}
+
+// storeRecording stores the asciicast and the description of a closed session
+func (t *NodeTerminal) storeRecording() error {
+	t.recorder.mu.Lock()
+	cast := append([]byte(nil), t.recorder.buf.Bytes()...)
+	t.info.Truncated = t.recorder.truncated
+	t.recorder.mu.Unlock()
+	t.info.Bytes = len(cast)
+
+	info, err := json.Marshal(t.info)
+	if err != nil {
+		return err
+	}
+	if err := kvstore.Put(terminalCastKey(t.info.NsId, t.info.InfraId, t.info.NodeId, t.info.SessionId), string(cast)); err != nil {
+		log.Error().Err(err).Str("sessionId", t.info.SessionId).Msg("Failed to store the terminal recording")
+		return err
+	}
+	if err := kvstore.Put(terminalRecordingKey(t.info.NsId, t.info.InfraId, t.info.NodeId, t.info.SessionId), string(info)); err != nil {
+		log.Error().Err(err).Str("sessionId", t.info.SessionId).Msg("Failed to store the terminal recording")
+		return err
+	}
+	return nil
+}
+
+// ListTerminalRecording returns the terminal recordings of a Node, newest first
+func ListTerminalRecording(nsId string, infraId string, nodeId string) ([]model.TerminalRecordingInfo, error) {
+	prefix := terminalRecordingKey(nsId, infraId, nodeId, "")
+	kvs, err := kvstore.GetKvList(prefix)
+	if err != nil {
+		return nil, err
+	}
+	kvs = kvutil.FilterKvListBy(kvs, prefix, 1)
+
+	result := []model.TerminalRecordingInfo{}
+	for _, kv := range kvs {
+		var info model.TerminalRecordingInfo
+		if err := json.Unmarshal([]byte(kv.Value), &info); err != nil {
+			log.Warn().Err(err).Str("key", kv.Key).Msg("Skipping an invalid terminal recording")
+			continue
+		}
+		result = append(result, info)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].StartedAt > result[j].StartedAt })
+	return result, nil
+}
+
+// GetTerminalRecording returns the description and the asciicast of a terminal recording
+func GetTerminalRecording(nsId string, infraId string, nodeId string, sessionId string) (model.TerminalRecordingInfo, []byte, error) {
+	var info model.TerminalRecordingInfo
+	kv, exists, err := kvstore.GetKv(terminalRecordingKey(nsId, infraId, nodeId, sessionId))
+	if err != nil {
+		return info, nil, err
+	}
+	if !exists {
+		return info, nil, fmt.Errorf("terminal recording %s of Node %s not found", sessionId, nodeId)
+	}
+	if err := json.Unmarshal([]byte(kv.Value), &info); err != nil {
+		return info, nil, err
+	}
+	cast, _, err := kvstore.GetKv(terminalCastKey(nsId, infraId, nodeId, sessionId))
+	if err != nil {
+		return info, nil, err
+	}
+	return info, []byte(cast.Value), nil
+}
+
+// DeleteTerminalRecording deletes a terminal recording
+func DeleteTerminalRecording(nsId string, infraId string, nodeId string, sessionId string) error {
+	key := terminalRecordingKey(nsId, infraId, nodeId, sessionId)
+	_, exists, err := kvstore.GetKv(key)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("terminal recording %s of Node %s not found", sessionId, nodeId)
+	}
+	if err := kvstore.Delete(terminalCastKey(nsId, infraId, nodeId, sessionId)); err != nil {
+		return err
+	}
+	return kvstore.Delete(key)
+}
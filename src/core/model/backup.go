@@ -0,0 +1,58 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package model is to handle object of CB-Tumblebug
+package model
+
+// BackupFormatVersion is the version of the backup archive layout written by this server
+const BackupFormatVersion = 1
+
+// BackupInfo describes a stored backup archive
+type BackupInfo struct {
+	// Name is the archive name used to restore or delete the backup
+	Name string `json:"name" example:"tumblebug-backup-20260101T000000Z.jsonl.gz"`
+	// Target is the storage the archive is kept in (local or s3)
+	Target    string `json:"target" example:"local"`
+	Size      int64  `json:"size" example:"104857"`
+	CreatedAt string `json:"createdAt" example:"2026-01-01T00:00:00Z"`
+}
+
+// BackupListResponse is the list of stored backups, newest first
+type BackupListResponse struct {
+	Backups []BackupInfo `json:"backups"`
+}
+
+// BackupResult is the outcome of a backup run
+type BackupResult struct {
+	Backup BackupInfo `json:"backup"`
+	// SchemaVersion is the kvstore schema version of the backed-up objects
+	SchemaVersion int `json:"schemaVersion" example:"1"`
+	Entries       int `json:"entries"`
+	Specs         int `json:"specs"`
+	Images        int `json:"images"`
+	// Pruned lists the archives removed by the retention policy after this backup
+	Pruned []string `json:"pruned"`
+}
+
+// BackupRestoreResult is the outcome of a restore
+type BackupRestoreResult struct {
+	Backup string `json:"backup" example:"tumblebug-backup-20260101T000000Z.jsonl.gz"`
+	// NsId is set when a single namespace was restored; empty means the whole instance
+	NsId            string `json:"nsId,omitempty" example:"default"`
+	RestoredEntries int    `json:"restoredEntries"`
+	RestoredLabels  int    `json:"restoredLabels"`
+	RestoredSpecs   int    `json:"restoredSpecs"`
+	RestoredImages  int    `json:"restoredImages"`
+	// Migration is the schema migration applied to restored objects from an older release
+	Migration *SchemaMigrationReport `json:"migration,omitempty"`
+}
@@ -16,6 +16,7 @@ package model
 
 import (
 	"database/sql"
+	"encoding/json"
 	"sync"
 	"time"
 
@@ -32,6 +33,21 @@ type ReadyzResponse struct {
 	Message     string `json:"message" example:"CB-Tumblebug is ready"`
 	Ready       bool   `json:"ready" example:"true"`
 	Initialized bool   `json:"initialized" example:"false"`
+	// ReplicaId is the replica that answered the request
+	ReplicaId string `json:"replicaId" example:"cb-tumblebug-7d9f8c6b5-x2k4p"`
+	// IsLeader tells whether that replica runs the background controllers
+	IsLeader bool `json:"isLeader" example:"true"`
+	// Leader is the replica recorded as leader, if any
+	Leader *LeaderInfo `json:"leader,omitempty"`
+}
+
+// LeaderInfo is the replica that holds the leader lock and runs the background controllers
+type LeaderInfo struct {
+	ReplicaId string `json:"replicaId" example:"cb-tumblebug-7d9f8c6b5-x2k4p"`
+	// Since is when the replica became the leader
+	Since string `json:"since" example:"2026-10-16T09:00:00Z"`
+	// RenewedAt is when the leader last refreshed this record (every 10 seconds)
+	RenewedAt string `json:"renewedAt" example:"2026-10-16T09:30:00Z"`
 }
 
 // ProviderAssetSummary is a provider-level summary of fetched assets.
@@ -61,11 +77,26 @@ type KeyValue struct {
 
 // ScheduleJobRequest is struct for creating a scheduled job
 type ScheduleJobRequest struct {
-	JobType         string `json:"jobType" validate:"required" example:"registerCspResources"` // Job type: registerCspResources, registerCspResourcesAll
-	NsId            string `json:"nsId" validate:"required" example:"default"`                 // Namespace ID
-	IntervalSeconds int    `json:"intervalSeconds" validate:"required,min=10" example:"60"`    // Execution interval in seconds
+	JobType         string `json:"jobType" validate:"required" example:"registerCspResources"`         // Job type: registerCspResources, registerCspResourcesAll, infraAction, nodeGroupAction, remoteCommand, or a type registered by another package
+	NsId            string `json:"nsId" validate:"required" example:"default"`                         // Namespace ID
+	IntervalSeconds int    `json:"intervalSeconds,omitempty" validate:"omitempty,min=10" example:"60"` // Execution interval in seconds. Ignored when CronExpression is set
+	JitterSeconds   int    `json:"jitterSeconds,omitempty" validate:"omitempty,min=0" example:"30"`    // Random delay of up to this many seconds before each scheduled execution, to spread load
+
+	// Calendar schedule (replaces IntervalSeconds when set)
+	CronExpression string   `json:"cronExpression,omitempty" example:"0 20 * * 1-5"` // Standard 5-field cron expression (minute hour day-of-month month day-of-week) or descriptor such as @daily
+	TimeZone       string   `json:"timeZone,omitempty" example:"Asia/Seoul"`         // IANA time zone of CronExpression and ExcludeDates. Empty: server local time
+	ExcludeDates   []string `json:"excludeDates,omitempty" example:"2026-12-25"`     // Dates (YYYY-MM-DD, in TimeZone) on which the job does not run, e.g. holidays
+
+	// Payload holds the parameters of the job type (e.g. RegisterCspResourcesJobPayload, PowerActionJobPayload, RemoteCommandJobPayload)
+	Payload json.RawMessage `json:"payload,omitempty" swaggertype:"object"`
 
-	// Job-specific parameters (for registerCspResources)
+	// (Deprecated) Inline parameters of the built-in job types, used when Payload is empty
+	RegisterCspResourcesJobPayload
+	PowerActionJobPayload
+}
+
+// RegisterCspResourcesJobPayload is the payload of registerCspResources and registerCspResourcesAll jobs
+type RegisterCspResourcesJobPayload struct {
 	ConnectionName  string `json:"connectionName,omitempty" example:"aws-ap-northeast-2"` // (Deprecated) Connection configuration name. Use Provider/Region/Zone instead
 	Provider        string `json:"provider,omitempty" example:"aws"`                      // Cloud provider name. Empty: all providers
 	Region          string `json:"region,omitempty" example:"ap-northeast-2"`             // Region name. Requires Provider. Empty: all regions for the provider
@@ -75,10 +106,77 @@ type ScheduleJobRequest struct {
 	InfraFlag       string `json:"infraFlag,omitempty" example:"y"`                       // Infra flag: y or n
 }
 
+// PowerActionJobPayload is the payload of infraAction and nodeGroupAction jobs
+type PowerActionJobPayload struct {
+	InfraId     string `json:"infraId,omitempty" example:"infra01"` // Target Infra
+	NodeGroupId string `json:"nodeGroupId,omitempty" example:"g1"`  // Target NodeGroup (nodeGroupAction only)
+	Action      string `json:"action,omitempty" example:"suspend" enums:"suspend,resume,reboot"`
+}
+
+// RemoteCommandJobPayload is the payload of remoteCommand jobs. The commands run on the Nodes of
+// InfraId (or of its NodeGroup NodeGroupId); with LabelSelector, on the Nodes matching it, in
+// InfraId or, without InfraId, in every Infra of the namespace.
+type RemoteCommandJobPayload struct {
+	InfraId       string   `json:"infraId,omitempty" example:"infra01"`                // Target Infra. Empty: every Infra with Nodes matching LabelSelector
+	NodeGroupId   string   `json:"nodeGroupId,omitempty" example:"g1"`                 // Target NodeGroup of InfraId. Empty: all NodeGroups
+	LabelSelector string   `json:"labelSelector,omitempty" example:"role=web,env=dev"` // Only the Nodes matching this label selector
+	UserName      string   `json:"userName,omitempty" example:"cb-user"`               // SSH user name. Empty: the verified user of each Node
+	Command       []string `json:"command" example:"sudo logrotate -f /etc/logrotate.conf"`
+	// TimeoutMinutes bounds each run (default: 30, min: 1, max: 120)
+	TimeoutMinutes int `json:"timeoutMinutes,omitempty" example:"30"`
+}
+
+// RemoteCommandJobOutput is the output of one run of a remoteCommand job
+type RemoteCommandJobOutput struct {
+	// XRequestId is the request ID of the run, recorded in the command status of each Node
+	XRequestId  string                       `json:"xRequestId" example:"remoteCommand-default-1698765432-1760000000"`
+	TotalNodes  int                          `json:"totalNodes" example:"3"`
+	FailedNodes int                          `json:"failedNodes" example:"1"`
+	Results     []RemoteCommandJobNodeResult `json:"results"`
+}
+
+// RemoteCommandJobNodeResult is the outcome of a run of a remoteCommand job on one Node
+type RemoteCommandJobNodeResult struct {
+	InfraId       string            `json:"infraId" example:"infra01"`
+	NodeId        string            `json:"nodeId" example:"g1-1"`
+	CommandStatus CommandStatusInfo `json:"commandStatus"`
+	Error         string            `json:"error,omitempty"`
+}
+
+// InfraCmdScheduleReq is struct for scheduling remote commands on Infras, NodeGroups or labeled Nodes
+type InfraCmdScheduleReq struct {
+	RemoteCommandJobPayload
+	CronExpression string   `json:"cronExpression" validate:"required" example:"0 3 * * *"` // Standard 5-field cron expression or descriptor such as @daily
+	TimeZone       string   `json:"timeZone,omitempty" example:"Asia/Seoul"`                // IANA time zone. Empty: server local time
+	ExcludeDates   []string `json:"excludeDates,omitempty" example:"2026-12-25"`            // Dates (YYYY-MM-DD, in TimeZone) on which the commands are skipped
+}
+
+// InfraPowerScheduleReq is struct for scheduling a power action on an Infra or on the Nodes of one of its NodeGroups
+type InfraPowerScheduleReq struct {
+	Action         string   `json:"action" validate:"required" example:"suspend" enums:"suspend,resume,reboot"`
+	NodeGroupId    string   `json:"nodeGroupId,omitempty" example:"g1"`                        // Target NodeGroup. Empty: the whole Infra
+	CronExpression string   `json:"cronExpression" validate:"required" example:"0 20 * * 1-5"` // Standard 5-field cron expression or descriptor such as @daily
+	TimeZone       string   `json:"timeZone,omitempty" example:"Asia/Seoul"`                   // IANA time zone. Empty: server local time
+	ExcludeDates   []string `json:"excludeDates,omitempty" example:"2026-12-25"`               // Dates (YYYY-MM-DD, in TimeZone) on which the action is skipped
+}
+
 // UpdateScheduleJobRequest is struct for updating a scheduled job
 type UpdateScheduleJobRequest struct {
-	IntervalSeconds *int  `json:"intervalSeconds,omitempty" example:"60"` // New execution interval in seconds
-	Enabled         *bool `json:"enabled,omitempty" example:"true"`       // Enable or disable the job
+	IntervalSeconds *int      `json:"intervalSeconds,omitempty" example:"60"`         // New execution interval in seconds
+	Enabled         *bool     `json:"enabled,omitempty" example:"true"`               // Enable or disable the job
+	JitterSeconds   *int      `json:"jitterSeconds,omitempty" example:"30"`           // New max random delay before each scheduled execution
+	CronExpression  *string   `json:"cronExpression,omitempty" example:"0 8 * * 1-5"` // New cron expression (cron jobs only)
+	TimeZone        *string   `json:"timeZone,omitempty" example:"Asia/Seoul"`        // New time zone (cron jobs only)
+	ExcludeDates    *[]string `json:"excludeDates,omitempty" example:"2026-12-25"`    // New list of excluded dates, replacing the current one
+}
+
+// ScheduleJobRun is the record of one execution of a scheduled job
+type ScheduleJobRun struct {
+	StartedAt  time.Time `json:"startedAt" example:"2023-10-27T11:00:00Z"`
+	FinishedAt time.Time `json:"finishedAt" example:"2023-10-27T11:00:05Z"`
+	Success    bool      `json:"success" example:"true"`
+	Result     string    `json:"result,omitempty" example:"Suspending the Infra"`
+	Error      string    `json:"error,omitempty" example:""`
 }
 
 // ScheduleJobStatus is struct for scheduled job status response
@@ -100,14 +198,20 @@ type ScheduleJobStatus struct {
 	LastError           string    `json:"lastError,omitempty" example:""`
 	LastResult          string    `json:"lastResult,omitempty" example:"Success (execution #5)"`
 
-	// Job-specific parameters
-	ConnectionName  string `json:"connectionName,omitempty" example:"aws-ap-northeast-2"` // (Deprecated)
-	Provider        string `json:"provider,omitempty" example:"aws"`
-	Region          string `json:"region,omitempty" example:"ap-northeast-2"`
-	Zone            string `json:"zone,omitempty" example:"ap-northeast-2a"`
-	InfraNamePrefix string `json:"infraNamePrefix,omitempty" example:"infra-01"`
-	Option          string `json:"option,omitempty" example:""`
-	InfraFlag       string `json:"infraFlag,omitempty" example:"y"`
+	JitterSeconds  int      `json:"jitterSeconds,omitempty" example:"30"`
+	CronExpression string   `json:"cronExpression,omitempty" example:"0 20 * * 1-5"`
+	TimeZone       string   `json:"timeZone,omitempty" example:"Asia/Seoul"`
+	ExcludeDates   []string `json:"excludeDates,omitempty" example:"2026-12-25"`
+
+	// Payload holds the parameters of the job type
+	Payload json.RawMessage `json:"payload,omitempty" swaggertype:"object"`
+
+	// (Deprecated) Parameters of the built-in job types mirrored from Payload
+	RegisterCspResourcesJobPayload
+	PowerActionJobPayload
+
+	// RunHistory lists the most recent executions, oldest first
+	RunHistory []ScheduleJobRun `json:"runHistory,omitempty"`
 }
 
 // ScheduleJobListResponse is struct for list of scheduled jobs
@@ -115,6 +219,26 @@ type ScheduleJobListResponse struct {
 	Jobs []ScheduleJobStatus `json:"jobs"`
 }
 
+// ScheduleJobExecution is the stored record of one execution of a scheduled job
+type ScheduleJobExecution struct {
+	JobId           string    `json:"jobId" example:"registerCspResources-default-1698765432"`
+	JobType         string    `json:"jobType" example:"registerCspResources"`
+	NsId            string    `json:"nsId" example:"default"`
+	ExecutionNumber int       `json:"executionNumber" example:"5"`
+	StartedAt       time.Time `json:"startedAt" example:"2023-10-27T11:00:00Z"`
+	FinishedAt      time.Time `json:"finishedAt" example:"2023-10-27T11:00:05Z"`
+	Success         bool      `json:"success" example:"true"`
+	Result          string    `json:"result,omitempty" example:"Success (execution #5)"`
+	Error           string    `json:"error,omitempty" example:""`
+	// Output is what the job type returned, if anything
+	Output any `json:"output,omitempty"`
+}
+
+// ScheduleJobExecutionList is struct for the stored executions of a scheduled job
+type ScheduleJobExecutionList struct {
+	Executions []ScheduleJobExecution `json:"executions"`
+}
+
 // KeyWithEncryptedValue is struct for key-(encrypted)value pair
 type KeyWithEncryptedValue struct {
 	// Key for the value
@@ -243,6 +367,8 @@ var SystemInitialized bool
 
 var SpiderRestUrl string
 var DragonflyRestUrl string
+var PrometheusUrl string
+var PrometheusBearerToken string
 var TerrariumRestUrl string
 var APIUsername string
 var APIPassword string
@@ -253,6 +379,7 @@ var DBDatabase string
 var DBUser string
 var DBPassword string
 var AutocontrolDurationMs string
+var WebhookAllowedCidrs string
 var DefaultNamespace string
 var DefaultCredentialHolder string
 var EtcdEndpoints string
@@ -270,6 +397,8 @@ const (
 	StrUidPrefix             string = "tb"
 	StrSpiderRestUrl         string = "TB_SPIDER_REST_URL"
 	StrDragonflyRestUrl      string = "TB_DRAGONFLY_REST_URL"
+	StrPrometheusUrl         string = "TB_PROMETHEUS_URL"
+	StrPrometheusBearerToken string = "TB_PROMETHEUS_BEARER_TOKEN"
 	StrTerrariumRestUrl      string = "TB_TERRARIUM_REST_URL"
 	StrAPIUsername           string = "TB_API_USERNAME"
 	StrAPIPassword           string = "TB_API_PASSWORD"
@@ -280,6 +409,7 @@ const (
 	StrDBUser                string = "TB_POSTGRES_USER"
 	StrDBPassword            string = "TB_POSTGRES_PASSWORD"
 	StrAutocontrolDurationMs string = "TB_AUTOCONTROL_DURATION_MS"
+	StrWebhookAllowedCidrs   string = "TB_WEBHOOK_ALLOWED_CIDRS"
 	StrEtcdEndpoints         string = "TB_ETCD_ENDPOINTS"
 	StrVaultAddr             string = "VAULT_ADDR"
 	StrVaultToken            string = "VAULT_TOKEN"
@@ -315,6 +445,8 @@ const (
 	StrContainer             string = "container"
 	StrNamespace             string = "ns"
 	StrTemplate              string = "template"
+	StrRunbook               string = "runbook"
+	StrEventSubscription     string = "eventSubscription"
 	StrCommon                string = "common"
 	StrGlobalDns             string = "globalDns"
 	StrEmpty                 string = ""
@@ -479,6 +611,20 @@ type CredentialInfo struct {
 	OpenBaoStatus string `json:"openBaoStatus,omitempty"`
 }
 
+// KvEncryptionRotationResult reports the outcome of a kvstore encryption key rotation
+type KvEncryptionRotationResult struct {
+	// DataKeyId is the new data key used for all encrypted values
+	DataKeyId string `json:"dataKeyId" example:"a155ee76b983ce8d"`
+	// MasterKey identifies the master key that now wraps every data key
+	MasterKey string `json:"masterKey" example:"openbao-transit:transit/tumblebug-kvstore"`
+	// Rewrapped is the number of older data keys re-wrapped with the master key
+	Rewrapped int `json:"rewrapped"`
+	// Scanned is the number of entries selected by the encryption rules
+	Scanned int `json:"scanned"`
+	// Reencrypted is the number of entries re-encrypted with the new data key
+	Reencrypted int `json:"reencrypted"`
+}
+
 // OpenBaoStatusInfo reports whether the OpenBao credential store is usable by CB-Tumblebug.
 // @Description OpenBao (secret store) connectivity and readiness status
 type OpenBaoStatusInfo struct {
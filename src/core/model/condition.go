@@ -32,6 +32,14 @@ const (
 	ConditionSynced ConditionType = "Synced"
 	// ConditionChildrenReady indicates whether all child resources are healthy (e.g., VNet's Subnets)
 	ConditionChildrenReady ConditionType = "ChildrenReady"
+
+	// Drift conditions of a Node: True means the CSP reports something other than the Node record
+	ConditionSpecDrifted          ConditionType = "SpecDrifted"
+	ConditionImageDrifted         ConditionType = "ImageDrifted"
+	ConditionSecurityGroupDrifted ConditionType = "SecurityGroupDrifted"
+	ConditionDataDiskDrifted      ConditionType = "DataDiskDrifted"
+	ConditionPublicIPDrifted      ConditionType = "PublicIPDrifted"
+	ConditionLabelDrifted         ConditionType = "LabelDrifted"
 )
 
 // ConditionStatus represents the status of a condition
@@ -69,6 +77,11 @@ const (
 	// (e.g., DeletionFailed) when the CSP resource was confirmed to still exist.
 	ReasonRestored = "Restored"
 
+	// Reasons for drift conditions
+	ReasonDriftDetected = "DriftDetected"
+	ReasonNoDrift       = "NoDrift"
+	ReasonNotReported   = "NotReported" // the CSP did not report the aspect; Status is Unknown
+
 	// Reasons for ChildrenReady condition
 	ReasonNoChildren       = "NoChildren"
 	ReasonAllReady         = "AllReady"
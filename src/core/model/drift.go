@@ -0,0 +1,54 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package model is to handle object of CB-Tumblebug
+package model
+
+// Sources of the CSP view used by a drift check
+const (
+	// DriftSourceCsp means the CSP was queried directly through its SDK
+	DriftSourceCsp = "csp"
+	// DriftSourceSpider means the CSP was queried through CB-Spider
+	DriftSourceSpider = "spider"
+)
+
+// NodeDriftInfo is the result of the drift check of one Node
+type NodeDriftInfo struct {
+	InfraId        string `json:"infraId" example:"infra01"`
+	NodeId         string `json:"nodeId" example:"g1-1"`
+	ConnectionName string `json:"connectionName" example:"aws-ap-northeast-2"`
+	CspResourceId  string `json:"cspResourceId" example:"i-014fa6ede6ada0b2c"`
+	// Source tells how the CSP view was obtained (csp or spider)
+	Source string `json:"source,omitempty" example:"csp" enums:"csp,spider"`
+	// Drifted is true when any drift condition is True
+	Drifted bool `json:"drifted"`
+	// Conditions are the drift conditions recorded on the Node
+	Conditions []Condition `json:"conditions,omitempty"`
+	// Error is set when the CSP view could not be obtained; Conditions are then left as they were
+	Error string `json:"error,omitempty"`
+}
+
+// DriftReport is the drift of the Nodes of a namespace
+type DriftReport struct {
+	NsId      string `json:"nsId" example:"default"`
+	CheckedAt string `json:"checkedAt" example:"2026-01-01T00:00:00Z"`
+	// Checked is the number of Nodes compared with the CSP
+	Checked int `json:"checked"`
+	// Drifted is the number of Nodes with at least one drift
+	Drifted int `json:"drifted"`
+	// Failed is the number of Nodes whose CSP view could not be obtained
+	Failed int `json:"failed"`
+	// Skipped is the number of Nodes not checked (not provisioned or not running/suspended)
+	Skipped int             `json:"skipped"`
+	Nodes   []NodeDriftInfo `json:"nodes"`
+}
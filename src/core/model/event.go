@@ -0,0 +1,200 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package model is to handle object of CB-Tumblebug
+package model
+
+// EventTypePrefix is the reverse-DNS prefix of the types of Tumblebug events
+const EventTypePrefix = "org.cloud-barista.tumblebug."
+
+// Types of the events published on the internal event bus
+const (
+	// EventTypeNodeCreated is published when the CSP accepted a Node (it may still be booting)
+	EventTypeNodeCreated = EventTypePrefix + "node.created"
+
+	// EventTypeNodeCreateFailed is published when the creation of a Node failed
+	EventTypeNodeCreateFailed = EventTypePrefix + "node.createFailed"
+
+	// EventTypeNodeStatusChanged is published when the stored status of a Node changes
+	EventTypeNodeStatusChanged = EventTypePrefix + "node.statusChanged"
+
+	// EventTypeInfraDeleted is published when an Infra has been deleted
+	EventTypeInfraDeleted = EventTypePrefix + "infra.deleted"
+
+	// EventTypeResourceStatusChanged is published when the status of a resource (vNet, ...) changes
+	EventTypeResourceStatusChanged = EventTypePrefix + "resource.statusChanged"
+
+	// EventTypeReconcileCompleted and EventTypeReconcileFailed report a reconcile of a resource
+	EventTypeReconcileCompleted = EventTypePrefix + "reconcile.completed"
+	EventTypeReconcileFailed    = EventTypePrefix + "reconcile.failed"
+
+	// EventTypeCommandCompleted is published when a remote command reaches a final status on a Node
+	EventTypeCommandCompleted = EventTypePrefix + "command.completed"
+
+	// EventTypeNodeDriftDetected is published when a drift check finds a new drift on a Node
+	EventTypeNodeDriftDetected = EventTypePrefix + "node.driftDetected"
+)
+
+// Event is an event of the internal event bus, shaped as a CloudEvents v1.0 event
+// (JSON format) so that it can be forwarded as is
+type Event struct {
+	SpecVersion string `json:"specversion" example:"1.0"`
+	Id          string `json:"id" example:"d2k4l8a1q8b0c7f3e9h0"`
+
+	// Source identifies the resource, e.g. /tumblebug/ns/default/infra/infra01/node/g1-1
+	Source string `json:"source" example:"/tumblebug/ns/default/infra/infra01/node/g1-1"`
+	Type   string `json:"type" example:"org.cloud-barista.tumblebug.node.statusChanged"`
+
+	// Subject is the ID of the resource
+	Subject         string    `json:"subject,omitempty" example:"g1-1"`
+	Time            string    `json:"time" example:"2024-01-01T00:00:00Z"`
+	DataContentType string    `json:"datacontenttype" example:"application/json"`
+	Data            EventData `json:"data"`
+}
+
+// EventData is the payload of an Event
+type EventData struct {
+	NsId         string `json:"nsId" example:"default"`
+	ResourceType string `json:"resourceType" example:"node"`
+	ResourceId   string `json:"resourceId" example:"g1-1"`
+
+	// InfraId is the Infra of a Node or of a command
+	InfraId string `json:"infraId,omitempty" example:"infra01"`
+
+	OldStatus string `json:"oldStatus,omitempty" example:"Running"`
+	NewStatus string `json:"newStatus,omitempty" example:"Terminated"`
+
+	// RequestId is the x-request-id of the API request that caused the event, if any
+	RequestId string `json:"requestId,omitempty" example:"1704067200000000000"`
+
+	Message string `json:"message,omitempty" example:"Node g1-1 is Terminated"`
+
+	// Labels are the labels of the resource (when known)
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// Payload formats of event subscriptions
+const (
+	// EventFormatCloudEvents posts the event as a structured CloudEvents JSON document
+	EventFormatCloudEvents = "cloudevents"
+
+	// EventFormatText posts {"text": "<summary>"}, as Slack and Microsoft Teams incoming webhooks expect
+	EventFormatText = "text"
+)
+
+// Outcomes of the delivery of an event to a subscription
+const (
+	EventDeliveryRetrying     = "Retrying"
+	EventDeliveryDelivered    = "Delivered"
+	EventDeliveryDeadLettered = "DeadLettered"
+)
+
+// EventSubscriptionReq is struct for creating or updating an outbound webhook subscription
+// to the events of a namespace
+type EventSubscriptionReq struct {
+	// Name is the subscription ID and name
+	Name string `json:"name" validate:"required" example:"ops-slack"`
+
+	// Description of the subscription
+	Description string `json:"description,omitempty" example:"Notify the ops channel of failures"`
+
+	// Url receives the events (HTTP POST). It may not resolve to a loopback, private or
+	// link-local address, except the ranges in TB_WEBHOOK_ALLOWED_CIDRS.
+	Url string `json:"url" validate:"required" example:"https://hooks.slack.com/services/T000/B000/XXXX"`
+
+	// Format of the request body (default: cloudevents)
+	Format string `json:"format,omitempty" example:"text" enums:"cloudevents,text"`
+
+	// Secret signs the requests (x-tb-signature: sha256=HMAC-SHA256 of "<x-tb-timestamp>.<body>").
+	// At least 16 characters; requests are not signed when empty.
+	Secret string `json:"secret,omitempty" example:"change-me-to-a-long-random-secret"`
+
+	// EventTypes selects the event types, in full or without the common prefix; a trailing '*'
+	// matches any suffix (e.g. "node.*"). All event types when empty.
+	EventTypes []string `json:"eventTypes,omitempty" example:"node.statusChanged,node.createFailed"`
+
+	// Statuses selects the events whose new status is one of these (e.g. Failed, Terminated)
+	Statuses []string `json:"statuses,omitempty" example:"Failed,Terminated"`
+
+	// LabelSelector selects the events of resources whose labels match (e.g. "env=prod")
+	LabelSelector string `json:"labelSelector,omitempty" example:"env=prod"`
+
+	// MaxRetries is the number of retries of a failed delivery before it is dead-lettered (default: 5, max: 10)
+	MaxRetries int `json:"maxRetries,omitempty" example:"5"`
+
+	// Disabled stops the deliveries without deleting the subscription
+	Disabled bool `json:"disabled,omitempty" example:"false"`
+}
+
+// EventSubscriptionInfo is struct for an outbound webhook subscription stored in ETCD
+type EventSubscriptionInfo struct {
+	// ResourceType is the type of the resource
+	ResourceType string `json:"resourceType" example:"eventSubscription"`
+
+	// Id is unique identifier for the subscription
+	Id string `json:"id" example:"ops-slack"`
+
+	// Name is human-readable string to represent the subscription
+	Name string `json:"name" example:"ops-slack"`
+
+	Description   string   `json:"description,omitempty" example:"Notify the ops channel of failures"`
+	Url           string   `json:"url" example:"https://hooks.slack.com/services/T000/B000/XXXX"`
+	Format        string   `json:"format" example:"text"`
+	Secret        string   `json:"secret,omitempty" example:"********"`
+	EventTypes    []string `json:"eventTypes,omitempty" example:"node.statusChanged,node.createFailed"`
+	Statuses      []string `json:"statuses,omitempty" example:"Failed,Terminated"`
+	LabelSelector string   `json:"labelSelector,omitempty" example:"env=prod"`
+	MaxRetries    int      `json:"maxRetries" example:"5"`
+	Disabled      bool     `json:"disabled" example:"false"`
+
+	// CreatedAt is the creation timestamp of the subscription
+	CreatedAt string `json:"createdAt" example:"2024-01-01T00:00:00Z"`
+
+	// UpdatedAt is the timestamp of the last update of the subscription
+	UpdatedAt string `json:"updatedAt" example:"2024-01-01T00:00:00Z"`
+}
+
+// EventSubscriptionListResponse is struct for listing event subscriptions
+type EventSubscriptionListResponse struct {
+	Subscriptions []EventSubscriptionInfo `json:"subscriptions"`
+}
+
+// EventDelivery is the delivery of an event to a subscription
+type EventDelivery struct {
+	Id             string `json:"id" example:"d2k4l8a1q8b0c7f3e9h0"`
+	SubscriptionId string `json:"subscriptionId" example:"ops-slack"`
+	EventId        string `json:"eventId" example:"d2k4l8a1q8b0c7f3e9g0"`
+	EventType      string `json:"eventType" example:"org.cloud-barista.tumblebug.node.statusChanged"`
+	Subject        string `json:"subject,omitempty" example:"g1-1"`
+
+	// Status is Retrying, Delivered or DeadLettered
+	Status string `json:"status" example:"Delivered" enums:"Retrying,Delivered,DeadLettered"`
+
+	// Attempts is the number of requests sent so far
+	Attempts int `json:"attempts" example:"1"`
+
+	// ResponseCode is the HTTP status of the last attempt (0 when no response was received)
+	ResponseCode int    `json:"responseCode,omitempty" example:"200"`
+	Error        string `json:"error,omitempty" example:"Post \"https://example.com/hook\": context deadline exceeded"`
+
+	CreatedAt     string `json:"createdAt" example:"2024-01-01T00:00:00Z"`
+	LastAttemptAt string `json:"lastAttemptAt,omitempty" example:"2024-01-01T00:00:01Z"`
+
+	// Event is kept with dead letters, so that they can be redelivered
+	Event *Event `json:"event,omitempty"`
+}
+
+// EventDeliveryListResponse is struct for listing the deliveries or the dead letters of a subscription
+type EventDeliveryListResponse struct {
+	Deliveries []EventDelivery `json:"deliveries"`
+}
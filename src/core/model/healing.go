@@ -0,0 +1,35 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package model is to handle object of CB-Tumblebug
+package model
+
+// NodeGroupHealingPolicy is the opt-in policy to replace the Nodes of a NodeGroup that
+// the status agent finds Terminated or Failed on the CSP without a user action.
+type NodeGroupHealingPolicy struct {
+	// Enabled turns healing of the NodeGroup on or off
+	Enabled bool `json:"enabled" example:"true"`
+	// MaxHealsPerHour caps the replacements of the NodeGroup within any hour (0 means 3)
+	MaxHealsPerHour int `json:"maxHealsPerHour,omitempty" example:"3" default:"3"`
+}
+
+// NodeGroupHealingPolicyInfo is the stored healing policy of a NodeGroup
+type NodeGroupHealingPolicyInfo struct {
+	NsId        string `json:"nsId" example:"default"`
+	InfraId     string `json:"infraId" example:"infra01"`
+	NodeGroupId string `json:"nodeGroupId" example:"g1"`
+
+	NodeGroupHealingPolicy
+
+	UpdatedAt string `json:"updatedAt" example:"2026-01-01T00:00:00Z"`
+}
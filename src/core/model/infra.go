@@ -162,6 +162,9 @@ type InfraReq struct {
 	// - "rollback": Cleanup entire Infra when any Node fails
 	// - "refine": Mark failed Nodes for refinement
 	PolicyOnPartialFailure string `json:"policyOnPartialFailure" example:"continue" default:"continue" enums:"continue,rollback,refine"`
+
+	// ExpirationOption optionally tears the Infra down at expiresAt or after ttl
+	ExpirationOption
 }
 
 // ResourceStatusInfo is struct for status information of a resource
@@ -235,8 +238,18 @@ type InfraInfo struct {
 
 	// CreationErrors contains information about Node creation failures (if any)
 	CreationErrors *InfraCreationErrors `json:"creationErrors,omitempty"`
+
+	// readBase is the stored record this object was read from (not serialized)
+	readBase string
 }
 
+// ReadBase returns the stored record the Infra object was read from, if any.
+// UpdateInfraInfo uses it to write back only the fields changed since the read.
+func (i InfraInfo) ReadBase() string { return i.readBase }
+
+// SetReadBase records the stored record the Infra object was read from.
+func (i *InfraInfo) SetReadBase(record string) { i.readBase = record }
+
 // PostCommandReq is a post-deployment command phase: an InfraCmdReq plus optional
 // targeting (at most one of nodeGroupId/nodeId/labelSelector) and phase policy.
 // Targeting mirrors the query parameters of the remote-command API.
@@ -251,6 +264,9 @@ type PostCommandReq struct {
 	LabelSelector string `json:"labelSelector,omitempty" example:"role=worker"`
 	// ContinueOnError keeps running the remaining phases when this phase fails (default: false)
 	ContinueOnError bool `json:"continueOnError,omitempty" example:"false"`
+	// Runbook runs the steps of a runbook instead of Command. UserName and TimeoutMinutes,
+	// when set, override those of the runbook, and the target above overrides its target.
+	Runbook *RunbookRef `json:"runbook,omitempty"`
 }
 
 // Target returns a human-readable echo of this phase's target scope
@@ -456,6 +472,9 @@ type InfraDynamicReq struct {
 	// or by polling GET /ns/{nsId}/infra/{infraId}.
 	PostCommandAsync bool `json:"postCommandAsync,omitempty" example:"false"`
 
+	// ExpirationOption optionally tears the Infra down at expiresAt or after ttl
+	ExpirationOption
+
 	// SystemLabel is for describing the infra in a keyword (any string can be used) for special System purpose
 	SystemLabel string `json:"systemLabel" example:"" default:""`
 
@@ -524,6 +543,78 @@ type CreateNodeGroupDynamicReq struct {
 	DistributeSubnets bool `json:"distributeSubnets,omitempty" example:"false"`
 }
 
+// Modes of the declarative Infra apply
+const (
+	// InfraApplyModePlan only computes the changes
+	InfraApplyModePlan string = "plan"
+	// InfraApplyModeApply computes the changes and executes them
+	InfraApplyModeApply string = "apply"
+)
+
+// Actions planned for a NodeGroup by the declarative Infra apply
+const (
+	NodeGroupApplyCreate string = "create"
+	NodeGroupApplyUpdate string = "update"
+	NodeGroupApplyDelete string = "delete"
+	NodeGroupApplyNone   string = "none"
+)
+
+// InfraApplyPlan is the set of changes that brings an Infra to the desired state
+// given as an InfraDynamicReq. In apply mode it also holds the outcome.
+type InfraApplyPlan struct {
+	// Mode is the mode the plan was computed in (plan or apply)
+	Mode string `json:"mode" example:"plan" enums:"plan,apply"`
+	// InfraId is the target Infra (the name of the desired state)
+	InfraId string `json:"infraId" example:"infra01"`
+
+	// CreateInfra is true when the Infra does not exist and is created as a whole
+	CreateInfra bool `json:"createInfra"`
+	// NoChange is true when the Infra already matches the desired state
+	NoChange bool `json:"noChange"`
+
+	// LabelsToSet are the Infra labels to add or update
+	LabelsToSet map[string]string `json:"labelsToSet,omitempty"`
+
+	// NodeGroups holds the changes per NodeGroup, in the order they are applied
+	NodeGroups []NodeGroupApplyPlan `json:"nodeGroups"`
+
+	// Warnings are parts of the desired state the plan could not compare
+	Warnings []string `json:"warnings,omitempty"`
+
+	// Errors are the steps that failed in apply mode (the other steps were still executed)
+	Errors []string `json:"errors,omitempty"`
+	// Infra is the Infra after the changes were executed (apply mode only)
+	Infra *InfraInfo `json:"infra,omitempty"`
+}
+
+// NodeGroupApplyPlan is the set of changes planned for one NodeGroup
+type NodeGroupApplyPlan struct {
+	// Name is the NodeGroup name
+	Name string `json:"name" example:"g1"`
+	// Action is create (new NodeGroup), update, delete (NodeGroup not in the desired state) or none
+	Action string `json:"action" example:"update" enums:"create,update,delete,none"`
+
+	CurrentSize int `json:"currentSize" example:"2"`
+	DesiredSize int `json:"desiredSize" example:"3"`
+
+	// NodesToAdd is the number of Nodes to create in addition to the replacements
+	NodesToAdd int `json:"nodesToAdd" example:"1"`
+	// NodesToRemove are the Nodes to delete without a replacement
+	NodesToRemove []string `json:"nodesToRemove,omitempty"`
+	// NodesToReplace are the Nodes to delete once a Node with the desired spec/image is created
+	NodesToReplace []string `json:"nodesToReplace,omitempty"`
+	// ReplaceReasons tells why each Node in NodesToReplace is replaced
+	ReplaceReasons map[string]string `json:"replaceReasons,omitempty"`
+
+	// LabelsToSet are the labels to add or update on every remaining Node of the NodeGroup
+	LabelsToSet map[string]string `json:"labelsToSet,omitempty"`
+
+	// SecurityGroupId is the SecurityGroup of the NodeGroup whose rules are reconciled
+	SecurityGroupId       string             `json:"securityGroupId,omitempty" example:"infra01-g1"`
+	FirewallRulesToAdd    []FirewallRuleInfo `json:"firewallRulesToAdd,omitempty"`
+	FirewallRulesToDelete []FirewallRuleInfo `json:"firewallRulesToDelete,omitempty"`
+}
+
 // InfraConnectionConfigCandidatesReq is struct for a request to check requirements to create a new Infra instance dynamically (with default resource option)
 type InfraConnectionConfigCandidatesReq struct {
 	// SpecId is field for id of a spec in common namespace
@@ -950,9 +1041,22 @@ type NodeInfo struct {
 	// CommandStatus stores the status and history of remote commands executed on this Node
 	CommandStatus []CommandStatusInfo `json:"commandStatus,omitempty"`
 
+	// Conditions hold the drift observations of the last drift check, one per compared aspect
+	Conditions []Condition `json:"conditions,omitempty"`
+
 	AddtionalDetails []KeyValue `json:"addtionalDetails,omitempty"`
+
+	// readBase is the stored record this object was read from (not serialized)
+	readBase string
 }
 
+// ReadBase returns the stored record the Node object was read from, if any.
+// UpdateNodeInfo uses it to write back only the fields changed since the read.
+func (n NodeInfo) ReadBase() string { return n.readBase }
+
+// SetReadBase records the stored record the Node object was read from.
+func (n *NodeInfo) SetReadBase(record string) { n.readBase = record }
+
 // InfraAccessInfo is struct to retrieve overall access information of a Infra
 type InfraAccessInfo struct {
 	InfraId                  string
@@ -1187,9 +1291,36 @@ const (
 
 	// AutoActionScaleIn is const for "ScaleIn" action.
 	AutoActionScaleIn string = "ScaleIn"
+
+	// AutoActionRunRunbook is const for "RunRunbook" action.
+	AutoActionRunRunbook string = "RunRunbook"
+)
+
+// Logic combining the metric rules of an AutoCondition
+const (
+	AutoLogicAnd string = "and"
+	AutoLogicOr  string = "or"
 )
 
+// Scale-in victim selection strategies
+const (
+	ScaleInVictimNewest        string = "newest"
+	ScaleInVictimOldest        string = "oldest"
+	ScaleInVictimMostExpensive string = "mostExpensive"
+)
+
+// MetricRule is one metric comparison of an AutoCondition. The rule matches when the
+// average of the last EvaluationPeriod samples satisfies Operator and Operand.
+type MetricRule struct {
+	Metric           string   `json:"metric" example:"memory"`
+	Operator         string   `json:"operator" example:">=" enums:"<,<=,>,>="`
+	Operand          float64  `json:"operand" example:"70"`
+	EvaluationPeriod int      `json:"evaluationPeriod" example:"10"`
+	EvaluationValue  []string `json:"evaluationValue"`
+}
+
 // AutoCondition is struct for Infra auto-control condition.
+// Metric/Operator/Operand is the primary rule; Rules adds more, combined by Logic.
 type AutoCondition struct {
 	Metric           string   `json:"metric" example:"cpu"`
 	Operator         string   `json:"operator" example:">=" enums:"<,<=,>,>="`
@@ -1198,16 +1329,57 @@ type AutoCondition struct {
 	EvaluationValue  []string `json:"evaluationValue"`
 	//InitTime	   string 	  `json:"initTime"`  // to check start of duration
 	//Duration	   string 	  `json:"duration"`  // duration for checking
+
+	// Logic combines the primary rule and Rules: "and" (default, all must match) or "or" (any)
+	Logic string `json:"logic,omitempty" example:"and" enums:"and,or"`
+
+	// Rules are additional metric rules
+	Rules []MetricRule `json:"rules,omitempty"`
 }
 
 // AutoAction is struct for Infra auto-control action.
 type AutoAction struct {
-	ActionType          string                    `json:"actionType" example:"ScaleOut" enums:"ScaleOut,ScaleIn"`
+	ActionType          string                    `json:"actionType" example:"ScaleOut" enums:"ScaleOut,ScaleIn,RunRunbook"`
 	NodeGroupDynamicReq CreateNodeGroupDynamicReq `json:"nodeGroupDynamicReq"`
 
 	// PostCommands bootstrap the Nodes added by this action (phases run in order)
 	PostCommands  []PostCommandReq `json:"postCommands,omitempty"`
 	PlacementAlgo string           `json:"placementAlgo" example:"random"`
+
+	// NodeGroupId is the NodeGroup the action resizes. When empty, ScaleOut adds a new
+	// auto-generated NodeGroup from NodeGroupDynamicReq and ScaleIn removes auto-generated Nodes.
+	NodeGroupId string `json:"nodeGroupId,omitempty" example:"g1"`
+
+	// Step is the number of Nodes added or removed per action (default: 1, or
+	// NodeGroupDynamicReq.NodeGroupSize for a new auto-generated NodeGroup)
+	Step int `json:"step,omitempty" example:"1"`
+
+	// MinSize and MaxSize bound the number of Nodes of the target (0: unbounded).
+	// A ScaleIn on NodeGroupId always keeps at least one Node to copy the configuration from.
+	MinSize int `json:"minSize,omitempty" example:"1"`
+	MaxSize int `json:"maxSize,omitempty" example:"5"`
+
+	// CooldownSeconds is the minimum time between two actions of the policy
+	CooldownSeconds int `json:"cooldownSeconds,omitempty" example:"300"`
+
+	// VictimSelection chooses the Nodes removed by ScaleIn (default: newest)
+	VictimSelection string `json:"victimSelection,omitempty" example:"newest" enums:"newest,oldest,mostExpensive"`
+
+	// RunbookId is the runbook run by RunRunbook, on NodeGroupId or on the whole Infra
+	RunbookId string `json:"runbookId,omitempty" example:"restart-nginx"`
+
+	// RunbookRunReq holds the version, parameters and SSH user of the runbook run
+	RunbookRunReq RunbookRunReq `json:"runbookRunReq,omitempty"`
+}
+
+// AutoWebhook lets an external system (an autoscaler, Alertmanager) trigger the action
+// of a policy through an HMAC-signed POST, subject to the cooldown and bounds of the action
+type AutoWebhook struct {
+	Enabled bool `json:"enabled" example:"true"`
+
+	// Secret is the HMAC-SHA256 key of the signatures (at least 16 characters).
+	// It is left out of responses and of namespace exports.
+	Secret string `json:"secret,omitempty" example:"change-me-to-a-long-random-string"`
 }
 
 // Policy is struct for Infra auto-control Policy request that includes AutoCondition, AutoAction, Status.
@@ -1215,6 +1387,86 @@ type Policy struct {
 	AutoCondition AutoCondition `json:"autoCondition"`
 	AutoAction    AutoAction    `json:"autoAction"`
 	Status        string        `json:"status"`
+
+	// MetricSource is where the metrics of AutoCondition are read from (default: dragonfly)
+	MetricSource MetricSourceConfig `json:"metricSource,omitempty"`
+
+	// Webhook enables the webhook trigger of the policy. A policy with a webhook may
+	// leave AutoCondition empty to act on webhooks only.
+	Webhook AutoWebhook `json:"webhook,omitempty"`
+
+	// LastActionTime is when the action of the policy last ran (RFC3339), for the cooldown
+	LastActionTime string `json:"lastActionTime,omitempty" example:"2024-01-01T00:00:00Z"`
+}
+
+// Decisions of an auto-control policy evaluation
+const (
+	AutoDecisionNoAction         string = "NoAction"
+	AutoDecisionInsufficientData string = "InsufficientData"
+	AutoDecisionDetected         string = "Detected"
+	AutoDecisionCooldown         string = "Cooldown"
+	AutoDecisionAtBound          string = "AtBound"
+	AutoDecisionExecuted         string = "Executed"
+	AutoDecisionFailed           string = "Failed"
+)
+
+// AutoRuleEvaluation is the outcome of one metric rule in a policy evaluation
+type AutoRuleEvaluation struct {
+	Metric   string  `json:"metric" example:"cpu"`
+	Operator string  `json:"operator" example:">="`
+	Operand  float64 `json:"operand" example:"80"`
+
+	// Value is the Infra average of the metric sampled by this evaluation
+	Value float64 `json:"value" example:"83.5"`
+
+	// Average is the average of the last EvaluationPeriod samples (when there are enough)
+	Average float64 `json:"average" example:"81.2"`
+
+	// Samples is the number of samples kept for the rule, out of Period
+	Samples int `json:"samples" example:"10"`
+	Period  int `json:"period" example:"10"`
+
+	// Matched is true when the rule is satisfied; Sufficient is false while samples are missing
+	Matched    bool `json:"matched" example:"true"`
+	Sufficient bool `json:"sufficient" example:"true"`
+}
+
+// AutoControlDecision records one evaluation or action of an auto-control policy
+type AutoControlDecision struct {
+	Id          string `json:"id" example:"1704067200000000000"`
+	Time        string `json:"time" example:"2024-01-01T00:00:00Z"`
+	PolicyIndex int    `json:"policyIndex" example:"0"`
+	ActionType  string `json:"actionType" example:"ScaleOut"`
+
+	// Decision is one of NoAction, InsufficientData, Detected, Cooldown, AtBound, Executed, Failed
+	Decision string `json:"decision" example:"Executed"`
+	Message  string `json:"message,omitempty" example:"added 1 Node to g1"`
+
+	Logic string               `json:"logic,omitempty" example:"and"`
+	Rules []AutoRuleEvaluation `json:"rules,omitempty"`
+
+	// CurrentSize is the number of Nodes of the target before the action
+	CurrentSize int `json:"currentSize,omitempty" example:"3"`
+
+	// NodeIds are the Nodes added or removed by the action
+	NodeIds []string `json:"nodeIds,omitempty"`
+
+	// Trigger is what started the evaluation: metric (the controller) or webhook
+	Trigger string `json:"trigger,omitempty" example:"webhook"`
+
+	// IdempotencyKey is the key of the webhook request that ran the action
+	IdempotencyKey string `json:"idempotencyKey,omitempty" example:"alert-1234"`
+}
+
+// Triggers of an auto-control decision
+const (
+	AutoTriggerMetric  string = "metric"
+	AutoTriggerWebhook string = "webhook"
+)
+
+// AutoControlDecisionListResponse is struct for listing the decision log of an Infra policy
+type AutoControlDecisionListResponse struct {
+	Decisions []AutoControlDecision `json:"decisions"`
 }
 
 // InfraPolicyInfo is struct for Infra auto-control Policy object.
@@ -1261,7 +1513,32 @@ type InfraCmdReq struct {
 
 	// TimeoutMinutes is the timeout for command execution in minutes (default: 30, min: 1, max: 120)
 	// If not specified or set to 0, the default timeout (30 minutes) will be used
+	// With Rolling, the timeout applies to each batch
 	TimeoutMinutes int `json:"timeoutMinutes,omitempty" example:"30" default:"30"`
+
+	// Rolling runs the commands batch by batch instead of on all target Nodes at once
+	Rolling *CommandRollingOption `json:"rolling,omitempty"`
+}
+
+// CommandRollingOption configures a rolling (batched) execution of remote commands.
+// Set at most one of BatchSize and BatchPercent; neither means one Node per batch.
+type CommandRollingOption struct {
+	// BatchSize is the number of Nodes per batch
+	BatchSize int `json:"batchSize,omitempty" example:"2"`
+
+	// BatchPercent is the batch size as a percentage of the target Nodes (1-100, rounded up)
+	BatchPercent int `json:"batchPercent,omitempty" example:"25"`
+
+	// PauseSeconds is the wait between the end of a batch and the start of the next one
+	PauseSeconds int `json:"pauseSeconds,omitempty" example:"30"`
+
+	// MaxFailures is the number of failed Nodes tolerated; the execution stops after the
+	// batch in which more Nodes failed (default: 0, stop after the first failure)
+	MaxFailures int `json:"maxFailures,omitempty" example:"0"`
+
+	// VerifyCommand runs on each Node after its commands succeeded; the Node counts as
+	// failed unless the verification succeeds too
+	VerifyCommand []string `json:"verifyCommand,omitempty" example:"systemctl is-active nginx"`
 }
 
 // GetEffectiveTimeout returns the effective timeout duration for command execution
@@ -1535,6 +1812,9 @@ const (
 
 	// EventCommandDone is sent when all Nodes have finished execution (terminal event)
 	EventCommandDone CommandStreamEventType = "CommandDone"
+
+	// EventCommandBatch is sent when a batch of a rolling execution starts, completes or stops the execution
+	EventCommandBatch CommandStreamEventType = "CommandBatch"
 )
 
 // CommandStreamEvent is a single SSE event sent to streaming clients
@@ -1559,6 +1839,35 @@ type CommandStreamEvent struct {
 
 	// Summary is populated for EventCommandDone events
 	Summary *CommandDoneSummary `json:"summary,omitempty"`
+
+	// Batch is populated for EventCommandBatch events
+	Batch *CommandBatchProgress `json:"batch,omitempty"`
+}
+
+// Phases of a batch of a rolling execution
+const (
+	CommandBatchStarted   = "Started"
+	CommandBatchCompleted = "Completed"
+	// CommandBatchStopped means the batch exceeded the failure threshold, or the request was
+	// cancelled, and no further batch runs
+	CommandBatchStopped = "Stopped"
+)
+
+// CommandBatchProgress reports the progress of a rolling execution
+type CommandBatchProgress struct {
+	// Batch is the number of the batch (1-based)
+	Batch        int    `json:"batch" example:"2"`
+	TotalBatches int    `json:"totalBatches" example:"4"`
+	Phase        string `json:"phase" example:"Completed" enums:"Started,Completed,Stopped"`
+
+	// NodeIds are the Nodes of the batch
+	NodeIds []string `json:"nodeIds" example:"g1-3,g1-4"`
+
+	// CompletedNodes and FailedNodes count the Nodes of all batches so far
+	CompletedNodes int `json:"completedNodes" example:"4"`
+	FailedNodes    int `json:"failedNodes" example:"0"`
+
+	Message string `json:"message,omitempty" example:"2 Nodes failed (max 1), skipping 3 Nodes"`
 }
 
 // CommandLogEntry represents a single log line from SSH command execution
@@ -1584,6 +1893,9 @@ type CommandDoneSummary struct {
 	// FailedNodes is the number of Nodes that failed
 	FailedNodes int `json:"failedNodes" example:"1"`
 
+	// SkippedNodes is the number of Nodes a stopped rolling execution did not reach
+	SkippedNodes int `json:"skippedNodes,omitempty" example:"0"`
+
 	// ElapsedSeconds is total wall-clock time for the entire command execution
 	ElapsedSeconds int64 `json:"elapsedSeconds" example:"45"`
 
@@ -1655,6 +1967,62 @@ type InfraFileTransferAndCmdResultForAPI struct {
 	CmdResults          *InfraSshCmdResultForAPI `json:"cmdResults,omitempty"`
 }
 
+// FileSyncReq is struct for reconciling a set of files to a directory on Nodes.
+// The files come from an uploaded tarball or from an object storage prefix.
+type FileSyncReq struct {
+	// TargetPath is the absolute directory on the Nodes that receives the files
+	TargetPath string `json:"targetPath" validate:"required" example:"/opt/app/config"`
+
+	// Prefix selects the objects to sync when the source is an object storage; the
+	// object keys below it are the file paths relative to TargetPath
+	Prefix string `json:"prefix,omitempty" example:"releases/v1.2/config/"`
+
+	// Owner of the synced files and of the directories that hold them ("user" or "user:group")
+	Owner string `json:"owner,omitempty" example:"cb-user:cb-user"`
+
+	// FileMode is the octal mode of the synced files (default: the mode in the tarball, or 0644)
+	FileMode string `json:"fileMode,omitempty" example:"0644"`
+
+	// DeleteExtraneous removes the files under TargetPath that are not in the source,
+	// and the directories that removing them leaves empty
+	DeleteExtraneous bool `json:"deleteExtraneous,omitempty" example:"false"`
+
+	// DryRun reports the changes each Node would get without applying them
+	DryRun bool `json:"dryRun,omitempty" example:"false"`
+}
+
+// FileSyncNodeResult is the outcome of a file sync on a Node. File paths are relative to the target path.
+type FileSyncNodeResult struct {
+	NodeId string `json:"nodeId" example:"g1-1"`
+	NodeIp string `json:"nodeIp,omitempty" example:"192.168.0.1"`
+
+	// Added are the files the Node did not have
+	Added []string `json:"added,omitempty"`
+	// Updated are the files whose content differed
+	Updated []string `json:"updated,omitempty"`
+	// AttrFixed are the files whose content matched but whose owner or mode differed
+	AttrFixed []string `json:"attrFixed,omitempty"`
+	// Deleted are the extraneous files removed (with deleteExtraneous)
+	Deleted []string `json:"deleted,omitempty"`
+	// Unchanged is the number of files already in sync
+	Unchanged int `json:"unchanged" example:"12"`
+
+	// Error is set when the sync failed on the Node
+	Error string `json:"error,omitempty"`
+}
+
+// FileSyncResult is the outcome of a file sync on the target Nodes
+type FileSyncResult struct {
+	TargetPath string `json:"targetPath" example:"/opt/app/config"`
+	// SourceFiles and SourceBytes describe the files of the source
+	SourceFiles int   `json:"sourceFiles" example:"14"`
+	SourceBytes int64 `json:"sourceBytes" example:"20480"`
+	DryRun      bool  `json:"dryRun,omitempty"`
+	// FailedNodes is the number of Nodes with an error
+	FailedNodes int                  `json:"failedNodes" example:"0"`
+	Results     []FileSyncNodeResult `json:"results"`
+}
+
 // FileDownloadReq is struct for file download request from a Node
 type FileDownloadReq struct {
 	SourcePath string `json:"sourcePath" validate:"required" example:"/home/cb-user/result.json"` // Full path of the file on the remote VM
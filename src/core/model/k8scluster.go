@@ -102,6 +102,9 @@ type K8sClusterReq struct {
 
 	// SystemLabel is for describing the k8scluster in a keyword (any string can be used) for special System purpose
 	SystemLabel string `json:"systemLabel" example:"" default:""`
+
+	// ExpirationOption optionally deletes the K8sCluster at expiresAt or after ttl (suspend is not supported)
+	ExpirationOption
 }
 
 // 2023-11-13 https://github.com/cloud-barista/cb-spider/blob/fa4bd91fdaa6bb853ea96eca4a7b4f58a2abebf2/api-runtime/rest-runtime/ClusterRest.go#L441
@@ -552,6 +555,9 @@ type K8sClusterDynamicReq struct {
 	// if ConnectionName is given, the VM tries to use associtated credential.
 	// if not, it will use predefined ConnectionName in Spec objects
 	ConnectionName string `json:"connectionName,omitempty" default:"tencent-ap-seoul"`
+
+	// ExpirationOption optionally deletes the K8sCluster at expiresAt or after ttl (suspend is not supported)
+	ExpirationOption
 }
 
 // K8sNodeGroupDynamicReq is struct for requirements to create K8sNodeGroup dynamically (with default resource option)
@@ -0,0 +1,72 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package model is to handle object of CB-Tumblebug
+package model
+
+// Actions taken when a lease expires
+const (
+	LeaseActionDelete  = "delete"
+	LeaseActionSuspend = "suspend"
+)
+
+// Status of a lease
+const (
+	// LeaseActive means the resource lives until ExpiresAt
+	LeaseActive = "Active"
+	// LeaseWarned means the expiry warning was given
+	LeaseWarned = "Warned"
+	// LeaseSuspended means the Infra was suspended on expiry; extend the lease before resuming it
+	LeaseSuspended = "Suspended"
+)
+
+// ExpirationOption sets when a resource is torn down. At most one of ExpiresAt and Ttl is given;
+// both empty means the resource does not expire.
+type ExpirationOption struct {
+	// ExpiresAt is the time (RFC3339) the resource expires
+	ExpiresAt string `json:"expiresAt,omitempty" example:"2026-12-31T00:00:00Z"`
+	// Ttl is the lifetime of the resource counted from its creation (Go duration, e.g. 72h)
+	Ttl string `json:"ttl,omitempty" example:"72h"`
+	// ExpirationAction is what happens on expiry: delete (default) or suspend (Infra only)
+	ExpirationAction string `json:"expirationAction,omitempty" example:"delete" enums:"delete,suspend"`
+}
+
+// LeaseInfo is the lease of an Infra or a K8sCluster
+type LeaseInfo struct {
+	NsId string `json:"nsId" example:"default"`
+	// ResourceType is infra or k8s
+	ResourceType string `json:"resourceType" example:"infra" enums:"infra,k8s"`
+	ResourceId   string `json:"resourceId" example:"infra01"`
+
+	ExpiresAt string `json:"expiresAt" example:"2026-12-31T00:00:00Z"`
+	Action    string `json:"action" example:"delete" enums:"delete,suspend"`
+	Status    string `json:"status" example:"Active" enums:"Active,Warned,Suspended"`
+	// Message is the outcome of the last action of the reaper, if any
+	Message string `json:"message,omitempty"`
+
+	WarnedAt  string `json:"warnedAt,omitempty" example:"2026-12-30T23:00:00Z"`
+	UpdatedAt string `json:"updatedAt" example:"2026-12-01T00:00:00Z"`
+}
+
+// LeaseUpdateReq changes the expiry of a resource. Exactly one of ExpiresAt, Ttl and
+// ExtendBy is given; Ttl counts from now and ExtendBy from the current expiry.
+type LeaseUpdateReq struct {
+	ExpirationOption
+	// ExtendBy postpones the current expiry (Go duration, e.g. 24h)
+	ExtendBy string `json:"extendBy,omitempty" example:"24h"`
+}
+
+// LeaseList is the list of leases of a namespace
+type LeaseList struct {
+	Leases []LeaseInfo `json:"leases"`
+}
@@ -0,0 +1,43 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package model is to handle object of CB-Tumblebug
+package model
+
+// SchemaMigrationReport describes what a schema migration run did (or, for a dry run, would do)
+type SchemaMigrationReport struct {
+	DryRun bool `json:"dryRun"`
+	// StoredVersion is the schema version recorded in the kvstore before the run
+	StoredVersion int `json:"storedVersion" example:"0"`
+	// TargetVersion is the latest schema version known to this server
+	TargetVersion int `json:"targetVersion" example:"1"`
+	// Scanned is the number of stored objects examined
+	Scanned int `json:"scanned"`
+	// Migrated is the number of objects changed by at least one migration
+	Migrated int `json:"migrated"`
+	// Moved is the number of objects whose key was changed by a migration
+	Moved int `json:"moved"`
+	// Stamped is the number of objects that get the schema version field written
+	Stamped int                   `json:"stamped"`
+	Steps   []SchemaMigrationStep `json:"steps"`
+}
+
+// SchemaMigrationStep is the per-migration part of SchemaMigrationReport
+type SchemaMigrationStep struct {
+	Version     int    `json:"version" example:"1"`
+	Description string `json:"description"`
+	// Objects is the number of objects changed by this migration
+	Objects int `json:"objects"`
+	// SampleKeys lists a few of the changed keys (as stored before the run)
+	SampleKeys []string `json:"sampleKeys,omitempty"`
+}
@@ -50,6 +50,37 @@ type MonResultSimpleResponse struct {
 	NsId            string            `json:"nsId"`
 	InfraId         string            `json:"infraId"`
 	InfraMonitoring []MonResultSimple `json:"infraMonitoring"`
+
+	// Source is the metric source that produced the results
+	Source string `json:"source,omitempty" example:"dragonfly"`
+}
+
+// Types of metric sources
+const (
+	MetricSourceDragonfly  string = "dragonfly"
+	MetricSourcePrometheus string = "prometheus"
+	MetricSourceSsh        string = "ssh"
+)
+
+// MetricSourceConfig selects where the metrics of Nodes are read from
+type MetricSourceConfig struct {
+	// Type of the source: dragonfly (default, CB-Dragonfly agents), prometheus
+	// (Prometheus HTTP API) or ssh (agentless, samples /proc of each Node over SSH)
+	Type string `json:"type,omitempty" example:"prometheus" enums:"dragonfly,prometheus,ssh"`
+
+	// Url is the Prometheus server (default: TB_PROMETHEUS_URL). TB_PROMETHEUS_BEARER_TOKEN is
+	// sent only when it is TB_PROMETHEUS_URL. Other urls may not resolve to loopback, private
+	// or link-local addresses unless they are in TB_WEBHOOK_ALLOWED_CIDRS.
+	Url string `json:"url,omitempty" example:"http://prometheus:9090"`
+
+	// Queries overrides the PromQL query of a metric (cpu, mem, disk, net or a custom name).
+	// The placeholders {{nsId}}, {{infraId}}, {{nodeId}}, {{publicIp}}, {{privateIp}} and
+	// {{instance}} (a regex matching either IP with any port) are replaced for each Node.
+	// The default queries read node_exporter metrics.
+	Queries map[string]string `json:"queries,omitempty"`
+
+	// UserName is the SSH user of the ssh source (default: the user of each Node)
+	UserName string `json:"userName,omitempty" example:"cb-user"`
 }
 
 // DfAgentInstallReq is struct for CB-Dragonfly monitoring agent installation request
@@ -34,3 +34,35 @@ type NsInfo struct {
 
 	Description string `json:"description" example:"Description for this namespace"`
 }
+
+// NsBundleFormatVersion is the format version written into exported namespace bundles.
+// Import rejects bundles with a newer version than the running server understands.
+const NsBundleFormatVersion = 1
+
+// NsBundle is a portable archive of a namespace's metadata, used to move a namespace
+// between Tumblebug instances. Entries hold every key under /ns/{nsId} (Infras, Nodes,
+// vNets, subnets, security groups, SSH keys, data disks, templates, ...) and Labels hold
+// the /label/... records of the namespace's objects. Values are stored verbatim, so a
+// bundle contains SSH private keys and must be handled as a secret. Importing a bundle
+// restores the metadata only; it does not register the resources with CB-Spider.
+type NsBundle struct {
+	FormatVersion int             `json:"formatVersion" example:"1"`
+	NsId          string          `json:"nsId" example:"default"`
+	ExportedAt    string          `json:"exportedAt" example:"2024-01-01T00:00:00Z"`
+	Entries       []NsBundleEntry `json:"entries"`
+	Labels        []NsBundleEntry `json:"labels"`
+}
+
+// NsBundleEntry is a single key-value record in an NsBundle
+type NsBundleEntry struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// NsImportResult is the result of importing an NsBundle
+type NsImportResult struct {
+	NsId            string   `json:"nsId" example:"default"`
+	ImportedEntries int      `json:"importedEntries"`
+	ImportedLabels  int      `json:"importedLabels"`
+	ConnectionNames []string `json:"connectionNames"`
+}
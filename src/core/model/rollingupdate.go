@@ -0,0 +1,109 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package model is to handle object of CB-Tumblebug
+package model
+
+// Phases of a NodeGroup rolling update
+const (
+	RollingUpdateRunning     = "Running"
+	RollingUpdatePaused      = "Paused"
+	RollingUpdateCompleted   = "Completed"
+	RollingUpdateFailed      = "Failed"
+	RollingUpdateRollingBack = "RollingBack"
+	RollingUpdateRolledBack  = "RolledBack"
+)
+
+// Actions on an ongoing NodeGroup rolling update
+const (
+	RollingUpdateActionPause    = "pause"
+	RollingUpdateActionResume   = "resume"
+	RollingUpdateActionRollback = "rollback"
+)
+
+// Health check types of a rolling update
+const (
+	RollingUpdateHealthCheckSsh  = "ssh"
+	RollingUpdateHealthCheckHttp = "http"
+)
+
+// NodeGroupRollingUpdateReq is the request to replace the Nodes of a NodeGroup with
+// Nodes of another spec and/or image, a few at a time.
+type NodeGroupRollingUpdateReq struct {
+	// SpecId of the replacement Nodes (empty keeps the current spec)
+	SpecId string `json:"specId,omitempty" example:"aws+ap-northeast-2+t3.small"`
+	// ImageId of the replacement Nodes (empty keeps the current image)
+	ImageId string `json:"imageId,omitempty" example:"ami-01f71f215b23ba262"`
+
+	// MaxSurge is the number of Nodes that may exist above the NodeGroup size during the update.
+	// MaxSurge and MaxUnavailable both 0 means MaxSurge 1.
+	MaxSurge int `json:"maxSurge" example:"1" default:"1"`
+	// MaxUnavailable is the number of old Nodes that may be deleted before their replacements are ready
+	MaxUnavailable int `json:"maxUnavailable" example:"0" default:"0"`
+
+	// PostCommands bootstrap each replacement Node. When empty, the post-deployment
+	// phases of the Infra that target this NodeGroup (or no target) are used.
+	PostCommands []PostCommandReq `json:"postCommands,omitempty"`
+
+	// HealthCheck, when set, must pass on the replacement Nodes before old Nodes are removed
+	HealthCheck *RollingUpdateHealthCheck `json:"healthCheck,omitempty"`
+
+	// PauseAfterEachBatch pauses the update after every batch until it is resumed
+	PauseAfterEachBatch bool `json:"pauseAfterEachBatch,omitempty" example:"false"`
+}
+
+// RollingUpdateHealthCheck is how a replacement Node is checked before it takes traffic
+type RollingUpdateHealthCheck struct {
+	// Type is ssh (a trivial remote command succeeds) or http (GET returns 2xx or 3xx)
+	Type string `json:"type" example:"http" enums:"ssh,http"`
+	// Port of the HTTP check
+	Port int `json:"port,omitempty" example:"80"`
+	// Path of the HTTP check
+	Path string `json:"path,omitempty" example:"/healthz"`
+	// TimeoutSeconds bounds how long a Node may take to become healthy
+	TimeoutSeconds int `json:"timeoutSeconds,omitempty" example:"300" default:"300"`
+}
+
+// NodeGroupRollingUpdateStatus is the state of the rolling update of a NodeGroup
+type NodeGroupRollingUpdateStatus struct {
+	NsId        string `json:"nsId" example:"default"`
+	InfraId     string `json:"infraId" example:"infra01"`
+	NodeGroupId string `json:"nodeGroupId" example:"g1"`
+
+	Phase   string `json:"phase" example:"Running" enums:"Running,Paused,Completed,Failed,RollingBack,RolledBack"`
+	Message string `json:"message,omitempty"`
+
+	Request NodeGroupRollingUpdateReq `json:"request"`
+
+	// From* is the configuration rolled back to, To* the one rolled out
+	FromSpecId       string `json:"fromSpecId"`
+	FromImageId      string `json:"fromImageId"`
+	FromCspImageName string `json:"fromCspImageName,omitempty"`
+	ToSpecId         string `json:"toSpecId"`
+	ToImageId        string `json:"toImageId"`
+	ToCspImageName   string `json:"toCspImageName,omitempty"`
+
+	// OldNodeIds are the Nodes of the NodeGroup when the update started
+	OldNodeIds []string `json:"oldNodeIds"`
+	// ReplacedNodeIds are the old Nodes deleted so far
+	ReplacedNodeIds []string `json:"replacedNodeIds"`
+	// NewNodeIds are the replacement Nodes that are in service
+	NewNodeIds []string `json:"newNodeIds"`
+	// PendingNodeIds are replacement Nodes of the current batch not yet in service
+	PendingNodeIds []string `json:"pendingNodeIds,omitempty"`
+	// NLBIds are the NLBs whose membership follows the NodeGroup
+	NLBIds []string `json:"nlbIds,omitempty"`
+
+	StartedAt string `json:"startedAt" example:"2026-01-01T00:00:00Z"`
+	UpdatedAt string `json:"updatedAt" example:"2026-01-01T00:10:00Z"`
+}
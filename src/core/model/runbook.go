@@ -0,0 +1,170 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package model is to handle object of CB-Tumblebug
+package model
+
+// Types of runbook parameters
+const (
+	RunbookParamString = "string"
+	RunbookParamInt    = "int"
+	RunbookParamBool   = "bool"
+	RunbookParamEnum   = "enum"
+)
+
+// RunbookParameter is a typed input of a runbook. The steps refer to it as {{name}},
+// which is replaced by the given value: string values as a single-quoted shell word
+// (do not quote the placeholder in the script), other types as they are.
+type RunbookParameter struct {
+	// Name of the parameter (letters, digits and '_')
+	Name string `json:"name" validate:"required" example:"version"`
+
+	// Type of the value (default: string)
+	Type string `json:"type,omitempty" example:"string" enums:"string,int,bool,enum"`
+
+	// Description of the parameter
+	Description string `json:"description,omitempty" example:"nginx package version"`
+
+	// Required rejects executions without a value (and without Default)
+	Required bool `json:"required,omitempty" example:"true"`
+
+	// Default is used when no value is given
+	Default string `json:"default,omitempty" example:"1.24.0"`
+
+	// AllowedValues lists the accepted values of an enum parameter
+	AllowedValues []string `json:"allowedValues,omitempty"`
+
+	// Pattern is an optional regular expression a string value must fully match
+	Pattern string `json:"pattern,omitempty" example:"^[0-9.]+$"`
+}
+
+// RunbookStep is one step of a runbook. Steps run in order on all target Nodes.
+type RunbookStep struct {
+	// Name of the step
+	Name string `json:"name,omitempty" example:"install"`
+
+	// Command is the list of commands of the step, with {{parameter}} placeholders
+	Command []string `json:"command" validate:"required" example:"sudo apt-get install -y nginx={{version}}"`
+
+	// TimeoutMinutes overrides the timeout of the runbook for this step
+	TimeoutMinutes int `json:"timeoutMinutes,omitempty" example:"10"`
+
+	// ContinueOnError runs the next steps even if this step failed on some Nodes
+	ContinueOnError bool `json:"continueOnError,omitempty" example:"false"`
+}
+
+// RunbookTarget is the default scope of a runbook. Executions may override it.
+type RunbookTarget struct {
+	// NodeGroupId limits execution to one NodeGroup
+	NodeGroupId string `json:"nodeGroupId,omitempty" example:"g1"`
+
+	// LabelSelector limits execution to Nodes matching the selector (e.g. "role=worker")
+	LabelSelector string `json:"labelSelector,omitempty" example:"role=web"`
+}
+
+// RunbookReq is struct for creating or updating a runbook
+type RunbookReq struct {
+	// Name is the runbook ID and name
+	Name string `json:"name" validate:"required" example:"upgrade-nginx"`
+
+	// Description of the runbook
+	Description string `json:"description,omitempty" example:"Upgrade nginx and restart it"`
+
+	// Parameters are the inputs of the runbook
+	Parameters []RunbookParameter `json:"parameters,omitempty"`
+
+	// Steps are the scripts of the runbook, run in order
+	Steps []RunbookStep `json:"steps" validate:"required"`
+
+	// UserName is the default SSH user of the executions
+	UserName string `json:"userName,omitempty" example:"cb-user"`
+
+	// TimeoutMinutes is the default timeout of each step (default: 30, max: 120)
+	TimeoutMinutes int `json:"timeoutMinutes,omitempty" example:"30"`
+
+	// Target is the default scope of the executions (all Nodes when empty)
+	Target RunbookTarget `json:"target,omitempty"`
+}
+
+// RunbookInfo is struct for a runbook stored in ETCD
+type RunbookInfo struct {
+	// ResourceType is the type of the resource
+	ResourceType string `json:"resourceType" example:"runbook"`
+
+	// Id is unique identifier for the runbook
+	Id string `json:"id" example:"upgrade-nginx"`
+
+	// Name is human-readable string to represent the runbook
+	Name string `json:"name" example:"upgrade-nginx"`
+
+	// Description of the runbook
+	Description string `json:"description,omitempty" example:"Upgrade nginx and restart it"`
+
+	// Version starts at 1 and increases with each update; previous versions stay available
+	Version int `json:"version" example:"1"`
+
+	Parameters     []RunbookParameter `json:"parameters,omitempty"`
+	Steps          []RunbookStep      `json:"steps"`
+	UserName       string             `json:"userName,omitempty" example:"cb-user"`
+	TimeoutMinutes int                `json:"timeoutMinutes,omitempty" example:"30"`
+	Target         RunbookTarget      `json:"target,omitempty"`
+
+	// CreatedAt is the creation timestamp of the runbook
+	CreatedAt string `json:"createdAt" example:"2024-01-01T00:00:00Z"`
+
+	// UpdatedAt is the creation timestamp of this version
+	UpdatedAt string `json:"updatedAt" example:"2024-01-01T00:00:00Z"`
+}
+
+// RunbookListResponse is struct for listing runbooks or the versions of a runbook
+type RunbookListResponse struct {
+	Runbooks []RunbookInfo `json:"runbooks"`
+}
+
+// RunbookRef refers to a runbook from a post-deployment command phase.
+// The phase runs one step after another, as if each step were a phase of its own.
+type RunbookRef struct {
+	// RunbookId is the ID of the runbook in the namespace of the Infra
+	RunbookId string `json:"runbookId" validate:"required" example:"upgrade-nginx"`
+
+	// Version pins a version of the runbook (default: the latest version at execution time)
+	Version int `json:"version,omitempty" example:"1"`
+
+	// Parameters are the values of the runbook parameters
+	Parameters map[string]string `json:"parameters,omitempty"`
+}
+
+// RunbookRunReq is struct for executing a runbook on an Infra
+type RunbookRunReq struct {
+	// Version of the runbook to run (default: the latest version)
+	Version int `json:"version,omitempty" example:"1"`
+
+	// Parameters are the values of the runbook parameters
+	Parameters map[string]string `json:"parameters,omitempty"`
+
+	// UserName overrides the SSH user of the runbook
+	UserName string `json:"userName,omitempty" example:"cb-user"`
+}
+
+// RunbookRunResult is the outcome of a runbook execution on an Infra
+type RunbookRunResult struct {
+	RunbookId string `json:"runbookId" example:"upgrade-nginx"`
+	Version   int    `json:"version" example:"1"`
+	InfraId   string `json:"infraId" example:"infra01"`
+
+	// Status is the aggregated outcome of the steps
+	Status PostCommandStatus `json:"status" example:"Completed"`
+
+	// Steps holds the outcome of each step, in order
+	Steps []PostCommandPhaseResult `json:"steps"`
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package model is to handle object of CB-Tumblebug
+package model
+
+// Types of the control messages of a terminal session (WebSocket text frames)
+const (
+	TerminalMsgInput  = "input"
+	TerminalMsgResize = "resize"
+	TerminalMsgPing   = "ping"
+)
+
+// TerminalReq is struct for opening an interactive terminal session on a Node
+type TerminalReq struct {
+	// UserName overrides the SSH user of the Node
+	UserName string `json:"userName,omitempty" example:"cb-user"`
+
+	// Cols and Rows are the initial size of the PTY (default: 80x24)
+	Cols int `json:"cols,omitempty" example:"120"`
+	Rows int `json:"rows,omitempty" example:"40"`
+
+	// Term is the terminal type requested for the PTY (default: xterm-256color)
+	Term string `json:"term,omitempty" example:"xterm-256color"`
+
+	// IdleTimeoutMinutes closes the session after this long without input (default: 15, max: 240)
+	IdleTimeoutMinutes int `json:"idleTimeoutMinutes,omitempty" example:"15"`
+
+	// Record stores the output of the session in asciicast v2 format for auditing
+	Record bool `json:"record,omitempty" example:"true"`
+}
+
+// TerminalMessage is a control message sent by the client as a WebSocket text frame.
+// Binary frames carry raw terminal input; the server sends the terminal output as binary frames.
+type TerminalMessage struct {
+	// Type of the message: input, resize or ping
+	Type string `json:"type" example:"resize" enums:"input,resize,ping"`
+
+	// Data is the input of an input message
+	Data string `json:"data,omitempty" example:"ls -al\r"`
+
+	// Cols and Rows are the new size of a resize message
+	Cols int `json:"cols,omitempty" example:"120"`
+	Rows int `json:"rows,omitempty" example:"40"`
+}
+
+// TerminalRecordingInfo describes the recording of a terminal session on a Node
+type TerminalRecordingInfo struct {
+	SessionId string `json:"sessionId" example:"d2k4l8a1q8b0c7f3e9h0"`
+	NsId      string `json:"nsId" example:"default"`
+	InfraId   string `json:"infraId" example:"infra01"`
+	NodeId    string `json:"nodeId" example:"g1-1"`
+
+	// UserName is the SSH user of the session
+	UserName string `json:"userName" example:"cb-user"`
+
+	// ClientIp is the address of the API client that opened the session
+	ClientIp string `json:"clientIp,omitempty" example:"10.0.0.5"`
+
+	StartedAt       string `json:"startedAt" example:"2024-01-01T00:00:00Z"`
+	EndedAt         string `json:"endedAt,omitempty" example:"2024-01-01T00:10:00Z"`
+	DurationSeconds int64  `json:"durationSeconds" example:"600"`
+
+	// EndReason tells why the session ended (e.g. "exit", "idle timeout", "client closed")
+	EndReason string `json:"endReason,omitempty" example:"exit"`
+
+	// Bytes is the size of the stored asciicast
+	Bytes int `json:"bytes" example:"20480"`
+
+	// Truncated is true when the output exceeded the recording size limit
+	Truncated bool `json:"truncated,omitempty" example:"false"`
+}
+
+// TerminalRecordingListResponse is struct for listing the terminal recordings of a Node
+type TerminalRecordingListResponse struct {
+	Recordings []TerminalRecordingInfo `json:"recordings"`
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"sync"
 
+	"github.com/cloud-barista/cb-tumblebug/src/core/common"
 	"github.com/cloud-barista/cb-tumblebug/src/core/model"
 )
 
@@ -50,7 +51,23 @@ func (m *Manager) RunReconcile(ctx context.Context, nsId string, resourceType st
 		return nil, fmt.Errorf("no reconciler registered for resource type: %s", resourceType)
 	}
 
-	return reconciler.Reconcile(ctx, nsId, resourceId, optPreloadedStatus)
+	result, err := reconciler.Reconcile(ctx, nsId, resourceId, optPreloadedStatus)
+	data := model.EventData{
+		NsId:         nsId,
+		ResourceType: resourceType,
+		ResourceId:   resourceId,
+		RequestId:    common.RequestIDFromContext(ctx),
+	}
+	if err != nil {
+		data.Message = err.Error()
+		common.PublishEvent(model.EventTypeReconcileFailed, data)
+	} else {
+		if msg, ok := result.(model.SimpleMsg); ok {
+			data.Message = msg.Message
+		}
+		common.PublishEvent(model.EventTypeReconcileCompleted, data)
+	}
+	return result, err
 }
 
 // RunReconcileAll routes the namespace-level batch reconcile request to the registered Reconciler.
@@ -63,5 +80,27 @@ func (m *Manager) RunReconcileAll(ctx context.Context, nsId string, resourceType
 		return model.ResourceReconcileResults{}, fmt.Errorf("no reconciler registered for resource type: %s", resourceType)
 	}
 
-	return reconciler.ReconcileAll(ctx, nsId, maxConcurrent)
+	results, err := reconciler.ReconcileAll(ctx, nsId, maxConcurrent)
+	requestId := common.RequestIDFromContext(ctx)
+	for _, r := range results.Results {
+		data := model.EventData{
+			NsId:         nsId,
+			ResourceType: r.ResourceType,
+			ResourceId:   r.ResourceId,
+			RequestId:    requestId,
+			Message:      r.Message,
+		}
+		if r.ResourceType == "" {
+			data.ResourceType = resourceType
+		}
+		if r.Success {
+			common.PublishEvent(model.EventTypeReconcileCompleted, data)
+			continue
+		}
+		if r.Error != "" {
+			data.Message = r.Error
+		}
+		common.PublishEvent(model.EventTypeReconcileFailed, data)
+	}
+	return results, err
 }
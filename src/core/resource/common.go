@@ -2071,23 +2071,30 @@ func UpdateAssociatedObjectList(nsId string, resourceType string, resourceId str
 
 	key := common.GenResourceKey(nsId, resourceType, resourceId)
 
-	keyValue, exists, err := kvstore.GetKv(key)
-	if err != nil {
-		log.Error().Err(err).Msg("")
-		return nil, err
-	}
+	// Parallel Node creation adds to the same list concurrently, so apply the change
+	// with compare-and-swap and redo it on the fresh value when another writer wins.
+	exists := false
+	err = kvstore.UpdateWithRetry(context.Background(), key, func(current string, found bool) (string, bool, error) {
+		exists = found
+		if !found {
+			return "", false, nil
+		}
+
+		type stringList struct {
+			AssociatedObjectList []string `json:"associatedObjectList"`
+		}
+		stored := stringList{}
+		json.Unmarshal([]byte(current), &stored)
+		objList := stored.AssociatedObjectList
 
-	if exists {
-		objList, _ := GetAssociatedObjectList(nsId, resourceType, resourceId)
 		switch cmd {
 		case model.StrAdd:
 			if slices.Contains(objList, objectKey) {
 				errString := objectKey + " is already associated with " + resourceType + " " + resourceId + "."
-				err = fmt.Errorf("%s", errString)
-				return nil, err
+				return "", false, fmt.Errorf("%s", errString)
 			}
 			var anyJson map[string]any
-			json.Unmarshal([]byte(keyValue.Value), &anyJson)
+			json.Unmarshal([]byte(current), &anyJson)
 			if anyJson["associatedObjectList"] == nil {
 				arrayToBe := []string{objectKey}
 
@@ -2100,41 +2107,28 @@ func UpdateAssociatedObjectList(nsId string, resourceType string, resourceId str
 				anyJson["associatedObjectList"] = arrayToBe
 			}
 			updatedJson, _ := json.Marshal(anyJson)
+			return string(updatedJson), true, nil
 
-			keyValue.Value = string(updatedJson)
 		case model.StrDelete:
-			var foundKey int
-			var foundVal string
-			for k, v := range objList {
-				if v == objectKey {
-					foundKey = k
-					foundVal = v
-					break
-				}
-			}
-			if foundVal == "" {
+			foundKey := slices.Index(objList, objectKey)
+			if foundKey < 0 {
 				errString := "Cannot find the associated object " + objectKey + "."
-				err = fmt.Errorf("%s", errString)
-				return nil, err
-			} else {
-				keyValue.Value, err = sjson.Delete(keyValue.Value, "associatedObjectList."+strconv.Itoa(foundKey))
-				if err != nil {
-					log.Error().Err(err).Msg("")
-					return nil, err
-				}
+				return "", false, fmt.Errorf("%s", errString)
 			}
+			updated, err := sjson.Delete(current, "associatedObjectList."+strconv.Itoa(foundKey))
+			if err != nil {
+				return "", false, err
+			}
+			return updated, true, nil
 		}
+		return "", false, nil
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return nil, err
+	}
 
-		if err != nil {
-			log.Error().Err(err).Msg("")
-			return nil, err
-		}
-		err = kvstore.Put(key, keyValue.Value)
-		if err != nil {
-			log.Error().Err(err).Msg("")
-			return nil, err
-		}
-
+	if exists {
 		result, _ := GetAssociatedObjectList(nsId, resourceType, resourceId)
 		return result, nil
 	}
@@ -2151,50 +2145,48 @@ func BatchRemoveFromAssociatedObjectList(nsId string, resourceType string, resou
 		return nil
 	}
 
-	key := common.GenResourceKey(nsId, resourceType, resourceId)
-	keyValue, exists, err := kvstore.GetKv(key)
-	if err != nil {
-		return err
-	}
-	if !exists {
-		return nil
-	}
-
 	toRemove := make(map[string]struct{}, len(objectKeys))
 	for _, k := range objectKeys {
 		toRemove[k] = struct{}{}
 	}
 
-	var anyJson map[string]any
-	if err := json.Unmarshal([]byte(keyValue.Value), &anyJson); err != nil {
-		return err
-	}
+	key := common.GenResourceKey(nsId, resourceType, resourceId)
+	return kvstore.UpdateWithRetry(context.Background(), key, func(current string, exists bool) (string, bool, error) {
+		if !exists {
+			return "", false, nil
+		}
 
-	raw, ok := anyJson["associatedObjectList"]
-	if !ok || raw == nil {
-		return nil
-	}
-	existing, ok := raw.([]any)
-	if !ok {
-		return nil
-	}
+		var anyJson map[string]any
+		if err := json.Unmarshal([]byte(current), &anyJson); err != nil {
+			return "", false, err
+		}
 
-	filtered := make([]any, 0, len(existing))
-	for _, v := range existing {
-		s, ok := v.(string)
-		if ok {
-			if _, remove := toRemove[s]; !remove {
-				filtered = append(filtered, v)
+		raw, ok := anyJson["associatedObjectList"]
+		if !ok || raw == nil {
+			return "", false, nil
+		}
+		existing, ok := raw.([]any)
+		if !ok {
+			return "", false, nil
+		}
+
+		filtered := make([]any, 0, len(existing))
+		for _, v := range existing {
+			s, ok := v.(string)
+			if ok {
+				if _, remove := toRemove[s]; !remove {
+					filtered = append(filtered, v)
+				}
 			}
 		}
-	}
-	anyJson["associatedObjectList"] = filtered
+		anyJson["associatedObjectList"] = filtered
 
-	updated, err := json.Marshal(anyJson)
-	if err != nil {
-		return err
-	}
-	return kvstore.Put(key, string(updated))
+		updated, err := json.Marshal(anyJson)
+		if err != nil {
+			return "", false, err
+		}
+		return string(updated), true, nil
+	})
 }
 
 // CustomImageCreationTimeout is the maximum time to wait for a custom image to become available
@@ -3684,29 +3676,31 @@ func UpdateResourceObject(nsId string, resourceType string, resourceObject any)
 	// For other resource types, use kvstore (existing code)
 	key := common.GenResourceKey(nsId, resourceType, resourceId)
 
-	// Check existence of the key. If no key, no update.
-	keyValue, exists, err := kvstore.GetKv(key)
-	if !exists || err != nil {
-		return
-	}
+	// Compare-and-swap so a concurrent writer's change is re-read instead of overwritten
+	err = kvstore.UpdateWithRetry(context.Background(), key, func(current string, exists bool) (string, bool, error) {
+		// If no key, no update.
+		if !exists {
+			return "", false, nil
+		}
 
-	// Implementation 2
-	var oldObject any
-	err = json.Unmarshal([]byte(keyValue.Value), &oldObject)
-	if err != nil {
-		log.Error().Err(err).Msg("")
-	}
+		// Implementation 2
+		var oldObject any
+		if err := json.Unmarshal([]byte(current), &oldObject); err != nil {
+			log.Error().Err(err).Msg("")
+		}
+		if reflect.DeepEqual(oldObject, resourceObject) {
+			return "", false, nil
+		}
 
-	if !reflect.DeepEqual(oldObject, resourceObject) {
 		val, _ := json.Marshal(resourceObject)
 		// Callers pass a snapshot taken earlier, so a whole-object write would revert
 		// associatedObjectList changes made meanwhile by UpdateAssociatedObjectList
 		// (the only writer of that field). Keep the stored value.
-		val = preserveAssociatedObjectList(keyValue.Value, val)
-		err = kvstore.Put(key, string(val))
-		if err != nil {
-			log.Error().Err(err).Msg("")
-		}
+		val = preserveAssociatedObjectList(current, val)
+		return string(val), true, nil
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("")
 	}
 
 }
@@ -3715,10 +3709,12 @@ func UpdateResourceObject(nsId string, resourceType string, resourceObject any)
 // associatedObjectList, which is maintained separately by UpdateAssociatedObjectList.
 // Use it instead of kvstore.Put when writing a whole resource snapshot.
 func PutResourceObject(key string, value []byte) error {
-	if keyValue, exists, err := kvstore.GetKv(key); err == nil && exists {
-		value = preserveAssociatedObjectList(keyValue.Value, value)
-	}
-	return kvstore.Put(key, string(value))
+	return kvstore.UpdateWithRetry(context.Background(), key, func(current string, exists bool) (string, bool, error) {
+		if !exists {
+			return string(value), true, nil
+		}
+		return string(preserveAssociatedObjectList(current, value)), true, nil
+	})
 }
 
 // UpdateResourceStatus updates only the status field of a stored resource, leaving
@@ -3726,16 +3722,30 @@ func PutResourceObject(key string, value []byte) error {
 // only the status is known to have changed.
 func UpdateResourceStatus(nsId string, resourceType string, resourceId string, status string) error {
 	key := common.GenResourceKey(nsId, resourceType, resourceId)
-	keyValue, exists, err := kvstore.GetKv(key)
-	if err != nil || !exists {
-		return err
-	}
-	updated, err := sjson.Set(keyValue.Value, "status", status)
-	if err != nil {
-		log.Error().Err(err).Msg("")
-		return err
+	oldStatus, written := "", false
+	err := kvstore.UpdateWithRetry(context.Background(), key, func(current string, exists bool) (string, bool, error) {
+		if !exists {
+			return "", false, nil
+		}
+		oldStatus = gjson.Get(current, "status").String()
+		updated, err := sjson.Set(current, "status", status)
+		if err != nil {
+			log.Error().Err(err).Msg("")
+			return "", false, err
+		}
+		written = true
+		return updated, true, nil
+	})
+	if err == nil && written && oldStatus != status {
+		common.PublishEvent(model.EventTypeResourceStatusChanged, model.EventData{
+			NsId:         nsId,
+			ResourceType: resourceType,
+			ResourceId:   resourceId,
+			OldStatus:    oldStatus,
+			NewStatus:    status,
+		})
 	}
-	return kvstore.Put(key, updated)
+	return err
 }
 
 // preserveAssociatedObjectList carries the stored associatedObjectList over into the
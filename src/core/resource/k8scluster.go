@@ -183,6 +183,17 @@ func storeK8sClusterInfo(nsId string, newTbK8sCInfo *model.K8sClusterInfo) {
 	}
 }
 
+// SetK8sClusterSystemMessage records a system message on a K8sCluster
+func SetK8sClusterSystemMessage(nsId string, k8sClusterId string, msg string) error {
+	tbK8sCInfo, err := getK8sClusterInfo(nsId, k8sClusterId)
+	if err != nil {
+		return err
+	}
+	tbK8sCInfo.SystemMessage = msg
+	storeK8sClusterInfo(nsId, tbK8sCInfo)
+	return nil
+}
+
 // deleteK8sClusterInfo is func to delete K8sClusterInfo
 func deleteK8sClusterInfo(nsId, k8sClusterId string) error {
 	log.Debug().Msg("[Delete K8sClusterInfo] " + k8sClusterId)
@@ -200,6 +211,10 @@ func deleteK8sClusterInfo(nsId, k8sClusterId string) error {
 		return fmt.Errorf("failed to delete K8sClusterInfo(%s): %v", k8sClusterId, err)
 	}
 
+	if err := common.DelLease(nsId, model.StrK8s, k8sClusterId); err != nil {
+		log.Warn().Err(err).Msgf("Failed to delete the lease of K8sCluster(%s)", k8sClusterId)
+	}
+
 	// Delete associated label
 	if k8sInfo != nil && k8sInfo.Uid != "" {
 		if labelErr := label.DeleteLabelObject(model.StrK8s, k8sInfo.Uid); labelErr != nil {
@@ -210,6 +225,16 @@ func deleteK8sClusterInfo(nsId, k8sClusterId string) error {
 	return nil
 }
 
+// ValidateK8sClusterExpiration checks the expiration option of a K8sCluster request.
+// A K8sCluster cannot be suspended, so it can only be deleted on expiry.
+func ValidateK8sClusterExpiration(opt model.ExpirationOption) error {
+	if strings.EqualFold(opt.ExpirationAction, model.LeaseActionSuspend) {
+		return fmt.Errorf("a K8sCluster cannot be suspended on expiry; use expirationAction %s", model.LeaseActionDelete)
+	}
+	_, _, err := common.ResolveExpiration(opt, time.Now())
+	return err
+}
+
 // CreateK8sCluster create a k8s cluster
 func CreateK8sCluster(ctx context.Context, nsId string, req *model.K8sClusterReq, option string, skipVersionCheck bool) (*model.K8sClusterInfo, error) {
 	log.Info().Msg("CreateK8sCluster")
@@ -240,6 +265,12 @@ func CreateK8sCluster(ctx context.Context, nsId string, req *model.K8sClusterReq
 		return emptyObj, err
 	}
 
+	err = ValidateK8sClusterExpiration(req.ExpirationOption)
+	if err != nil {
+		log.Err(err).Msgf("Failed to Create a K8sCluster(%s)", k8sClusterId)
+		return emptyObj, err
+	}
+
 	/*
 	 * Check for K8sCluster Enablement from K8sClusterSetting
 	 */
@@ -289,6 +320,11 @@ func CreateK8sCluster(ctx context.Context, nsId string, req *model.K8sClusterReq
 		return emptyObj, err
 	}
 
+	err = common.RegisterLease(nsId, model.StrK8s, k8sClusterId, req.ExpirationOption)
+	if err != nil {
+		log.Err(err).Msgf("Failed to register the lease of K8sCluster(%s)", k8sClusterId)
+	}
+
 	var createErr error
 	defer func() {
 		if createErr != nil {
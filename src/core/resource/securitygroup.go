@@ -784,6 +784,21 @@ func GetSecurityGroup(nsId string, securityGroupId string) (model.SecurityGroupI
 	return sg, nil
 }
 
+// DiffFirewallRules returns the rules UpdateFirewallRules would add to and delete from
+// the security group to reach desiredRules, without changing anything.
+func DiffFirewallRules(nsId string, securityGroupId string, desiredRules []model.FirewallRuleReq) (toAdd, toDelete []model.FirewallRuleInfo, err error) {
+	desiredRulesInfos := []model.FirewallRuleInfo{}
+	for _, rule := range desiredRules {
+		desiredRulesInfos = append(desiredRulesInfos, ConvertFirewallRuleRequestObjToInfoObjs(rule)...)
+	}
+	sg, err := GetSecurityGroup(nsId, securityGroupId)
+	if err != nil {
+		return nil, nil, err
+	}
+	toAdd, toDelete = diffFirewallRules(sg.FirewallRules, desiredRulesInfos)
+	return toAdd, toDelete, nil
+}
+
 // UpdateFirewallRules updates the firewall rules of a security group
 func UpdateFirewallRules(nsId string, securityGroupId string, desiredRules []model.FirewallRuleReq) (model.SecurityGroupUpdateResponse, error) {
 
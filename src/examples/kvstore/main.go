@@ -443,7 +443,7 @@ func watchSingleKey(ctx context.Context, wg *sync.WaitGroup) {
 				return
 			}
 			for _, ev := range resp.Events {
-				fmt.Printf("(Single key watch) Type: %s Key: %s Value: %s\n", ev.Type, ev.Kv.Key, ev.Kv.Value)
+				fmt.Printf("(Single key watch) Type: %s Key: %s Value: %s\n", ev.Type, ev.Key, ev.Value)
 			}
 		case <-ctx.Done():
 			fmt.Println("Single key watch cancelled")
@@ -463,7 +463,7 @@ func watchMultipleKeys(ctx context.Context, wg *sync.WaitGroup) {
 				return
 			}
 			for _, ev := range resp.Events {
-				fmt.Printf("(Multiple keys watch) Type: %s Key: %s Value: %s\n", ev.Type, ev.Kv.Key, ev.Kv.Value)
+				fmt.Printf("(Multiple keys watch) Type: %s Key: %s Value: %s\n", ev.Type, ev.Key, ev.Value)
 			}
 		case <-ctx.Done():
 			fmt.Println("Multiple keys watch cancelled")
@@ -0,0 +1,110 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package common is to handle REST API for common funcitonalities
+package common
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/cloud-barista/cb-tumblebug/src/core/common/backup"
+	clientManager "github.com/cloud-barista/cb-tumblebug/src/core/common/client"
+)
+
+// RestPostBackup godoc
+// @ID PostBackup
+// @Summary Take a backup of CB-Tumblebug state now
+// @Description Serialize every kvstore key and the spec/image tables into an archive and store it in the configured backup target (TB_BACKUP_TARGET: local or s3).
+// @Description Archives outside of the retention policy (TB_BACKUP_RETENTION_COUNT, TB_BACKUP_RETENTION_DAYS) are pruned afterwards.
+// @Description Note: the archive contains SSH private keys and other secrets, so protect the backup target accordingly.
+// @Tags [Admin] System Configuration
+// @Accept  json
+// @Produce  json
+// @Success 200 {object} model.BackupResult
+// @Failure 500 {object} model.SimpleMsg
+// @Param x-request-id header string false "Custom request ID for tracking"
+// @Router /backup [post]
+func RestPostBackup(c echo.Context) error {
+	content, err := backup.Create(c.Request().Context())
+	return clientManager.EndRequestWithLog(c, err, content)
+}
+
+// RestGetBackupList godoc
+// @ID GetBackupList
+// @Summary List backups
+// @Description List the backup archives in the configured backup target, newest first
+// @Tags [Admin] System Configuration
+// @Accept  json
+// @Produce  json
+// @Success 200 {object} model.BackupListResponse
+// @Failure 500 {object} model.SimpleMsg
+// @Param x-request-id header string false "Custom request ID for tracking"
+// @Router /backup [get]
+func RestGetBackupList(c echo.Context) error {
+	content, err := backup.List(c.Request().Context())
+	return clientManager.EndRequestWithLog(c, err, content)
+}
+
+// RestDeleteBackup godoc
+// @ID DeleteBackup
+// @Summary Delete a backup
+// @Description Delete a backup archive from the configured backup target
+// @Tags [Admin] System Configuration
+// @Accept  json
+// @Produce  json
+// @Param backupName path string true "Backup archive name" default(tumblebug-backup-20260101T000000Z.jsonl.gz)
+// @Success 200 {object} model.SimpleMsg
+// @Failure 404 {object} model.SimpleMsg
+// @Failure 500 {object} model.SimpleMsg
+// @Param x-request-id header string false "Custom request ID for tracking"
+// @Router /backup/{backupName} [delete]
+func RestDeleteBackup(c echo.Context) error {
+	name := c.Param("backupName")
+	if err := backup.Delete(c.Request().Context(), name); err != nil {
+		if backup.IsNotFound(err) {
+			return clientManager.EndRequestWithLogAndStatus(c, err, nil, http.StatusNotFound)
+		}
+		return clientManager.EndRequestWithLog(c, err, nil)
+	}
+	content := map[string]string{"message": "The backup " + name + " has been deleted"}
+	return clientManager.EndRequestWithLog(c, nil, content)
+}
+
+// RestPostBackupRestore godoc
+// @ID PostBackupRestore
+// @Summary Restore a backup
+// @Description Restore CB-Tumblebug state from a backup archive.
+// @Description Without nsId, the whole instance is restored: every kvstore key is reset to the backup (keys created after the backup are deleted) and the spec/image tables are replaced.
+// @Description With nsId, only that namespace (its objects, their labels and its spec/image rows) is replaced; the rest of the instance is untouched.
+// @Description Labels are restored as stored and are not pushed to the CSP. Objects from an older release are upgraded by the schema migrations.
+// @Description Restore is a maintenance operation; avoid running other requests at the same time.
+// @Tags [Admin] System Configuration
+// @Accept  json
+// @Produce  json
+// @Param backupName path string true "Backup archive name" default(tumblebug-backup-20260101T000000Z.jsonl.gz)
+// @Param nsId query string false "Restore only this namespace"
+// @Success 200 {object} model.BackupRestoreResult
+// @Failure 400 {object} model.SimpleMsg
+// @Failure 404 {object} model.SimpleMsg
+// @Failure 500 {object} model.SimpleMsg
+// @Param x-request-id header string false "Custom request ID for tracking"
+// @Router /backup/{backupName}/restore [post]
+func RestPostBackupRestore(c echo.Context) error {
+	content, err := backup.Restore(c.Request().Context(), c.Param("backupName"), c.QueryParam("nsId"))
+	if backup.IsNotFound(err) {
+		return clientManager.EndRequestWithLogAndStatus(c, err, nil, http.StatusNotFound)
+	}
+	return clientManager.EndRequestWithLog(c, err, content)
+}
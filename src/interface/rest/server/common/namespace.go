@@ -194,3 +194,61 @@ func RestPutNs(c echo.Context) error {
 	content, err := common.UpdateNs(c.Param("nsId"), u)
 	return clientManager.EndRequestWithLog(c, err, content)
 }
+
+// RestGetNsExport godoc
+// @ID GetNsExport
+// @Summary Export namespace as a portable bundle
+// @Description Export every metadata record of the namespace (Infras, Nodes, vNets, subnets, security groups, SSH keys, data disks, templates, ...) and the labels of its objects as a versioned bundle.
+// @Description The bundle can be imported into another CB-Tumblebug instance with POST /ns/import.
+// @Description Note: the bundle contains SSH private keys stored in the namespace, so handle it as a secret.
+// @Description The secrets of event subscriptions and of Infra policy webhooks are left out of the bundle; set them again after the import.
+// @Tags [Admin] System Configuration
+// @Accept  json
+// @Produce  json
+// @Param nsId path string true "Namespace ID" default(default)
+// @Success 200 {object} model.NsBundle
+// @Failure 404 {object} model.SimpleMsg
+// @Failure 500 {object} model.SimpleMsg
+// @Param x-request-id header string false "Custom request ID for tracking"
+// @Router /ns/{nsId}/export [get]
+func RestGetNsExport(c echo.Context) error {
+
+	if err := Validate(c, []string{"nsId"}); err != nil {
+		return clientManager.EndRequestWithLog(c, err, nil)
+	}
+
+	nsId := c.Param("nsId")
+	content, err := common.ExportNs(nsId)
+	if err == nil {
+		c.Response().Header().Set(echo.HeaderContentDisposition, "attachment; filename=\"ns-"+nsId+"-bundle.json\"")
+	}
+	return clientManager.EndRequestWithLog(c, err, content)
+}
+
+// RestPostNsImport godoc
+// @ID PostNsImport
+// @Summary Import namespace from a bundle
+// @Description Re-create a namespace from a bundle exported by GET /ns/{nsId}/export.
+// @Description The namespace must not exist yet, and every connection config referenced by the bundle must exist on this server.
+// @Description Import is metadata-only: the records and labels are stored as-is in one transaction and CB-Spider is never called.
+// @Description The imported objects can be controlled once their CSP resources are registered with the CB-Spider of this server under the same connection configs.
+// @Tags [Admin] System Configuration
+// @Accept  json
+// @Produce  json
+// @Param bundle body model.NsBundle true "Namespace bundle"
+// @Success 200 {object} model.NsImportResult
+// @Failure 400 {object} model.SimpleMsg
+// @Failure 500 {object} model.SimpleMsg
+// @Param x-request-id header string false "Custom request ID for tracking"
+// @Router /ns/import [post]
+func RestPostNsImport(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	bundle := &model.NsBundle{}
+	if err := c.Bind(bundle); err != nil {
+		return clientManager.EndRequestWithLog(c, err, nil)
+	}
+
+	content, err := common.ImportNs(ctx, bundle)
+	return clientManager.EndRequestWithLog(c, err, content)
+}
@@ -155,7 +155,7 @@ func checkDependencies() (bool, string) {
 // @ID GetReadyz
 // RestGetReadyz godoc
 // @Summary Check Tumblebug is ready
-// @Description Check Tumblebug is ready. Returns ready status and initialization status. With TB_READYZ_CHECK_DEPS=true, also verifies etcd/PostgreSQL connectivity.
+// @Description Check Tumblebug is ready. Returns ready status, initialization status and which replica leads the background controllers. With TB_READYZ_CHECK_DEPS=true, also verifies etcd/PostgreSQL connectivity.
 // @Tags [Admin] System Management
 // @Accept  json
 // @Produce  json
@@ -167,6 +167,11 @@ func RestGetReadyz(c echo.Context) error {
 	response := model.ReadyzResponse{
 		Ready:       model.SystemReady,
 		Initialized: model.SystemInitialized,
+		ReplicaId:   common.ReplicaId(),
+		IsLeader:    common.IsLeader(),
+	}
+	if leader, exists, err := common.GetLeaderInfo(); err == nil && exists {
+		response.Leader = &leader
 	}
 
 	if !model.SystemReady {
@@ -298,6 +303,25 @@ func RestGetOpenBaoStatus(c echo.Context) error {
 	return clientManager.EndRequestWithLog(c, nil, status)
 }
 
+// RestPostKvEncryptionRotate godoc
+// @ID PostKvEncryptionRotate
+// @Summary Rotate the kvstore encryption key
+// @Description Generate a new data key for kvstore encryption (TB_KVSTORE_ENCRYPTION), re-wrap older data keys with the current master key, and re-encrypt every protected value (SSH private keys, RDBMS passwords, kubeconfigs, ...) with the new data key.
+// @Description Values stored in plaintext before encryption was enabled are encrypted as well.
+// @Description To replace a local master key, put the new key file first in TB_KVSTORE_ENCRYPTION_KEY_FILE (keeping the old one after it), restart, and rotate; the old key file can then be removed.
+// @Tags [Admin] System Configuration
+// @Accept  json
+// @Produce  json
+// @Success 200 {object} model.KvEncryptionRotationResult
+// @Failure 400 {object} model.SimpleMsg
+// @Failure 500 {object} model.SimpleMsg
+// @Param x-request-id header string false "Custom request ID for tracking"
+// @Router /kvstore/encryption/rotate [post]
+func RestPostKvEncryptionRotate(c echo.Context) error {
+	content, err := common.RotateKvEncryptionKey(c.Request().Context())
+	return clientManager.EndRequestWithLog(c, err, content)
+}
+
 // RestRegisterCredential is a REST API handler for registering credentials.
 // @ID RegisterCredential
 // @Summary Register Credential Information
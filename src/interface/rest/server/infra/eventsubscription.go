@@ -0,0 +1,283 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package infra is to handle REST API for infra
+package infra
+
+import (
+	clientManager "github.com/cloud-barista/cb-tumblebug/src/core/common/client"
+	"github.com/cloud-barista/cb-tumblebug/src/core/infra"
+	"github.com/cloud-barista/cb-tumblebug/src/core/model"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog/log"
+)
+
+// RestPostEventSubscription godoc
+// @ID PostEventSubscription
+// @Summary Create an event subscription
+// @Description Create an outbound webhook subscription: the events of the namespace that pass its filters are POSTed to its URL.
+// @Description
+// @Description Events are CloudEvents v1.0 (`format: cloudevents`), or `{"text": "<summary>"}` (`format: text`) for Slack and Microsoft Teams incoming webhooks.
+// @Description Event types: node.created, node.createFailed, node.statusChanged, node.driftDetected, infra.deleted, resource.statusChanged,
+// @Description reconcile.completed, reconcile.failed and command.completed (all prefixed by `org.cloud-barista.tumblebug.`).
+// @Description
+// @Description With a secret, requests carry `x-tb-timestamp` (Unix seconds) and `x-tb-signature: sha256=<hex HMAC-SHA256 of "<timestamp>.<body>">`.
+// @Description Failed deliveries (no response, 408, 429 or 5xx) are retried with exponential backoff (2s, 4s, 8s, ... up to 5m);
+// @Description deliveries that exhaust their retries or get another 4xx go to the dead letters of the subscription.
+// @Description Events are delivered in order per subscription; up to 1000 events wait for a slow endpoint, the next ones go to the dead letters.
+// @Description
+// @Description URLs that resolve to loopback, private or link-local addresses are refused, except the ranges in TB_WEBHOOK_ALLOWED_CIDRS.
+// @Tags [Admin] Event Subscription Management
+// @Accept  json
+// @Produce  json
+// @Param nsId path string true "Namespace ID" default(default)
+// @Param eventSubscriptionReq body model.EventSubscriptionReq true "Event subscription request"
+// @Success 200 {object} model.EventSubscriptionInfo "Created event subscription (secret masked)"
+// @Failure 400 {object} model.SimpleMsg "Invalid request"
+// @Failure 500 {object} model.SimpleMsg "Internal error"
+// @Param x-request-id header string false "Custom request ID for tracking"
+// @Router /ns/{nsId}/eventSubscription [post]
+func RestPostEventSubscription(c echo.Context) error {
+	nsId := c.Param("nsId")
+
+	req := &model.EventSubscriptionReq{}
+	if err := c.Bind(req); err != nil {
+		log.Warn().Err(err).Msg("invalid request")
+		return clientManager.EndRequestWithLog(c, err, nil)
+	}
+
+	result, err := infra.CreateEventSubscription(nsId, req)
+	return clientManager.EndRequestWithLog(c, err, result)
+}
+
+// RestGetEventSubscription godoc
+// @ID GetEventSubscription
+// @Summary Get an event subscription
+// @Description Get an event subscription (secret masked).
+// @Tags [Admin] Event Subscription Management
+// @Accept  json
+// @Produce  json
+// @Param nsId path string true "Namespace ID" default(default)
+// @Param subscriptionId path string true "Event subscription ID"
+// @Success 200 {object} model.EventSubscriptionInfo "Event subscription"
+// @Failure 404 {object} model.SimpleMsg "Event subscription not found"
+// @Failure 500 {object} model.SimpleMsg "Internal error"
+// @Param x-request-id header string false "Custom request ID for tracking"
+// @Router /ns/{nsId}/eventSubscription/{subscriptionId} [get]
+func RestGetEventSubscription(c echo.Context) error {
+	nsId := c.Param("nsId")
+	subscriptionId := c.Param("subscriptionId")
+
+	result, err := infra.GetEventSubscription(nsId, subscriptionId)
+	return clientManager.EndRequestWithLog(c, err, result)
+}
+
+// RestGetAllEventSubscription godoc
+// @ID GetAllEventSubscription
+// @Summary List event subscriptions
+// @Description List the event subscriptions of a namespace (secrets masked).
+// @Tags [Admin] Event Subscription Management
+// @Accept  json
+// @Produce  json
+// @Param nsId path string true "Namespace ID" default(default)
+// @Success 200 {object} model.EventSubscriptionListResponse "List of event subscriptions"
+// @Failure 500 {object} model.SimpleMsg "Internal error"
+// @Param x-request-id header string false "Custom request ID for tracking"
+// @Router /ns/{nsId}/eventSubscription [get]
+func RestGetAllEventSubscription(c echo.Context) error {
+	nsId := c.Param("nsId")
+
+	result, err := infra.ListEventSubscription(nsId)
+	if err != nil {
+		return clientManager.EndRequestWithLog(c, err, nil)
+	}
+	return clientManager.EndRequestWithLog(c, nil, model.EventSubscriptionListResponse{Subscriptions: result})
+}
+
+// RestPutEventSubscription godoc
+// @ID PutEventSubscription
+// @Summary Update an event subscription
+// @Description Replace the settings of an event subscription. Send the masked secret ("********") to keep the current secret.
+// @Tags [Admin] Event Subscription Management
+// @Accept  json
+// @Produce  json
+// @Param nsId path string true "Namespace ID" default(default)
+// @Param subscriptionId path string true "Event subscription ID"
+// @Param eventSubscriptionReq body model.EventSubscriptionReq true "Event subscription request"
+// @Success 200 {object} model.EventSubscriptionInfo "Updated event subscription (secret masked)"
+// @Failure 400 {object} model.SimpleMsg "Invalid request"
+// @Failure 404 {object} model.SimpleMsg "Event subscription not found"
+// @Failure 500 {object} model.SimpleMsg "Internal error"
+// @Param x-request-id header string false "Custom request ID for tracking"
+// @Router /ns/{nsId}/eventSubscription/{subscriptionId} [put]
+func RestPutEventSubscription(c echo.Context) error {
+	nsId := c.Param("nsId")
+	subscriptionId := c.Param("subscriptionId")
+
+	req := &model.EventSubscriptionReq{}
+	if err := c.Bind(req); err != nil {
+		log.Warn().Err(err).Msg("invalid request")
+		return clientManager.EndRequestWithLog(c, err, nil)
+	}
+
+	result, err := infra.UpdateEventSubscription(nsId, subscriptionId, req)
+	return clientManager.EndRequestWithLog(c, err, result)
+}
+
+// RestDeleteEventSubscription godoc
+// @ID DeleteEventSubscription
+// @Summary Delete an event subscription
+// @Description Delete an event subscription with its delivery history and dead letters. Pending retries stop.
+// @Tags [Admin] Event Subscription Management
+// @Accept  json
+// @Produce  json
+// @Param nsId path string true "Namespace ID" default(default)
+// @Param subscriptionId path string true "Event subscription ID"
+// @Success 200 {object} model.SimpleMsg "Event subscription deleted"
+// @Failure 404 {object} model.SimpleMsg "Event subscription not found"
+// @Failure 500 {object} model.SimpleMsg "Internal error"
+// @Param x-request-id header string false "Custom request ID for tracking"
+// @Router /ns/{nsId}/eventSubscription/{subscriptionId} [delete]
+func RestDeleteEventSubscription(c echo.Context) error {
+	nsId := c.Param("nsId")
+	subscriptionId := c.Param("subscriptionId")
+
+	if err := infra.DeleteEventSubscription(nsId, subscriptionId); err != nil {
+		return clientManager.EndRequestWithLog(c, err, nil)
+	}
+	return clientManager.EndRequestWithLog(c, nil, model.SimpleMsg{Message: "The event subscription " + subscriptionId + " has been deleted"})
+}
+
+// RestDeleteAllEventSubscription godoc
+// @ID DeleteAllEventSubscription
+// @Summary Delete all event subscriptions
+// @Description Delete all event subscriptions in a namespace.
+// @Tags [Admin] Event Subscription Management
+// @Accept  json
+// @Produce  json
+// @Param nsId path string true "Namespace ID" default(default)
+// @Success 200 {object} model.SimpleMsg "All event subscriptions deleted"
+// @Failure 500 {object} model.SimpleMsg "Internal error"
+// @Param x-request-id header string false "Custom request ID for tracking"
+// @Router /ns/{nsId}/eventSubscription [delete]
+func RestDeleteAllEventSubscription(c echo.Context) error {
+	nsId := c.Param("nsId")
+
+	if err := infra.DeleteAllEventSubscription(nsId); err != nil {
+		return clientManager.EndRequestWithLog(c, err, nil)
+	}
+	return clientManager.EndRequestWithLog(c, nil, model.SimpleMsg{Message: "All event subscriptions have been deleted"})
+}
+
+// RestGetEventSubscriptionDelivery godoc
+// @ID GetEventSubscriptionDelivery
+// @Summary List the deliveries of an event subscription
+// @Description List the recent deliveries of an event subscription (the last 100), newest first.
+// @Description A delivery is Retrying until it is Delivered or DeadLettered.
+// @Tags [Admin] Event Subscription Management
+// @Accept  json
+// @Produce  json
+// @Param nsId path string true "Namespace ID" default(default)
+// @Param subscriptionId path string true "Event subscription ID"
+// @Success 200 {object} model.EventDeliveryListResponse "Deliveries"
+// @Failure 404 {object} model.SimpleMsg "Event subscription not found"
+// @Failure 500 {object} model.SimpleMsg "Internal error"
+// @Param x-request-id header string false "Custom request ID for tracking"
+// @Router /ns/{nsId}/eventSubscription/{subscriptionId}/delivery [get]
+func RestGetEventSubscriptionDelivery(c echo.Context) error {
+	nsId := c.Param("nsId")
+	subscriptionId := c.Param("subscriptionId")
+
+	result, err := infra.ListEventDeliveries(nsId, subscriptionId)
+	if err != nil {
+		return clientManager.EndRequestWithLog(c, err, nil)
+	}
+	return clientManager.EndRequestWithLog(c, nil, model.EventDeliveryListResponse{Deliveries: result})
+}
+
+// RestGetEventSubscriptionDeadLetter godoc
+// @ID GetEventSubscriptionDeadLetter
+// @Summary List the dead letters of an event subscription
+// @Description List the deliveries that failed for good, newest first, with their events.
+// @Tags [Admin] Event Subscription Management
+// @Accept  json
+// @Produce  json
+// @Param nsId path string true "Namespace ID" default(default)
+// @Param subscriptionId path string true "Event subscription ID"
+// @Success 200 {object} model.EventDeliveryListResponse "Dead letters"
+// @Failure 404 {object} model.SimpleMsg "Event subscription not found"
+// @Failure 500 {object} model.SimpleMsg "Internal error"
+// @Param x-request-id header string false "Custom request ID for tracking"
+// @Router /ns/{nsId}/eventSubscription/{subscriptionId}/deadLetter [get]
+func RestGetEventSubscriptionDeadLetter(c echo.Context) error {
+	nsId := c.Param("nsId")
+	subscriptionId := c.Param("subscriptionId")
+
+	result, err := infra.ListEventDeadLetters(nsId, subscriptionId)
+	if err != nil {
+		return clientManager.EndRequestWithLog(c, err, nil)
+	}
+	return clientManager.EndRequestWithLog(c, nil, model.EventDeliveryListResponse{Deliveries: result})
+}
+
+// RestPostEventSubscriptionRedeliver godoc
+// @ID PostEventSubscriptionRedeliver
+// @Summary Redeliver a dead letter
+// @Description Remove a dead letter and deliver its event again in the background, with the current settings of the subscription.
+// @Description Follow the new delivery in the delivery history.
+// @Tags [Admin] Event Subscription Management
+// @Accept  json
+// @Produce  json
+// @Param nsId path string true "Namespace ID" default(default)
+// @Param subscriptionId path string true "Event subscription ID"
+// @Param deliveryId path string true "Delivery ID of the dead letter"
+// @Success 200 {object} model.SimpleMsg "Redelivery started"
+// @Failure 404 {object} model.SimpleMsg "Event subscription or dead letter not found"
+// @Failure 500 {object} model.SimpleMsg "Internal error"
+// @Param x-request-id header string false "Custom request ID for tracking"
+// @Router /ns/{nsId}/eventSubscription/{subscriptionId}/deadLetter/{deliveryId}/redeliver [post]
+func RestPostEventSubscriptionRedeliver(c echo.Context) error {
+	nsId := c.Param("nsId")
+	subscriptionId := c.Param("subscriptionId")
+	deliveryId := c.Param("deliveryId")
+
+	newId, err := infra.RedeliverEventDeadLetter(nsId, subscriptionId, deliveryId)
+	if err != nil {
+		return clientManager.EndRequestWithLog(c, err, nil)
+	}
+	return clientManager.EndRequestWithLog(c, nil, model.SimpleMsg{Message: "Redelivery " + newId + " of dead letter " + deliveryId + " started"})
+}
+
+// RestDeleteEventSubscriptionDeadLetter godoc
+// @ID DeleteEventSubscriptionDeadLetter
+// @Summary Delete the dead letters of an event subscription
+// @Description Drop all dead letters of an event subscription.
+// @Tags [Admin] Event Subscription Management
+// @Accept  json
+// @Produce  json
+// @Param nsId path string true "Namespace ID" default(default)
+// @Param subscriptionId path string true "Event subscription ID"
+// @Success 200 {object} model.SimpleMsg "Dead letters deleted"
+// @Failure 404 {object} model.SimpleMsg "Event subscription not found"
+// @Failure 500 {object} model.SimpleMsg "Internal error"
+// @Param x-request-id header string false "Custom request ID for tracking"
+// @Router /ns/{nsId}/eventSubscription/{subscriptionId}/deadLetter [delete]
+func RestDeleteEventSubscriptionDeadLetter(c echo.Context) error {
+	nsId := c.Param("nsId")
+	subscriptionId := c.Param("subscriptionId")
+
+	if err := infra.DeleteEventDeadLetters(nsId, subscriptionId); err != nil {
+		return clientManager.EndRequestWithLog(c, err, nil)
+	}
+	return clientManager.EndRequestWithLog(c, nil, model.SimpleMsg{Message: "The dead letters of event subscription " + subscriptionId + " have been deleted"})
+}
@@ -610,6 +610,131 @@ func RestGetInfraAssociatedResources(c echo.Context) error {
 	return clientManager.EndRequestWithLog(c, err, result)
 }
 
+// RestPostNsDriftReport godoc
+// @ID PostNsDriftReport
+// @Summary Check the Nodes of a namespace for configuration drift
+// @Description Compare each running or suspended Node (spec, image, SecurityGroups, data disks, public IP, labels) with what the CSP reports.
+// @Description The CSP is queried directly when supported, and through CB-Spider otherwise.
+// @Description The outcome is recorded as drift conditions on each Node (see `conditions` of the Node) and returned as a report.
+// @Description Newly detected drift is published as node.driftDetected events.
+// @Tags [MC-Infra] Infra Provisioning and Management
+// @Accept  json
+// @Produce  json
+// @Param nsId path string true "Namespace ID" default(default)
+// @Param infraId query string false "Check only the Nodes of this Infra"
+// @Success 200 {object} model.DriftReport
+// @Failure 404 {object} model.SimpleMsg
+// @Failure 500 {object} model.SimpleMsg
+// @Param x-request-id header string false "Custom request ID for tracking"
+// @Param x-credential-holder header string false "Credential holder ID for selecting which credentials to use (default: system default holder)"
+// @Router /ns/{nsId}/driftReport [post]
+func RestPostNsDriftReport(c echo.Context) error {
+	ctx := c.Request().Context()
+	nsId := c.Param("nsId")
+	infraId := c.QueryParam("infraId")
+
+	result, err := infra.DetectNsDrift(ctx, nsId, infraId)
+	return clientManager.EndRequestWithLog(c, err, result)
+}
+
+// RestGetNsLease godoc
+// @ID GetNsLease
+// @Summary List the leases of the Infras and K8sClusters of a namespace
+// @Description List the resources of a namespace that expire, with their expiry, the action taken on expiry and the lease status.
+// @Tags [MC-Infra] Infra Provisioning and Management
+// @Accept  json
+// @Produce  json
+// @Param nsId path string true "Namespace ID" default(default)
+// @Param x-request-id header string false "Custom request ID for tracking"
+// @Success 200 {object} model.LeaseList
+// @Failure 500 {object} model.SimpleMsg
+// @Router /ns/{nsId}/lease [get]
+func RestGetNsLease(c echo.Context) error {
+	nsId := c.Param("nsId")
+
+	result, err := infra.ListLeases(nsId)
+	return clientManager.EndRequestWithLog(c, err, result)
+}
+
+// RestGetInfraLease godoc
+// @ID GetInfraLease
+// @Summary Get the lease of an Infra
+// @Description Get when the Infra expires and what happens then (delete or suspend).
+// @Tags [MC-Infra] Infra Provisioning and Management
+// @Accept  json
+// @Produce  json
+// @Param nsId path string true "Namespace ID" default(default)
+// @Param infraId path string true "Infra ID" default(infra01)
+// @Param x-request-id header string false "Custom request ID for tracking"
+// @Success 200 {object} model.LeaseInfo
+// @Failure 404 {object} model.SimpleMsg
+// @Failure 500 {object} model.SimpleMsg
+// @Router /ns/{nsId}/infra/{infraId}/lease [get]
+func RestGetInfraLease(c echo.Context) error {
+	nsId := c.Param("nsId")
+	infraId := c.Param("infraId")
+
+	result, err := infra.GetResourceLease(nsId, model.StrInfra, infraId)
+	return clientManager.EndRequestWithLog(c, err, result)
+}
+
+// RestPutInfraLease godoc
+// @ID PutInfraLease
+// @Summary Set or extend the lease of an Infra
+// @Description Set the expiry of an Infra (`expiresAt`, or `ttl` counted from now) or postpone it (`extendBy`).
+// @Description The owner is warned (log event and Infra system message) TB_LEASE_WARNING_LEAD (default 1h) before expiry,
+// @Description then the Infra is deleted or suspended according to `expirationAction`.
+// @Description A suspended Infra stays suspended after its lease is extended; resume it explicitly.
+// @Tags [MC-Infra] Infra Provisioning and Management
+// @Accept  json
+// @Produce  json
+// @Param nsId path string true "Namespace ID" default(default)
+// @Param infraId path string true "Infra ID" default(infra01)
+// @Param leaseReq body model.LeaseUpdateReq true "New expiry (one of expiresAt, ttl and extendBy)"
+// @Param x-request-id header string false "Custom request ID for tracking"
+// @Success 200 {object} model.LeaseInfo
+// @Failure 400 {object} model.SimpleMsg
+// @Failure 500 {object} model.SimpleMsg
+// @Router /ns/{nsId}/infra/{infraId}/lease [put]
+func RestPutInfraLease(c echo.Context) error {
+	nsId := c.Param("nsId")
+	infraId := c.Param("infraId")
+
+	req := &model.LeaseUpdateReq{}
+	if err := c.Bind(req); err != nil {
+		return clientManager.EndRequestWithLog(c, err, nil)
+	}
+
+	result, err := infra.UpdateResourceLease(nsId, model.StrInfra, infraId, req)
+	return clientManager.EndRequestWithLog(c, err, result)
+}
+
+// RestDelInfraLease godoc
+// @ID DelInfraLease
+// @Summary Delete the lease of an Infra
+// @Description Delete the lease of an Infra so it no longer expires.
+// @Tags [MC-Infra] Infra Provisioning and Management
+// @Accept  json
+// @Produce  json
+// @Param nsId path string true "Namespace ID" default(default)
+// @Param infraId path string true "Infra ID" default(infra01)
+// @Param x-request-id header string false "Custom request ID for tracking"
+// @Success 200 {object} model.SimpleMsg
+// @Failure 404 {object} model.SimpleMsg
+// @Failure 500 {object} model.SimpleMsg
+// @Router /ns/{nsId}/infra/{infraId}/lease [delete]
+func RestDelInfraLease(c echo.Context) error {
+	nsId := c.Param("nsId")
+	infraId := c.Param("infraId")
+
+	err := infra.DelResourceLease(nsId, model.StrInfra, infraId)
+	if err != nil {
+		return clientManager.EndRequestWithLog(c, err, nil)
+	}
+	result := model.SimpleMsg{Message: "Infra " + infraId + " no longer expires"}
+	return clientManager.EndRequestWithLog(c, err, result)
+}
+
 // RestPutInfraAssociatedSecurityGroups godoc
 // @ID PutInfraAssociatedSecurityGroups
 // @Summary Update all Security Groups associated with a given Infra
@@ -87,12 +87,16 @@ func RestPutMonitorAgentStatusInstalled(c echo.Context) error {
 // @ID GetMonitorData
 // @Summary Get monitoring data of specified Infra for specified monitoring metric (cpu, memory, disk, network)
 // @Description Get monitoring data of specified Infra for specified monitoring metric (cpu, memory, disk, network)
+// @Description from CB-Dragonfly (default), Prometheus or agentless SSH sampling of the Nodes
 // @Tags [MC-Infra] Infra Resource Monitor (for developer)
 // @Accept  json
 // @Produce  json
 // @Param nsId path string true "Namespace ID" default(default)
 // @Param infraId path string true "Infra ID" default(infra01)
 // @Param metric path string true "Metric type: cpu, memory, disk, network"
+// @Param source query string false "Metric source" Enums(dragonfly, prometheus, ssh) default(dragonfly)
+// @Param prometheusUrl query string false "Prometheus server for the prometheus source (default: TB_PROMETHEUS_URL; TB_PROMETHEUS_BEARER_TOKEN is sent to TB_PROMETHEUS_URL only)"
+// @Param userName query string false "SSH user for the ssh source (default: the user of each Node)"
 // @Success 200 {object} model.MonResultSimpleResponse
 // @Failure 404 {object} model.SimpleMsg
 // @Failure 500 {object} model.SimpleMsg
@@ -110,6 +114,11 @@ func RestGetMonitorData(c echo.Context) error {
 		return clientManager.EndRequestWithLog(c, err, nil)
 	}
 
-	content, err := infra.GetMonitoringData(nsId, infraId, metric)
+	source := model.MetricSourceConfig{
+		Type:     c.QueryParam("source"),
+		Url:      c.QueryParam("prometheusUrl"),
+		UserName: c.QueryParam("userName"),
+	}
+	content, err := infra.GetMonitoringDataFromSource(nsId, infraId, metric, source)
 	return clientManager.EndRequestWithLog(c, err, content)
 }
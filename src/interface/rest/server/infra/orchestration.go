@@ -15,7 +15,11 @@ limitations under the License.
 package infra
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"strconv"
 
 	clientManager "github.com/cloud-barista/cb-tumblebug/src/core/common/client"
 	"github.com/cloud-barista/cb-tumblebug/src/core/infra"
@@ -28,6 +32,15 @@ import (
 // @ID PostInfraPolicy
 // @Summary Create Infra Automation policy
 // @Description Create Infra Automation policy
+// @Description
+// @Description A policy acts when its condition holds: the primary metric rule and autoCondition.rules, combined by autoCondition.logic (and/or).
+// @Description autoAction.nodeGroupId resizes an existing NodeGroup by autoAction.step Nodes within minSize/maxSize; without it, ScaleOut adds an
+// @Description auto-generated NodeGroup and ScaleIn removes auto-generated Nodes, picked by victimSelection (newest, oldest, mostExpensive).
+// @Description cooldownSeconds holds further actions after one ran. Each evaluation is kept in the decision log of the policy.
+// @Description metricSource selects where the metrics are read from: dragonfly (default), prometheus (PromQL on metricSource.url,
+// @Description node_exporter queries by default, overridable per metric in metricSource.queries) or ssh (agentless sampling of /proc).
+// @Description webhook.enabled with a webhook.secret lets external systems trigger autoAction (see the webhook API of the policy);
+// @Description such a policy may leave autoCondition empty. actionType RunRunbook runs autoAction.runbookId instead of scaling.
 // @Tags [MC-Infra] Infra Orchestration Management (WIP)
 // @Accept  json
 // @Produce  json
@@ -51,7 +64,7 @@ func RestPostInfraPolicy(c echo.Context) error {
 	}
 
 	content, err := infra.CreateInfraPolicy(nsId, infraId, req)
-	return clientManager.EndRequestWithLog(c, err, content)
+	return clientManager.EndRequestWithLog(c, err, infra.OmitInfraPolicySecret(content))
 }
 
 // RestGetInfraPolicy godoc
@@ -84,7 +97,101 @@ func RestGetInfraPolicy(c echo.Context) error {
 		errorMessage := fmt.Errorf("Failed to find InfraPolicyObject : %s", infraId)
 		return clientManager.EndRequestWithLog(c, errorMessage, nil)
 	}
-	return clientManager.EndRequestWithLog(c, err, result)
+	return clientManager.EndRequestWithLog(c, err, infra.OmitInfraPolicySecret(result))
+}
+
+// RestPostInfraPolicyWebhook godoc
+// @ID PostInfraPolicyWebhook
+// @Summary Trigger the action of an Infra policy (signed webhook)
+// @Description Run autoAction of a policy with a webhook enabled, for external autoscalers or Alertmanager.
+// @Description The request is authenticated by its signature instead of the API credentials:
+// @Description x-tb-timestamp is the current Unix time in seconds (5 minutes of skew allowed), and x-tb-signature is
+// @Description "sha256=" followed by the hex HMAC-SHA256 of "<x-tb-timestamp>.<raw body>" keyed by webhook.secret.
+// @Description The cooldown and the bounds of the action apply; a body with "status":"resolved" (Alertmanager) takes no action.
+// @Description Requests with the same Idempotency-Key within 24 hours return the first decision without acting again.
+// @Description Actions of an Infra run one at a time; a request waits up to 10 seconds for a running action, then gets 409.
+// @Tags [MC-Infra] Infra Orchestration Management (WIP)
+// @Accept  json
+// @Produce  json
+// @Param nsId path string true "Namespace ID" default(default)
+// @Param infraId path string true "Infra ID" default(infra01)
+// @Param policyIndex path int true "Index of the policy in the Infra policy" default(0)
+// @Param x-tb-timestamp header string true "Unix time of the request in seconds"
+// @Param x-tb-signature header string true "sha256=<hex HMAC-SHA256 of timestamp.body>"
+// @Param Idempotency-Key header string false "Key identifying the event, to act once on redeliveries"
+// @Param payload body object false "Any payload (signed as is)"
+// @Success 200 {object} model.AutoControlDecision
+// @Failure 400 {object} model.SimpleMsg
+// @Failure 401 {object} model.SimpleMsg "Invalid signature"
+// @Failure 409 {object} model.SimpleMsg "An action of the Infra or a request with the same Idempotency-Key is in progress"
+// @Param x-request-id header string false "Custom request ID for tracking"
+// @Router /ns/{nsId}/policy/infra/{infraId}/webhook/{policyIndex} [post]
+func RestPostInfraPolicyWebhook(c echo.Context) error {
+
+	nsId := c.Param("nsId")
+	infraId := c.Param("infraId")
+	policyIndex, err := strconv.Atoi(c.Param("policyIndex"))
+	if err != nil {
+		return clientManager.EndRequestWithLog(c, fmt.Errorf("invalid policyIndex %q", c.Param("policyIndex")), nil)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request().Body, 1<<20))
+	if err != nil {
+		return clientManager.EndRequestWithLog(c, err, nil)
+	}
+
+	req := c.Request()
+	decision, replayed, err := infra.TriggerInfraPolicyWebhook(nsId, infraId, policyIndex, body,
+		req.Header.Get("x-tb-timestamp"), req.Header.Get("x-tb-signature"), req.Header.Get("Idempotency-Key"))
+	switch {
+	case errors.Is(err, infra.ErrAutoWebhookUnauthorized):
+		return clientManager.EndRequestWithLogAndStatus(c, err, nil, http.StatusUnauthorized)
+	case errors.Is(err, infra.ErrAutoControlBusy):
+		return clientManager.EndRequestWithLogAndStatus(c, err, nil, http.StatusConflict)
+	case err != nil:
+		return clientManager.EndRequestWithLog(c, err, nil)
+	}
+	if replayed {
+		c.Response().Header().Set("Idempotent-Replayed", "true")
+	}
+	return clientManager.EndRequestWithLog(c, nil, decision)
+}
+
+// RestGetInfraPolicyDecision godoc
+// @ID GetInfraPolicyDecision
+// @Summary List the decision log of an Infra policy
+// @Description List the evaluations and actions of the auto-control policy of an Infra, newest first:
+// @Description the sampled rules, the decision (NoAction, InsufficientData, Detected, Cooldown, AtBound, Executed, Failed) and the Nodes changed.
+// @Tags [MC-Infra] Infra Orchestration Management (WIP)
+// @Accept  json
+// @Produce  json
+// @Param nsId path string true "Namespace ID" default(default)
+// @Param infraId path string true "Infra ID" default(infra01)
+// @Param limit query int false "Maximum number of decisions to return" default(50)
+// @Success 200 {object} model.AutoControlDecisionListResponse
+// @Failure 400 {object} model.SimpleMsg
+// @Failure 500 {object} model.SimpleMsg
+// @Param x-request-id header string false "Custom request ID for tracking"
+// @Router /ns/{nsId}/policy/infra/{infraId}/decision [get]
+func RestGetInfraPolicyDecision(c echo.Context) error {
+
+	nsId := c.Param("nsId")
+	infraId := c.Param("infraId")
+
+	limit := 50
+	if v := c.QueryParam("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return clientManager.EndRequestWithLog(c, fmt.Errorf("invalid limit %q", v), nil)
+		}
+		limit = n
+	}
+
+	result, err := infra.ListAutoControlDecision(nsId, infraId, limit)
+	if err != nil {
+		return clientManager.EndRequestWithLog(c, err, nil)
+	}
+	return clientManager.EndRequestWithLog(c, nil, model.AutoControlDecisionListResponse{Decisions: result})
 }
 
 // Response structure for RestGetAllInfraPolicy
@@ -117,7 +224,9 @@ func RestGetAllInfraPolicy(c echo.Context) error {
 	}
 
 	content := RestGetAllInfraPolicyResponse{}
-	content.InfraPolicy = result
+	for _, p := range result {
+		content.InfraPolicy = append(content.InfraPolicy, infra.OmitInfraPolicySecret(p))
+	}
 	return clientManager.EndRequestWithLog(c, err, content)
 }
 
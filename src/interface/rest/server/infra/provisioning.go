@@ -521,6 +521,10 @@ func RestPostInfraDynamicNodeGroupNodeReview(c echo.Context) error {
 		log.Warn().Err(err).Msg("invalid postCommands in Node dynamic addition review")
 		return clientManager.EndRequestWithLog(c, err, nil)
 	}
+	if err := infra.ValidatePostCommandRunbooks(nsId, req.PostCommands); err != nil {
+		log.Warn().Err(err).Msg("invalid runbook in postCommands of Node dynamic addition review")
+		return clientManager.EndRequestWithLog(c, err, nil)
+	}
 
 	// Validate that target Infra exists
 	_, err := infra.GetInfraInfo(nsId, infraId)
@@ -827,6 +831,241 @@ func RestPostInfraNodeGroupScaleOut(c echo.Context) error {
 	return clientManager.EndRequestWithLog(c, err, result)
 }
 
+// RestPutInfraApply godoc
+// @ID PutInfraApply
+// @Summary Apply a desired state to an Infra (declarative)
+// @Description Compare an Infra with a desired state given as an InfraDynamicReq and compute the changes to reach it.
+// @Description The same request can be sent repeatedly (e.g., from a GitOps pipeline): once the Infra matches, the plan is empty (`noChange: true`).
+// @Description
+// @Description **Planned changes (NodeGroups are matched by name):**
+// @Description - NodeGroups missing from the Infra are created; NodeGroups missing from the desired state are deleted
+// @Description - Nodes are added or removed to reach `nodeGroupSize` (failed Nodes, then the newest, are removed first)
+// @Description - Nodes whose spec, image, connection or zone differ are replaced; the replacement is created before the old Node is deleted
+// @Description - Labels of the desired state are added or updated on the Infra and Nodes (other labels are kept)
+// @Description - SecurityGroup rules of a NodeGroup are reconciled with its SecurityGroup template when `sgTemplateId` is set
+// @Description - If the Infra does not exist, it is created as a whole
+// @Description
+// @Description **Modes:**
+// @Description - `plan` (default): only returns the plan
+// @Description - `apply`: executes the plan; failed steps are listed in `errors` and the resulting Infra is returned in `infra`
+// @Tags [MC-Infra] Infra Provisioning and Management
+// @Accept  json
+// @Produce  json
+// @Param nsId path string true "Namespace ID" default(default)
+// @Param infraId path string true "Infra ID (must match the name of the desired state)" default(infra01)
+// @Param infraReq body model.InfraDynamicReq true "Desired state of the Infra"
+// @Param mode query string false "plan (default) or apply" Enums(plan,apply) default(plan)
+// @Param x-request-id header string false "Custom request ID for tracking"
+// @Param x-credential-holder header string false "Credential holder ID to select which credentials to use for provisioning (default: system default holder)"
+// @Success 200 {object} model.InfraApplyPlan "Plan of the changes (and their outcome in apply mode)"
+// @Failure 400 {object} model.SimpleMsg "Invalid desired state or mode"
+// @Failure 500 {object} model.SimpleMsg "Failed to compute the plan"
+// @Router /ns/{nsId}/infra/{infraId}/apply [put]
+func RestPutInfraApply(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	nsId := c.Param("nsId")
+	infraId := c.Param("infraId")
+	mode := c.QueryParam("mode")
+
+	req := &model.InfraDynamicReq{}
+	if err := c.Bind(req); err != nil {
+		return clientManager.EndRequestWithLog(c, err, nil)
+	}
+
+	result, err := infra.ApplyInfraDynamic(ctx, nsId, infraId, req, mode)
+	return clientManager.EndRequestWithLog(c, err, result)
+}
+
+// RestPostNodeGroupRollingUpdate godoc
+// @ID PostNodeGroupRollingUpdate
+// @Summary Start a rolling update of a NodeGroup (change spec or image without downtime)
+// @Description Replace the Nodes of a NodeGroup with Nodes of another spec and/or image, a batch at a time.
+// @Description The update runs in the background; the initial status is returned and can be followed with GET on the same path.
+// @Description
+// @Description **Each batch:**
+// @Description 1. Deletes up to `maxUnavailable` old Nodes (taken out of the NLBs of the NodeGroup first)
+// @Description 2. Creates `maxSurge + maxUnavailable` replacement Nodes in the same NodeGroup
+// @Description 3. Runs `postCommands` on them (default: the post-deployment phases of the Infra targeting this NodeGroup or no target)
+// @Description 4. Runs `healthCheck` on them when set (ssh, or http GET expecting 2xx/3xx)
+// @Description 5. Adds them to the NLBs of the NodeGroup, then removes and deletes the other old Nodes of the batch
+// @Description
+// @Description A failed step stops the update in the `Failed` phase; resume retries the batch and rollback restores the previous spec and image.
+// @Tags [MC-Infra] Infra Provisioning and Management
+// @Accept  json
+// @Produce  json
+// @Param nsId path string true "Namespace ID" default(default)
+// @Param infraId path string true "Infra ID" default(infra01)
+// @Param nodegroupId path string true "NodeGroup ID" default(g1)
+// @Param rollingUpdateReq body model.NodeGroupRollingUpdateReq true "Target spec/image and rollout options"
+// @Param x-request-id header string false "Custom request ID for tracking"
+// @Param x-credential-holder header string false "Credential holder ID to select which credentials to use for provisioning (default: system default holder)"
+// @Success 200 {object} model.NodeGroupRollingUpdateStatus "Initial status of the rolling update"
+// @Failure 400 {object} model.SimpleMsg "Invalid request, or an update of the NodeGroup is already in progress"
+// @Failure 500 {object} model.SimpleMsg
+// @Router /ns/{nsId}/infra/{infraId}/nodegroup/{nodegroupId}/rollingUpdate [post]
+func RestPostNodeGroupRollingUpdate(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	nsId := c.Param("nsId")
+	infraId := c.Param("infraId")
+	nodegroupId := c.Param("nodegroupId")
+
+	req := &model.NodeGroupRollingUpdateReq{}
+	if err := c.Bind(req); err != nil {
+		return clientManager.EndRequestWithLog(c, err, nil)
+	}
+
+	result, err := infra.StartNodeGroupRollingUpdate(ctx, nsId, infraId, nodegroupId, req)
+	return clientManager.EndRequestWithLog(c, err, result)
+}
+
+// RestGetNodeGroupRollingUpdate godoc
+// @ID GetNodeGroupRollingUpdate
+// @Summary Get the status of the rolling update of a NodeGroup
+// @Description Get the phase and progress (replaced, new and pending Nodes) of the latest rolling update of a NodeGroup.
+// @Tags [MC-Infra] Infra Provisioning and Management
+// @Accept  json
+// @Produce  json
+// @Param nsId path string true "Namespace ID" default(default)
+// @Param infraId path string true "Infra ID" default(infra01)
+// @Param nodegroupId path string true "NodeGroup ID" default(g1)
+// @Param x-request-id header string false "Custom request ID for tracking"
+// @Success 200 {object} model.NodeGroupRollingUpdateStatus
+// @Failure 404 {object} model.SimpleMsg
+// @Failure 500 {object} model.SimpleMsg
+// @Router /ns/{nsId}/infra/{infraId}/nodegroup/{nodegroupId}/rollingUpdate [get]
+func RestGetNodeGroupRollingUpdate(c echo.Context) error {
+	nsId := c.Param("nsId")
+	infraId := c.Param("infraId")
+	nodegroupId := c.Param("nodegroupId")
+
+	result, err := infra.GetNodeGroupRollingUpdate(nsId, infraId, nodegroupId)
+	return clientManager.EndRequestWithLog(c, err, result)
+}
+
+// RestPutNodeGroupRollingUpdate godoc
+// @ID PutNodeGroupRollingUpdate
+// @Summary Pause, resume or roll back the rolling update of a NodeGroup
+// @Description - `pause`: the update stops after the current batch (phase `Paused`)
+// @Description - `resume`: continues a `Paused` or `Failed` update; an unfinished batch is redone
+// @Description - `rollback`: recreates the deleted Nodes with the previous spec and image, moves the NLB membership back to them and deletes the replacement Nodes
+// @Tags [MC-Infra] Infra Provisioning and Management
+// @Accept  json
+// @Produce  json
+// @Param nsId path string true "Namespace ID" default(default)
+// @Param infraId path string true "Infra ID" default(infra01)
+// @Param nodegroupId path string true "NodeGroup ID" default(g1)
+// @Param action query string true "Action to take" Enums(pause,resume,rollback)
+// @Param x-request-id header string false "Custom request ID for tracking"
+// @Param x-credential-holder header string false "Credential holder ID to select which credentials to use for provisioning (default: system default holder)"
+// @Success 200 {object} model.NodeGroupRollingUpdateStatus
+// @Failure 400 {object} model.SimpleMsg
+// @Failure 500 {object} model.SimpleMsg
+// @Router /ns/{nsId}/infra/{infraId}/nodegroup/{nodegroupId}/rollingUpdate [put]
+func RestPutNodeGroupRollingUpdate(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	nsId := c.Param("nsId")
+	infraId := c.Param("infraId")
+	nodegroupId := c.Param("nodegroupId")
+	action := c.QueryParam("action")
+
+	result, err := infra.ControlNodeGroupRollingUpdate(ctx, nsId, infraId, nodegroupId, action)
+	return clientManager.EndRequestWithLog(c, err, result)
+}
+
+// RestPutNodeGroupHealingPolicy godoc
+// @ID PutNodeGroupHealingPolicy
+// @Summary Set the auto-healing policy of a NodeGroup
+// @Description Opt a NodeGroup in (or out) of auto-healing. When the status agent finds a Node of the NodeGroup
+// @Description `Terminated` or `Failed` on the CSP without a terminate, create or suspend request behind it, Tumblebug:
+// @Description 1. Creates a replacement Node with the same spec, image, subnet and security groups in the NodeGroup
+// @Description 2. Runs the post-deployment phases of the Infra that target this NodeGroup (or no target) on it
+// @Description 3. Moves the data disks and the NLB membership of the failed Node to it, where possible
+// @Description 4. Deletes the failed Node
+// @Description
+// @Description Each step is logged in the system messages of the Infra. Replacements are limited to `maxHealsPerHour`
+// @Description per NodeGroup and to TB_HEALING_CONNECTION_LIMIT per connection within TB_HEALING_CONNECTION_WINDOW
+// @Description (default 3 per hour), so a regional outage does not trigger a replacement storm.
+// @Tags [MC-Infra] Infra Provisioning and Management
+// @Accept  json
+// @Produce  json
+// @Param nsId path string true "Namespace ID" default(default)
+// @Param infraId path string true "Infra ID" default(infra01)
+// @Param nodegroupId path string true "NodeGroup ID" default(g1)
+// @Param healingPolicy body model.NodeGroupHealingPolicy true "Healing policy"
+// @Param x-request-id header string false "Custom request ID for tracking"
+// @Success 200 {object} model.NodeGroupHealingPolicyInfo
+// @Failure 400 {object} model.SimpleMsg
+// @Failure 500 {object} model.SimpleMsg
+// @Router /ns/{nsId}/infra/{infraId}/nodegroup/{nodegroupId}/healingPolicy [put]
+func RestPutNodeGroupHealingPolicy(c echo.Context) error {
+	nsId := c.Param("nsId")
+	infraId := c.Param("infraId")
+	nodegroupId := c.Param("nodegroupId")
+
+	req := &model.NodeGroupHealingPolicy{}
+	if err := c.Bind(req); err != nil {
+		return clientManager.EndRequestWithLog(c, err, nil)
+	}
+
+	result, err := infra.PutNodeGroupHealingPolicy(nsId, infraId, nodegroupId, req)
+	return clientManager.EndRequestWithLog(c, err, result)
+}
+
+// RestGetNodeGroupHealingPolicy godoc
+// @ID GetNodeGroupHealingPolicy
+// @Summary Get the auto-healing policy of a NodeGroup
+// @Description Get the auto-healing policy of a NodeGroup. Healing actions are logged in the system messages of the Infra.
+// @Tags [MC-Infra] Infra Provisioning and Management
+// @Accept  json
+// @Produce  json
+// @Param nsId path string true "Namespace ID" default(default)
+// @Param infraId path string true "Infra ID" default(infra01)
+// @Param nodegroupId path string true "NodeGroup ID" default(g1)
+// @Param x-request-id header string false "Custom request ID for tracking"
+// @Success 200 {object} model.NodeGroupHealingPolicyInfo
+// @Failure 404 {object} model.SimpleMsg
+// @Failure 500 {object} model.SimpleMsg
+// @Router /ns/{nsId}/infra/{infraId}/nodegroup/{nodegroupId}/healingPolicy [get]
+func RestGetNodeGroupHealingPolicy(c echo.Context) error {
+	nsId := c.Param("nsId")
+	infraId := c.Param("infraId")
+	nodegroupId := c.Param("nodegroupId")
+
+	result, err := infra.GetNodeGroupHealingPolicy(nsId, infraId, nodegroupId)
+	return clientManager.EndRequestWithLog(c, err, result)
+}
+
+// RestDelNodeGroupHealingPolicy godoc
+// @ID DelNodeGroupHealingPolicy
+// @Summary Delete the auto-healing policy of a NodeGroup
+// @Description Delete the auto-healing policy of a NodeGroup, which turns healing off. A replacement in progress is not stopped.
+// @Tags [MC-Infra] Infra Provisioning and Management
+// @Accept  json
+// @Produce  json
+// @Param nsId path string true "Namespace ID" default(default)
+// @Param infraId path string true "Infra ID" default(infra01)
+// @Param nodegroupId path string true "NodeGroup ID" default(g1)
+// @Param x-request-id header string false "Custom request ID for tracking"
+// @Success 200 {object} model.SimpleMsg
+// @Failure 404 {object} model.SimpleMsg
+// @Failure 500 {object} model.SimpleMsg
+// @Router /ns/{nsId}/infra/{infraId}/nodegroup/{nodegroupId}/healingPolicy [delete]
+func RestDelNodeGroupHealingPolicy(c echo.Context) error {
+	nsId := c.Param("nsId")
+	infraId := c.Param("infraId")
+	nodegroupId := c.Param("nodegroupId")
+
+	err := infra.DelNodeGroupHealingPolicy(nsId, infraId, nodegroupId)
+	if err != nil {
+		return clientManager.EndRequestWithLog(c, err, nil)
+	}
+	result := model.SimpleMsg{Message: "Deleted the healing policy of NodeGroup " + nodegroupId}
+	return clientManager.EndRequestWithLog(c, err, result)
+}
+
 // RestGetProvisioningLog godoc
 // @ID GetProvisioningLog
 // @Summary Get Provisioning History Log for node Specification
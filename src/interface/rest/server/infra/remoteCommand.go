@@ -43,6 +43,7 @@ func convertSshCmdResultForAPI(internal []model.SshCmdResult) model.InfraSshCmdR
 // @Summary Send a command to specified Infra
 // @Description Send a command to specified Infra. Use query parameters to target specific nodeGroup or node.
 // @Description When async=true, returns immediately with xRequestId and streams results via SSE at GET /stream/ns/{nsId}/cmd/infra/{infraId}?xRequestId={xRequestId}
+// @Description With `rolling` set, Nodes run in batches; each batch is announced as a CommandBatch event on the stream, and the execution stops once more than `maxFailures` Nodes failed.
 // @Tags [MC-Infra] Infra Remote Command
 // @Accept  json
 // @Produce  json
@@ -290,6 +291,117 @@ func RestPostFileAndCmdToInfra(c echo.Context) error {
 	return clientManager.EndRequestWithLog(c, nil, apiResult)
 }
 
+// RestPostSyncFileToInfra godoc
+// @ID PostSyncFileToInfra
+// @Summary Sync a directory tarball to Infra
+// @Description Reconcile the files of a tar or tar.gz archive to a target directory on the targeted nodes of Infra.
+// @Description Files are compared by SHA-256 checksum; only new or changed files are sent, in one archive per node over the SSH/bastion path.
+// @Description Owner and file mode are applied to the synced files; deleteExtraneous removes the files under the target path that are not in the archive.
+// @Description With dryRun, nothing is changed and the result lists what would be done on each node.
+// @Tags [MC-Infra] Infra Remote Command
+// @Accept  multipart/form-data
+// @Produce  json
+// @Param nsId path string true "Namespace ID" default(default)
+// @Param infraId path string true "Infra ID" default(infra01)
+// @Param nodeGroupId query string false "NodeGroup ID to limit the sync to nodes in a nodeGroup"
+// @Param nodeId query string false "Node ID to limit the sync to a single node"
+// @Param labelSelector query string false "Label selector to limit the sync to matching nodes. Example: role=web"
+// @Param targetPath formData string true "Absolute target directory on the nodes" default(/opt/app)
+// @Param file formData file true "The tar or tar.gz archive of the directory"
+// @Param owner formData string false "Owner (user or user:group) of the synced files and directories"
+// @Param fileMode formData string false "Octal mode of the synced files (default: mode in the archive)" default(0644)
+// @Param deleteExtraneous formData bool false "Delete files under the target path that are not in the archive"
+// @Param dryRun formData bool false "Only report the changes"
+// @Param x-request-id header string false "Custom request ID"
+// @Param x-credential-holder header string false "Credential holder ID for selecting which credentials to use (default: system default holder)"
+// @Success 200 {object} model.FileSyncResult
+// @Failure 400 {object} model.SimpleMsg "Invalid request"
+// @Failure 500 {object} model.SimpleMsg "Internal Server Error"
+// @Router /ns/{nsId}/syncFile/infra/{infraId} [post]
+func RestPostSyncFileToInfra(c echo.Context) error {
+
+	nsId := c.Param("nsId")
+	infraId := c.Param("infraId")
+
+	req := &model.FileSyncReq{
+		TargetPath: c.FormValue("targetPath"),
+		Owner:      c.FormValue("owner"),
+		FileMode:   c.FormValue("fileMode"),
+	}
+	for name, dst := range map[string]*bool{"deleteExtraneous": &req.DeleteExtraneous, "dryRun": &req.DryRun} {
+		if v := c.FormValue(name); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return clientManager.EndRequestWithLog(c, fmt.Errorf("invalid %s %q", name, v), nil)
+			}
+			*dst = b
+		}
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		err = fmt.Errorf("failed to read the file: %v", err)
+		return clientManager.EndRequestWithLog(c, err, nil)
+	}
+	if file.Size > infra.FileSyncMaxBytes {
+		err := fmt.Errorf("file too large, max size is %v bytes", infra.FileSyncMaxBytes)
+		return clientManager.EndRequestWithLog(c, err, nil)
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		err = fmt.Errorf("failed to open the file: %v", err)
+		return clientManager.EndRequestWithLog(c, err, nil)
+	}
+	defer src.Close()
+
+	fileBytes, err := io.ReadAll(src)
+	if err != nil {
+		err = fmt.Errorf("failed to read the file: %v", err)
+		return clientManager.EndRequestWithLog(c, err, nil)
+	}
+
+	result, err := infra.SyncTarballToInfra(nsId, infraId, c.QueryParam("nodeGroupId"), c.QueryParam("nodeId"), c.QueryParam("labelSelector"), fileBytes, req)
+	return clientManager.EndRequestWithLog(c, err, result)
+}
+
+// RestPostSyncObjectStorageToInfra godoc
+// @ID PostSyncObjectStorageToInfra
+// @Summary Sync an object storage prefix to Infra
+// @Description Reconcile the objects below a prefix of an object storage to a target directory on the targeted nodes of Infra.
+// @Description Object keys relative to the prefix become paths relative to the target directory.
+// @Description The comparison, owner/mode handling, deleteExtraneous and dryRun work as for the tarball sync.
+// @Tags [MC-Infra] Infra Remote Command
+// @Accept  json
+// @Produce  json
+// @Param nsId path string true "Namespace ID" default(default)
+// @Param infraId path string true "Infra ID" default(infra01)
+// @Param osId path string true "Object storage ID"
+// @Param nodeGroupId query string false "NodeGroup ID to limit the sync to nodes in a nodeGroup"
+// @Param nodeId query string false "Node ID to limit the sync to a single node"
+// @Param labelSelector query string false "Label selector to limit the sync to matching nodes. Example: role=web"
+// @Param fileSyncReq body model.FileSyncReq true "File sync request"
+// @Param x-request-id header string false "Custom request ID"
+// @Param x-credential-holder header string false "Credential holder ID for selecting which credentials to use (default: system default holder)"
+// @Success 200 {object} model.FileSyncResult
+// @Failure 400 {object} model.SimpleMsg "Invalid request"
+// @Failure 500 {object} model.SimpleMsg "Internal Server Error"
+// @Router /ns/{nsId}/syncFile/infra/{infraId}/objectStorage/{osId} [post]
+func RestPostSyncObjectStorageToInfra(c echo.Context) error {
+
+	nsId := c.Param("nsId")
+	infraId := c.Param("infraId")
+	osId := c.Param("osId")
+
+	req := &model.FileSyncReq{}
+	if err := c.Bind(req); err != nil {
+		return clientManager.EndRequestWithLog(c, err, nil)
+	}
+
+	result, err := infra.SyncObjectStorageToInfra(nsId, infraId, c.QueryParam("nodeGroupId"), c.QueryParam("nodeId"), c.QueryParam("labelSelector"), osId, req)
+	return clientManager.EndRequestWithLog(c, err, result)
+}
+
 // RestPostDownloadFileFromInfraNode godoc
 // @ID PostDownloadFileFromInfraNode
 // @Summary Download a file from a node in Infra
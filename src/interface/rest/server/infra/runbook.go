@@ -0,0 +1,256 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package infra is to handle REST API for infra
+package infra
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/cloud-barista/cb-tumblebug/src/core/common"
+	clientManager "github.com/cloud-barista/cb-tumblebug/src/core/common/client"
+	"github.com/cloud-barista/cb-tumblebug/src/core/infra"
+	"github.com/cloud-barista/cb-tumblebug/src/core/model"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog/log"
+)
+
+// RestPostRunbook godoc
+// @ID PostRunbook
+// @Summary Create a runbook
+// @Description Create a runbook: named, parameterized multi-step scripts that run on the Nodes of an Infra.
+// @Description
+// @Description Steps refer to parameters as `{{name}}`; the placeholder is replaced by the value given at execution, single-quoted for string parameters (do not quote it in the script).
+// @Description A runbook runs by ID (POST /ns/{nsId}/cmd/infra/{infraId}/runbook/{runbookId}), or as a post-deployment
+// @Description phase (`postCommands[].runbook`) of Infra creation, NodeGroup addition, templates and auto-control policies.
+// @Tags [MC-Infra] Infra Runbook Management
+// @Accept  json
+// @Produce  json
+// @Param nsId path string true "Namespace ID" default(default)
+// @Param runbookReq body model.RunbookReq true "Runbook request"
+// @Success 200 {object} model.RunbookInfo "Created runbook (version 1)"
+// @Failure 400 {object} model.SimpleMsg "Invalid request"
+// @Failure 500 {object} model.SimpleMsg "Internal error"
+// @Param x-request-id header string false "Custom request ID for tracking"
+// @Router /ns/{nsId}/runbook [post]
+func RestPostRunbook(c echo.Context) error {
+	nsId := c.Param("nsId")
+
+	req := &model.RunbookReq{}
+	if err := c.Bind(req); err != nil {
+		log.Warn().Err(err).Msg("invalid request")
+		return clientManager.EndRequestWithLog(c, err, nil)
+	}
+
+	result, err := infra.CreateRunbook(nsId, req)
+	return clientManager.EndRequestWithLog(c, err, result)
+}
+
+// RestGetRunbook godoc
+// @ID GetRunbook
+// @Summary Get a runbook
+// @Description Get the latest version of a runbook, or the version given by the version query parameter.
+// @Tags [MC-Infra] Infra Runbook Management
+// @Accept  json
+// @Produce  json
+// @Param nsId path string true "Namespace ID" default(default)
+// @Param runbookId path string true "Runbook ID"
+// @Param version query int false "Version of the runbook (default: latest)"
+// @Success 200 {object} model.RunbookInfo "Runbook"
+// @Failure 404 {object} model.SimpleMsg "Runbook not found"
+// @Failure 500 {object} model.SimpleMsg "Internal error"
+// @Param x-request-id header string false "Custom request ID for tracking"
+// @Router /ns/{nsId}/runbook/{runbookId} [get]
+func RestGetRunbook(c echo.Context) error {
+	nsId := c.Param("nsId")
+	runbookId := c.Param("runbookId")
+
+	version := 0
+	if v := c.QueryParam("version"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return clientManager.EndRequestWithLog(c, fmt.Errorf("invalid version %q", v), nil)
+		}
+		version = n
+	}
+
+	result, err := infra.GetRunbook(nsId, runbookId, version)
+	return clientManager.EndRequestWithLog(c, err, result)
+}
+
+// RestGetAllRunbook godoc
+// @ID GetAllRunbook
+// @Summary List runbooks
+// @Description List the latest version of the runbooks in a namespace.
+// @Description Optionally filter by keyword matching against runbook name or description (case-insensitive).
+// @Tags [MC-Infra] Infra Runbook Management
+// @Accept  json
+// @Produce  json
+// @Param nsId path string true "Namespace ID" default(default)
+// @Param filterKeyword query string false "Keyword to filter runbooks by name or description"
+// @Success 200 {object} model.RunbookListResponse "List of runbooks"
+// @Failure 500 {object} model.SimpleMsg "Internal error"
+// @Param x-request-id header string false "Custom request ID for tracking"
+// @Router /ns/{nsId}/runbook [get]
+func RestGetAllRunbook(c echo.Context) error {
+	nsId := c.Param("nsId")
+
+	result, err := infra.ListRunbook(nsId, c.QueryParam("filterKeyword"))
+	if err != nil {
+		return clientManager.EndRequestWithLog(c, err, nil)
+	}
+	return clientManager.EndRequestWithLog(c, nil, model.RunbookListResponse{Runbooks: result})
+}
+
+// RestGetRunbookVersionList godoc
+// @ID GetRunbookVersionList
+// @Summary List the versions of a runbook
+// @Description List all stored versions of a runbook, oldest first.
+// @Tags [MC-Infra] Infra Runbook Management
+// @Accept  json
+// @Produce  json
+// @Param nsId path string true "Namespace ID" default(default)
+// @Param runbookId path string true "Runbook ID"
+// @Success 200 {object} model.RunbookListResponse "Versions of the runbook"
+// @Failure 404 {object} model.SimpleMsg "Runbook not found"
+// @Failure 500 {object} model.SimpleMsg "Internal error"
+// @Param x-request-id header string false "Custom request ID for tracking"
+// @Router /ns/{nsId}/runbook/{runbookId}/version [get]
+func RestGetRunbookVersionList(c echo.Context) error {
+	nsId := c.Param("nsId")
+	runbookId := c.Param("runbookId")
+
+	result, err := infra.ListRunbookVersions(nsId, runbookId)
+	if err != nil {
+		return clientManager.EndRequestWithLog(c, err, nil)
+	}
+	return clientManager.EndRequestWithLog(c, nil, model.RunbookListResponse{Runbooks: result})
+}
+
+// RestPutRunbook godoc
+// @ID PutRunbook
+// @Summary Update a runbook
+// @Description Store a new version of a runbook. Previous versions stay available, so that references pinned to them keep working.
+// @Tags [MC-Infra] Infra Runbook Management
+// @Accept  json
+// @Produce  json
+// @Param nsId path string true "Namespace ID" default(default)
+// @Param runbookId path string true "Runbook ID"
+// @Param runbookReq body model.RunbookReq true "Runbook request"
+// @Success 200 {object} model.RunbookInfo "New version of the runbook"
+// @Failure 400 {object} model.SimpleMsg "Invalid request"
+// @Failure 404 {object} model.SimpleMsg "Runbook not found"
+// @Failure 500 {object} model.SimpleMsg "Internal error"
+// @Param x-request-id header string false "Custom request ID for tracking"
+// @Router /ns/{nsId}/runbook/{runbookId} [put]
+func RestPutRunbook(c echo.Context) error {
+	nsId := c.Param("nsId")
+	runbookId := c.Param("runbookId")
+
+	req := &model.RunbookReq{}
+	if err := c.Bind(req); err != nil {
+		log.Warn().Err(err).Msg("invalid request")
+		return clientManager.EndRequestWithLog(c, err, nil)
+	}
+
+	result, err := infra.UpdateRunbook(nsId, runbookId, req)
+	return clientManager.EndRequestWithLog(c, err, result)
+}
+
+// RestDeleteRunbook godoc
+// @ID DeleteRunbook
+// @Summary Delete a runbook
+// @Description Delete a runbook with all its versions. Post-deployment phases that refer to it fail from then on.
+// @Tags [MC-Infra] Infra Runbook Management
+// @Accept  json
+// @Produce  json
+// @Param nsId path string true "Namespace ID" default(default)
+// @Param runbookId path string true "Runbook ID"
+// @Success 200 {object} model.SimpleMsg "Runbook deleted"
+// @Failure 404 {object} model.SimpleMsg "Runbook not found"
+// @Failure 500 {object} model.SimpleMsg "Internal error"
+// @Param x-request-id header string false "Custom request ID for tracking"
+// @Router /ns/{nsId}/runbook/{runbookId} [delete]
+func RestDeleteRunbook(c echo.Context) error {
+	nsId := c.Param("nsId")
+	runbookId := c.Param("runbookId")
+
+	if err := infra.DeleteRunbook(nsId, runbookId); err != nil {
+		return clientManager.EndRequestWithLog(c, err, nil)
+	}
+	return clientManager.EndRequestWithLog(c, nil, model.SimpleMsg{Message: "The runbook " + runbookId + " has been deleted"})
+}
+
+// RestDeleteAllRunbook godoc
+// @ID DeleteAllRunbook
+// @Summary Delete all runbooks
+// @Description Delete all runbooks in a namespace.
+// @Tags [MC-Infra] Infra Runbook Management
+// @Accept  json
+// @Produce  json
+// @Param nsId path string true "Namespace ID" default(default)
+// @Success 200 {object} model.SimpleMsg "All runbooks deleted"
+// @Failure 500 {object} model.SimpleMsg "Internal error"
+// @Param x-request-id header string false "Custom request ID for tracking"
+// @Router /ns/{nsId}/runbook [delete]
+func RestDeleteAllRunbook(c echo.Context) error {
+	nsId := c.Param("nsId")
+
+	if err := infra.DeleteAllRunbook(nsId); err != nil {
+		return clientManager.EndRequestWithLog(c, err, nil)
+	}
+	return clientManager.EndRequestWithLog(c, nil, model.SimpleMsg{Message: "All runbooks have been deleted"})
+}
+
+// RestPostRunbookToInfra godoc
+// @ID PostRunbookToInfra
+// @Summary Run a runbook on an Infra
+// @Description Run the steps of a runbook, in order, on the Nodes of an Infra. A step that fails on any Node stops
+// @Description the run (the next steps are Skipped) unless the step continues on error.
+// @Description The query parameters override the target of the runbook. Logs stream via SSE at
+// @Description GET /ns/{nsId}/stream/cmd/infra/{infraId}?xRequestId={xRequestId}.
+// @Tags [MC-Infra] Infra Remote Command
+// @Accept  json
+// @Produce  json
+// @Param nsId path string true "Namespace ID" default(default)
+// @Param infraId path string true "Infra ID" default(infra01)
+// @Param runbookId path string true "Runbook ID"
+// @Param runbookRunReq body model.RunbookRunReq true "Runbook execution request"
+// @Param nodeGroupId query string false "Run only on the Nodes of this NodeGroup"
+// @Param nodeId query string false "Run only on this Node"
+// @Param labelSelector query string false "Run only on the Nodes matching this label selector. Example: role=web"
+// @Param x-request-id header string false "Custom request ID"
+// @Success 200 {object} model.RunbookRunResult "Outcome of each step"
+// @Failure 400 {object} model.SimpleMsg "Invalid request"
+// @Failure 404 {object} model.SimpleMsg "Runbook or Infra not found"
+// @Failure 500 {object} model.SimpleMsg "Internal error"
+// @Router /ns/{nsId}/cmd/infra/{infraId}/runbook/{runbookId} [post]
+func RestPostRunbookToInfra(c echo.Context) error {
+	nsId := c.Param("nsId")
+	infraId := c.Param("infraId")
+	runbookId := c.Param("runbookId")
+
+	xRequestId := c.Request().Header.Get("X-Request-Id")
+	if xRequestId == "" {
+		xRequestId = common.GenUid()
+	}
+
+	req := &model.RunbookRunReq{}
+	if err := c.Bind(req); err != nil {
+		return clientManager.EndRequestWithLog(c, err, nil)
+	}
+
+	result, err := infra.RunRunbook(nsId, infraId, runbookId, c.QueryParam("nodeGroupId"), c.QueryParam("nodeId"), c.QueryParam("labelSelector"), req, xRequestId)
+	return clientManager.EndRequestWithLog(c, err, result)
+}
@@ -15,6 +15,7 @@ limitations under the License.
 package infra
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"strings"
@@ -39,6 +40,11 @@ import (
 // @Description - Single connection: `{"jobType": "registerCspResources", "nsId": "default", "intervalSeconds": 60, "connectionName": "aws-ap-northeast-2", "infraNamePrefix": "infra-01"}`
 // @Description - All connections: `{"jobType": "registerCspResources", "nsId": "default", "intervalSeconds": 60, "connectionName": "", "infraNamePrefix": "infra-all"}` or `{"jobType": "registerCspResources", "nsId": "default", "intervalSeconds": 60, "infraNamePrefix": "infra-all"}`
 // @Description
+// @Description **Scheduling Options:**
+// @Description - `cronExpression` (+ `timeZone`, `excludeDates`): run at calendar times instead of every `intervalSeconds`; cron jobs do not execute on creation
+// @Description - `jitterSeconds`: delay each scheduled execution by a random part of this many seconds
+// @Description - `payload`: the job parameters as an object (e.g. `{"provider": "aws", "option": "vNet"}`); the inline fields are still accepted
+// @Description
 // @Description **Job Status Values:**
 // @Description - `Scheduled`: Job is scheduled and waiting for the next execution time
 // @Description - `Executing`: Job is currently running the task
@@ -220,6 +226,7 @@ func RestGetScheduleRegisterCspResourcesStatus(c echo.Context) error {
 // @Description **Updatable Fields:**
 // @Description - `intervalSeconds`: Change execution frequency (minimum 10 seconds)
 // @Description - `enabled`: Enable (true) or disable (false) the job
+// @Description - `cronExpression`, `timeZone`, `excludeDates`: Change the calendar of a cron job (e.g. a power schedule); `excludeDates` replaces the current list
 // @Description
 // @Description **Usage Examples:**
 // @Description - Change interval: `{"intervalSeconds": 30}` (30 seconds)
@@ -457,3 +464,240 @@ func RestPutScheduleRegisterCspResourcesResume(c echo.Context) error {
 	status := job.GetStatus()
 	return c.JSON(http.StatusOK, status)
 }
+
+// RestPostInfraPowerSchedule godoc
+// @ID PostInfraPowerSchedule
+// @Summary Schedule a power action on an Infra or a NodeGroup
+// @Description Create a scheduled job that suspends, resumes or reboots an Infra (or the Nodes of one of its NodeGroups) on a cron schedule
+// @Description
+// @Description **Schedule:**
+// @Description - `cronExpression`: standard 5-field cron (minute hour day-of-month month day-of-week) or a descriptor such as `@daily`
+// @Description - `timeZone`: IANA time zone the expression is evaluated in (e.g. `Asia/Seoul`); empty means the server local time
+// @Description - `excludeDates`: dates (YYYY-MM-DD, in `timeZone`) on which the action is skipped, e.g. holidays
+// @Description
+// @Description **Usage Example (stop a dev Infra on weekday evenings and start it in the morning):**
+// @Description - `{"action": "suspend", "cronExpression": "0 20 * * 1-5", "timeZone": "Asia/Seoul"}`
+// @Description - `{"action": "resume", "cronExpression": "0 8 * * 1-5", "timeZone": "Asia/Seoul", "excludeDates": ["2026-12-25"]}`
+// @Description
+// @Description **Notes:**
+// @Description - Unlike interval jobs, the job does not run on creation; `nextExecutionAt` shows the first run
+// @Description - A resume is refused while the Infra is suspended by an expired lease
+// @Description - The last executions are listed in `runHistory`; manage the job (update, pause, resume, delete) with the `/registerCspResources/schedule/{jobId}` APIs
+// @Description - The jobs are deleted with the Infra
+// @Tags [MC-Infra] Infra Provisioning and Management
+// @Accept json
+// @Produce json
+// @Param nsId path string true "Namespace ID" default(default)
+// @Param infraId path string true "Infra ID" default(infra01)
+// @Param scheduleRequest body model.InfraPowerScheduleReq true "Power schedule"
+// @Success 200 {object} model.ScheduleJobStatus
+// @Failure 400 {object} model.SimpleMsg
+// @Failure 409 {object} model.SimpleMsg "Duplicate job already exists"
+// @Failure 500 {object} model.SimpleMsg
+// @Param x-request-id header string false "Custom request ID for tracking"
+// @Router /ns/{nsId}/infra/{infraId}/powerSchedule [post]
+func RestPostInfraPowerSchedule(c echo.Context) error {
+	nsId := c.Param("nsId")
+	infraId := c.Param("infraId")
+
+	req := new(model.InfraPowerScheduleReq)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, model.SimpleMsg{
+			Message: "Invalid request format: " + err.Error(),
+		})
+	}
+
+	payload, err := json.Marshal(model.PowerActionJobPayload{
+		InfraId:     infraId,
+		NodeGroupId: req.NodeGroupId,
+		Action:      req.Action,
+	})
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, model.SimpleMsg{
+			Message: "Invalid request format: " + err.Error(),
+		})
+	}
+	jobReq := model.ScheduleJobRequest{
+		JobType:        string(infra.JobTypeInfraAction),
+		NsId:           nsId,
+		CronExpression: req.CronExpression,
+		TimeZone:       req.TimeZone,
+		ExcludeDates:   req.ExcludeDates,
+		Payload:        payload,
+	}
+	if req.NodeGroupId != "" {
+		jobReq.JobType = string(infra.JobTypeNodeGroupAction)
+	}
+
+	scheduler := infra.GetSchedulerManager()
+	job, err := scheduler.CreateScheduledJob(jobReq)
+	if err != nil {
+		if strings.Contains(err.Error(), "duplicate job already exists") {
+			return c.JSON(http.StatusConflict, model.SimpleMsg{
+				Message: err.Error(),
+			})
+		}
+		log.Warn().Err(err).Msg("Failed to create power schedule")
+		return c.JSON(http.StatusBadRequest, model.SimpleMsg{
+			Message: "Failed to create power schedule: " + err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, job.GetStatus())
+}
+
+// RestGetInfraPowerScheduleList godoc
+// @ID GetInfraPowerScheduleList
+// @Summary List the power schedules of an Infra
+// @Description List the scheduled power jobs of an Infra and its NodeGroups, with their next execution and run history
+// @Tags [MC-Infra] Infra Provisioning and Management
+// @Accept json
+// @Produce json
+// @Param nsId path string true "Namespace ID" default(default)
+// @Param infraId path string true "Infra ID" default(infra01)
+// @Success 200 {object} model.ScheduleJobListResponse
+// @Failure 500 {object} model.SimpleMsg
+// @Param x-request-id header string false "Custom request ID for tracking"
+// @Router /ns/{nsId}/infra/{infraId}/powerSchedule [get]
+func RestGetInfraPowerScheduleList(c echo.Context) error {
+	nsId := c.Param("nsId")
+	infraId := c.Param("infraId")
+
+	jobs := infra.GetSchedulerManager().ListInfraScheduledJobs(nsId, infraId)
+	statusList := make([]model.ScheduleJobStatus, 0, len(jobs))
+	for _, job := range jobs {
+		statusList = append(statusList, job.GetStatus())
+	}
+
+	return c.JSON(http.StatusOK, model.ScheduleJobListResponse{
+		Jobs: statusList,
+	})
+}
+
+// RestPostCmdSchedule godoc
+// @ID PostCmdSchedule
+// @Summary Schedule remote commands on Infras, NodeGroups or labeled Nodes
+// @Description Create a scheduled job that runs remote commands (e.g. log rotation, patching) on a cron schedule
+// @Description
+// @Description **Target:**
+// @Description - `infraId`: all Nodes of the Infra, or of its NodeGroup `nodeGroupId`
+// @Description - `labelSelector`: only the Nodes matching it; without `infraId`, in every Infra of the namespace
+// @Description
+// @Description **Usage Example (rotate logs of the web Nodes every night):**
+// @Description - `{"labelSelector": "role=web", "command": ["sudo logrotate -f /etc/logrotate.conf"], "cronExpression": "0 3 * * *", "timeZone": "Asia/Seoul"}`
+// @Description
+// @Description **Notes:**
+// @Description - Each run is recorded in the command status of every target Node under the `xRequestId` shown in the execution output
+// @Description - A run fails if a Node did not complete the commands; a non-zero exit raises a `ScheduledCommandNonZeroExit` event
+// @Description - List the runs with `/registerCspResources/schedule/{jobId}/execution`; manage the job with the `/registerCspResources/schedule/{jobId}` APIs
+// @Description - The jobs targeting an Infra are deleted with the Infra
+// @Tags [MC-Infra] Infra Remote Command
+// @Accept json
+// @Produce json
+// @Param nsId path string true "Namespace ID" default(default)
+// @Param scheduleRequest body model.InfraCmdScheduleReq true "Command schedule"
+// @Success 200 {object} model.ScheduleJobStatus
+// @Failure 400 {object} model.SimpleMsg
+// @Failure 409 {object} model.SimpleMsg "Duplicate job already exists"
+// @Failure 500 {object} model.SimpleMsg
+// @Param x-request-id header string false "Custom request ID for tracking"
+// @Router /ns/{nsId}/cmd/schedule [post]
+func RestPostCmdSchedule(c echo.Context) error {
+	nsId := c.Param("nsId")
+
+	req := new(model.InfraCmdScheduleReq)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, model.SimpleMsg{
+			Message: "Invalid request format: " + err.Error(),
+		})
+	}
+
+	payload, err := json.Marshal(req.RemoteCommandJobPayload)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, model.SimpleMsg{
+			Message: "Invalid request format: " + err.Error(),
+		})
+	}
+	job, err := infra.GetSchedulerManager().CreateScheduledJob(model.ScheduleJobRequest{
+		JobType:        string(infra.JobTypeRemoteCommand),
+		NsId:           nsId,
+		CronExpression: req.CronExpression,
+		TimeZone:       req.TimeZone,
+		ExcludeDates:   req.ExcludeDates,
+		Payload:        payload,
+	})
+	if err != nil {
+		if strings.Contains(err.Error(), "duplicate job already exists") {
+			return c.JSON(http.StatusConflict, model.SimpleMsg{
+				Message: err.Error(),
+			})
+		}
+		log.Warn().Err(err).Msg("Failed to create command schedule")
+		return c.JSON(http.StatusBadRequest, model.SimpleMsg{
+			Message: "Failed to create command schedule: " + err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, job.GetStatus())
+}
+
+// RestGetCmdScheduleList godoc
+// @ID GetCmdScheduleList
+// @Summary List the command schedules of a namespace
+// @Description List the scheduled remote command jobs of a namespace, with their next execution and run history
+// @Tags [MC-Infra] Infra Remote Command
+// @Accept json
+// @Produce json
+// @Param nsId path string true "Namespace ID" default(default)
+// @Success 200 {object} model.ScheduleJobListResponse
+// @Failure 500 {object} model.SimpleMsg
+// @Param x-request-id header string false "Custom request ID for tracking"
+// @Router /ns/{nsId}/cmd/schedule [get]
+func RestGetCmdScheduleList(c echo.Context) error {
+	nsId := c.Param("nsId")
+
+	jobs := infra.GetSchedulerManager().ListScheduledJobsByType(nsId, infra.JobTypeRemoteCommand)
+	statusList := make([]model.ScheduleJobStatus, 0, len(jobs))
+	for _, job := range jobs {
+		statusList = append(statusList, job.GetStatus())
+	}
+
+	return c.JSON(http.StatusOK, model.ScheduleJobListResponse{
+		Jobs: statusList,
+	})
+}
+
+// RestGetScheduleJobExecutionList godoc
+// @ID GetScheduleJobExecutionList
+// @Summary List the stored executions of a scheduled job
+// @Description Get the stored execution records of a scheduled job, oldest first, with the output of each execution
+// @Description
+// @Description - The most recent 100 executions are kept per job (`TB_SCHEDULER_EXECUTION_RECORDS`)
+// @Description - The records are deleted with the job
+// @Tags [Job Scheduler] (WIP) CSP Resource Registration
+// @Accept json
+// @Produce json
+// @Param jobId path string true "Job ID"
+// @Success 200 {object} model.ScheduleJobExecutionList
+// @Failure 404 {object} model.SimpleMsg
+// @Failure 500 {object} model.SimpleMsg
+// @Param x-request-id header string false "Custom request ID for tracking"
+// @Router /registerCspResources/schedule/{jobId}/execution [get]
+func RestGetScheduleJobExecutionList(c echo.Context) error {
+	jobId := c.Param("jobId")
+
+	scheduler := infra.GetSchedulerManager()
+	if _, err := scheduler.GetScheduledJob(jobId); err != nil {
+		return c.JSON(http.StatusNotFound, model.SimpleMsg{
+			Message: "Job not found: " + err.Error(),
+		})
+	}
+
+	executions, err := infra.ListJobExecutions(jobId)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, model.SimpleMsg{
+			Message: err.Error(),
+		})
+	}
+	return c.JSON(http.StatusOK, executions)
+}
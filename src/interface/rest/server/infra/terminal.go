@@ -0,0 +1,284 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package infra is to handle REST API for infra
+package infra
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	clientManager "github.com/cloud-barista/cb-tumblebug/src/core/common/client"
+	"github.com/cloud-barista/cb-tumblebug/src/core/infra"
+	"github.com/cloud-barista/cb-tumblebug/src/core/model"
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog/log"
+)
+
+// terminalUpgrader accepts WebSocket connections from the origins allowed by TB_ALLOW_ORIGINS
+var terminalUpgrader = websocket.Upgrader{
+	ReadBufferSize:  4096,
+	WriteBufferSize: 32 * 1024,
+	CheckOrigin: func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			return true // not a browser
+		}
+		for allowed := range strings.SplitSeq(os.Getenv("TB_ALLOW_ORIGINS"), ",") {
+			allowed = strings.TrimSpace(allowed)
+			if allowed == "*" || strings.EqualFold(allowed, origin) {
+				return true
+			}
+		}
+		u, err := url.Parse(origin)
+		return err == nil && strings.EqualFold(u.Host, r.Host)
+	},
+}
+
+// RestGetNodeTerminal godoc
+// @ID GetNodeTerminal
+// @Summary Open an interactive terminal on a Node (WebSocket)
+// @Description Upgrade to a WebSocket carrying an interactive shell (PTY) on a Node. The SSH key stored for the Node
+// @Description is used through its bastion, so operators need no private key.
+// @Description
+// @Description Protocol: the server sends the terminal output as binary frames. The client sends input as binary
+// @Description frames, or as text frames with a JSON model.TerminalMessage: {"type":"input","data":"ls\r"},
+// @Description {"type":"resize","cols":120,"rows":40} or {"type":"ping"} (keepalive, does not count as activity).
+// @Description The session closes when the shell exits, the client disconnects, or no input arrives within the idle timeout.
+// @Description With record=true, the output is stored in asciicast v2 format (see the terminalRecording APIs of the Node).
+// @Tags [MC-Infra] Infra Remote Command
+// @Param nsId path string true "Namespace ID" default(default)
+// @Param infraId path string true "Infra ID" default(infra01)
+// @Param nodeId path string true "Node ID" default(g1-1)
+// @Param userName query string false "SSH user (default: the user of the Node)"
+// @Param cols query int false "Initial terminal width" default(80)
+// @Param rows query int false "Initial terminal height" default(24)
+// @Param term query string false "Terminal type" default(xterm-256color)
+// @Param idleTimeoutMinutes query int false "Close the session after this many minutes without input (default: 15, max: 240)"
+// @Param record query bool false "Record the session for auditing" default(false)
+// @Param x-credential-holder header string false "Credential holder ID for selecting which credentials to use (default: system default holder)"
+// @Success 101 {string} string "Switching Protocols"
+// @Failure 400 {object} model.SimpleMsg "Invalid request"
+// @Failure 500 {object} model.SimpleMsg "Internal Server Error"
+// @Router /ns/{nsId}/terminal/infra/{infraId}/node/{nodeId} [get]
+func RestGetNodeTerminal(c echo.Context) error {
+	nsId := c.Param("nsId")
+	infraId := c.Param("infraId")
+	nodeId := c.Param("nodeId")
+
+	req := &model.TerminalReq{
+		UserName: c.QueryParam("userName"),
+		Term:     c.QueryParam("term"),
+	}
+	for name, dst := range map[string]*int{"cols": &req.Cols, "rows": &req.Rows, "idleTimeoutMinutes": &req.IdleTimeoutMinutes} {
+		if v := c.QueryParam(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return clientManager.EndRequestWithLog(c, fmt.Errorf("invalid %s %q", name, v), nil)
+			}
+			*dst = n
+		}
+	}
+	if v := c.QueryParam("record"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return clientManager.EndRequestWithLog(c, fmt.Errorf("invalid record %q", v), nil)
+		}
+		req.Record = b
+	}
+	if !websocket.IsWebSocketUpgrade(c.Request()) {
+		return clientManager.EndRequestWithLog(c, fmt.Errorf("a WebSocket upgrade request is required"), nil)
+	}
+
+	// Open the session before upgrading so that connection errors are returned as HTTP errors
+	term, err := infra.OpenNodeTerminal(nsId, infraId, nodeId, req, c.RealIP())
+	if err != nil {
+		return clientManager.EndRequestWithLog(c, err, nil)
+	}
+	ws, err := terminalUpgrader.Upgrade(c.Response(), c.Request(), nil)
+	if err != nil {
+		term.Close("upgrade failed")
+		return nil // the upgrader has already replied
+	}
+	defer ws.Close()
+
+	var writeMu sync.Mutex
+	closeWith := func(code int, reason string) {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(5*time.Second))
+	}
+
+	// Terminal output -> client
+	outputDone := make(chan struct{})
+	go func() {
+		defer close(outputDone)
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := term.Read(buf)
+			if n > 0 {
+				writeMu.Lock()
+				ws.SetWriteDeadline(time.Now().Add(30 * time.Second))
+				werr := ws.WriteMessage(websocket.BinaryMessage, buf[:n])
+				writeMu.Unlock()
+				if werr != nil {
+					return
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	// Client -> terminal input; the read deadline enforces the idle timeout
+	reason := make(chan string, 1)
+	go func() {
+		idle := term.IdleTimeout()
+		lastInput := time.Now()
+		for {
+			ws.SetReadDeadline(lastInput.Add(idle))
+			msgType, data, err := ws.ReadMessage()
+			if err != nil {
+				var netErr interface{ Timeout() bool }
+				if errors.As(err, &netErr) && netErr.Timeout() {
+					reason <- "idle timeout"
+				} else {
+					reason <- "client closed"
+				}
+				return
+			}
+			if msgType == websocket.BinaryMessage {
+				lastInput = time.Now()
+				if _, err := term.Write(data); err != nil {
+					reason <- "input failed"
+					return
+				}
+				continue
+			}
+
+			var msg model.TerminalMessage
+			if err := json.Unmarshal(data, &msg); err != nil {
+				log.Debug().Err(err).Str("sessionId", term.SessionId()).Msg("Ignoring an invalid terminal message")
+				continue
+			}
+			switch msg.Type {
+			case model.TerminalMsgInput:
+				lastInput = time.Now()
+				if _, err := term.Write([]byte(msg.Data)); err != nil {
+					reason <- "input failed"
+					return
+				}
+			case model.TerminalMsgResize:
+				if err := term.Resize(msg.Cols, msg.Rows); err != nil {
+					log.Debug().Err(err).Str("sessionId", term.SessionId()).Msg("Terminal resize failed")
+				}
+			case model.TerminalMsgPing:
+				writeMu.Lock()
+				ws.SetWriteDeadline(time.Now().Add(30 * time.Second))
+				ws.WriteMessage(websocket.TextMessage, []byte(`{"type":"pong"}`))
+				writeMu.Unlock()
+			}
+		}
+	}()
+
+	select {
+	case <-outputDone:
+		term.Close("exit")
+		closeWith(websocket.CloseNormalClosure, "session ended")
+	case r := <-reason:
+		term.Close(r)
+		if r == "idle timeout" {
+			closeWith(websocket.ClosePolicyViolation, r)
+		}
+	}
+	return nil
+}
+
+// RestGetNodeTerminalRecordingList godoc
+// @ID GetNodeTerminalRecordingList
+// @Summary List the terminal recordings of a Node
+// @Description List the recorded terminal sessions of a Node, newest first.
+// @Tags [MC-Infra] Infra Remote Command
+// @Accept  json
+// @Produce  json
+// @Param nsId path string true "Namespace ID" default(default)
+// @Param infraId path string true "Infra ID" default(infra01)
+// @Param nodeId path string true "Node ID" default(g1-1)
+// @Param x-request-id header string false "Custom request ID for tracking"
+// @Success 200 {object} model.TerminalRecordingListResponse
+// @Failure 500 {object} model.SimpleMsg "Internal Server Error"
+// @Router /ns/{nsId}/infra/{infraId}/node/{nodeId}/terminalRecording [get]
+func RestGetNodeTerminalRecordingList(c echo.Context) error {
+	result, err := infra.ListTerminalRecording(c.Param("nsId"), c.Param("infraId"), c.Param("nodeId"))
+	if err != nil {
+		return clientManager.EndRequestWithLog(c, err, nil)
+	}
+	return clientManager.EndRequestWithLog(c, nil, model.TerminalRecordingListResponse{Recordings: result})
+}
+
+// RestGetNodeTerminalRecording godoc
+// @ID GetNodeTerminalRecording
+// @Summary Download a terminal recording
+// @Description Download the recording of a terminal session as an asciicast v2 file (playable with asciinema).
+// @Tags [MC-Infra] Infra Remote Command
+// @Produce  application/x-asciicast
+// @Param nsId path string true "Namespace ID" default(default)
+// @Param infraId path string true "Infra ID" default(infra01)
+// @Param nodeId path string true "Node ID" default(g1-1)
+// @Param sessionId path string true "Terminal session ID"
+// @Param x-request-id header string false "Custom request ID for tracking"
+// @Success 200 {file} file "asciicast v2 recording"
+// @Failure 404 {object} model.SimpleMsg "Recording not found"
+// @Router /ns/{nsId}/infra/{infraId}/node/{nodeId}/terminalRecording/{sessionId} [get]
+func RestGetNodeTerminalRecording(c echo.Context) error {
+	sessionId := c.Param("sessionId")
+	_, cast, err := infra.GetTerminalRecording(c.Param("nsId"), c.Param("infraId"), c.Param("nodeId"), sessionId)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, model.SimpleMsg{Message: err.Error()})
+	}
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", sessionId+".cast"))
+	return c.Blob(http.StatusOK, "application/x-asciicast", cast)
+}
+
+// RestDeleteNodeTerminalRecording godoc
+// @ID DeleteNodeTerminalRecording
+// @Summary Delete a terminal recording
+// @Description Delete the recording of a terminal session of a Node.
+// @Tags [MC-Infra] Infra Remote Command
+// @Accept  json
+// @Produce  json
+// @Param nsId path string true "Namespace ID" default(default)
+// @Param infraId path string true "Infra ID" default(infra01)
+// @Param nodeId path string true "Node ID" default(g1-1)
+// @Param sessionId path string true "Terminal session ID"
+// @Param x-request-id header string false "Custom request ID for tracking"
+// @Success 200 {object} model.SimpleMsg
+// @Failure 404 {object} model.SimpleMsg "Recording not found"
+// @Router /ns/{nsId}/infra/{infraId}/node/{nodeId}/terminalRecording/{sessionId} [delete]
+func RestDeleteNodeTerminalRecording(c echo.Context) error {
+	sessionId := c.Param("sessionId")
+	if err := infra.DeleteTerminalRecording(c.Param("nsId"), c.Param("infraId"), c.Param("nodeId"), sessionId); err != nil {
+		return clientManager.EndRequestWithLog(c, err, nil)
+	}
+	return clientManager.EndRequestWithLog(c, nil, model.SimpleMsg{Message: "The terminal recording " + sessionId + " has been deleted"})
+}
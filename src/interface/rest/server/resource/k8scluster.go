@@ -559,6 +559,84 @@ func RestDeleteK8sCluster(c echo.Context) error {
 	return c.JSON(http.StatusOK, &mapA)
 }
 
+// RestGetK8sClusterLease godoc
+// @ID GetK8sClusterLease
+// @Summary Get the lease of a K8sCluster
+// @Description Get when the K8sCluster expires and is deleted.
+// @Tags [Kubernetes] Cluster Management
+// @Accept  json
+// @Produce  json
+// @Param nsId path string true "Namespace ID" default(default)
+// @Param k8sClusterId path string true "K8sCluster ID" default(k8scluster01)
+// @Param x-request-id header string false "Custom request ID for tracking"
+// @Success 200 {object} model.LeaseInfo
+// @Failure 404 {object} model.SimpleMsg
+// @Failure 500 {object} model.SimpleMsg
+// @Router /ns/{nsId}/k8sCluster/{k8sClusterId}/lease [get]
+func RestGetK8sClusterLease(c echo.Context) error {
+	nsId := c.Param("nsId")
+	k8sClusterId := c.Param("k8sClusterId")
+
+	result, err := infra.GetResourceLease(nsId, model.StrK8s, k8sClusterId)
+	return clientManager.EndRequestWithLog(c, err, result)
+}
+
+// RestPutK8sClusterLease godoc
+// @ID PutK8sClusterLease
+// @Summary Set or extend the lease of a K8sCluster
+// @Description Set the expiry of a K8sCluster (`expiresAt`, or `ttl` counted from now) or postpone it (`extendBy`).
+// @Description The owner is warned (log event and K8sCluster system message) TB_LEASE_WARNING_LEAD (default 1h) before expiry,
+// @Description then the K8sCluster is deleted. `expirationAction` suspend is not supported for K8sClusters.
+// @Tags [Kubernetes] Cluster Management
+// @Accept  json
+// @Produce  json
+// @Param nsId path string true "Namespace ID" default(default)
+// @Param k8sClusterId path string true "K8sCluster ID" default(k8scluster01)
+// @Param leaseReq body model.LeaseUpdateReq true "New expiry (one of expiresAt, ttl and extendBy)"
+// @Param x-request-id header string false "Custom request ID for tracking"
+// @Success 200 {object} model.LeaseInfo
+// @Failure 400 {object} model.SimpleMsg
+// @Failure 500 {object} model.SimpleMsg
+// @Router /ns/{nsId}/k8sCluster/{k8sClusterId}/lease [put]
+func RestPutK8sClusterLease(c echo.Context) error {
+	nsId := c.Param("nsId")
+	k8sClusterId := c.Param("k8sClusterId")
+
+	req := &model.LeaseUpdateReq{}
+	if err := c.Bind(req); err != nil {
+		return clientManager.EndRequestWithLog(c, err, nil)
+	}
+
+	result, err := infra.UpdateResourceLease(nsId, model.StrK8s, k8sClusterId, req)
+	return clientManager.EndRequestWithLog(c, err, result)
+}
+
+// RestDeleteK8sClusterLease godoc
+// @ID DeleteK8sClusterLease
+// @Summary Delete the lease of a K8sCluster
+// @Description Delete the lease of a K8sCluster so it no longer expires.
+// @Tags [Kubernetes] Cluster Management
+// @Accept  json
+// @Produce  json
+// @Param nsId path string true "Namespace ID" default(default)
+// @Param k8sClusterId path string true "K8sCluster ID" default(k8scluster01)
+// @Param x-request-id header string false "Custom request ID for tracking"
+// @Success 200 {object} model.SimpleMsg
+// @Failure 404 {object} model.SimpleMsg
+// @Failure 500 {object} model.SimpleMsg
+// @Router /ns/{nsId}/k8sCluster/{k8sClusterId}/lease [delete]
+func RestDeleteK8sClusterLease(c echo.Context) error {
+	nsId := c.Param("nsId")
+	k8sClusterId := c.Param("k8sClusterId")
+
+	err := infra.DelResourceLease(nsId, model.StrK8s, k8sClusterId)
+	if err != nil {
+		return clientManager.EndRequestWithLog(c, err, nil)
+	}
+	result := model.SimpleMsg{Message: "K8sCluster " + k8sClusterId + " no longer expires"}
+	return clientManager.EndRequestWithLog(c, err, result)
+}
+
 // RestDeleteAllK8sCluster godoc
 // @ID DeleteAllK8sCluster
 // @Summary Delete all K8sClusters
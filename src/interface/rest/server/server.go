@@ -264,6 +264,12 @@ func RunServer() {
 							return true // Skip Basic Auth for AWS4-HMAC-SHA256
 						}
 					}
+
+					// Skip policy webhooks that carry an HMAC signature (verified by the handler)
+					if path == "/tumblebug/ns/:nsId/policy/infra/:infraId/webhook/:policyIndex" &&
+						c.Request().Header.Get("x-tb-signature") != "" {
+						return true
+					}
 					return false
 				},
 				Validator: func(username, password string, c echo.Context) (bool, error) {
@@ -357,6 +363,7 @@ func RunServer() {
 	e.POST("/tumblebug/registerCspResources/schedule", rest_infra.RestPostScheduleRegisterCspResources)
 	e.GET("/tumblebug/registerCspResources/schedule", rest_infra.RestGetScheduleRegisterCspResourcesList)
 	e.GET("/tumblebug/registerCspResources/schedule/:jobId", rest_infra.RestGetScheduleRegisterCspResourcesStatus)
+	e.GET("/tumblebug/registerCspResources/schedule/:jobId/execution", rest_infra.RestGetScheduleJobExecutionList)
 	e.PUT("/tumblebug/registerCspResources/schedule/:jobId", rest_infra.RestPutScheduleRegisterCspResources)
 	e.PUT("/tumblebug/registerCspResources/schedule/:jobId/pause", rest_infra.RestPutScheduleRegisterCspResourcesPause)
 	e.PUT("/tumblebug/registerCspResources/schedule/:jobId/resume", rest_infra.RestPutScheduleRegisterCspResourcesResume)
@@ -370,6 +377,13 @@ func RunServer() {
 	e.DELETE("/tumblebug/config/:configId", rest_common.RestInitConfig)
 	e.DELETE("/tumblebug/config", rest_common.RestInitAllConfig)
 
+	e.POST("/tumblebug/backup", rest_common.RestPostBackup)
+	e.GET("/tumblebug/backup", rest_common.RestGetBackupList)
+	e.DELETE("/tumblebug/backup/:backupName", rest_common.RestDeleteBackup)
+	e.POST("/tumblebug/backup/:backupName/restore", rest_common.RestPostBackupRestore)
+
+	e.POST("/tumblebug/kvstore/encryption/rotate", rest_common.RestPostKvEncryptionRotate)
+
 	e.GET("/tumblebug/request/:reqId", rest_common.RestGetRequest)
 	e.GET("/tumblebug/requests", rest_common.RestGetAllRequests)
 	e.DELETE("/tumblebug/request/:reqId", rest_common.RestDeleteRequest)
@@ -402,6 +416,8 @@ func RunServer() {
 	g.PUT("/:nsId", rest_common.RestPutNs)
 	g.DELETE("/:nsId", rest_common.RestDelNs)
 	g.DELETE("", rest_common.RestDelAllNs)
+	g.GET("/:nsId/export", rest_common.RestGetNsExport)
+	g.POST("/import", rest_common.RestPostNsImport)
 
 	// Resource Label
 	e.PUT("/tumblebug/label/:labelType/:uid", rest_label.RestCreateOrUpdateLabel)
@@ -441,6 +457,27 @@ func RunServer() {
 	g.DELETE("/:nsId/template/infra/:templateId", rest_infra.RestDeleteInfraDynamicTemplate)
 	g.DELETE("/:nsId/template/infra", rest_infra.RestDeleteAllInfraDynamicTemplate)
 
+	// Runbook Management
+	g.POST("/:nsId/runbook", rest_infra.RestPostRunbook)
+	g.GET("/:nsId/runbook", rest_infra.RestGetAllRunbook)
+	g.GET("/:nsId/runbook/:runbookId", rest_infra.RestGetRunbook)
+	g.GET("/:nsId/runbook/:runbookId/version", rest_infra.RestGetRunbookVersionList)
+	g.PUT("/:nsId/runbook/:runbookId", rest_infra.RestPutRunbook)
+	g.DELETE("/:nsId/runbook/:runbookId", rest_infra.RestDeleteRunbook)
+	g.DELETE("/:nsId/runbook", rest_infra.RestDeleteAllRunbook)
+
+	// Event Subscription Management (outbound webhooks)
+	g.POST("/:nsId/eventSubscription", rest_infra.RestPostEventSubscription)
+	g.GET("/:nsId/eventSubscription", rest_infra.RestGetAllEventSubscription)
+	g.GET("/:nsId/eventSubscription/:subscriptionId", rest_infra.RestGetEventSubscription)
+	g.PUT("/:nsId/eventSubscription/:subscriptionId", rest_infra.RestPutEventSubscription)
+	g.DELETE("/:nsId/eventSubscription/:subscriptionId", rest_infra.RestDeleteEventSubscription)
+	g.DELETE("/:nsId/eventSubscription", rest_infra.RestDeleteAllEventSubscription)
+	g.GET("/:nsId/eventSubscription/:subscriptionId/delivery", rest_infra.RestGetEventSubscriptionDelivery)
+	g.GET("/:nsId/eventSubscription/:subscriptionId/deadLetter", rest_infra.RestGetEventSubscriptionDeadLetter)
+	g.DELETE("/:nsId/eventSubscription/:subscriptionId/deadLetter", rest_infra.RestDeleteEventSubscriptionDeadLetter)
+	g.POST("/:nsId/eventSubscription/:subscriptionId/deadLetter/:deliveryId/redeliver", rest_infra.RestPostEventSubscriptionRedeliver)
+
 	// Provisioning History and Analytics Routes
 	e.GET("/tumblebug/provisioning/log/:specId", rest_infra.RestGetProvisioningLog)
 	e.DELETE("/tumblebug/provisioning/log/:specId", rest_infra.RestDeleteProvisioningLog)
@@ -449,6 +486,11 @@ func RunServer() {
 	e.POST("/tumblebug/provisioning/event", rest_infra.RestRecordProvisioningEvent)
 
 	g.GET("/:nsId/infra/:infraId/associatedResources", rest_infra.RestGetInfraAssociatedResources)
+	g.POST("/:nsId/driftReport", rest_infra.RestPostNsDriftReport)
+	g.GET("/:nsId/lease", rest_infra.RestGetNsLease)
+	g.GET("/:nsId/infra/:infraId/lease", rest_infra.RestGetInfraLease)
+	g.PUT("/:nsId/infra/:infraId/lease", rest_infra.RestPutInfraLease)
+	g.DELETE("/:nsId/infra/:infraId/lease", rest_infra.RestDelInfraLease)
 	g.PUT("/:nsId/infra/:infraId/associatedSecurityGroups", rest_infra.RestPutInfraAssociatedSecurityGroups)
 
 	g.GET("/:nsId/infra/:infraId/configCopy", rest_infra.RestGetInfraReqFromInfra)
@@ -479,6 +521,15 @@ func RunServer() {
 	g.GET("/:nsId/infra/:infraId/cluster", rest_infra.RestGetInfraClusters)
 	g.GET("/:nsId/infra/:infraId/cluster/:clusterId", rest_infra.RestGetInfraCluster)
 	g.POST("/:nsId/infra/:infraId/nodegroup/:nodegroupId", rest_infra.RestPostInfraNodeGroupScaleOut)
+	g.POST("/:nsId/infra/:infraId/nodegroup/:nodegroupId/rollingUpdate", rest_infra.RestPostNodeGroupRollingUpdate)
+	g.GET("/:nsId/infra/:infraId/nodegroup/:nodegroupId/rollingUpdate", rest_infra.RestGetNodeGroupRollingUpdate)
+	g.PUT("/:nsId/infra/:infraId/nodegroup/:nodegroupId/rollingUpdate", rest_infra.RestPutNodeGroupRollingUpdate)
+	g.PUT("/:nsId/infra/:infraId/nodegroup/:nodegroupId/healingPolicy", rest_infra.RestPutNodeGroupHealingPolicy)
+	g.GET("/:nsId/infra/:infraId/nodegroup/:nodegroupId/healingPolicy", rest_infra.RestGetNodeGroupHealingPolicy)
+	g.DELETE("/:nsId/infra/:infraId/nodegroup/:nodegroupId/healingPolicy", rest_infra.RestDelNodeGroupHealingPolicy)
+	g.POST("/:nsId/infra/:infraId/powerSchedule", rest_infra.RestPostInfraPowerSchedule)
+	g.GET("/:nsId/infra/:infraId/powerSchedule", rest_infra.RestGetInfraPowerScheduleList)
+	g.PUT("/:nsId/infra/:infraId/apply", rest_infra.RestPutInfraApply)
 
 	//g.GET("/:nsId/infra/:infraId/node", rest_infra.RestGetAllInfraNode)
 	// g.PUT("/:nsId/infra/:infraId/node/:nodeId", rest_infra.RestPutInfraNode)
@@ -492,13 +543,24 @@ func RunServer() {
 	g.GET("/:nsId/control/infra/:infraId/node/:nodeId", rest_infra.RestGetControlInfraNode)
 
 	g.POST("/:nsId/cmd/infra/:infraId", rest_infra.RestPostCmdInfra)
+	g.POST("/:nsId/cmd/infra/:infraId/runbook/:runbookId", rest_infra.RestPostRunbookToInfra)
+	g.POST("/:nsId/cmd/schedule", rest_infra.RestPostCmdSchedule)
+	g.GET("/:nsId/cmd/schedule", rest_infra.RestGetCmdScheduleList)
 	g.POST("/:nsId/transferFile/infra/:infraId", rest_infra.RestPostFileToInfra)
 	g.POST("/:nsId/transferFileAndCmd/infra/:infraId", rest_infra.RestPostFileAndCmdToInfra)
+	g.POST("/:nsId/syncFile/infra/:infraId", rest_infra.RestPostSyncFileToInfra)
+	g.POST("/:nsId/syncFile/infra/:infraId/objectStorage/:osId", rest_infra.RestPostSyncObjectStorageToInfra)
 	g.POST("/:nsId/downloadFile/infra/:infraId/node/:nodeId", rest_infra.RestPostDownloadFileFromInfraNode)
 
 	// SSE stream for real-time command execution log streaming
 	g.GET("/:nsId/stream/cmd/infra/:infraId", rest_infra.RestGetCmdInfraStream)
 
+	// Interactive terminal (WebSocket) and its recordings
+	g.GET("/:nsId/terminal/infra/:infraId/node/:nodeId", rest_infra.RestGetNodeTerminal)
+	g.GET("/:nsId/infra/:infraId/node/:nodeId/terminalRecording", rest_infra.RestGetNodeTerminalRecordingList)
+	g.GET("/:nsId/infra/:infraId/node/:nodeId/terminalRecording/:sessionId", rest_infra.RestGetNodeTerminalRecording)
+	g.DELETE("/:nsId/infra/:infraId/node/:nodeId/terminalRecording/:sessionId", rest_infra.RestDeleteNodeTerminalRecording)
+
 	// Command Status Management for Nodes
 	g.GET("/:nsId/infra/:infraId/node/:nodeId/commandStatus/:index", rest_infra.RestGetNodeCommandStatus)
 	g.GET("/:nsId/infra/:infraId/node/:nodeId/commandStatus", rest_infra.RestListNodeCommandStatus)
@@ -560,6 +622,8 @@ func RunServer() {
 	//Infra AUTO Policy
 	g.POST("/:nsId/policy/infra/:infraId", rest_infra.RestPostInfraPolicy)
 	g.GET("/:nsId/policy/infra/:infraId", rest_infra.RestGetInfraPolicy)
+	g.GET("/:nsId/policy/infra/:infraId/decision", rest_infra.RestGetInfraPolicyDecision)
+	g.POST("/:nsId/policy/infra/:infraId/webhook/:policyIndex", rest_infra.RestPostInfraPolicyWebhook)
 	g.GET("/:nsId/policy/infra", rest_infra.RestGetAllInfraPolicy)
 	g.PUT("/:nsId/policy/infra/:infraId", rest_infra.RestPutInfraPolicy)
 	g.DELETE("/:nsId/policy/infra/:infraId", rest_infra.RestDelInfraPolicy)
@@ -587,6 +651,9 @@ func RunServer() {
 	g.DELETE("/:nsId/k8sCluster/:k8sClusterId", rest_resource.RestDeleteK8sCluster)
 	g.DELETE("/:nsId/k8sCluster", rest_resource.RestDeleteAllK8sCluster)
 	g.PUT("/:nsId/k8sCluster/:k8sClusterId/upgrade", rest_resource.RestPutUpgradeK8sCluster)
+	g.GET("/:nsId/k8sCluster/:k8sClusterId/lease", rest_resource.RestGetK8sClusterLease)
+	g.PUT("/:nsId/k8sCluster/:k8sClusterId/lease", rest_resource.RestPutK8sClusterLease)
+	g.DELETE("/:nsId/k8sCluster/:k8sClusterId/lease", rest_resource.RestDeleteK8sClusterLease)
 	g.GET("/:nsId/k8sCluster/:k8sClusterId/token", rest_resource.RestGetK8sClusterToken,
 		middleware.TimeoutWithConfig(timeoutConfig),
 		middleware.RateLimiter(middleware.NewRateLimiterMemoryStore(2)))
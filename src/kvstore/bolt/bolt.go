@@ -0,0 +1,202 @@
+package bolt
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	bbolt "go.etcd.io/bbolt"
+
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvstore"
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/memory"
+)
+
+var (
+	bucketKv   = []byte("kv")
+	bucketMeta = []byte("meta")
+	keyRev     = []byte("revision")
+)
+
+// Config holds the configuration for the embedded bolt store.
+type Config struct {
+	// Path is the database file. Parent directories are created if missing.
+	Path string
+	// OpenTimeout bounds how long to wait for the file lock held by another process.
+	OpenTimeout time.Duration
+}
+
+// boltPersister persists memory.Record entries in a single bbolt file.
+type boltPersister struct {
+	mu   sync.Mutex
+	db   *bbolt.DB
+	path string
+	opts *bbolt.Options
+}
+
+// storedRecord is the on-disk encoding of a record (the key is the bbolt key).
+type storedRecord struct {
+	Value          string `json:"v"`
+	CreateRevision int64  `json:"c"`
+	ModRevision    int64  `json:"m"`
+	Version        int64  `json:"ver"`
+}
+
+// NewBoltStore creates a kvstore.Store backed by an embedded bbolt file.
+// Reads are served from memory; every write goes through to disk before it is applied,
+// so the store survives restarts without any external service.
+func NewBoltStore(ctx context.Context, config Config) (kvstore.Store, error) {
+	if config.Path == "" {
+		return nil, fmt.Errorf("bolt store path is empty")
+	}
+	if err := os.MkdirAll(filepath.Dir(config.Path), 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create directory for bolt store: %w", err)
+	}
+
+	opts := &bbolt.Options{Timeout: config.OpenTimeout}
+	db, err := bbolt.Open(config.Path, 0o600, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bolt store %s: %w", config.Path, err)
+	}
+
+	err = db.Update(func(tx *bbolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(bucketKv); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(bucketMeta)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize bolt store buckets: %w", err)
+	}
+
+	p := &boltPersister{db: db, path: config.Path, opts: opts}
+	store, err := memory.NewMemoryStoreWithPersister(ctx, p)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+// Load reads every record and the last revision from the file.
+func (p *boltPersister) Load() ([]memory.Record, int64, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var records []memory.Record
+	var revision int64
+	err := p.db.View(func(tx *bbolt.Tx) error {
+		if v := tx.Bucket(bucketMeta).Get(keyRev); len(v) == 8 {
+			revision = int64(binary.BigEndian.Uint64(v))
+		}
+		return tx.Bucket(bucketKv).ForEach(func(k, v []byte) error {
+			var rec storedRecord
+			if err := json.Unmarshal(v, &rec); err != nil {
+				return fmt.Errorf("failed to decode record %q: %w", string(k), err)
+			}
+			records = append(records, memory.Record{
+				Key:            string(k),
+				Value:          rec.Value,
+				CreateRevision: rec.CreateRevision,
+				ModRevision:    rec.ModRevision,
+				Version:        rec.Version,
+			})
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return records, revision, nil
+}
+
+// Save writes puts and deletes in one bbolt transaction.
+func (p *boltPersister) Save(revision int64, puts []memory.Record, deletes []string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.db.Update(func(tx *bbolt.Tx) error {
+		kv := tx.Bucket(bucketKv)
+		for _, rec := range puts {
+			v, err := json.Marshal(storedRecord{
+				Value:          rec.Value,
+				CreateRevision: rec.CreateRevision,
+				ModRevision:    rec.ModRevision,
+				Version:        rec.Version,
+			})
+			if err != nil {
+				return err
+			}
+			if err := kv.Put([]byte(rec.Key), v); err != nil {
+				return err
+			}
+		}
+		for _, k := range deletes {
+			if err := kv.Delete([]byte(k)); err != nil {
+				return err
+			}
+		}
+		rev := make([]byte, 8)
+		binary.BigEndian.PutUint64(rev, uint64(revision))
+		return tx.Bucket(bucketMeta).Put(keyRev, rev)
+	})
+}
+
+// Defragment rewrites the database into a fresh file and swaps it in.
+// bbolt reuses freed pages but never shrinks the file, so this is the only way to
+// give space back to the filesystem after large deletions.
+func (p *boltPersister) Defragment(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	tmpPath := p.path + ".defrag"
+	os.Remove(tmpPath)
+	dst, err := bbolt.Open(tmpPath, 0o600, p.opts)
+	if err != nil {
+		return fmt.Errorf("failed to open defragment target: %w", err)
+	}
+	if err := bbolt.Compact(dst, p.db, 64*1024); err != nil {
+		dst.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to compact bolt store: %w", err)
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to close defragment target: %w", err)
+	}
+
+	if err := p.db.Close(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to close bolt store: %w", err)
+	}
+	renameErr := os.Rename(tmpPath, p.path)
+
+	// Reopen whichever file is now at p.path, even if the rename failed
+	db, err := bbolt.Open(p.path, 0o600, p.opts)
+	if err != nil {
+		return fmt.Errorf("failed to reopen bolt store after defragment: %w", err)
+	}
+	p.db = db
+	if renameErr != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to replace bolt store with defragmented file: %w", renameErr)
+	}
+	return nil
+}
+
+// Close closes the bbolt file.
+func (p *boltPersister) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.db.Close()
+}
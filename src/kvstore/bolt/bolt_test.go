@@ -0,0 +1,77 @@
+package bolt
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvstore"
+)
+
+func openTestStore(t *testing.T, path string) kvstore.Store {
+	t.Helper()
+	store, err := NewBoltStore(context.Background(), Config{Path: path, OpenTimeout: time.Second})
+	if err != nil {
+		t.Fatalf("NewBoltStore() error: %v", err)
+	}
+	return store
+}
+
+func TestBoltStoreReopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "db", "tumblebug.db")
+
+	store := openTestStore(t, path)
+	store.Put("/a", "1")
+	store.Put("/b", "1")
+	store.Put("/a", "2")
+	store.Delete("/b")
+	if err := store.Txn(ctx, nil, []kvstore.Op{kvstore.PutOp("/c", "3"), kvstore.PutOp("/d", "4")}); err != nil {
+		t.Fatalf("Txn() error: %v", err)
+	}
+	_, lastRev, _, _ := store.GetWithRevision(ctx, "/d")
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close() error: %v", err)
+	}
+
+	store = openTestStore(t, path)
+	defer store.Close()
+
+	tests := []struct {
+		key        string
+		wantValue  string
+		wantExists bool
+	}{
+		{"/a", "2", true},
+		{"/b", "", false},
+		{"/c", "3", true},
+		{"/d", "4", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			value, exists, err := store.Get(tt.key)
+			if err != nil || value != tt.wantValue || exists != tt.wantExists {
+				t.Errorf("Get(%q) = (%q, %v, %v), want (%q, %v)", tt.key, value, exists, err, tt.wantValue, tt.wantExists)
+			}
+		})
+	}
+
+	// Revisions continue from the last one saved, so stale writers still conflict
+	if err := store.PutIfRevision(ctx, "/d", "5", lastRev); err != nil {
+		t.Fatalf("PutIfRevision() with the saved revision error: %v", err)
+	}
+	_, rev, _, _ := store.GetWithRevision(ctx, "/d")
+	if rev <= lastRev {
+		t.Errorf("revision after reopen = %d, want more than %d", rev, lastRev)
+	}
+	if err := store.PutIfRevision(ctx, "/d", "6", lastRev); err != kvstore.ErrRevisionConflict {
+		t.Errorf("PutIfRevision() with a stale revision error = %v, want %v", err, kvstore.ErrRevisionConflict)
+	}
+}
+
+func TestBoltStoreEmptyPath(t *testing.T) {
+	if _, err := NewBoltStore(context.Background(), Config{}); err == nil {
+		t.Error("NewBoltStore() with an empty path succeeded")
+	}
+}
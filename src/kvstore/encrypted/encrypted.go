@@ -0,0 +1,451 @@
+// Package encrypted provides a kvstore.Store wrapper that transparently encrypts
+// sensitive values (SSH private keys, passwords, kubeconfigs, ...) at rest.
+//
+// Envelope encryption is used: values are sealed with AES-256-GCM under a data key,
+// and the data key is stored in the kvstore wrapped by a master key that never
+// leaves its KeyWrapper (a local key file or an OpenBao transit key).
+// Callers of the wrapped store always see plaintext.
+package encrypted
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvstore"
+)
+
+// cipherPrefix marks an encrypted string: tbenc:v1:{dataKeyId}:{base64(nonce|ciphertext)}.
+// The data key id and the key itself are bound to the ciphertext as additional data.
+const cipherPrefix = "tbenc:v1:"
+
+// Rule selects what is encrypted for the keys matching Pattern.
+type Rule struct {
+	// Pattern is matched segment by segment against a key: "*" matches any single
+	// segment and a trailing "**" matches any number of remaining segments,
+	// e.g. "/ns/*/resources/sshKey/*".
+	Pattern string
+	// Fields are gjson paths of string fields to encrypt inside a JSON value, where a
+	// "#" segment stands for every element of an array (see FieldPaths).
+	// When empty, the whole value is encrypted.
+	Fields []string
+}
+
+// DefaultRules covers the secrets Tumblebug keeps in its object records.
+var DefaultRules = []Rule{
+	{Pattern: "/ns/*/resources/sshKey/*", Fields: []string{"privateKey"}},
+	{Pattern: "/ns/*/k8scluster/*", Fields: []string{"accessInfo.kubeconfig"}},
+	{Pattern: "/ns/*/infra/*/node/*", Fields: []string{"nodeUserPassword"}},
+	{Pattern: "/ns/*/eventSubscription/*", Fields: []string{"secret"}},
+	{Pattern: "/ns/*/policy/infra/*", Fields: []string{"policy.#.webhook.secret"}},
+}
+
+// match reports whether key matches the rule pattern.
+func (r Rule) match(key string) bool {
+	pattern := strings.Split(r.Pattern, "/")
+	parts := strings.Split(key, "/")
+	for i, p := range pattern {
+		if p == "**" && i == len(pattern)-1 {
+			return len(parts) > i
+		}
+		if i >= len(parts) || (p != "*" && p != parts[i]) {
+			return false
+		}
+	}
+	return len(parts) == len(pattern)
+}
+
+// scanPrefix returns the literal key prefix before the first wildcard of the pattern.
+func (r Rule) scanPrefix() string {
+	if i := strings.Index(r.Pattern, "*"); i >= 0 {
+		return r.Pattern[:i]
+	}
+	return r.Pattern
+}
+
+// FieldPaths expands the "#" segments of a gjson field path into the indexes of the
+// arrays in value, e.g. "policy.#.webhook.secret" into "policy.0.webhook.secret",
+// "policy.1.webhook.secret", and so on. A path without "#" is returned as is.
+func FieldPaths(value, field string) []string {
+	before, after, found := strings.Cut(field, ".#")
+	if !found || (after != "" && after[0] != '.') {
+		return []string{field}
+	}
+	var paths []string
+	for i := range gjson.Get(value, before+".#").Int() {
+		paths = append(paths, FieldPaths(value, before+"."+strconv.FormatInt(i, 10)+after)...)
+	}
+	return paths
+}
+
+// Store wraps a kvstore.Store and encrypts the values selected by its rules.
+// Methods that do not carry values (deletes, locks, key listings, maintenance)
+// are served by the embedded store unchanged.
+type Store struct {
+	kvstore.Store
+
+	wrapper KeyWrapper
+	rules   []Rule
+
+	mu       sync.RWMutex
+	activeId string
+	keys     map[string]cipher.AEAD
+}
+
+// NewStore wraps inner with envelope encryption. It loads the active data key, or
+// creates one wrapped by wrapper if the store has none yet.
+func NewStore(ctx context.Context, inner kvstore.Store, wrapper KeyWrapper, rules []Rule) (*Store, error) {
+	if inner == nil || wrapper == nil {
+		return nil, fmt.Errorf("encrypted store requires an inner store and a key wrapper")
+	}
+	s := &Store{
+		Store:   inner,
+		wrapper: wrapper,
+		rules:   rules,
+		keys:    make(map[string]cipher.AEAD),
+	}
+	if err := s.loadActiveKey(ctx); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// encryptValue encrypts the parts of value selected by the rules for key.
+// Parts that are already encrypted are left as they are.
+func (s *Store) encryptValue(ctx context.Context, key, value string) (string, error) {
+	for _, rule := range s.rules {
+		if !rule.match(key) {
+			continue
+		}
+		if len(rule.Fields) == 0 {
+			if value == "" || strings.HasPrefix(value, cipherPrefix) {
+				return value, nil
+			}
+			return s.seal(ctx, key, value)
+		}
+		if !gjson.Valid(value) {
+			return value, nil
+		}
+		for _, field := range rule.Fields {
+			for _, path := range FieldPaths(value, field) {
+				v := gjson.Get(value, path)
+				if v.Type != gjson.String || v.Str == "" || strings.HasPrefix(v.Str, cipherPrefix) {
+					continue
+				}
+				sealed, err := s.seal(ctx, key, v.Str)
+				if err != nil {
+					return "", err
+				}
+				if value, err = sjson.Set(value, path, sealed); err != nil {
+					return "", fmt.Errorf("failed to set encrypted field %s of %s: %w", path, key, err)
+				}
+			}
+		}
+		return value, nil
+	}
+	return value, nil
+}
+
+// decryptValue reverses encryptValue. Values written before encryption was enabled
+// are returned unchanged.
+func (s *Store) decryptValue(ctx context.Context, key, value string) (string, error) {
+	for _, rule := range s.rules {
+		if !rule.match(key) {
+			continue
+		}
+		if len(rule.Fields) == 0 {
+			if !strings.HasPrefix(value, cipherPrefix) {
+				return value, nil
+			}
+			return s.open(ctx, key, value)
+		}
+		if !strings.Contains(value, cipherPrefix) || !gjson.Valid(value) {
+			return value, nil
+		}
+		for _, field := range rule.Fields {
+			for _, path := range FieldPaths(value, field) {
+				v := gjson.Get(value, path)
+				if v.Type != gjson.String || !strings.HasPrefix(v.Str, cipherPrefix) {
+					continue
+				}
+				plain, err := s.open(ctx, key, v.Str)
+				if err != nil {
+					return "", err
+				}
+				if value, err = sjson.Set(value, path, plain); err != nil {
+					return "", fmt.Errorf("failed to set decrypted field %s of %s: %w", path, key, err)
+				}
+			}
+		}
+		return value, nil
+	}
+	return value, nil
+}
+
+// seal encrypts plaintext with the active data key, binding it to key.
+func (s *Store) seal(ctx context.Context, key, plaintext string) (string, error) {
+	s.mu.RLock()
+	id := s.activeId
+	aead := s.keys[id]
+	s.mu.RUnlock()
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), additionalData(id, key))
+	return cipherPrefix + id + ":" + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// open decrypts a value produced by seal for the same key.
+func (s *Store) open(ctx context.Context, key, ciphertext string) (string, error) {
+	id, encoded, ok := strings.Cut(strings.TrimPrefix(ciphertext, cipherPrefix), ":")
+	if !ok {
+		return "", fmt.Errorf("malformed encrypted value at %s", key)
+	}
+	aead, err := s.dataKey(ctx, id)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt %s: %w", key, err)
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", fmt.Errorf("malformed encrypted value at %s", key)
+	}
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], additionalData(id, key))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt %s: %w", key, err)
+	}
+	return string(plain), nil
+}
+
+// additionalData binds a ciphertext to its data key and kvstore key, so an encrypted
+// value copied to another key does not decrypt.
+func additionalData(dataKeyId, key string) []byte {
+	return []byte(dataKeyId + "\x00" + key)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Put stores value, encrypting the parts selected by the rules.
+func (s *Store) Put(key, value string) error {
+	return s.PutWith(context.Background(), key, value)
+}
+
+// PutWith stores value using the provided context.
+func (s *Store) PutWith(ctx context.Context, key, value string) error {
+	enc, err := s.encryptValue(ctx, key, value)
+	if err != nil {
+		return err
+	}
+	return s.Store.PutWith(ctx, key, enc)
+}
+
+// PutIfRevision stores value if the key's revision still matches.
+func (s *Store) PutIfRevision(ctx context.Context, key, value string, revision int64) error {
+	enc, err := s.encryptValue(ctx, key, value)
+	if err != nil {
+		return err
+	}
+	return s.Store.PutIfRevision(ctx, key, enc, revision)
+}
+
+// Txn applies ops atomically, encrypting the values of put operations.
+func (s *Store) Txn(ctx context.Context, compares []kvstore.Compare, ops []kvstore.Op) error {
+	encOps := make([]kvstore.Op, len(ops))
+	for i, op := range ops {
+		encOps[i] = op
+		if op.Type != kvstore.OpPut {
+			continue
+		}
+		enc, err := s.encryptValue(ctx, op.Key, op.Value)
+		if err != nil {
+			return err
+		}
+		encOps[i].Value = enc
+	}
+	return s.Store.Txn(ctx, compares, encOps)
+}
+
+// Get returns the decrypted value of key.
+func (s *Store) Get(key string) (string, bool, error) {
+	return s.GetWith(context.Background(), key)
+}
+
+// GetWith returns the decrypted value of key using the provided context.
+func (s *Store) GetWith(ctx context.Context, key string) (string, bool, error) {
+	value, exists, err := s.Store.GetWith(ctx, key)
+	if err != nil || !exists {
+		return value, exists, err
+	}
+	value, err = s.decryptValue(ctx, key, value)
+	return value, err == nil, err
+}
+
+// GetList returns the decrypted values under keyPrefix.
+func (s *Store) GetList(keyPrefix string) ([]string, error) {
+	return s.GetListWith(context.Background(), keyPrefix)
+}
+
+// GetListWith returns the decrypted values under keyPrefix using the provided context.
+// Values are read with their keys, which are needed to decrypt them.
+func (s *Store) GetListWith(ctx context.Context, keyPrefix string) ([]string, error) {
+	kvs, err := s.GetKvListWith(ctx, keyPrefix)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]string, len(kvs))
+	for i, kv := range kvs {
+		values[i] = kv.Value
+	}
+	return values, nil
+}
+
+// GetKv returns the decrypted key-value pair.
+func (s *Store) GetKv(key string) (kvstore.KeyValue, bool, error) {
+	return s.GetKvWith(context.Background(), key)
+}
+
+// GetKvWith returns the decrypted key-value pair using the provided context.
+func (s *Store) GetKvWith(ctx context.Context, key string) (kvstore.KeyValue, bool, error) {
+	kv, exists, err := s.Store.GetKvWith(ctx, key)
+	if err != nil || !exists {
+		return kv, exists, err
+	}
+	kv.Value, err = s.decryptValue(ctx, kv.Key, kv.Value)
+	return kv, err == nil, err
+}
+
+// GetKvList returns the decrypted key-value pairs under keyPrefix.
+func (s *Store) GetKvList(keyPrefix string) ([]kvstore.KeyValue, error) {
+	return s.GetKvListWith(context.Background(), keyPrefix)
+}
+
+// GetKvListWith returns the decrypted key-value pairs under keyPrefix using the provided context.
+func (s *Store) GetKvListWith(ctx context.Context, keyPrefix string) ([]kvstore.KeyValue, error) {
+	kvs, err := s.Store.GetKvListWith(ctx, keyPrefix)
+	if err != nil {
+		return nil, err
+	}
+	return s.decryptList(ctx, kvs)
+}
+
+// GetSortedKvList returns the decrypted key-value pairs under keyPrefix in the given order.
+// Sorting by value orders encrypted values by their ciphertext.
+func (s *Store) GetSortedKvList(keyPrefix string, sortBy kvstore.SortTarget, order kvstore.SortOrder) ([]kvstore.KeyValue, error) {
+	return s.GetSortedKvListWith(context.Background(), keyPrefix, sortBy, order)
+}
+
+// GetSortedKvListWith is GetSortedKvList using the provided context.
+func (s *Store) GetSortedKvListWith(ctx context.Context, keyPrefix string, sortBy kvstore.SortTarget, order kvstore.SortOrder) ([]kvstore.KeyValue, error) {
+	kvs, err := s.Store.GetSortedKvListWith(ctx, keyPrefix, sortBy, order)
+	if err != nil {
+		return nil, err
+	}
+	return s.decryptList(ctx, kvs)
+}
+
+// GetWithRevision returns the decrypted key-value pair with its modification revision.
+func (s *Store) GetWithRevision(ctx context.Context, key string) (kvstore.KeyValue, int64, bool, error) {
+	kv, revision, exists, err := s.Store.GetWithRevision(ctx, key)
+	if err != nil || !exists {
+		return kv, revision, exists, err
+	}
+	kv.Value, err = s.decryptValue(ctx, kv.Key, kv.Value)
+	if err != nil {
+		return kvstore.KeyValue{}, 0, false, err
+	}
+	return kv, revision, true, nil
+}
+
+// GetKvMap returns the decrypted key-value map under keyPrefix.
+func (s *Store) GetKvMap(keyPrefix string) (kvstore.KeyValueMap, error) {
+	return s.GetKvMapWith(context.Background(), keyPrefix)
+}
+
+// GetKvMapWith returns the decrypted key-value map under keyPrefix using the provided context.
+func (s *Store) GetKvMapWith(ctx context.Context, keyPrefix string) (kvstore.KeyValueMap, error) {
+	kvm, err := s.Store.GetKvMapWith(ctx, keyPrefix)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range kvm {
+		if kvm[key], err = s.decryptValue(ctx, key, value); err != nil {
+			return nil, err
+		}
+	}
+	return kvm, nil
+}
+
+func (s *Store) decryptList(ctx context.Context, kvs []kvstore.KeyValue) ([]kvstore.KeyValue, error) {
+	for i := range kvs {
+		value, err := s.decryptValue(ctx, kvs[i].Key, kvs[i].Value)
+		if err != nil {
+			return nil, err
+		}
+		kvs[i].Value = value
+	}
+	return kvs, nil
+}
+
+// WatchKey watches key and delivers decrypted values.
+func (s *Store) WatchKey(key string) kvstore.WatchChan {
+	return s.WatchKeyWith(context.Background(), key)
+}
+
+// WatchKeyWith watches key using the provided context.
+func (s *Store) WatchKeyWith(ctx context.Context, key string) kvstore.WatchChan {
+	return s.decryptWatch(ctx, s.Store.WatchKeyWith(ctx, key))
+}
+
+// WatchKeys watches keyPrefix and delivers decrypted values.
+func (s *Store) WatchKeys(keyPrefix string) kvstore.WatchChan {
+	return s.WatchKeysWith(context.Background(), keyPrefix)
+}
+
+// WatchKeysWith watches keyPrefix using the provided context.
+func (s *Store) WatchKeysWith(ctx context.Context, keyPrefix string) kvstore.WatchChan {
+	return s.decryptWatch(ctx, s.Store.WatchKeysWith(ctx, keyPrefix))
+}
+
+// decryptWatch relays watch responses with decrypted event values.
+// A response holding a value that cannot be decrypted is replaced by an error response.
+func (s *Store) decryptWatch(ctx context.Context, in kvstore.WatchChan) kvstore.WatchChan {
+	out := make(chan kvstore.WatchResponse)
+	go func() {
+		defer close(out)
+		for resp := range in {
+			for i, ev := range resp.Events {
+				if ev.Type != kvstore.EventPut {
+					continue
+				}
+				value, err := s.decryptValue(ctx, ev.Key, ev.Value)
+				if err != nil {
+					resp = kvstore.WatchResponse{Err: err}
+					break
+				}
+				resp.Events[i].Value = value
+			}
+			select {
+			case out <- resp:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
@@ -0,0 +1,279 @@
+package encrypted
+
+import (
+	"context"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvstore"
+)
+
+const (
+	// KeyPrefix holds the encryption metadata. Its records are written to the inner
+	// store directly.
+	KeyPrefix = "/encryption/"
+	// DataKeyPrefix holds the wrapped data keys, one record per key id. They may be
+	// copied to another store (e.g., by backups) along with the values they seal.
+	DataKeyPrefix = KeyPrefix + "dataKey/"
+	// ActiveDataKeyKey holds the id of the data key used for new writes. It belongs to
+	// its store and must not be copied.
+	ActiveDataKeyKey = KeyPrefix + "activeDataKey"
+
+	dataKeySize = 32
+)
+
+// KeyWrapper protects data keys with a master key.
+type KeyWrapper interface {
+	// Name identifies the master key, e.g. "local:1a2b3c4d" or "openbao-transit:transit/tumblebug".
+	Name() string
+	// WrapKey encrypts a data key with the current master key.
+	WrapKey(ctx context.Context, dataKey []byte) (string, error)
+	// UnwrapKey decrypts a data key wrapped by WrapKey, with the current or a previous master key.
+	UnwrapKey(ctx context.Context, wrapped string) ([]byte, error)
+}
+
+// dataKeyRecord is the stored form of a data key.
+type dataKeyRecord struct {
+	Id         string `json:"id"`
+	MasterKey  string `json:"masterKey"`
+	WrappedKey string `json:"wrappedKey"`
+	CreatedAt  string `json:"createdAt"`
+}
+
+// loadActiveKey loads the active data key, creating the first one if there is none.
+func (s *Store) loadActiveKey(ctx context.Context) error {
+	for {
+		id, exists, err := s.Store.GetWith(ctx, ActiveDataKeyKey)
+		if err != nil {
+			return fmt.Errorf("failed to read the active data key: %w", err)
+		}
+		if exists {
+			if _, err := s.dataKey(ctx, id); err != nil {
+				return err
+			}
+			s.mu.Lock()
+			s.activeId = id
+			s.mu.Unlock()
+			return nil
+		}
+
+		// Another server may be creating the first key at the same time; only one wins
+		record, aead, err := s.newDataKey(ctx)
+		if err != nil {
+			return err
+		}
+		err = s.Store.Txn(ctx,
+			[]kvstore.Compare{{Key: ActiveDataKeyKey, ModRevision: 0}},
+			[]kvstore.Op{kvstore.PutOp(DataKeyPrefix+record.Id, mustJSON(record)), kvstore.PutOp(ActiveDataKeyKey, record.Id)})
+		if errors.Is(err, kvstore.ErrRevisionConflict) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to store the first data key: %w", err)
+		}
+		s.mu.Lock()
+		s.keys[record.Id] = aead
+		s.activeId = record.Id
+		s.mu.Unlock()
+		return nil
+	}
+}
+
+// newDataKey generates a data key and wraps it with the master key.
+func (s *Store) newDataKey(ctx context.Context) (dataKeyRecord, cipher.AEAD, error) {
+	key := make([]byte, dataKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return dataKeyRecord{}, nil, err
+	}
+	idBytes := make([]byte, 8)
+	if _, err := rand.Read(idBytes); err != nil {
+		return dataKeyRecord{}, nil, err
+	}
+	wrapped, err := s.wrapper.WrapKey(ctx, key)
+	if err != nil {
+		return dataKeyRecord{}, nil, fmt.Errorf("failed to wrap data key with %s: %w", s.wrapper.Name(), err)
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return dataKeyRecord{}, nil, err
+	}
+	record := dataKeyRecord{
+		Id:         hex.EncodeToString(idBytes),
+		MasterKey:  s.wrapper.Name(),
+		WrappedKey: wrapped,
+		CreatedAt:  time.Now().UTC().Format(time.RFC3339),
+	}
+	return record, aead, nil
+}
+
+// dataKey returns the cipher of the data key id, unwrapping it on first use.
+func (s *Store) dataKey(ctx context.Context, id string) (cipher.AEAD, error) {
+	s.mu.RLock()
+	aead, ok := s.keys[id]
+	s.mu.RUnlock()
+	if ok {
+		return aead, nil
+	}
+
+	value, exists, err := s.Store.GetWith(ctx, DataKeyPrefix+id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read data key %s: %w", id, err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("data key %s does not exist", id)
+	}
+	var record dataKeyRecord
+	if err := json.Unmarshal([]byte(value), &record); err != nil {
+		return nil, fmt.Errorf("data key %s is malformed: %w", id, err)
+	}
+	key, err := s.wrapper.UnwrapKey(ctx, record.WrappedKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key %s (wrapped by %s): %w", id, record.MasterKey, err)
+	}
+	if aead, err = newAEAD(key); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.keys[id] = aead
+	s.mu.Unlock()
+	return aead, nil
+}
+
+// CheckDataKey reports whether a data key record, as stored under DataKeyPrefix, can be
+// unwrapped with the master key of the store.
+func (s *Store) CheckDataKey(ctx context.Context, value string) error {
+	var record dataKeyRecord
+	if err := json.Unmarshal([]byte(value), &record); err != nil || record.Id == "" {
+		return fmt.Errorf("malformed data key record")
+	}
+	if _, err := s.wrapper.UnwrapKey(ctx, record.WrappedKey); err != nil {
+		return fmt.Errorf("data key %s (wrapped by %s) cannot be unwrapped with %s: %w",
+			record.Id, record.MasterKey, s.wrapper.Name(), err)
+	}
+	return nil
+}
+
+// Inner returns the store under the encryption layer of store, or store itself when it
+// is not encrypted. Values read from it keep their ciphertext.
+func Inner(store kvstore.Store) kvstore.Store {
+	if s, ok := store.(*Store); ok {
+		return s.Store
+	}
+	return store
+}
+
+func mustJSON(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return string(b)
+}
+
+// LocalKeyWrapper wraps data keys with AES-256-GCM master keys read from local files.
+// The first key wraps new data keys; the others are only used to unwrap, which lets
+// a master key be replaced: add the new file first, rotate, then drop the old one.
+type LocalKeyWrapper struct {
+	keys []localMasterKey
+}
+
+type localMasterKey struct {
+	id   string
+	aead cipher.AEAD
+}
+
+// NewLocalKeyWrapper reads the master keys from paths. Each file holds 32 random
+// bytes encoded in base64 (e.g., the output of "openssl rand -base64 32").
+// If the first file does not exist, a new key is generated into it.
+func NewLocalKeyWrapper(paths ...string) (*LocalKeyWrapper, error) {
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no master key file is given")
+	}
+	w := &LocalKeyWrapper{}
+	for i, path := range paths {
+		key, err := readKeyFile(path, i == 0)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(key)
+		w.keys = append(w.keys, localMasterKey{id: hex.EncodeToString(sum[:4]), aead: aead})
+	}
+	return w, nil
+}
+
+func readKeyFile(path string, create bool) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) && create {
+		key := make([]byte, dataKeySize)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			return nil, err
+		}
+		encoded := base64.StdEncoding.EncodeToString(key) + "\n"
+		if err := os.WriteFile(path, []byte(encoded), 0o600); err != nil {
+			return nil, fmt.Errorf("failed to create master key file %s: %w", path, err)
+		}
+		return key, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read master key file %s: %w", path, err)
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(key) != dataKeySize {
+		return nil, fmt.Errorf("master key file %s must hold %d base64-encoded bytes", path, dataKeySize)
+	}
+	return key, nil
+}
+
+// Name identifies the current master key by a fingerprint of the key.
+func (w *LocalKeyWrapper) Name() string {
+	return "local:" + w.keys[0].id
+}
+
+// WrapKey encrypts dataKey with the current master key.
+func (w *LocalKeyWrapper) WrapKey(ctx context.Context, dataKey []byte) (string, error) {
+	current := w.keys[0]
+	nonce := make([]byte, current.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := current.aead.Seal(nonce, nonce, dataKey, []byte(current.id))
+	return current.id + ":" + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// UnwrapKey decrypts a data key with the master key it was wrapped by.
+func (w *LocalKeyWrapper) UnwrapKey(ctx context.Context, wrapped string) ([]byte, error) {
+	id, encoded, ok := strings.Cut(wrapped, ":")
+	if !ok {
+		return nil, fmt.Errorf("malformed wrapped key")
+	}
+	for _, k := range w.keys {
+		if k.id != id {
+			continue
+		}
+		sealed, err := base64.RawStdEncoding.DecodeString(encoded)
+		if err != nil || len(sealed) < k.aead.NonceSize() {
+			return nil, fmt.Errorf("malformed wrapped key")
+		}
+		return k.aead.Open(nil, sealed[:k.aead.NonceSize()], sealed[k.aead.NonceSize():], []byte(id))
+	}
+	return nil, fmt.Errorf("master key %s is not configured", id)
+}
@@ -0,0 +1,162 @@
+package encrypted
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvstore"
+)
+
+// maxRotateAttempts bounds the retries of a single entry under concurrent writes.
+const maxRotateAttempts = 5
+
+// RotationReport describes what Rotate did.
+type RotationReport struct {
+	// DataKeyId is the new active data key.
+	DataKeyId string
+	// MasterKey identifies the master key the data keys are now wrapped by.
+	MasterKey string
+	// Rewrapped is the number of older data keys re-wrapped with the current master key.
+	Rewrapped int
+	// Scanned is the number of entries matched by the encryption rules.
+	Scanned int
+	// Reencrypted is the number of entries re-encrypted with the new data key.
+	Reencrypted int
+}
+
+// Rotate starts using a new data key, re-wraps the older data keys with the current
+// master key and re-encrypts every entry selected by the rules with the new data key.
+// Entries written in plaintext before encryption was enabled are encrypted as well.
+//
+// Older data keys are kept (wrapped by the current master key) so that values written
+// concurrently by another server that has not yet seen the new key stay readable.
+// After a rotation, a previous master key is no longer needed and can be removed.
+func (s *Store) Rotate(ctx context.Context) (RotationReport, error) {
+	record, aead, err := s.newDataKey(ctx)
+	if err != nil {
+		return RotationReport{}, err
+	}
+	err = s.Store.Txn(ctx, nil, []kvstore.Op{
+		kvstore.PutOp(DataKeyPrefix+record.Id, mustJSON(record)),
+		kvstore.PutOp(ActiveDataKeyKey, record.Id),
+	})
+	if err != nil {
+		return RotationReport{}, fmt.Errorf("failed to store the new data key: %w", err)
+	}
+	s.mu.Lock()
+	s.keys[record.Id] = aead
+	s.activeId = record.Id
+	s.mu.Unlock()
+
+	report := RotationReport{DataKeyId: record.Id, MasterKey: s.wrapper.Name()}
+
+	if report.Rewrapped, err = s.rewrapDataKeys(ctx, record.Id); err != nil {
+		return report, err
+	}
+
+	keys, err := s.ruleKeys(ctx)
+	if err != nil {
+		return report, err
+	}
+	for _, key := range keys {
+		reencrypted, err := s.reencrypt(ctx, key)
+		if err != nil {
+			return report, err
+		}
+		report.Scanned++
+		if reencrypted {
+			report.Reencrypted++
+		}
+	}
+	return report, nil
+}
+
+// rewrapDataKeys wraps every data key except activeId with the current master key.
+func (s *Store) rewrapDataKeys(ctx context.Context, activeId string) (int, error) {
+	kvs, err := s.Store.GetKvListWith(ctx, DataKeyPrefix)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list data keys: %w", err)
+	}
+	rewrapped := 0
+	for _, kv := range kvs {
+		var record dataKeyRecord
+		if err := json.Unmarshal([]byte(kv.Value), &record); err != nil {
+			return rewrapped, fmt.Errorf("data key %s is malformed: %w", kv.Key, err)
+		}
+		if record.Id == activeId {
+			continue
+		}
+		key, err := s.wrapper.UnwrapKey(ctx, record.WrappedKey)
+		if err != nil {
+			return rewrapped, fmt.Errorf("failed to unwrap data key %s (wrapped by %s): %w", record.Id, record.MasterKey, err)
+		}
+		if record.WrappedKey, err = s.wrapper.WrapKey(ctx, key); err != nil {
+			return rewrapped, fmt.Errorf("failed to re-wrap data key %s: %w", record.Id, err)
+		}
+		record.MasterKey = s.wrapper.Name()
+		if err := s.Store.PutWith(ctx, kv.Key, mustJSON(record)); err != nil {
+			return rewrapped, fmt.Errorf("failed to store re-wrapped data key %s: %w", record.Id, err)
+		}
+		rewrapped++
+	}
+	return rewrapped, nil
+}
+
+// ruleKeys lists the keys matched by any rule.
+func (s *Store) ruleKeys(ctx context.Context) ([]string, error) {
+	seen := make(map[string]struct{})
+	for _, rule := range s.rules {
+		keys, err := s.Store.GetKeyListWith(ctx, rule.scanPrefix())
+		if err != nil {
+			return nil, fmt.Errorf("failed to list keys under %s: %w", rule.scanPrefix(), err)
+		}
+		for _, key := range keys {
+			if rule.match(key) {
+				seen[key] = struct{}{}
+			}
+		}
+	}
+	keys := make([]string, 0, len(seen))
+	for key := range seen {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// reencrypt rewrites the entry at key with the active data key, guarded by its
+// revision so a concurrent update is never overwritten with stale content.
+func (s *Store) reencrypt(ctx context.Context, key string) (bool, error) {
+	for range maxRotateAttempts {
+		kv, revision, exists, err := s.Store.GetWithRevision(ctx, key)
+		if err != nil {
+			return false, fmt.Errorf("failed to read %s: %w", key, err)
+		}
+		if !exists {
+			return false, nil
+		}
+		plain, err := s.decryptValue(ctx, key, kv.Value)
+		if err != nil {
+			return false, err
+		}
+		enc, err := s.encryptValue(ctx, key, plain)
+		if err != nil {
+			return false, err
+		}
+		if enc == plain {
+			return false, nil // nothing to encrypt in this entry
+		}
+		err = s.Store.PutIfRevision(ctx, key, enc, revision)
+		if errors.Is(err, kvstore.ErrRevisionConflict) {
+			continue
+		}
+		if err != nil {
+			return false, fmt.Errorf("failed to write re-encrypted %s: %w", key, err)
+		}
+		return true, nil
+	}
+	return false, fmt.Errorf("failed to re-encrypt %s: %w", key, kvstore.ErrRevisionConflict)
+}
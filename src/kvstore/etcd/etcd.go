@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"time"
 
+	"go.etcd.io/etcd/api/v3/mvccpb"
 	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
 	clientv3 "go.etcd.io/etcd/client/v3"
 	"go.etcd.io/etcd/client/v3/concurrency"
@@ -43,21 +44,47 @@ func NewEtcdStore(ctx context.Context, config Config) (kvstore.Store, error) {
 	return &EtcdStore{cli: cli, ctx: ctx}, nil
 }
 
-// OpenSession creates a new etcd session.
+// etcdSession adapts concurrency.Session to kvstore.Session.
+type etcdSession struct {
+	session *concurrency.Session
+}
+
+func (es *etcdSession) Close() error          { return es.session.Close() }
+func (es *etcdSession) Done() <-chan struct{} { return es.session.Done() }
+
+// etcdLock adapts concurrency.Mutex to kvstore.Lock.
+type etcdLock struct {
+	mutex   *concurrency.Mutex
+	lockKey string
+}
+
+func (l *etcdLock) Lock(ctx context.Context) error   { return l.mutex.Lock(ctx) }
+func (l *etcdLock) Unlock(ctx context.Context) error { return l.mutex.Unlock(ctx) }
+func (l *etcdLock) Key() string                      { return l.lockKey }
+
+// NewSession creates a new etcd session.
 // A session is needed for acquiring locks.
-func (s *EtcdStore) NewSession(ctx context.Context) (*concurrency.Session, error) {
-	return concurrency.NewSession(s.cli)
+func (s *EtcdStore) NewSession(ctx context.Context) (kvstore.Session, error) {
+	session, err := concurrency.NewSession(s.cli)
+	if err != nil {
+		return nil, err
+	}
+	return &etcdSession{session: session}, nil
 }
 
-// NewLock acquires a lock on the given key and returns the mutex.
+// NewLock acquires a lock on the given key and returns it.
 // It uses the provided session to ensure the lock's lifecycle is tied to the session.
-func (s *EtcdStore) NewLock(ctx context.Context, session *concurrency.Session, lockKey string) (*concurrency.Mutex, error) {
-	mutex := concurrency.NewMutex(session, lockKey)
+func (s *EtcdStore) NewLock(ctx context.Context, session kvstore.Session, lockKey string) (kvstore.Lock, error) {
+	es, ok := session.(*etcdSession)
+	if !ok {
+		return nil, fmt.Errorf("session was not created by the etcd store")
+	}
+	mutex := concurrency.NewMutex(es.session, lockKey)
 	err := mutex.Lock(ctx)
 	if err != nil {
 		return nil, err
 	}
-	return mutex, nil
+	return &etcdLock{mutex: mutex, lockKey: lockKey}, nil
 }
 
 // Put stores a key-value pair in etcd.
@@ -185,13 +212,13 @@ func (s *EtcdStore) GetKeyListWith(ctx context.Context, keyPrefix string) ([]str
 }
 
 // GetSortedKvList retrieves multiple values for keys with the given keyPrefix, sortBy, and order from etcd.
-func (s *EtcdStore) GetSortedKvList(keyPrefix string, sortBy clientv3.SortTarget, order clientv3.SortOrder) ([]kvstore.KeyValue, error) {
+func (s *EtcdStore) GetSortedKvList(keyPrefix string, sortBy kvstore.SortTarget, order kvstore.SortOrder) ([]kvstore.KeyValue, error) {
 	return s.GetSortedKvListWith(s.ctx, keyPrefix, sortBy, order)
 }
 
 // GetSortedKvListWith retrieves multiple values for keys with  the given keyPrefix, sortBy, and order from etcd using the provided context.
-func (s *EtcdStore) GetSortedKvListWith(ctx context.Context, keyPrefix string, sortBy clientv3.SortTarget, order clientv3.SortOrder) ([]kvstore.KeyValue, error) {
-	sortOp := clientv3.WithSort(sortBy, order)
+func (s *EtcdStore) GetSortedKvListWith(ctx context.Context, keyPrefix string, sortBy kvstore.SortTarget, order kvstore.SortOrder) ([]kvstore.KeyValue, error) {
+	sortOp := clientv3.WithSort(toEtcdSortTarget(sortBy), toEtcdSortOrder(order))
 	resp, err := s.cli.Get(ctx, keyPrefix, clientv3.WithPrefix(), sortOp, clientv3.WithSerializable())
 	if err != nil {
 		return nil, fmt.Errorf("failed to get list with keyPrefix: %w", err)
@@ -204,6 +231,55 @@ func (s *EtcdStore) GetSortedKvListWith(ctx context.Context, keyPrefix string, s
 	return kvs, nil
 }
 
+// GetWithRevision retrieves a key-value pair and its modification revision from etcd.
+// The read is linearizable (not serializable) so that the revision is current
+// enough to guard a subsequent PutIfRevision or Txn.
+func (s *EtcdStore) GetWithRevision(ctx context.Context, key string) (kvstore.KeyValue, int64, bool, error) {
+	resp, err := s.cli.Get(ctx, key)
+	if err != nil {
+		return kvstore.KeyValue{}, 0, false, fmt.Errorf("failed to get key: %w", err)
+	}
+	if len(resp.Kvs) == 0 {
+		return kvstore.KeyValue{}, 0, false, nil
+	}
+	kv := resp.Kvs[0]
+	return kvstore.KeyValue{Key: string(kv.Key), Value: string(kv.Value)}, kv.ModRevision, true, nil
+}
+
+// PutIfRevision stores a key-value pair in etcd only if the key's modification
+// revision still equals revision. A missing key has revision 0.
+func (s *EtcdStore) PutIfRevision(ctx context.Context, key, value string, revision int64) error {
+	return s.Txn(ctx, []kvstore.Compare{{Key: key, ModRevision: revision}}, []kvstore.Op{kvstore.PutOp(key, value)})
+}
+
+// Txn applies ops in a single etcd transaction guarded by the given revision compares.
+func (s *EtcdStore) Txn(ctx context.Context, compares []kvstore.Compare, ops []kvstore.Op) error {
+	cmps := make([]clientv3.Cmp, 0, len(compares))
+	for _, c := range compares {
+		cmps = append(cmps, clientv3.Compare(clientv3.ModRevision(c.Key), "=", c.ModRevision))
+	}
+	etcdOps := make([]clientv3.Op, 0, len(ops))
+	for _, op := range ops {
+		switch op.Type {
+		case kvstore.OpPut:
+			etcdOps = append(etcdOps, clientv3.OpPut(op.Key, op.Value))
+		case kvstore.OpDelete:
+			etcdOps = append(etcdOps, clientv3.OpDelete(op.Key))
+		default:
+			return fmt.Errorf("unsupported transaction op type: %d", op.Type)
+		}
+	}
+
+	resp, err := s.cli.Txn(ctx).If(cmps...).Then(etcdOps...).Commit()
+	if err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	if !resp.Succeeded {
+		return kvstore.ErrRevisionConflict
+	}
+	return nil
+}
+
 // GetKvMap retrieves multiple key-value pairs with the given keyPrefix from etcd.
 func (s *EtcdStore) GetKvMap(keyPrefix string) (kvstore.KeyValueMap, error) {
 	return s.GetKvMapWith(s.ctx, keyPrefix)
@@ -256,23 +332,83 @@ func (s *EtcdStore) DeleteWithPrefixWith(ctx context.Context, keyPrefix string)
 }
 
 // WatchKey watches for changes on the given key.
-func (s *EtcdStore) WatchKey(key string) clientv3.WatchChan {
+func (s *EtcdStore) WatchKey(key string) kvstore.WatchChan {
 	return s.WatchKeyWith(s.ctx, key)
 }
 
 // WatchKeyWith watches for changes on the given key using the provided context.
-func (s *EtcdStore) WatchKeyWith(ctx context.Context, key string) clientv3.WatchChan {
-	return s.cli.Watch(ctx, key)
+func (s *EtcdStore) WatchKeyWith(ctx context.Context, key string) kvstore.WatchChan {
+	return translateWatch(ctx, s.cli.Watch(ctx, key))
 }
 
 // WatchKeys watches for changes on keys with the given keyPrefix.
-func (s *EtcdStore) WatchKeys(keyPrefix string) clientv3.WatchChan {
+func (s *EtcdStore) WatchKeys(keyPrefix string) kvstore.WatchChan {
 	return s.WatchKeysWith(s.ctx, keyPrefix)
 }
 
 // WatchKeysWith watches for changes on keys with the given keyPrefix using the provided context.
-func (s *EtcdStore) WatchKeysWith(ctx context.Context, keyPrefix string) clientv3.WatchChan {
-	return s.cli.Watch(ctx, keyPrefix, clientv3.WithPrefix())
+func (s *EtcdStore) WatchKeysWith(ctx context.Context, keyPrefix string) kvstore.WatchChan {
+	return translateWatch(ctx, s.cli.Watch(ctx, keyPrefix, clientv3.WithPrefix()))
+}
+
+// translateWatch converts an etcd watch stream into kvstore watch responses.
+// The returned channel is closed when the etcd channel closes or ctx is done.
+func translateWatch(ctx context.Context, wch clientv3.WatchChan) kvstore.WatchChan {
+	out := make(chan kvstore.WatchResponse)
+	go func() {
+		defer close(out)
+		for resp := range wch {
+			events := make([]kvstore.WatchEvent, 0, len(resp.Events))
+			for _, ev := range resp.Events {
+				eventType := kvstore.EventPut
+				if ev.Type == mvccpb.DELETE {
+					eventType = kvstore.EventDelete
+				}
+				events = append(events, kvstore.WatchEvent{
+					Type:           eventType,
+					Key:            string(ev.Kv.Key),
+					Value:          string(ev.Kv.Value),
+					CreateRevision: ev.Kv.CreateRevision,
+					ModRevision:    ev.Kv.ModRevision,
+					Version:        ev.Kv.Version,
+				})
+			}
+			select {
+			case out <- kvstore.WatchResponse{Events: events, Err: resp.Err()}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// toEtcdSortTarget maps a kvstore sort target to the etcd client value.
+func toEtcdSortTarget(target kvstore.SortTarget) clientv3.SortTarget {
+	switch target {
+	case kvstore.SortByVersion:
+		return clientv3.SortByVersion
+	case kvstore.SortByCreateRevision:
+		return clientv3.SortByCreateRevision
+	case kvstore.SortByModRevision:
+		return clientv3.SortByModRevision
+	case kvstore.SortByValue:
+		return clientv3.SortByValue
+	default:
+		return clientv3.SortByKey
+	}
+}
+
+// toEtcdSortOrder maps a kvstore sort order to the etcd client value.
+func toEtcdSortOrder(order kvstore.SortOrder) clientv3.SortOrder {
+	switch order {
+	case kvstore.SortAscend:
+		return clientv3.SortAscend
+	case kvstore.SortDescend:
+		return clientv3.SortDescend
+	default:
+		return clientv3.SortNone
+	}
 }
 
 // Compact discards all MVCC history up to the current revision, marking the
@@ -319,15 +455,3 @@ func (s *EtcdStore) Defragment(ctx context.Context) error {
 func (s *EtcdStore) Close() error {
 	return s.cli.Close()
 }
-
-// // CloseSession closes the given etcd session.
-// // It's important to close sessions to release resources.
-// func (s *EtcdStore) CloseSession(session *concurrency.Session) error {
-// 	return session.Close()
-// }
-
-// // Unlock releases the given lock.
-// // It is important to release the lock to allow other clients to acquire it.
-// func (s *EtcdStore) Unlock(ctx context.Context, mutex *concurrency.Mutex) error {
-// 	return mutex.Unlock(ctx)
-// }
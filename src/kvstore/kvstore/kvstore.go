@@ -2,22 +2,24 @@ package kvstore
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math/rand/v2"
 	"sync"
-
-	clientv3 "go.etcd.io/etcd/client/v3"
-	"go.etcd.io/etcd/client/v3/concurrency"
+	"time"
 )
 
 // Extensibility: Abstraction and Polymorphism
 // Store interface for key-value operations, designed for extensibility.
-// Initially for etcd, but adaptable to other stores.
+// Initially for etcd, but adaptable to other stores (see types.go for the
+// backend-neutral watch, sort, and lock types).
 
 // Store defines operations as an interface for key-value store.
 // This was mainly implemented for etcd, but can be extended to other key-value stores later.
 type Store interface {
-	NewSession(ctx context.Context) (*concurrency.Session, error)
-	NewLock(ctx context.Context, session *concurrency.Session, lockKey string) (*concurrency.Mutex, error)
+	NewSession(ctx context.Context) (Session, error)
+	// NewLock creates a lock on lockKey bound to session and acquires it before returning.
+	NewLock(ctx context.Context, session Session, lockKey string) (Lock, error)
 	Put(key, value string) error
 	PutWith(ctx context.Context, key, value string) error
 	Get(key string) (string, bool, error)
@@ -30,18 +32,26 @@ type Store interface {
 	GetKvListWith(ctx context.Context, keyPrefix string) ([]KeyValue, error)
 	GetKeyList(keyPrefix string) ([]string, error)
 	GetKeyListWith(ctx context.Context, keyPrefix string) ([]string, error)
-	GetSortedKvList(keyPrefix string, sortBy clientv3.SortTarget, order clientv3.SortOrder) ([]KeyValue, error)
-	GetSortedKvListWith(ctx context.Context, keyPrefix string, sortBy clientv3.SortTarget, order clientv3.SortOrder) ([]KeyValue, error)
+	GetSortedKvList(keyPrefix string, sortBy SortTarget, order SortOrder) ([]KeyValue, error)
+	GetSortedKvListWith(ctx context.Context, keyPrefix string, sortBy SortTarget, order SortOrder) ([]KeyValue, error)
+	// GetWithRevision returns the key-value pair with its modification revision,
+	// read linearizably so the revision can be used as a PutIfRevision or Txn guard.
+	GetWithRevision(ctx context.Context, key string) (KeyValue, int64, bool, error)
+	// PutIfRevision stores the value only if the key's modification revision still
+	// equals revision (0 means the key must not exist). Otherwise it returns ErrRevisionConflict.
+	PutIfRevision(ctx context.Context, key, value string, revision int64) error
+	// Txn applies ops atomically if every compare holds, or returns ErrRevisionConflict.
+	Txn(ctx context.Context, compares []Compare, ops []Op) error
 	GetKvMap(keyPrefix string) (KeyValueMap, error)
 	GetKvMapWith(ctx context.Context, keyPrefix string) (KeyValueMap, error)
 	Delete(key string) error
 	DeleteWith(ctx context.Context, key string) error
 	DeleteWithPrefix(keyPrefix string) error
 	DeleteWithPrefixWith(ctx context.Context, keyPrefix string) error
-	WatchKey(key string) clientv3.WatchChan
-	WatchKeyWith(ctx context.Context, key string) clientv3.WatchChan
-	WatchKeys(keyPrefix string) clientv3.WatchChan
-	WatchKeysWith(ctx context.Context, keyPrefix string) clientv3.WatchChan
+	WatchKey(key string) WatchChan
+	WatchKeyWith(ctx context.Context, key string) WatchChan
+	WatchKeys(keyPrefix string) WatchChan
+	WatchKeysWith(ctx context.Context, keyPrefix string) WatchChan
 	// Compact discards MVCC history up to the current revision. It only marks
 	// space as reclaimable; call Defragment afterward to shrink the on-disk
 	// database file.
@@ -50,10 +60,15 @@ type Store interface {
 	// Compact. Blocking and I/O-heavy on the server side.
 	Defragment(ctx context.Context) error
 	Close() error
-	// CloseSession(session *concurrency.Session) error
-	// Unlock(ctx context.Context, mutex *concurrency.Mutex) error
 }
 
+// ErrRevisionConflict is returned by PutIfRevision and Txn when a guarded key was
+// modified after it was read.
+var ErrRevisionConflict = errors.New("kvstore: revision conflict")
+
+// maxUpdateAttempts bounds UpdateWithRetry under sustained contention.
+const maxUpdateAttempts = 10
+
 type KeyValue struct {
 	Key   string `json:"key"`
 	Value string `json:"value"`
@@ -82,6 +97,11 @@ func InitializeStore(store Store) error {
 	return nil
 }
 
+// GetStore returns the global Store, e.g., to reach features of a specific implementation.
+func GetStore() (Store, error) {
+	return getStore()
+}
+
 // getStore returns the initialized global Store
 func getStore() (Store, error) {
 	if globalStore == nil {
@@ -91,7 +111,7 @@ func getStore() (Store, error) {
 }
 
 // NewSession creates a new session
-func NewSession(ctx context.Context) (*concurrency.Session, error) {
+func NewSession(ctx context.Context) (Session, error) {
 	store, err := getStore()
 	if err != nil {
 		return nil, err
@@ -100,7 +120,7 @@ func NewSession(ctx context.Context) (*concurrency.Session, error) {
 }
 
 // NewLock creates a new lock
-func NewLock(ctx context.Context, session *concurrency.Session, lockKey string) (*concurrency.Mutex, error) {
+func NewLock(ctx context.Context, session Session, lockKey string) (Lock, error) {
 	store, err := getStore()
 	if err != nil {
 		return nil, err
@@ -220,7 +240,7 @@ func GetKeyListWith(ctx context.Context, keyPrefix string) ([]string, error) {
 }
 
 // GetSortedKvList retrieves sorted key-value pairs with the given prefix
-func GetSortedKvList(keyPrefix string, sortBy clientv3.SortTarget, order clientv3.SortOrder) ([]KeyValue, error) {
+func GetSortedKvList(keyPrefix string, sortBy SortTarget, order SortOrder) ([]KeyValue, error) {
 	store, err := getStore()
 	if err != nil {
 		return nil, err
@@ -229,7 +249,7 @@ func GetSortedKvList(keyPrefix string, sortBy clientv3.SortTarget, order clientv
 }
 
 // GetSortedKvListWith retrieves sorted key-value pairs with the given prefix with context
-func GetSortedKvListWith(ctx context.Context, keyPrefix string, sortBy clientv3.SortTarget, order clientv3.SortOrder) ([]KeyValue, error) {
+func GetSortedKvListWith(ctx context.Context, keyPrefix string, sortBy SortTarget, order SortOrder) ([]KeyValue, error) {
 	store, err := getStore()
 	if err != nil {
 		return nil, err
@@ -237,6 +257,70 @@ func GetSortedKvListWith(ctx context.Context, keyPrefix string, sortBy clientv3.
 	return store.GetSortedKvListWith(ctx, keyPrefix, sortBy, order)
 }
 
+// GetWithRevision retrieves a key-value pair with its modification revision
+func GetWithRevision(ctx context.Context, key string) (KeyValue, int64, bool, error) {
+	store, err := getStore()
+	if err != nil {
+		return KeyValue{}, 0, false, err
+	}
+	return store.GetWithRevision(ctx, key)
+}
+
+// PutIfRevision stores a key-value pair only if the key is unchanged since revision
+func PutIfRevision(ctx context.Context, key, value string, revision int64) error {
+	store, err := getStore()
+	if err != nil {
+		return err
+	}
+	return store.PutIfRevision(ctx, key, value, revision)
+}
+
+// Txn applies ops atomically if every compare holds
+func Txn(ctx context.Context, compares []Compare, ops []Op) error {
+	store, err := getStore()
+	if err != nil {
+		return err
+	}
+	return store.Txn(ctx, compares, ops)
+}
+
+// UpdateWithRetry performs an optimistic read-modify-write on key.
+// update receives the current value (exists is false if the key is missing) and returns
+// the value to store; returning write=false leaves the key untouched. When another
+// writer modifies the key in between, update is called again with the fresh value.
+func UpdateWithRetry(ctx context.Context, key string, update func(current string, exists bool) (value string, write bool, err error)) error {
+	store, err := getStore()
+	if err != nil {
+		return err
+	}
+
+	for attempt := 1; ; attempt++ {
+		kv, revision, exists, err := store.GetWithRevision(ctx, key)
+		if err != nil {
+			return err
+		}
+		value, write, err := update(kv.Value, exists)
+		if err != nil || !write {
+			return err
+		}
+		err = store.PutIfRevision(ctx, key, value, revision)
+		if !errors.Is(err, ErrRevisionConflict) {
+			return err
+		}
+		if attempt >= maxUpdateAttempts {
+			return fmt.Errorf("failed to update %s after %d attempts: %w", key, attempt, err)
+		}
+
+		// Short jittered backoff so competing writers do not retry in lockstep
+		backoff := time.Duration(attempt)*5*time.Millisecond + rand.N(5*time.Millisecond)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+	}
+}
+
 // GetKvMap retrieves a map of key-value pairs with the given prefix
 func GetKvMap(keyPrefix string) (KeyValueMap, error) {
 	store, err := getStore()
@@ -292,7 +376,7 @@ func DeleteWithPrefixWith(ctx context.Context, keyPrefix string) error {
 }
 
 // WatchKey watches for changes on a specific key
-func WatchKey(key string) clientv3.WatchChan {
+func WatchKey(key string) WatchChan {
 	store, err := getStore()
 	if err != nil {
 		return nil
@@ -301,7 +385,7 @@ func WatchKey(key string) clientv3.WatchChan {
 }
 
 // WatchKeyWith watches for changes on a specific key with context
-func WatchKeyWith(ctx context.Context, key string) clientv3.WatchChan {
+func WatchKeyWith(ctx context.Context, key string) WatchChan {
 	store, err := getStore()
 	if err != nil {
 		return nil
@@ -310,7 +394,7 @@ func WatchKeyWith(ctx context.Context, key string) clientv3.WatchChan {
 }
 
 // WatchKeys watches for changes on keys with the given prefix
-func WatchKeys(keyPrefix string) clientv3.WatchChan {
+func WatchKeys(keyPrefix string) WatchChan {
 	store, err := getStore()
 	if err != nil {
 		return nil
@@ -319,7 +403,7 @@ func WatchKeys(keyPrefix string) clientv3.WatchChan {
 }
 
 // WatchKeysWith watches for changes on keys with the given prefix with context
-func WatchKeysWith(ctx context.Context, keyPrefix string) clientv3.WatchChan {
+func WatchKeysWith(ctx context.Context, keyPrefix string) WatchChan {
 	store, err := getStore()
 	if err != nil {
 		return nil
@@ -0,0 +1,119 @@
+package kvstore
+
+import "context"
+
+// Backend-neutral types used by the Store interface.
+// Backends translate their native types into these so that callers never need to
+// import a specific client library (e.g., the etcd client).
+
+// SortTarget selects the field used to order range results.
+type SortTarget int
+
+const (
+	SortByKey SortTarget = iota
+	SortByVersion
+	SortByCreateRevision
+	SortByModRevision
+	SortByValue
+)
+
+// SortOrder selects the direction used to order range results.
+type SortOrder int
+
+const (
+	SortNone SortOrder = iota
+	SortAscend
+	SortDescend
+)
+
+// EventType is the kind of change reported by a watch.
+type EventType int
+
+const (
+	EventPut EventType = iota
+	EventDelete
+)
+
+// String returns the event type name (PUT or DELETE).
+func (t EventType) String() string {
+	switch t {
+	case EventPut:
+		return "PUT"
+	case EventDelete:
+		return "DELETE"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// WatchEvent is a single change on a watched key.
+// For EventDelete, Value is empty and ModRevision is the revision of the deletion.
+type WatchEvent struct {
+	Type           EventType
+	Key            string
+	Value          string
+	CreateRevision int64
+	ModRevision    int64
+	Version        int64
+}
+
+// WatchResponse is a batch of events delivered together.
+// Err is set when the watch was terminated by the backend (e.g., compaction).
+type WatchResponse struct {
+	Events []WatchEvent
+	Err    error
+}
+
+// WatchChan delivers watch responses until the watch context is done.
+type WatchChan <-chan WatchResponse
+
+// Session is a liveness scope for distributed locks.
+// Locks acquired through a session are released when the session is closed or expires.
+type Session interface {
+	// Close ends the session and releases every lock it holds.
+	Close() error
+	// Done is closed when the session ends.
+	Done() <-chan struct{}
+}
+
+// Lock is a mutual-exclusion lock on a key, bound to a Session.
+type Lock interface {
+	// Lock blocks until the lock is held or ctx is done. It is a no-op if the lock is already held.
+	Lock(ctx context.Context) error
+	// Unlock releases the lock.
+	Unlock(ctx context.Context) error
+	// Key returns the key the lock guards.
+	Key() string
+}
+
+// Compare is a transaction guard on a key's modification revision.
+// ModRevision 0 requires that the key does not exist.
+type Compare struct {
+	Key         string
+	ModRevision int64
+}
+
+// OpType is the kind of write performed by a transaction Op.
+type OpType int
+
+const (
+	OpPut OpType = iota
+	OpDelete
+)
+
+// Op is a single write applied by a transaction.
+type Op struct {
+	Type  OpType
+	Key   string
+	Value string
+}
+
+// PutOp returns an Op that stores value at key.
+func PutOp(key, value string) Op {
+	return Op{Type: OpPut, Key: key, Value: value}
+}
+
+// DeleteOp returns an Op that removes key.
+func DeleteOp(key string) Op {
+	return Op{Type: OpDelete, Key: key}
+}
@@ -0,0 +1,145 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// lockTable tracks which session holds each lock key.
+// Waiters block on the per-key release channel, which is closed and replaced on every unlock.
+type lockTable struct {
+	mu      sync.Mutex
+	holders map[string]*memorySession
+	release map[string]chan struct{}
+	closed  bool
+}
+
+func newLockTable() *lockTable {
+	return &lockTable{
+		holders: make(map[string]*memorySession),
+		release: make(map[string]chan struct{}),
+	}
+}
+
+// memorySession is a kvstore.Session for MemoryStore.
+type memorySession struct {
+	table     *lockTable
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// memoryLock is a kvstore.Lock for MemoryStore.
+type memoryLock struct {
+	session *memorySession
+	lockKey string
+}
+
+func (t *lockTable) newSession() *memorySession {
+	ms := &memorySession{table: t, done: make(chan struct{})}
+	t.mu.Lock()
+	closed := t.closed
+	t.mu.Unlock()
+	if closed {
+		ms.closeOnce.Do(func() { close(ms.done) })
+	}
+	return ms
+}
+
+// acquire blocks until session holds key, ctx is done, or the session ends.
+func (t *lockTable) acquire(ctx context.Context, session *memorySession, key string) error {
+	for {
+		t.mu.Lock()
+		select {
+		case <-session.done:
+			t.mu.Unlock()
+			return fmt.Errorf("lock session is closed")
+		default:
+		}
+		holder, held := t.holders[key]
+		if !held || holder == session {
+			t.holders[key] = session
+			t.mu.Unlock()
+			return nil
+		}
+		wait, ok := t.release[key]
+		if !ok {
+			wait = make(chan struct{})
+			t.release[key] = wait
+		}
+		t.mu.Unlock()
+
+		select {
+		case <-wait:
+		case <-session.done:
+			return fmt.Errorf("lock session is closed")
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// releaseLocked frees key if session holds it. t.mu must be held.
+func (t *lockTable) releaseLocked(session *memorySession, key string) {
+	if t.holders[key] != session {
+		return
+	}
+	delete(t.holders, key)
+	if wait, ok := t.release[key]; ok {
+		close(wait)
+		delete(t.release, key)
+	}
+}
+
+// close ends every session that still holds a lock.
+func (t *lockTable) close() {
+	t.mu.Lock()
+	t.closed = true
+	sessions := make(map[*memorySession]struct{})
+	for _, session := range t.holders {
+		sessions[session] = struct{}{}
+	}
+	t.mu.Unlock()
+
+	for session := range sessions {
+		session.Close()
+	}
+}
+
+// Close ends the session and releases every lock it holds.
+func (ms *memorySession) Close() error {
+	ms.closeOnce.Do(func() {
+		close(ms.done)
+		ms.table.mu.Lock()
+		defer ms.table.mu.Unlock()
+		for key, holder := range ms.table.holders {
+			if holder == ms {
+				ms.table.releaseLocked(ms, key)
+			}
+		}
+	})
+	return nil
+}
+
+// Done is closed when the session ends.
+func (ms *memorySession) Done() <-chan struct{} {
+	return ms.done
+}
+
+// Lock acquires the lock, or returns immediately if this session already holds it.
+func (l *memoryLock) Lock(ctx context.Context) error {
+	return l.session.table.acquire(ctx, l.session, l.lockKey)
+}
+
+// Unlock releases the lock if this session holds it.
+func (l *memoryLock) Unlock(ctx context.Context) error {
+	l.session.table.mu.Lock()
+	defer l.session.table.mu.Unlock()
+	l.session.table.releaseLocked(l.session, l.lockKey)
+	return nil
+}
+
+// Key returns the key the lock guards.
+func (l *memoryLock) Key() string {
+	return l.lockKey
+}
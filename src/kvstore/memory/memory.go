@@ -0,0 +1,541 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvstore"
+)
+
+// Record is a key-value pair together with the MVCC-style metadata the store
+// keeps for it. Revisions are store-wide and strictly increasing, mirroring
+// etcd so that sorting by create/mod revision behaves the same on every backend.
+type Record struct {
+	Key            string `json:"key"`
+	Value          string `json:"value"`
+	CreateRevision int64  `json:"createRevision"`
+	ModRevision    int64  `json:"modRevision"`
+	Version        int64  `json:"version"`
+}
+
+// Persister is implemented by durable backends layered under MemoryStore (e.g. bolt).
+// MemoryStore serves all reads from memory and calls Save before applying a write,
+// so a failed disk write never leaves memory ahead of the persisted state.
+type Persister interface {
+	// Load returns every persisted record and the last revision issued.
+	Load() ([]Record, int64, error)
+	// Save persists puts and deletes atomically together with the new revision.
+	Save(revision int64, puts []Record, deletes []string) error
+	// Defragment reclaims space in the underlying file.
+	Defragment(ctx context.Context) error
+	// Close releases the underlying file.
+	Close() error
+}
+
+// MemoryStore is a kvstore.Store kept entirely in process memory.
+// It is intended for unit tests and single-node standalone runs; data is lost on
+// restart unless a Persister is attached (see NewMemoryStoreWithPersister).
+type MemoryStore struct {
+	ctx context.Context
+
+	mu       sync.RWMutex
+	data     map[string]*Record
+	revision int64
+
+	persister Persister
+	watchers  *watchHub
+	locks     *lockTable
+}
+
+// NewMemoryStore creates a new, empty in-memory store.
+func NewMemoryStore(ctx context.Context) (kvstore.Store, error) {
+	return newMemoryStore(ctx), nil
+}
+
+// NewMemoryStoreWithPersister creates an in-memory store that is pre-loaded from
+// the given Persister and writes every change through to it.
+func NewMemoryStoreWithPersister(ctx context.Context, persister Persister) (kvstore.Store, error) {
+	if persister == nil {
+		return nil, fmt.Errorf("provided persister is nil")
+	}
+	records, revision, err := persister.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load persisted records: %w", err)
+	}
+
+	s := newMemoryStore(ctx)
+	s.persister = persister
+	s.revision = revision
+	for i := range records {
+		rec := records[i]
+		s.data[rec.Key] = &rec
+		if rec.ModRevision > s.revision {
+			s.revision = rec.ModRevision
+		}
+	}
+	return s, nil
+}
+
+func newMemoryStore(ctx context.Context) *MemoryStore {
+	return &MemoryStore{
+		ctx:      ctx,
+		data:     make(map[string]*Record),
+		watchers: newWatchHub(),
+		locks:    newLockTable(),
+	}
+}
+
+// NewSession creates a new lock session.
+// Locks are process-local, which matches the single-node use of this store.
+func (s *MemoryStore) NewSession(ctx context.Context) (kvstore.Session, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("failed to create session: %w", err)
+	}
+	return s.locks.newSession(), nil
+}
+
+// NewLock acquires a lock on the given key and returns it.
+// The lock is released automatically when the session is closed.
+func (s *MemoryStore) NewLock(ctx context.Context, session kvstore.Session, lockKey string) (kvstore.Lock, error) {
+	ms, ok := session.(*memorySession)
+	if !ok || ms.table != s.locks {
+		return nil, fmt.Errorf("session was not created by this memory store")
+	}
+	lock := &memoryLock{session: ms, lockKey: lockKey}
+	if err := lock.Lock(ctx); err != nil {
+		return nil, err
+	}
+	return lock, nil
+}
+
+// Put stores a key-value pair.
+func (s *MemoryStore) Put(key, value string) error {
+	return s.PutWith(s.ctx, key, value)
+}
+
+// PutWith stores a key-value pair using the provided context.
+func (s *MemoryStore) PutWith(ctx context.Context, key, value string) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("failed to put key-value: %w", err)
+	}
+
+	s.mu.Lock()
+	events, err := s.commitLocked([]kvstore.Op{kvstore.PutOp(key, value)})
+	s.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to put key-value: %w", err)
+	}
+
+	s.watchers.notify(events)
+	return nil
+}
+
+// Get retrieves the value for a given key.
+func (s *MemoryStore) Get(key string) (string, bool, error) {
+	return s.GetWith(s.ctx, key)
+}
+
+// GetWith retrieves the value for a given key using the provided context.
+func (s *MemoryStore) GetWith(ctx context.Context, key string) (string, bool, error) {
+	kv, exists, err := s.GetKvWith(ctx, key)
+	return kv.Value, exists, err
+}
+
+// GetList retrieves multiple values for keys with the given keyPrefix.
+func (s *MemoryStore) GetList(keyPrefix string) ([]string, error) {
+	return s.GetListWith(s.ctx, keyPrefix)
+}
+
+// GetListWith retrieves multiple values for keys with the given keyPrefix using the provided context.
+func (s *MemoryStore) GetListWith(ctx context.Context, keyPrefix string) ([]string, error) {
+	recs, err := s.rangePrefix(ctx, keyPrefix, kvstore.SortByKey, kvstore.SortAscend)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get list with keyPrefix: %w", err)
+	}
+	values := make([]string, 0, len(recs))
+	for _, rec := range recs {
+		values = append(values, rec.Value)
+	}
+	return values, nil
+}
+
+// GetKv retrieves a key-value pair.
+func (s *MemoryStore) GetKv(key string) (kvstore.KeyValue, bool, error) {
+	return s.GetKvWith(s.ctx, key)
+}
+
+// GetKvWith retrieves a key-value pair using the provided context.
+func (s *MemoryStore) GetKvWith(ctx context.Context, key string) (kvstore.KeyValue, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return kvstore.KeyValue{}, false, fmt.Errorf("failed to get key: %w", err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rec, ok := s.data[key]
+	if !ok {
+		return kvstore.KeyValue{}, false, nil
+	}
+	return kvstore.KeyValue{Key: rec.Key, Value: rec.Value}, true, nil
+}
+
+// GetKvList retrieves multiple key-value pairs with the given keyPrefix.
+func (s *MemoryStore) GetKvList(keyPrefix string) ([]kvstore.KeyValue, error) {
+	return s.GetKvListWith(s.ctx, keyPrefix)
+}
+
+// GetKvListWith retrieves multiple key-value pairs with the given keyPrefix using the provided context.
+func (s *MemoryStore) GetKvListWith(ctx context.Context, keyPrefix string) ([]kvstore.KeyValue, error) {
+	return s.GetSortedKvListWith(ctx, keyPrefix, kvstore.SortByKey, kvstore.SortAscend)
+}
+
+// GetKeyList retrieves only keys with the given keyPrefix.
+func (s *MemoryStore) GetKeyList(keyPrefix string) ([]string, error) {
+	return s.GetKeyListWith(s.ctx, keyPrefix)
+}
+
+// GetKeyListWith retrieves only keys with the given keyPrefix using the provided context.
+func (s *MemoryStore) GetKeyListWith(ctx context.Context, keyPrefix string) ([]string, error) {
+	recs, err := s.rangePrefix(ctx, keyPrefix, kvstore.SortByKey, kvstore.SortAscend)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get key list with keyPrefix: %w", err)
+	}
+	keys := make([]string, 0, len(recs))
+	for _, rec := range recs {
+		keys = append(keys, rec.Key)
+	}
+	return keys, nil
+}
+
+// GetSortedKvList retrieves key-value pairs with the given keyPrefix, sortBy, and order.
+func (s *MemoryStore) GetSortedKvList(keyPrefix string, sortBy kvstore.SortTarget, order kvstore.SortOrder) ([]kvstore.KeyValue, error) {
+	return s.GetSortedKvListWith(s.ctx, keyPrefix, sortBy, order)
+}
+
+// GetSortedKvListWith retrieves key-value pairs with the given keyPrefix, sortBy, and order using the provided context.
+func (s *MemoryStore) GetSortedKvListWith(ctx context.Context, keyPrefix string, sortBy kvstore.SortTarget, order kvstore.SortOrder) ([]kvstore.KeyValue, error) {
+	recs, err := s.rangePrefix(ctx, keyPrefix, sortBy, order)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get list with keyPrefix: %w", err)
+	}
+	kvs := make([]kvstore.KeyValue, 0, len(recs))
+	for _, rec := range recs {
+		kvs = append(kvs, kvstore.KeyValue{Key: rec.Key, Value: rec.Value})
+	}
+	return kvs, nil
+}
+
+// GetWithRevision retrieves a key-value pair and its modification revision.
+func (s *MemoryStore) GetWithRevision(ctx context.Context, key string) (kvstore.KeyValue, int64, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return kvstore.KeyValue{}, 0, false, fmt.Errorf("failed to get key: %w", err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rec, ok := s.data[key]
+	if !ok {
+		return kvstore.KeyValue{}, 0, false, nil
+	}
+	return kvstore.KeyValue{Key: rec.Key, Value: rec.Value}, rec.ModRevision, true, nil
+}
+
+// PutIfRevision stores a key-value pair only if the key's modification revision
+// still equals revision. A missing key has revision 0.
+func (s *MemoryStore) PutIfRevision(ctx context.Context, key, value string, revision int64) error {
+	return s.Txn(ctx, []kvstore.Compare{{Key: key, ModRevision: revision}}, []kvstore.Op{kvstore.PutOp(key, value)})
+}
+
+// Txn applies ops atomically, under a single revision, if every compare holds.
+// Like etcd, it rejects a transaction that writes the same key more than once.
+func (s *MemoryStore) Txn(ctx context.Context, compares []kvstore.Compare, ops []kvstore.Op) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	seen := make(map[string]struct{}, len(ops))
+	for _, op := range ops {
+		if _, ok := seen[op.Key]; ok {
+			return fmt.Errorf("failed to commit transaction: duplicate key %q given in txn request", op.Key)
+		}
+		seen[op.Key] = struct{}{}
+	}
+
+	s.mu.Lock()
+	for _, c := range compares {
+		var current int64
+		if rec, ok := s.data[c.Key]; ok {
+			current = rec.ModRevision
+		}
+		if current != c.ModRevision {
+			s.mu.Unlock()
+			return kvstore.ErrRevisionConflict
+		}
+	}
+	events, err := s.commitLocked(ops)
+	s.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	s.watchers.notify(events)
+	return nil
+}
+
+// GetKvMap retrieves multiple key-value pairs with the given keyPrefix as a map.
+func (s *MemoryStore) GetKvMap(keyPrefix string) (kvstore.KeyValueMap, error) {
+	return s.GetKvMapWith(s.ctx, keyPrefix)
+}
+
+// GetKvMapWith retrieves multiple key-value pairs with the given keyPrefix as a map using the provided context.
+func (s *MemoryStore) GetKvMapWith(ctx context.Context, keyPrefix string) (kvstore.KeyValueMap, error) {
+	recs, err := s.rangePrefix(ctx, keyPrefix, kvstore.SortByKey, kvstore.SortAscend)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get list with keyPrefix: %w", err)
+	}
+	kvs := make(kvstore.KeyValueMap, len(recs))
+	for _, rec := range recs {
+		kvs[rec.Key] = rec.Value
+	}
+	return kvs, nil
+}
+
+// Delete removes a key-value pair.
+func (s *MemoryStore) Delete(key string) error {
+	return s.DeleteWith(s.ctx, key)
+}
+
+// DeleteWith removes a key-value pair using the provided context.
+func (s *MemoryStore) DeleteWith(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("failed to delete key: %w", err)
+	}
+	if err := s.deleteKeys(func(k string) bool { return k == key }); err != nil {
+		return fmt.Errorf("failed to delete key: %w", err)
+	}
+	return nil
+}
+
+// DeleteWithPrefix removes all key-value pairs with the given prefix.
+func (s *MemoryStore) DeleteWithPrefix(keyPrefix string) error {
+	return s.DeleteWithPrefixWith(s.ctx, keyPrefix)
+}
+
+// DeleteWithPrefixWith removes all key-value pairs with the given prefix using the provided context.
+func (s *MemoryStore) DeleteWithPrefixWith(ctx context.Context, keyPrefix string) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("failed to delete keys with prefix %q: %w", keyPrefix, err)
+	}
+	if err := s.deleteKeys(func(k string) bool { return strings.HasPrefix(k, keyPrefix) }); err != nil {
+		return fmt.Errorf("failed to delete keys with prefix %q: %w", keyPrefix, err)
+	}
+	return nil
+}
+
+// WatchKey watches for changes on the given key.
+func (s *MemoryStore) WatchKey(key string) kvstore.WatchChan {
+	return s.WatchKeyWith(s.ctx, key)
+}
+
+// WatchKeyWith watches for changes on the given key using the provided context.
+func (s *MemoryStore) WatchKeyWith(ctx context.Context, key string) kvstore.WatchChan {
+	return s.watchers.watch(ctx, key, false)
+}
+
+// WatchKeys watches for changes on keys with the given keyPrefix.
+func (s *MemoryStore) WatchKeys(keyPrefix string) kvstore.WatchChan {
+	return s.WatchKeysWith(s.ctx, keyPrefix)
+}
+
+// WatchKeysWith watches for changes on keys with the given keyPrefix using the provided context.
+func (s *MemoryStore) WatchKeysWith(ctx context.Context, keyPrefix string) kvstore.WatchChan {
+	return s.watchers.watch(ctx, keyPrefix, true)
+}
+
+// Compact is a no-op: the in-memory store keeps only the latest version of each key.
+func (s *MemoryStore) Compact(ctx context.Context) error {
+	return nil
+}
+
+// Defragment reclaims space in the attached Persister, if any.
+func (s *MemoryStore) Defragment(ctx context.Context) error {
+	if s.persister == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.persister.Defragment(ctx)
+}
+
+// Close stops all watchers, ends all lock sessions, and closes the attached Persister, if any.
+func (s *MemoryStore) Close() error {
+	s.watchers.close()
+	s.locks.close()
+	if s.persister != nil {
+		return s.persister.Close()
+	}
+	return nil
+}
+
+// rangePrefix returns copies of the records under keyPrefix in the requested order.
+// An empty keyPrefix matches every key, as etcd's WithPrefix does.
+func (s *MemoryStore) rangePrefix(ctx context.Context, keyPrefix string, sortBy kvstore.SortTarget, order kvstore.SortOrder) ([]Record, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	recs := make([]Record, 0)
+	for k, rec := range s.data {
+		if strings.HasPrefix(k, keyPrefix) {
+			recs = append(recs, *rec)
+		}
+	}
+	s.mu.RUnlock()
+
+	sortRecords(recs, sortBy, order)
+	return recs, nil
+}
+
+// deleteKeys removes every key accepted by match and notifies watchers.
+func (s *MemoryStore) deleteKeys(match func(key string) bool) error {
+	s.mu.Lock()
+	var keys []string
+	for k := range s.data {
+		if match(k) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	ops := make([]kvstore.Op, 0, len(keys))
+	for _, k := range keys {
+		ops = append(ops, kvstore.DeleteOp(k))
+	}
+	events, err := s.commitLocked(ops)
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	s.watchers.notify(events)
+	return nil
+}
+
+// commitLocked applies ops under one new revision, persisting them first.
+// Deletes of missing keys are dropped; if nothing remains, no revision is issued.
+// It returns the events to deliver once s.mu is released. s.mu must be held.
+func (s *MemoryStore) commitLocked(ops []kvstore.Op) ([]kvstore.WatchEvent, error) {
+	rev := s.revision + 1
+
+	// Resolve ops against a private view so that nothing is applied before the
+	// Persister saved the changes. Txn rejects repeated keys, as etcd does.
+	pending := make(map[string]*Record)
+	lookup := func(key string) (*Record, bool) {
+		if rec, ok := pending[key]; ok {
+			return rec, rec != nil
+		}
+		rec, ok := s.data[key]
+		return rec, ok
+	}
+
+	var events []kvstore.WatchEvent
+	for _, op := range ops {
+		switch op.Type {
+		case kvstore.OpPut:
+			rec := &Record{Key: op.Key, Value: op.Value, CreateRevision: rev, ModRevision: rev, Version: 1}
+			if prev, ok := lookup(op.Key); ok {
+				rec.CreateRevision = prev.CreateRevision
+				rec.Version = prev.Version + 1
+			}
+			pending[op.Key] = rec
+			events = append(events, newEvent(kvstore.EventPut, *rec))
+		case kvstore.OpDelete:
+			if _, ok := lookup(op.Key); !ok {
+				continue
+			}
+			pending[op.Key] = nil
+			// A deleted key is reported with only its key and the delete revision, as etcd does
+			events = append(events, newEvent(kvstore.EventDelete, Record{Key: op.Key, ModRevision: rev}))
+		default:
+			return nil, fmt.Errorf("unsupported transaction op type: %d", op.Type)
+		}
+	}
+	if len(events) == 0 {
+		return nil, nil
+	}
+
+	var puts []Record
+	var deletes []string
+	for key, rec := range pending {
+		if rec == nil {
+			if _, ok := s.data[key]; ok {
+				deletes = append(deletes, key)
+			}
+			continue
+		}
+		puts = append(puts, *rec)
+	}
+	if s.persister != nil {
+		if err := s.persister.Save(rev, puts, deletes); err != nil {
+			return nil, err
+		}
+	}
+
+	s.revision = rev
+	for _, rec := range puts {
+		s.data[rec.Key] = &rec
+	}
+	for _, key := range deletes {
+		delete(s.data, key)
+	}
+	return events, nil
+}
+
+// sortRecords orders records following etcd's range semantics.
+// SortNone is treated as ascending, which is what etcd does for a set sort target.
+func sortRecords(recs []Record, sortBy kvstore.SortTarget, order kvstore.SortOrder) {
+	less := func(a, b Record) bool {
+		switch sortBy {
+		case kvstore.SortByVersion:
+			if a.Version != b.Version {
+				return a.Version < b.Version
+			}
+		case kvstore.SortByCreateRevision:
+			if a.CreateRevision != b.CreateRevision {
+				return a.CreateRevision < b.CreateRevision
+			}
+		case kvstore.SortByModRevision:
+			if a.ModRevision != b.ModRevision {
+				return a.ModRevision < b.ModRevision
+			}
+		case kvstore.SortByValue:
+			if a.Value != b.Value {
+				return a.Value < b.Value
+			}
+		}
+		return a.Key < b.Key
+	}
+
+	sort.SliceStable(recs, func(i, j int) bool {
+		if order == kvstore.SortDescend {
+			return less(recs[j], recs[i])
+		}
+		return less(recs[i], recs[j])
+	})
+}
+
+// newEvent converts a record into a watch event.
+func newEvent(eventType kvstore.EventType, rec Record) kvstore.WatchEvent {
+	return kvstore.WatchEvent{
+		Type:           eventType,
+		Key:            rec.Key,
+		Value:          rec.Value,
+		CreateRevision: rec.CreateRevision,
+		ModRevision:    rec.ModRevision,
+		Version:        rec.Version,
+	}
+}
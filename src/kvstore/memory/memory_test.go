@@ -0,0 +1,492 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvstore"
+)
+
+func newTestStore(t *testing.T) *MemoryStore {
+	t.Helper()
+	s := newMemoryStore(context.Background())
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestMemoryStoreGetPutDelete(t *testing.T) {
+	tests := []struct {
+		name       string
+		setup      func(s *MemoryStore)
+		key        string
+		wantValue  string
+		wantExists bool
+	}{
+		{
+			name:       "missing key",
+			setup:      func(s *MemoryStore) {},
+			key:        "/a",
+			wantExists: false,
+		},
+		{
+			name:       "put",
+			setup:      func(s *MemoryStore) { s.Put("/a", "1") },
+			key:        "/a",
+			wantValue:  "1",
+			wantExists: true,
+		},
+		{
+			name:       "overwrite",
+			setup:      func(s *MemoryStore) { s.Put("/a", "1"); s.Put("/a", "2") },
+			key:        "/a",
+			wantValue:  "2",
+			wantExists: true,
+		},
+		{
+			name:       "empty value",
+			setup:      func(s *MemoryStore) { s.Put("/a", "") },
+			key:        "/a",
+			wantValue:  "",
+			wantExists: true,
+		},
+		{
+			name:       "delete",
+			setup:      func(s *MemoryStore) { s.Put("/a", "1"); s.Delete("/a") },
+			key:        "/a",
+			wantExists: false,
+		},
+		{
+			name:       "delete missing key",
+			setup:      func(s *MemoryStore) { s.Delete("/a") },
+			key:        "/a",
+			wantExists: false,
+		},
+		{
+			name:       "delete with prefix",
+			setup:      func(s *MemoryStore) { s.Put("/a/1", "1"); s.Put("/a/2", "2"); s.DeleteWithPrefix("/a/") },
+			key:        "/a/2",
+			wantExists: false,
+		},
+		{
+			name:       "delete with prefix keeps other keys",
+			setup:      func(s *MemoryStore) { s.Put("/a/1", "1"); s.Put("/ab", "2"); s.DeleteWithPrefix("/a/") },
+			key:        "/ab",
+			wantValue:  "2",
+			wantExists: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestStore(t)
+			tt.setup(s)
+
+			value, exists, err := s.Get(tt.key)
+			if err != nil {
+				t.Fatalf("Get(%q) error: %v", tt.key, err)
+			}
+			if exists != tt.wantExists || value != tt.wantValue {
+				t.Errorf("Get(%q) = (%q, %v), want (%q, %v)", tt.key, value, exists, tt.wantValue, tt.wantExists)
+			}
+		})
+	}
+}
+
+func TestMemoryStoreCancelledContext(t *testing.T) {
+	s := newTestStore(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := s.PutWith(ctx, "/a", "1"); !errors.Is(err, context.Canceled) {
+		t.Errorf("PutWith() error = %v, want context.Canceled", err)
+	}
+	if _, _, err := s.GetWith(ctx, "/a"); !errors.Is(err, context.Canceled) {
+		t.Errorf("GetWith() error = %v, want context.Canceled", err)
+	}
+}
+
+func TestMemoryStoreSortedList(t *testing.T) {
+	s := newTestStore(t)
+	// Revisions: /p/b=1, /p/a=2, /p/c=3, /p/b=4 (version 2), /q=5
+	s.Put("/p/b", "y")
+	s.Put("/p/a", "z")
+	s.Put("/p/c", "x")
+	s.Put("/p/b", "w")
+	s.Put("/q", "v")
+
+	tests := []struct {
+		name   string
+		prefix string
+		sortBy kvstore.SortTarget
+		order  kvstore.SortOrder
+		want   []string
+	}{
+		{"by key ascending", "/p/", kvstore.SortByKey, kvstore.SortAscend, []string{"/p/a", "/p/b", "/p/c"}},
+		{"by key descending", "/p/", kvstore.SortByKey, kvstore.SortDescend, []string{"/p/c", "/p/b", "/p/a"}},
+		{"sort none is ascending", "/p/", kvstore.SortByKey, kvstore.SortNone, []string{"/p/a", "/p/b", "/p/c"}},
+		{"by create revision", "/p/", kvstore.SortByCreateRevision, kvstore.SortAscend, []string{"/p/b", "/p/a", "/p/c"}},
+		{"by mod revision", "/p/", kvstore.SortByModRevision, kvstore.SortAscend, []string{"/p/a", "/p/c", "/p/b"}},
+		{"by mod revision descending", "/p/", kvstore.SortByModRevision, kvstore.SortDescend, []string{"/p/b", "/p/c", "/p/a"}},
+		{"by version, then key", "/p/", kvstore.SortByVersion, kvstore.SortAscend, []string{"/p/a", "/p/c", "/p/b"}},
+		{"by value", "/p/", kvstore.SortByValue, kvstore.SortAscend, []string{"/p/b", "/p/c", "/p/a"}},
+		{"prefix is not a path segment", "/p", kvstore.SortByKey, kvstore.SortAscend, []string{"/p/a", "/p/b", "/p/c"}},
+		{"empty prefix matches every key", "", kvstore.SortByKey, kvstore.SortAscend, []string{"/p/a", "/p/b", "/p/c", "/q"}},
+		{"no match", "/r", kvstore.SortByKey, kvstore.SortAscend, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kvs, err := s.GetSortedKvList(tt.prefix, tt.sortBy, tt.order)
+			if err != nil {
+				t.Fatalf("GetSortedKvList() error: %v", err)
+			}
+			got := make([]string, 0, len(kvs))
+			for _, kv := range kvs {
+				got = append(got, kv.Key)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("GetSortedKvList(%q) = %v, want %v", tt.prefix, got, tt.want)
+			}
+		})
+	}
+
+	keys, err := s.GetKeyList("/p/")
+	if err != nil || !slices.Equal(keys, []string{"/p/a", "/p/b", "/p/c"}) {
+		t.Errorf("GetKeyList() = %v, %v; want keys in ascending order", keys, err)
+	}
+	values, err := s.GetList("/p/")
+	if err != nil || !slices.Equal(values, []string{"z", "w", "x"}) {
+		t.Errorf("GetList() = %v, %v; want values in key order", values, err)
+	}
+}
+
+func TestMemoryStoreRevisions(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+
+	s.Put("/a", "1")
+	_, rev1, _, _ := s.GetWithRevision(ctx, "/a")
+	s.Put("/b", "1")
+	s.Put("/a", "2")
+	kv, rev2, exists, err := s.GetWithRevision(ctx, "/a")
+	if err != nil || !exists || kv.Value != "2" {
+		t.Fatalf("GetWithRevision() = (%v, %d, %v, %v)", kv, rev2, exists, err)
+	}
+	if rev2 <= rev1 {
+		t.Errorf("revision did not increase: %d then %d", rev1, rev2)
+	}
+
+	// A delete of a missing key issues no revision
+	s.Delete("/missing")
+	s.Put("/c", "1")
+	_, rev3, _, _ := s.GetWithRevision(ctx, "/c")
+	if rev3 != rev2+1 {
+		t.Errorf("revision after a no-op delete = %d, want %d", rev3, rev2+1)
+	}
+}
+
+func TestMemoryStoreTxn(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		run     func(s *MemoryStore, rev int64) error
+		wantErr error
+		anyErr  bool
+		wantA   string
+		wantB   string
+	}{
+		{
+			name:  "put if absent on a new key",
+			run:   func(s *MemoryStore, rev int64) error { return s.PutIfRevision(ctx, "/b", "new", 0) },
+			wantA: "1",
+			wantB: "new",
+		},
+		{
+			name:    "put if absent on an existing key",
+			run:     func(s *MemoryStore, rev int64) error { return s.PutIfRevision(ctx, "/a", "new", 0) },
+			wantErr: kvstore.ErrRevisionConflict,
+			wantA:   "1",
+		},
+		{
+			name:  "put if revision matches",
+			run:   func(s *MemoryStore, rev int64) error { return s.PutIfRevision(ctx, "/a", "2", rev) },
+			wantA: "2",
+		},
+		{
+			name:    "put if revision is stale",
+			run:     func(s *MemoryStore, rev int64) error { return s.PutIfRevision(ctx, "/a", "2", rev-1) },
+			wantErr: kvstore.ErrRevisionConflict,
+			wantA:   "1",
+		},
+		{
+			name: "txn applies every op",
+			run: func(s *MemoryStore, rev int64) error {
+				return s.Txn(ctx, []kvstore.Compare{{Key: "/a", ModRevision: rev}, {Key: "/b", ModRevision: 0}},
+					[]kvstore.Op{kvstore.DeleteOp("/a"), kvstore.PutOp("/b", "moved")})
+			},
+			wantB: "moved",
+		},
+		{
+			name: "txn applies no op when a compare fails",
+			run: func(s *MemoryStore, rev int64) error {
+				return s.Txn(ctx, []kvstore.Compare{{Key: "/a", ModRevision: rev}, {Key: "/b", ModRevision: 1}},
+					[]kvstore.Op{kvstore.DeleteOp("/a"), kvstore.PutOp("/b", "moved")})
+			},
+			wantErr: kvstore.ErrRevisionConflict,
+			wantA:   "1",
+		},
+		{
+			name: "txn rejects a key written twice",
+			run: func(s *MemoryStore, rev int64) error {
+				return s.Txn(ctx, nil, []kvstore.Op{kvstore.PutOp("/b", "x"), kvstore.PutOp("/b", "y")})
+			},
+			anyErr: true,
+			wantA:  "1",
+		},
+		{
+			name: "txn rejects a key put and deleted",
+			run: func(s *MemoryStore, rev int64) error {
+				return s.Txn(ctx, nil, []kvstore.Op{kvstore.PutOp("/a", "x"), kvstore.DeleteOp("/a")})
+			},
+			anyErr: true,
+			wantA:  "1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestStore(t)
+			s.Put("/a", "1")
+			_, rev, _, _ := s.GetWithRevision(ctx, "/a")
+
+			err := tt.run(s, rev)
+			switch {
+			case tt.wantErr != nil && !errors.Is(err, tt.wantErr):
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			case tt.anyErr && err == nil:
+				t.Fatalf("error = nil, want an error")
+			case tt.wantErr == nil && !tt.anyErr && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if a, _, _ := s.Get("/a"); a != tt.wantA {
+				t.Errorf("/a = %q, want %q", a, tt.wantA)
+			}
+			if b, _, _ := s.Get("/b"); b != tt.wantB {
+				t.Errorf("/b = %q, want %q", b, tt.wantB)
+			}
+		})
+	}
+}
+
+func receiveEvents(t *testing.T, ch kvstore.WatchChan, n int) []kvstore.WatchEvent {
+	t.Helper()
+	var events []kvstore.WatchEvent
+	timeout := time.After(2 * time.Second)
+	for len(events) < n {
+		select {
+		case resp, ok := <-ch:
+			if !ok {
+				t.Fatalf("watch closed after %d of %d events", len(events), n)
+			}
+			events = append(events, resp.Events...)
+		case <-timeout:
+			t.Fatalf("received %d of %d events", len(events), n)
+		}
+	}
+	return events
+}
+
+func TestMemoryStoreWatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		watch func(s *MemoryStore, ctx context.Context) kvstore.WatchChan
+		want  []kvstore.EventType
+		keys  []string
+	}{
+		{
+			name:  "key",
+			watch: func(s *MemoryStore, ctx context.Context) kvstore.WatchChan { return s.WatchKeyWith(ctx, "/w/a") },
+			want:  []kvstore.EventType{kvstore.EventPut, kvstore.EventPut, kvstore.EventDelete},
+			keys:  []string{"/w/a", "/w/a", "/w/a"},
+		},
+		{
+			name:  "prefix",
+			watch: func(s *MemoryStore, ctx context.Context) kvstore.WatchChan { return s.WatchKeysWith(ctx, "/w/") },
+			want:  []kvstore.EventType{kvstore.EventPut, kvstore.EventPut, kvstore.EventPut, kvstore.EventDelete, kvstore.EventDelete},
+			keys:  []string{"/w/a", "/w/b", "/w/a", "/w/a", "/w/b"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestStore(t)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			ch := tt.watch(s, ctx)
+
+			s.Put("/w/a", "1")
+			s.Put("/w/b", "1")
+			s.Put("/other", "1")
+			s.Put("/w/a", "2")
+			s.DeleteWithPrefix("/w/")
+
+			events := receiveEvents(t, ch, len(tt.want))
+			var lastRev int64
+			for i, ev := range events {
+				if ev.Type != tt.want[i] || ev.Key != tt.keys[i] {
+					t.Errorf("event %d = %s %s, want %s %s", i, ev.Type, ev.Key, tt.want[i], tt.keys[i])
+				}
+				if ev.ModRevision < lastRev {
+					t.Errorf("event %d: revision %d went back from %d", i, ev.ModRevision, lastRev)
+				}
+				lastRev = ev.ModRevision
+				if ev.Type == kvstore.EventDelete && ev.Value != "" {
+					t.Errorf("event %d: delete carries value %q", i, ev.Value)
+				}
+			}
+
+			cancel()
+			select {
+			case _, ok := <-ch:
+				for ok {
+					_, ok = <-ch
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatal("watch not closed after its context was cancelled")
+			}
+		})
+	}
+}
+
+func TestMemoryStoreWatchClosedWithStore(t *testing.T) {
+	s := newMemoryStore(context.Background())
+	ch := s.WatchKeys("/")
+	s.Close()
+
+	select {
+	case _, ok := <-ch:
+		if ok {
+			t.Fatal("unexpected event after Close")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("watch not closed with the store")
+	}
+	if _, ok := <-s.WatchKeys("/"); ok {
+		t.Error("a watch on a closed store is open")
+	}
+}
+
+func TestMemoryStoreLock(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t)
+
+	s1, _ := s.NewSession(ctx)
+	s2, _ := s.NewSession(ctx)
+	lock, err := s.NewLock(ctx, s1, "/lock/a")
+	if err != nil {
+		t.Fatalf("NewLock() error: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		session kvstore.Session
+		key     string
+		wantErr bool
+	}{
+		{"other session waits on a held key", s2, "/lock/a", true},
+		{"other session takes another key", s2, "/lock/b", false},
+		{"holder locks again", s1, "/lock/a", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			waitCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+			defer cancel()
+			_, err := s.NewLock(waitCtx, tt.session, tt.key)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewLock(%q) error = %v, wantErr %v", tt.key, err, tt.wantErr)
+			}
+		})
+	}
+
+	// Unlock hands the key to a waiter
+	acquired := make(chan error, 1)
+	go func() {
+		_, err := s.NewLock(ctx, s2, "/lock/a")
+		acquired <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	lock.Unlock(ctx)
+	select {
+	case err := <-acquired:
+		if err != nil {
+			t.Fatalf("waiter error: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("waiter not woken by Unlock")
+	}
+
+	// A session of another store is refused
+	other := newTestStore(t)
+	foreign, _ := other.NewSession(ctx)
+	if _, err := s.NewLock(ctx, foreign, "/lock/c"); err == nil {
+		t.Error("NewLock() accepted a session of another store")
+	}
+}
+
+func TestMemoryStoreSessionExpiry(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		end  func(s *MemoryStore, session kvstore.Session)
+	}{
+		{"session closed", func(s *MemoryStore, session kvstore.Session) { session.Close() }},
+		{"store closed", func(s *MemoryStore, session kvstore.Session) { s.Close() }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestStore(t)
+			holder, _ := s.NewSession(ctx)
+			if _, err := s.NewLock(ctx, holder, "/lock/a"); err != nil {
+				t.Fatalf("NewLock() error: %v", err)
+			}
+
+			tt.end(s, holder)
+
+			select {
+			case <-holder.Done():
+			case <-time.After(2 * time.Second):
+				t.Fatal("Done() not closed when the session ended")
+			}
+			if _, err := s.NewLock(ctx, holder, "/lock/b"); err == nil {
+				t.Error("an ended session acquired a lock")
+			}
+
+			// The locks of an ended session are released
+			waitCtx, cancel := context.WithTimeout(ctx, time.Second)
+			defer cancel()
+			next, _ := s.NewSession(ctx)
+			select {
+			case <-next.Done():
+				// Sessions of a closed store end right away
+				return
+			default:
+			}
+			if _, err := s.NewLock(waitCtx, next, "/lock/a"); err != nil {
+				t.Errorf("lock of the ended session not released: %v", err)
+			}
+		})
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := newTestStore(t).NewSession(cancelled); err == nil {
+		t.Error("NewSession() with a cancelled context succeeded")
+	}
+}
@@ -0,0 +1,133 @@
+package memory
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvstore"
+)
+
+// watchHub fans store events out to registered watchers.
+// Each watcher owns an unbounded queue drained by its own goroutine, so a slow
+// consumer never blocks writers or other watchers.
+type watchHub struct {
+	mu       sync.Mutex
+	watchers map[*watcher]struct{}
+	closed   bool
+}
+
+type watcher struct {
+	key    string
+	prefix bool
+	cancel context.CancelFunc
+
+	mu     sync.Mutex
+	queue  []kvstore.WatchEvent
+	signal chan struct{}
+}
+
+func newWatchHub() *watchHub {
+	return &watchHub{watchers: make(map[*watcher]struct{})}
+}
+
+// watch registers a watcher for key (or all keys under it when prefix is true).
+// The returned channel is closed when ctx is done or the hub is closed.
+func (h *watchHub) watch(ctx context.Context, key string, prefix bool) kvstore.WatchChan {
+	out := make(chan kvstore.WatchResponse)
+
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		close(out)
+		return out
+	}
+	wctx, cancel := context.WithCancel(ctx)
+	w := &watcher{
+		key:    key,
+		prefix: prefix,
+		cancel: cancel,
+		signal: make(chan struct{}, 1),
+	}
+	h.watchers[w] = struct{}{}
+	h.mu.Unlock()
+
+	go func() {
+		defer func() {
+			h.mu.Lock()
+			delete(h.watchers, w)
+			h.mu.Unlock()
+			cancel()
+			close(out)
+		}()
+
+		for {
+			select {
+			case <-wctx.Done():
+				return
+			case <-w.signal:
+			}
+
+			w.mu.Lock()
+			events := w.queue
+			w.queue = nil
+			w.mu.Unlock()
+			if len(events) == 0 {
+				continue
+			}
+
+			select {
+			case out <- kvstore.WatchResponse{Events: events}:
+			case <-wctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out
+}
+
+// notify delivers events to every watcher whose key matches.
+func (h *watchHub) notify(events []kvstore.WatchEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for w := range h.watchers {
+		var matched []kvstore.WatchEvent
+		for _, ev := range events {
+			if w.matches(ev.Key) {
+				matched = append(matched, ev)
+			}
+		}
+		if len(matched) == 0 {
+			continue
+		}
+
+		w.mu.Lock()
+		w.queue = append(w.queue, matched...)
+		w.mu.Unlock()
+
+		select {
+		case w.signal <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// close cancels every watcher and rejects new ones.
+func (h *watchHub) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for w := range h.watchers {
+		w.cancel()
+	}
+}
+
+func (w *watcher) matches(key string) bool {
+	if w.prefix {
+		return strings.HasPrefix(key, w.key)
+	}
+	return key == w.key
+}
@@ -26,16 +26,22 @@ import (
 	"sync"
 	"time"
 
+	"github.com/cloud-barista/cb-tumblebug/src/core/common/backup"
 	"github.com/cloud-barista/cb-tumblebug/src/core/common/logger"
+	"github.com/cloud-barista/cb-tumblebug/src/core/common/migration"
 	"github.com/cloud-barista/cb-tumblebug/src/core/model"
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/bolt"
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/encrypted"
 	"github.com/cloud-barista/cb-tumblebug/src/kvstore/etcd"
 	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvstore"
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/memory"
 	"github.com/rs/zerolog/log"
 
 	"github.com/fsnotify/fsnotify"
 	"github.com/spf13/viper"
 
 	"github.com/cloud-barista/cb-tumblebug/src/core/common"
+	"github.com/cloud-barista/cb-tumblebug/src/core/csp"
 	"github.com/cloud-barista/cb-tumblebug/src/core/infra"
 
 	restServer "github.com/cloud-barista/cb-tumblebug/src/interface/rest/server"
@@ -52,6 +58,8 @@ func init() {
 	model.SelfEndpoint = common.NVL(os.Getenv("TB_SELF_ENDPOINT"), "localhost:1323")
 	model.SpiderRestUrl = common.NVL(os.Getenv("TB_SPIDER_REST_URL"), "http://localhost:1024/spider")
 	model.DragonflyRestUrl = common.NVL(os.Getenv("TB_DRAGONFLY_REST_URL"), "http://localhost:9090/dragonfly")
+	model.PrometheusUrl = common.NVL(os.Getenv("TB_PROMETHEUS_URL"), "http://localhost:9090")
+	model.PrometheusBearerToken = os.Getenv("TB_PROMETHEUS_BEARER_TOKEN")
 	model.TerrariumRestUrl = common.NVL(os.Getenv("TB_TERRARIUM_REST_URL"), "http://localhost:8055/terrarium")
 	model.APIUsername = common.NVL(os.Getenv("TB_API_USERNAME"), "default")
 	model.APIPassword = common.NVL(os.Getenv("TB_API_PASSWORD"), "default")
@@ -63,6 +71,7 @@ func init() {
 	model.DBUser = common.NVL(os.Getenv("TB_POSTGRES_USER"), "tumblebug")
 	model.DBPassword = common.NVL(os.Getenv("TB_POSTGRES_PASSWORD"), "tumblebug")
 	model.AutocontrolDurationMs = common.NVL(os.Getenv("TB_AUTOCONTROL_DURATION_MS"), "10000")
+	model.WebhookAllowedCidrs = os.Getenv("TB_WEBHOOK_ALLOWED_CIDRS")
 	model.DefaultNamespace = common.NVL(os.Getenv("TB_DEFAULT_NAMESPACE"), "default")
 	model.DefaultCredentialHolder = common.NVL(os.Getenv("TB_DEFAULT_CREDENTIALHOLDER"), "admin")
 
@@ -77,9 +86,12 @@ func init() {
 
 	log.Info().Msg("init: updating system environment")
 	common.UpdateGlobalVariable(model.StrDragonflyRestUrl)
+	common.UpdateGlobalVariable(model.StrPrometheusUrl)
+	common.UpdateGlobalVariable(model.StrPrometheusBearerToken)
 	common.UpdateGlobalVariable(model.StrSpiderRestUrl)
 	common.UpdateGlobalVariable(model.StrTerrariumRestUrl)
 	common.UpdateGlobalVariable(model.StrAutocontrolDurationMs)
+	common.UpdateGlobalVariable(model.StrWebhookAllowedCidrs)
 	common.UpdateGlobalVariable(model.StrVaultAddr)
 	common.UpdateGlobalVariable(model.StrVaultToken)
 
@@ -140,6 +152,12 @@ func init() {
 		}
 	})
 
+	// Upgrade objects stored in the kvstore to the current schema version
+	runWithMigrationLock(runSchemaMigration)
+
+	// Scheduled backups of kvstore keys and the spec/image tables (TB_BACKUP_*)
+	backup.StartBackupLoop()
+
 	setConfig()
 
 	_, err := common.GetNs(model.DefaultNamespace)
@@ -237,8 +255,29 @@ func setupAndWaitForInternalServices() {
 	}()
 
 	// 3. Wait for etcd and initialize kvstore (50 seconds timeout: 10 retries * 5 seconds)
+	// TB_KVSTORE_TYPE=memory|bolt runs without etcd (standalone/laptop mode)
 	go func() {
 		defer wg.Done()
+
+		switch kvStoreType := strings.ToLower(common.NVL(os.Getenv("TB_KVSTORE_TYPE"), "etcd")); kvStoreType {
+		case "etcd":
+		case "memory", "bolt":
+			if err := initializeLocalKvStore(kvStoreType); err != nil {
+				errChan <- err
+			}
+			return
+		default:
+			errChan <- fmt.Errorf("unsupported TB_KVSTORE_TYPE: %s (use etcd, memory, or bolt)", kvStoreType)
+			return
+		}
+
+		// Encryption settings are checked once: retrying cannot fix a configuration error
+		encryption, encErr := newKvEncryption()
+		if encErr != nil {
+			errChan <- fmt.Errorf("kvstore encryption setup failed: %w", encErr)
+			return
+		}
+
 		log.Info().Msg("setup: connecting to etcd...")
 		maxRetries := 10
 		retryInterval := 5 * time.Second
@@ -261,9 +300,15 @@ func setupAndWaitForInternalServices() {
 
 			etcdStore, etcdErr := etcd.NewEtcdStore(context.Background(), etcdCfg)
 			if etcdErr == nil {
-				if initErr := kvstore.InitializeStore(etcdStore); initErr == nil {
+				store, wrapErr := encryption.wrap(etcdStore)
+				if wrapErr != nil {
+					log.Warn().Err(wrapErr).Msg("setup: kvstore encryption is not ready")
+					etcdStore.Close()
+				} else if initErr := kvstore.InitializeStore(store); initErr == nil {
 					log.Info().Msgf("setup: etcd is ready (attempt %d)", i+1)
 					return
+				} else {
+					store.Close()
 				}
 			}
 			log.Warn().Msgf("setup: etcd not ready, retrying (%d/%d)", i+1, maxRetries)
@@ -291,6 +336,111 @@ func setupAndWaitForInternalServices() {
 	log.Info().Msg("setup: all internal services are ready")
 }
 
+// kvEncryption holds the envelope encryption settings of the kvstore.
+// A nil wrapper means encryption is disabled.
+type kvEncryption struct {
+	wrapper encrypted.KeyWrapper
+	rules   []encrypted.Rule
+}
+
+// newKvEncryption reads the encryption settings: TB_KVSTORE_ENCRYPTION is "none",
+// "local" (master key files at TB_KVSTORE_ENCRYPTION_KEY_FILE, comma-separated, the
+// first one current) or "openbao" (an OpenBao transit key).
+// Key prefixes listed in TB_KVSTORE_ENCRYPTION_PREFIXES are encrypted as a whole.
+func newKvEncryption() (kvEncryption, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var wrapper encrypted.KeyWrapper
+	var err error
+	switch mode := strings.ToLower(common.NVL(os.Getenv("TB_KVSTORE_ENCRYPTION"), "none")); mode {
+	case "none":
+		return kvEncryption{}, nil
+	case "local":
+		var paths []string
+		for _, path := range strings.Split(common.NVL(os.Getenv("TB_KVSTORE_ENCRYPTION_KEY_FILE"), "./db/kvstore-master.key"), ",") {
+			if path = strings.TrimSpace(path); path != "" {
+				paths = append(paths, path)
+			}
+		}
+		wrapper, err = encrypted.NewLocalKeyWrapper(paths...)
+	case "openbao":
+		wrapper, err = csp.NewOpenBaoTransitKeyWrapper(ctx,
+			common.NVL(os.Getenv("TB_KVSTORE_ENCRYPTION_TRANSIT_MOUNT"), "transit"),
+			common.NVL(os.Getenv("TB_KVSTORE_ENCRYPTION_TRANSIT_KEY"), "tumblebug-kvstore"))
+	default:
+		return kvEncryption{}, fmt.Errorf("unsupported TB_KVSTORE_ENCRYPTION: %s (use none, local, or openbao)", mode)
+	}
+	if err != nil {
+		return kvEncryption{}, err
+	}
+
+	rules := append([]encrypted.Rule{}, encrypted.DefaultRules...)
+	for _, prefix := range strings.Split(os.Getenv("TB_KVSTORE_ENCRYPTION_PREFIXES"), ",") {
+		if prefix = strings.TrimSpace(prefix); prefix != "" {
+			rules = append(rules, encrypted.Rule{Pattern: strings.TrimSuffix(prefix, "/") + "/**"})
+		}
+	}
+	return kvEncryption{wrapper: wrapper, rules: rules}, nil
+}
+
+// wrap returns store with envelope encryption of sensitive values, if enabled.
+// The caller keeps ownership of store when an error is returned.
+func (e kvEncryption) wrap(store kvstore.Store) (kvstore.Store, error) {
+	if e.wrapper == nil {
+		return store, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	encStore, err := encrypted.NewStore(ctx, store, e.wrapper, e.rules)
+	if err != nil {
+		return nil, err
+	}
+	log.Info().Msgf("setup: kvstore encryption enabled (master key %s)", e.wrapper.Name())
+	return encStore, nil
+}
+
+// initializeLocalKvStore initializes kvstore with a backend that needs no external service.
+// "memory" keeps all metadata in process (lost on restart); "bolt" persists it to an
+// embedded file at TB_KVSTORE_PATH.
+func initializeLocalKvStore(kvStoreType string) error {
+	var store kvstore.Store
+	var err error
+
+	switch kvStoreType {
+	case "memory":
+		log.Warn().Msg("setup: using in-memory kvstore; metadata will be lost on restart")
+		store, err = memory.NewMemoryStore(context.Background())
+	case "bolt":
+		path := common.NVL(os.Getenv("TB_KVSTORE_PATH"), "./db/tumblebug-kv.db")
+		log.Info().Msgf("setup: using embedded bolt kvstore (%s)", path)
+		store, err = bolt.NewBoltStore(context.Background(), bolt.Config{
+			Path:        path,
+			OpenTimeout: 10 * time.Second,
+		})
+	}
+	if err != nil {
+		return fmt.Errorf("%s kvstore initialization failed: %w", kvStoreType, err)
+	}
+	encryption, err := newKvEncryption()
+	if err != nil {
+		store.Close()
+		return fmt.Errorf("%s kvstore encryption setup failed: %w", kvStoreType, err)
+	}
+	wrapped, err := encryption.wrap(store)
+	if err != nil {
+		store.Close()
+		return fmt.Errorf("%s kvstore encryption setup failed: %w", kvStoreType, err)
+	}
+	store = wrapped
+	if err := kvstore.InitializeStore(store); err != nil {
+		return fmt.Errorf("%s kvstore initialization failed: %w", kvStoreType, err)
+	}
+	log.Info().Msgf("setup: %s kvstore is ready", kvStoreType)
+	return nil
+}
+
 // setConfig get cloud settings from a config file
 func setConfig() {
 	fileName := "cloud_conf"
@@ -621,6 +771,25 @@ func runWithMigrationLock(fn func()) {
 	}
 }
 
+// runSchemaMigration applies pending kvstore schema migrations and stops startup when
+// the stored data was written by a newer release. With TB_SCHEMA_MIGRATION_DRYRUN=true
+// it only logs what would change and exits, leaving the data untouched.
+func runSchemaMigration() {
+	dryRun := strings.ToLower(os.Getenv("TB_SCHEMA_MIGRATION_DRYRUN")) == "true"
+
+	report, err := migration.Run(context.Background(), dryRun)
+	if err != nil {
+		log.Error().Err(err).Msg("init: kvstore schema migration failed")
+		panic(err)
+	}
+	migration.LogReport(report)
+
+	if dryRun {
+		log.Info().Msg("init: schema migration dry run finished; exiting without changes (unset TB_SCHEMA_MIGRATION_DRYRUN to apply)")
+		os.Exit(0)
+	}
+}
+
 // addIndexes adds indexes to the tables for faster search
 func addIndexes() error {
 	// Existing single column indexes
@@ -794,25 +963,44 @@ func addIndexes() error {
 
 func main() {
 
+	// Background controllers run only on the replica that holds the leader lock,
+	// so that several replicas sharing one etcd do not act twice
+	leaderCtx, leaderCancel := context.WithCancel(context.Background())
+	defer leaderCancel()
+
 	//Ticker for Infra Orchestration Policy
 	log.Info().Msg("main: initiating multi-cloud orchestration")
 	autoControlDuration, _ := strconv.Atoi(model.AutocontrolDurationMs) //ms
-	ticker := time.NewTicker(time.Millisecond * time.Duration(autoControlDuration))
-	go func() {
-		for t := range ticker.C {
-			//display ticker if you need (remove '_ = t')
-			_ = t
-			//fmt.Println("- Orchestration Controller ", t.Format("2006-01-02 15:04:05"))
-			infra.OrchestrationController()
+	common.RunAsLeader("orchestrationController", func(ctx context.Context) {
+		ticker := time.NewTicker(time.Millisecond * time.Duration(autoControlDuration))
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				infra.OrchestrationController()
+			}
 		}
-	}()
-	defer ticker.Stop()
+	})
 
 	// Start NodeStatusAgent: load all nodes into StatusStore and begin periodic polling.
-	agentCtx, agentCancel := context.WithCancel(context.Background())
-	defer agentCancel()
-	go infra.GlobalAgent.StartupScan()
-	go infra.GlobalAgent.Start(agentCtx)
+	common.RunAsLeader("nodeStatusAgent", func(ctx context.Context) {
+		go infra.GlobalAgent.StartupScan()
+		infra.GlobalAgent.Start(ctx)
+	})
+
+	// Warn about and tear down Infras and K8sClusters whose lease expired
+	infra.StartLeaseReaper()
+
+	// Deliver the events to the webhook subscriptions (on every replica: events are per process)
+	infra.StartEventSubscriptionDispatcher()
+
+	// Recover persisted scheduled jobs, so cron power schedules survive restarts.
+	// Every replica keeps the jobs in sync; only the leader executes them.
+	infra.GetSchedulerManager()
+
+	go common.StartLeaderElection(leaderCtx)
 
 	// Reload cloud_conf.yaml on change; keep the last good config on reload errors
 	go func() {